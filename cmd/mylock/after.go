@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// freeWaiter is a backend that can observe a lock without taking it
+type freeWaiter interface {
+	WaitFree(ctx context.Context, lockName string, timeout int) (bool, error)
+}
+
+// waitLocksFree waits, one after another, until each of names is free or
+// deadline passes. It returns 0 when all were seen free, or the exit code
+// to stop with. A lock may be taken again once it has been seen free.
+func waitLocksFree(ctx context.Context, lock locker.Backend, names []string, deadline time.Time) int {
+	waiter, ok := lock.(freeWaiter)
+	if !ok {
+		logging.Printc(logging.Red, "Error: --after-lock-free needs a single MySQL server or the memory backend\n")
+		return locker.InternalError
+	}
+	for _, name := range names {
+		name = cli.FitLockName(name)
+		timeout := remainingTimeout(deadline)
+		logging.Debugf("waiting up to %ds for lock '%s' to be free", timeout, name)
+		free, err := waiter.WaitFree(ctx, name, timeout)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// MYLOCK_DEADLINE came first
+			free, err = false, nil
+		}
+		if err != nil {
+			logging.Printc(logging.Red, "Error: --after-lock-free: %v\n", err)
+			return locker.InternalError
+		}
+		if !free {
+			logging.Printc(logging.Yellow, "Lock '%s' named in --after-lock-free is still held after %d seconds\n", name, timeout)
+			return locker.LockTimeout
+		}
+	}
+	return 0
+}
+
+// errLockBusy means a lock named in --if-free is held, so the run is
+// skipped with exit code 0
+var errLockBusy = errors.New("held by another job")
+
+// checkLocksFree returns an error wrapping errLockBusy if any of names is
+// held right now. It neither waits nor takes the locks.
+func checkLocksFree(ctx context.Context, waiter freeWaiter, names []string) error {
+	for _, name := range names {
+		name = cli.FitLockName(name)
+		free, err := waiter.WaitFree(ctx, name, 0)
+		if err != nil {
+			return fmt.Errorf("--if-free: %w", err)
+		}
+		if !free {
+			return fmt.Errorf("lock '%s' named in --if-free is %w", name, errLockBusy)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// openBackend connects to the lock backend selected by the configuration
+func openBackend(cfg config.Config) (locker.Backend, error) {
+	if cfg.Backend == config.BackendMemory {
+		logging.Debugf("using in-memory lock backend")
+		return locker.NewMemoryLocker(), nil
+	}
+
+	if cfg.QuorumHosts != "" {
+		return openQuorum(cfg)
+	}
+
+	logging.Debugf("connecting to %s", cfg.DSN())
+	lock, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// openQuorum connects to every quorum host. Hosts that cannot be reached are
+// skipped, as long as enough remain to make a majority.
+func openQuorum(cfg config.Config) (locker.Backend, error) {
+	dsns := cfg.QuorumDSNs()
+	var backends []locker.Backend
+	for _, dsn := range dsns {
+		logging.Debugf("connecting to %s", dsn)
+		lock, err := locker.NewLocker(dsn)
+		if err != nil {
+			logging.Printc(logging.Yellow, "Warning: skipping quorum host: %v\n", err)
+			continue
+		}
+		backends = append(backends, lock)
+	}
+
+	q, err := locker.NewQuorumLocker(backends, locker.Majority(len(dsns)))
+	if err != nil {
+		for _, b := range backends {
+			b.Close()
+		}
+		return nil, err
+	}
+	return q, nil
+}
+
+// connectionAttributes identifies a mylock session to the server, in
+// performance_schema.session_connect_attrs. lockName and runID are left out
+// when empty.
+func connectionAttributes(lockName, runID string) map[string]string {
+	attrs := map[string]string{
+		"program_name":   "mylock",
+		"mylock_version": buildVersion(),
+	}
+	if lockName != "" {
+		attrs["mylock_lock_name"] = lockName
+	}
+	if runID != "" {
+		attrs["mylock_run_id"] = runID
+	}
+	return attrs
+}
+
+// buildVersion is the module version mylock was built from, or "(devel)"
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/yammerjp/mylock/internal/bench"
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runBench implements "mylock bench"
+func runBench(args []string) int {
+	benchArgs, err := cli.ParseBenchCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(benchArgs.Config.Password)
+
+	opts := bench.Options{
+		LockName: benchArgs.LockName,
+		Workers:  benchArgs.Workers,
+		Duration: benchArgs.Duration,
+		Hold:     benchArgs.Hold,
+		Timeout:  benchArgs.Timeout,
+		Connect: func() (bench.Session, error) {
+			return locker.NewLocker(benchArgs.Config.DSN())
+		},
+	}
+
+	result, err := bench.Run(context.Background(), opts)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	result.Report(os.Stdout, opts)
+	return 0
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// blockJSON is one entry of "mylock block status --json"
+type blockJSON struct {
+	LockName         string  `json:"lock_name"`
+	Reason           string  `json:"reason"`
+	SetBy            string  `json:"set_by"`
+	AgeSeconds       float64 `json:"age_seconds"`
+	RemainingSeconds float64 `json:"remaining_seconds,omitempty"`
+}
+
+// runBlock implements "mylock block", dispatching to its subcommands
+func runBlock(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "set":
+			return runBlockSet(args[1:])
+		case "clear":
+			return runBlockClear(args[1:])
+		case "status":
+			return runBlockStatus(args[1:])
+		}
+	}
+	if helpRequested(args) {
+		cli.PrintBlockHelp()
+		return 0
+	}
+	if len(args) == 0 {
+		logging.Printc(logging.Red, "Error: expected a command after \"mylock block\"\n")
+	} else {
+		logging.Printc(logging.Red, "Error: unknown block command %q\n", args[0])
+	}
+	return locker.InternalError
+}
+
+// runBlockSet implements "mylock block set"
+func runBlockSet(args []string) int {
+	setArgs, err := cli.ParseBlockSetCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	lockName := cli.FitLockName(setArgs.LockName)
+	store, code := openBlockStore(setArgs.Config, lockName, setArgs.Target)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	setBy := currentUser() + "@" + hostname()
+	if err := store.SetBlock(context.Background(), lockName, setArgs.Reason, setBy, setArgs.Duration); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if setArgs.Duration > 0 {
+		logging.Printf("Blocked lock '%s' for %s\n", lockName, setArgs.Duration)
+	} else {
+		logging.Printf("Blocked lock '%s' until \"mylock block clear %s\"\n", lockName, lockName)
+	}
+	return 0
+}
+
+// runBlockClear implements "mylock block clear"
+func runBlockClear(args []string) int {
+	clearArgs, err := cli.ParseBlockClearCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	lockName := cli.FitLockName(clearArgs.LockName)
+	store, code := openBlockStore(clearArgs.Config, lockName, clearArgs.Target)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	cleared, err := store.ClearBlock(context.Background(), lockName)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cleared {
+		logging.Printf("Cleared the block on lock '%s'\n", lockName)
+	} else {
+		logging.Printf("Lock '%s' was not blocked\n", lockName)
+	}
+	return 0
+}
+
+// runBlockStatus implements "mylock block status". It exits 206 when the
+// named lock is blocked, so scripts can test it.
+func runBlockStatus(args []string) int {
+	statusArgs, err := cli.ParseBlockStatusCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	lockName := statusArgs.LockName
+	if lockName != "" {
+		lockName = cli.FitLockName(lockName)
+	}
+	store, code := openBlockStore(statusArgs.Config, lockName, statusArgs.Target)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	var blocks []locker.Block
+	if lockName != "" {
+		block, err := store.ActiveBlock(context.Background(), lockName)
+		if err != nil {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.InternalError
+		}
+		if block != nil {
+			blocks = append(blocks, *block)
+		}
+	} else if blocks, err = store.Blocks(context.Background()); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	if err := writeBlocks(os.Stdout, blocks, statusArgs.JSON); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if lockName != "" && len(blocks) > 0 {
+		return locker.Blocked
+	}
+	return 0
+}
+
+// openBlockStore connects to the MySQL server that holds the blocks of
+// lockName, or of target when lockName is empty
+func openBlockStore(cfg config.Config, lockName, target string) (*locker.Locker, int) {
+	logging.AddSecret(cfg.Password)
+	cfg, _, err := cfg.Route(lockName, target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return nil, locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory || cfg.QuorumHosts != "" {
+		logging.Printc(logging.Red, "Error: maintenance blocks need a single MySQL server\n")
+		return nil, locker.InternalError
+	}
+
+	cfg.ConnectionAttributes = connectionAttributes(lockName, "")
+	store, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return nil, locker.InternalError
+	}
+	return store, 0
+}
+
+// writeBlocks prints one line per block, or a JSON array
+func writeBlocks(w io.Writer, blocks []locker.Block, asJSON bool) error {
+	if asJSON {
+		doc := []blockJSON{}
+		for _, b := range blocks {
+			doc = append(doc, blockJSON{
+				LockName:         b.LockName,
+				Reason:           b.Reason,
+				SetBy:            b.SetBy,
+				AgeSeconds:       b.Age.Seconds(),
+				RemainingSeconds: b.Remaining.Seconds(),
+			})
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	if len(blocks) == 0 {
+		_, err := fmt.Fprintln(w, "no active blocks")
+		return err
+	}
+	for _, b := range blocks {
+		if _, err := fmt.Fprintf(w, "%-32s %s\n", b.LockName, describeBlock(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeBlock says who set a block, when and why
+func describeBlock(b locker.Block) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "set by %s %s ago", b.SetBy, b.Age.Round(time.Second))
+	if b.Remaining > 0 {
+		fmt.Fprintf(&s, ", expires in %s", b.Remaining.Round(time.Second))
+	}
+	if b.Reason != "" {
+		fmt.Fprintf(&s, ": %s", b.Reason)
+	}
+	return s.String()
+}
+
+// checkBlock returns an error wrapping ErrBlocked if lockName, or baseName
+// it was derived from, is blocked for maintenance. Failing to read the
+// blocks only warns, so runs do not depend on a table most setups never
+// create.
+func checkBlock(ctx context.Context, store *locker.Locker, lockName, baseName string) error {
+	names := []string{lockName}
+	if baseName != "" && baseName != lockName {
+		names = append(names, baseName)
+	}
+	block, err := store.FirstBlock(ctx, names...)
+	if err != nil {
+		logging.Printc(logging.Yellow, "Warning: %v\n", err)
+		return nil
+	}
+	if block == nil {
+		return nil
+	}
+	if block.LockName != lockName {
+		return fmt.Errorf("lock '%s' is %w through '%s', %s", lockName, locker.ErrBlocked, block.LockName, describeBlock(*block))
+	}
+	return fmt.Errorf("lock '%s' is %w, %s", lockName, locker.ErrBlocked, describeBlock(*block))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+	"github.com/yammerjp/mylock/internal/sandbox"
+)
+
+// envChildSetup marks a mylock process started in place of the command to
+// prepare the process before executing it. It carries a childSetup as JSON.
+const envChildSetup = "MYLOCK_CHILD_SETUP"
+
+// childSetup is what the command's process applies to itself before the
+// command replaces it
+type childSetup struct {
+	// Chroot is the new root directory, or "" to keep it
+	Chroot string `json:"chroot,omitempty"`
+	// OOMScoreAdj is written to the process's oom_score_adj when set
+	OOMScoreAdj *int `json:"oom_score_adj,omitempty"`
+	// CoreLimit is the RLIMIT_CORE to set when not nil
+	CoreLimit *uint64 `json:"core_limit,omitempty"`
+	// Sandbox sets no-new-privs, and Landlock rules when AllowPaths is set
+	Sandbox    bool     `json:"sandbox,omitempty"`
+	AllowPaths []string `json:"allow_paths,omitempty"`
+}
+
+// newChildSetup collects the options that need the child set up. It returns
+// nil when there are none, so the command is run directly.
+func newChildSetup(cliArgs cli.CLI) (*childSetup, error) {
+	s := childSetup{
+		Chroot:      cliArgs.Chroot,
+		OOMScoreAdj: cliArgs.OOMScoreAdj,
+		Sandbox:     cliArgs.Sandbox,
+		AllowPaths:  cliArgs.AllowPath,
+	}
+	if s.Chroot != "" {
+		if runtime.GOOS == "windows" {
+			return nil, fmt.Errorf("--chroot is not supported on Windows")
+		}
+		if geteuid() != 0 {
+			return nil, fmt.Errorf("--chroot requires running as root")
+		}
+		if info, err := os.Stat(s.Chroot); err != nil {
+			return nil, fmt.Errorf("--chroot: %w", err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("--chroot: %s is not a directory", s.Chroot)
+		}
+	}
+	if s.OOMScoreAdj != nil && runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("--oom-score-adj is only supported on Linux")
+	}
+	if cliArgs.CoreLimit != "" {
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("--core-limit is only supported on Linux")
+		}
+		limit, err := cli.ParseCoreLimit(cliArgs.CoreLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --core-limit: %w", err)
+		}
+		s.CoreLimit = &limit
+	}
+	// Landlock paths are opened inside the new root, so only check them without one
+	if s.Sandbox && s.Chroot == "" {
+		if err := sandbox.Check(s.AllowPaths); err != nil {
+			return nil, fmt.Errorf("--sandbox: %w", err)
+		}
+	}
+	if s.Chroot == "" && s.OOMScoreAdj == nil && s.CoreLimit == nil && !s.Sandbox {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// wrapCommand makes mylock start first in the child, set itself up and then
+// execute the command. It returns the new command line and the environment
+// entry to pass to it.
+func wrapCommand(command []string, s *childSetup) ([]string, string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot find the mylock executable: %w", err)
+	}
+	spec, err := json.Marshal(s)
+	if err != nil {
+		return nil, "", err
+	}
+	return append([]string{self}, command...), envChildSetup + "=" + string(spec), nil
+}
+
+// runChildSetup sets this process up as spec says and replaces it with
+// command. It only returns if that fails.
+func runChildSetup(spec string, command []string) int {
+	var s childSetup
+	if err := json.Unmarshal([]byte(spec), &s); err != nil {
+		logging.Printc(logging.Red, "Error: invalid %s: %v\n", envChildSetup, err)
+		return locker.InternalError
+	}
+	if len(command) == 0 {
+		logging.Printc(logging.Red, "Error: no command to run\n")
+		return locker.InternalError
+	}
+
+	// A mylock run by the command must not take itself for a child being set up
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envChildSetup+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	// The sandbox applies to this thread, which must be the one to exec
+	runtime.LockOSThread()
+	// /proc may be missing inside the new root, so this comes first
+	if s.OOMScoreAdj != nil {
+		if err := os.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(*s.OOMScoreAdj)), 0); err != nil {
+			logging.Printc(logging.Red, "Error: --oom-score-adj: %v\n", err)
+			return locker.InternalError
+		}
+	}
+	if s.CoreLimit != nil {
+		if err := setCoreLimit(*s.CoreLimit); err != nil {
+			logging.Printc(logging.Red, "Error: --core-limit: %v\n", err)
+			return locker.InternalError
+		}
+	}
+	if s.Chroot != "" {
+		if err := chroot(s.Chroot); err != nil {
+			logging.Printc(logging.Red, "Error: --chroot: %v\n", err)
+			return locker.InternalError
+		}
+	}
+	// The command is looked up in the new root
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if s.Sandbox {
+		if err := sandbox.Restrict(s.AllowPaths); err != nil {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.InternalError
+		}
+	}
+	err = syscall.Exec(path, command, env)
+	logging.Printc(logging.Red, "Error: failed to exec command: %v\n", err)
+	return locker.InternalError
+}
@@ -0,0 +1,17 @@
+package main
+
+import "syscall"
+
+// setCoreLimit sets the soft RLIMIT_CORE, raising the hard limit too when
+// the new limit is above it. cli.CoreLimitUnlimited is RLIM_INFINITY here.
+func setCoreLimit(limit uint64) error {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &rlim); err != nil {
+		return err
+	}
+	rlim.Cur = limit
+	if rlim.Max < limit {
+		rlim.Max = limit
+	}
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &rlim)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// setCoreLimit is only implemented on Linux, where RLIM_INFINITY is the
+// value of cli.CoreLimitUnlimited
+func setCoreLimit(limit uint64) error {
+	return errors.New("only supported on Linux")
+}
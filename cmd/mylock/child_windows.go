@@ -0,0 +1,8 @@
+package main
+
+import "errors"
+
+// chroot is not available on Windows
+func chroot(dir string) error {
+	return errors.New("not supported on Windows")
+}
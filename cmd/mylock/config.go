@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// validationJSON is the "mylock config validate --json" result
+type validationJSON struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// settingJSON is one entry of "mylock config print --json"
+type settingJSON struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// configJSON is the "mylock config print --json" encoding
+type configJSON struct {
+	Target   string        `json:"target,omitempty"`
+	Settings []settingJSON `json:"settings"`
+}
+
+// runConfig implements "mylock config", dispatching to its subcommands
+func runConfig(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "validate":
+			return runConfigValidate(args[1:])
+		case "print":
+			return runConfigPrint(args[1:])
+		}
+	}
+	if helpRequested(args) {
+		cli.PrintConfigHelp()
+		return 0
+	}
+	if len(args) == 0 {
+		logging.Printc(logging.Red, "Error: expected a command after \"mylock config\"\n")
+	} else {
+		logging.Printc(logging.Red, "Error: unknown config command %q\n", args[0])
+	}
+	return locker.InternalError
+}
+
+// runConfigValidate implements "mylock config validate"
+func runConfigValidate(args []string) int {
+	validateArgs, err := cli.ParseConfigValidateCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	problems := validateConfig(validateArgs)
+	if err := writeValidation(os.Stdout, problems, validateArgs.JSON); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if len(problems) > 0 {
+		return locker.InternalError
+	}
+	return 0
+}
+
+// validateConfig checks the environment and the given lock names and
+// timeout, and returns every problem found
+func validateConfig(args cli.ConfigValidateCLI) []string {
+	var problems []string
+
+	if cfg, err := config.NewConfig(); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		logging.AddSecret(cfg.Password)
+	}
+
+	if args.Timeout < 0 {
+		problems = append(problems, "timeout must be non-negative")
+	}
+	// Check the names as a run with the same flags would send them
+	policy := lockNamePolicy(cli.CLI{AllowAnyLockName: args.AllowAnyLockName, UnicodeLockName: args.UnicodeLockName})
+	for _, name := range args.LockName {
+		lockName := name
+		if args.UnicodeLockName {
+			lockName = locker.NormalizeLockName(lockName)
+		}
+		if err := policy.Validate(cli.FitLockName(lockName)); err != nil {
+			problems = append(problems, fmt.Sprintf("lock name %q: %v", name, err))
+		}
+	}
+	return problems
+}
+
+// writeValidation prints the problems one per line, or "OK" if there are
+// none, or the result as JSON
+func writeValidation(w io.Writer, problems []string, asJSON bool) error {
+	if asJSON {
+		result := validationJSON{Valid: len(problems) == 0, Errors: problems}
+		if result.Errors == nil {
+			result.Errors = []string{}
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	if len(problems) == 0 {
+		_, err := fmt.Fprintln(w, "OK")
+		return err
+	}
+	for _, problem := range problems {
+		if _, err := fmt.Fprintf(w, "error: %s\n", problem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runConfigPrint implements "mylock config print"
+func runConfigPrint(args []string) int {
+	printArgs, err := cli.ParseConfigPrintCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(printArgs.Config.Password)
+
+	_, target, err := printArgs.Config.Route(printArgs.LockName, printArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if err := writeConfig(os.Stdout, printArgs.Config, target, printArgs.JSON); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return 0
+}
+
+// configSettings lists the resolved settings of the named target, or of the
+// main server if target is empty, with the variable each came from
+func configSettings(base config.Config, target string) []settingJSON {
+	cfg := base
+	if target != "" {
+		cfg = base.Targets[target].Config
+	}
+
+	// source finds the variable that set a MYLOCK_<suffix> setting. Target
+	// variables take precedence for the settings a target can override. As
+	// in config.NewConfig, only the password counts when set but empty.
+	source := func(suffix string, perTarget bool) string {
+		names := []string{"MYLOCK_" + suffix}
+		if target != "" && perTarget {
+			names = append([]string{config.TargetEnvPrefix(target) + suffix}, names...)
+		}
+		for _, name := range names {
+			if value, ok := os.LookupEnv(name); ok && (value != "" || suffix == "PASSWORD") {
+				return name
+			}
+		}
+		return "default"
+	}
+
+	backend := cfg.Backend
+	if backend == "" {
+		backend = config.BackendMySQL
+	}
+	settings := []settingJSON{{Name: "backend", Value: backend, Source: source("BACKEND", false)}}
+	if backend == config.BackendMemory {
+		return settings
+	}
+
+	password := "(empty)"
+	if cfg.Password != "" {
+		password = "(set)"
+	}
+	settings = append(settings,
+		settingJSON{Name: "host", Value: cfg.Host, Source: source("HOST", true)},
+		settingJSON{Name: "port", Value: strconv.Itoa(cfg.Port), Source: source("PORT", true)},
+		settingJSON{Name: "user", Value: cfg.User, Source: source("USER", true)},
+		settingJSON{Name: "password", Value: password, Source: source("PASSWORD", true)},
+		settingJSON{Name: "database", Value: cfg.Database, Source: source("DATABASE", true)},
+		settingJSON{Name: "compress", Value: strconv.FormatBool(cfg.Compress), Source: source("COMPRESS", false)},
+		settingJSON{Name: "charset", Value: cfg.Charset, Source: source("CHARSET", false)},
+		settingJSON{Name: "collation", Value: cfg.Collation, Source: source("COLLATION", false)},
+	)
+	if target != "" {
+		// Targets are single servers, and never inherit the quorum
+		prefix := base.Targets[target].Prefix
+		return append(settings, settingJSON{Name: "prefix", Value: prefix, Source: source("PREFIX", true)})
+	}
+
+	names := make([]string, 0, len(cfg.Targets))
+	for name := range cfg.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(settings,
+		settingJSON{Name: "quorum_hosts", Value: cfg.QuorumHosts, Source: source("QUORUM_HOSTS", false)},
+		settingJSON{Name: "targets", Value: strings.Join(names, ","), Source: source("TARGETS", false)},
+	)
+}
+
+// writeConfig prints the settings as aligned "name: value (source)" lines,
+// or as JSON. Empty values are shown as "(none)" in the text form.
+func writeConfig(w io.Writer, base config.Config, target string, asJSON bool) error {
+	settings := configSettings(base, target)
+	if asJSON {
+		data, err := json.Marshal(configJSON{Target: target, Settings: settings})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	if target != "" {
+		if _, err := fmt.Fprintf(w, "%-14s %s\n", "target:", target); err != nil {
+			return err
+		}
+	}
+	for _, s := range settings {
+		value := s.Value
+		if value == "" {
+			value = "(none)"
+		}
+		if _, err := fmt.Fprintf(w, "%-14s %s (%s)\n", s.Name+":", value, s.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
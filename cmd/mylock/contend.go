@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/contend"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runContend implements "mylock contend"
+func runContend(args []string) int {
+	contendArgs, err := cli.ParseContendCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(contendArgs.Config.Password)
+	contendArgs.LockName = cli.FitLockName(contendArgs.LockName)
+
+	cfg, _, err := contendArgs.Config.Route(contendArgs.LockName, contendArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory {
+		logging.Printc(logging.Red, "Error: the memory backend cannot be observed from another process\n")
+		return locker.InternalError
+	}
+
+	cfg.ConnectionAttributes = connectionAttributes(contendArgs.LockName, "")
+	lock, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	defer lock.Close()
+
+	// Ctrl-C ends sampling early and still prints the report
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := contend.Options{
+		LockName: contendArgs.LockName,
+		Duration: contendArgs.Duration,
+		Interval: contendArgs.Interval,
+	}
+	result, err := contend.Run(ctx, lock, opts)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if result.Samples == 0 {
+		logging.Printc(logging.Red, "Error: every sample of lock '%s' failed\n", contendArgs.LockName)
+		return locker.InternalError
+	}
+	result.Report(os.Stdout, opts)
+	return 0
+}
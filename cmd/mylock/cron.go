@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+	"github.com/yammerjp/mylock/internal/schedule"
+)
+
+// runCron implements "mylock cron"
+func runCron(args []string) int {
+	if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+		cli.PrintCronHelp()
+		return 0
+	}
+	cronArgs, err := cli.ParseCronCLI(args)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	self, err := os.Executable()
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var running sync.WaitGroup
+	err = scheduleRuns(ctx, cronArgs.Schedule, cronArgs.Splay, clock.Real, func() {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			startScheduledRun(ctx, self, cronArgs.RunArgs)
+		}()
+	})
+	running.Wait()
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return 0
+}
+
+// scheduleRuns calls start each time sched fires, delayed by up to splay,
+// until ctx is done
+func scheduleRuns(ctx context.Context, sched *schedule.Schedule, splay time.Duration, clk clock.Clock, start func()) error {
+	for {
+		next := sched.Next(clk.Now())
+		if next.IsZero() {
+			return errors.New("the schedule never fires")
+		}
+		delay := next.Sub(clk.Now())
+		if splay > 0 {
+			delay += time.Duration(rand.Int63n(int64(splay)))
+		}
+		logging.Debugf("next run at %s", clk.Now().Add(delay).Format(time.RFC3339))
+
+		timer := clk.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+			start()
+		}
+	}
+}
+
+// startScheduledRun runs mylock with args as a process of its own and
+// waits for it. When ctx is done the run is asked to stop.
+func startScheduledRun(ctx context.Context, self string, args []string) {
+	cmd := exec.CommandContext(ctx, self, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		logging.Printc(logging.Yellow, "Scheduled run exited with %d\n", exitErr.ExitCode())
+	default:
+		logging.Printc(logging.Red, "Error: scheduled run failed: %v\n", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/docs"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runDocs implements "mylock docs"
+func runDocs(args []string) int {
+	docsArgs, err := cli.ParseDocsCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	models, err := cli.Models()
+	if err == nil {
+		if docsArgs.Format == cli.DocsFormatMan {
+			err = docs.Man(os.Stdout, models)
+		} else {
+			err = docs.Markdown(os.Stdout, models)
+		}
+	}
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// envExecHolder marks the helper process that holds the lock for --exec,
+// and carries the run id of the mylock that started it
+const envExecHolder = "MYLOCK_EXEC_HOLDER"
+
+// Files passed from the --exec parent to the holder process
+const (
+	// holderReadyFD receives "acquired <connection id>" or "exit <code>"
+	holderReadyFD = 3
+	// holderAliveFD stays open until the command exits
+	holderAliveFD = 4
+)
+
+// runExecHolder holds the lock on behalf of an --exec parent. It tells the
+// parent once the lock is acquired, then keeps it until the command, which
+// replaced the parent, exits. If the lock is lost first, the command is sent
+// SIGTERM, as it is when ctx ends. before runs with ctx ahead of the wait,
+// and check with the lock held before the parent is told; an error from
+// either ends the run without starting the command.
+func runExecHolder(ctx context.Context, lock locker.Backend, lockName string, timeout int, before, check func(context.Context) error) int {
+	ready := os.NewFile(holderReadyFD, "ready")
+	alive := os.NewFile(holderAliveFD, "alive")
+	defer ready.Close()
+	parent := os.Getppid()
+
+	acquired := false
+	err := before(ctx)
+	if err == nil {
+		err = lock.WithLockCtx(ctx, lockName, timeout, func(lockCtx context.Context) error {
+			if err := check(lockCtx); err != nil {
+				return err
+			}
+			acquired = true
+			fmt.Fprintf(ready, "acquired %d\n", lock.ConnectionID())
+			ready.Close()
+
+			exited := make(chan struct{})
+			go func() {
+				_, _ = io.Copy(io.Discard, alive)
+				close(exited)
+			}()
+
+			select {
+			case <-exited:
+				return nil
+			case <-lockCtx.Done():
+				if p, err := os.FindProcess(parent); err == nil {
+					_ = p.Signal(syscall.SIGTERM)
+				}
+				return context.Cause(lockCtx)
+			}
+		})
+	}
+
+	code := locker.ExitCode(err)
+	var outside *windowError
+	switch {
+	case err == nil:
+	case errors.Is(err, locker.ErrLockTimeout):
+		logging.Printc(logging.Yellow, "Failed to acquire lock '%s' within %d seconds (connection id %d)\n", lockName, timeout, lock.ConnectionID())
+	case errors.Is(err, locker.ErrBlocked):
+		logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+	case errors.As(err, &outside):
+		logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+		code = outside.code
+	case errors.Is(err, errLockBusy):
+		logging.Printf("Skipping: %v\n", err)
+		code = 0
+	case errors.Is(err, locker.ErrLockLost):
+		logging.Printc(logging.Red, "Error: %v; the command was sent SIGTERM because mutual exclusion was no longer guaranteed\n", err)
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil:
+		if !acquired {
+			logging.Printc(logging.Yellow, "Failed to acquire lock '%s' before MYLOCK_DEADLINE\n", lockName)
+			code = locker.LockTimeout
+			break
+		}
+		logging.Printc(logging.Red, "Error: MYLOCK_DEADLINE reached, the command was sent SIGTERM\n")
+	default:
+		logging.Printc(logging.Red, "Error: %v (connection id %d)\n", err, lock.ConnectionID())
+	}
+	fmt.Fprintf(ready, "exit %d\n", code)
+	return code
+}
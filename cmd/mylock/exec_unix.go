@@ -0,0 +1,81 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// execCommand starts a holder process that acquires the lock, then replaces
+// mylock with the command, so supervisors see the command's own PID. The
+// holder releases the lock once the command exits. The holder and the
+// command share runID; extraEnv is added to the command's environment.
+func execCommand(args []string, command []string, runID string, extraEnv ...string) int {
+	self, err := os.Executable()
+	if err != nil {
+		logging.Printc(logging.Red, "Error: cannot find the mylock executable: %v\n", err)
+		return locker.InternalError
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	aliveR, aliveW, err := os.Pipe()
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	holder := exec.Command(self, args[1:]...)
+	holder.Env = append(os.Environ(), envExecHolder+"="+runID)
+	holder.Stderr = os.Stderr
+	holder.ExtraFiles = []*os.File{readyW, aliveR}
+	// Keep terminal signals meant for the command away from the holder
+	holder.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := holder.Start(); err != nil {
+		logging.Printc(logging.Red, "Error: failed to start lock holder: %v\n", err)
+		return locker.InternalError
+	}
+	readyW.Close()
+	aliveR.Close()
+
+	line, _ := bufio.NewReader(readyR).ReadString('\n')
+	readyR.Close()
+	var connID int64
+	if _, err := fmt.Sscanf(line, "acquired %d", &connID); err != nil {
+		code := locker.InternalError
+		if _, err := fmt.Sscanf(line, "exit %d", &code); err != nil {
+			logging.Printc(logging.Red, "Error: lock holder exited unexpectedly\n")
+		}
+		_ = holder.Wait()
+		return code
+	}
+
+	// The duplicate is not close-on-exec, so the command inherits it and the
+	// holder sees EOF when the command exits
+	if _, err := syscall.Dup(int(aliveW.Fd())); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	env := append(os.Environ(), fmt.Sprintf("MYLOCK_CONNECTION_ID=%d", connID), "MYLOCK_RUN_ID="+runID)
+	env = append(env, extraEnv...)
+	err = syscall.Exec(path, command, env)
+	// Exec only returns on failure; exiting closes the pipe and frees the lock
+	logging.Printc(logging.Red, "Error: failed to exec command: %v\n", err)
+	return locker.InternalError
+}
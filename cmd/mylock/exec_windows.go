@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// execCommand is not available on Windows, which has no execve
+func execCommand(args []string, command []string, runID string, extraEnv ...string) int {
+	logging.Printc(logging.Red, "Error: --exec is not supported on Windows\n")
+	return locker.InternalError
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runHold implements "mylock hold"
+func runHold(args []string) int {
+	holdArgs, err := cli.ParseHoldCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(holdArgs.Config.Password)
+	holdArgs.LockName = cli.FitLockName(holdArgs.LockName)
+
+	cfg, _, err := holdArgs.Config.Route(holdArgs.LockName, holdArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory {
+		logging.Printc(logging.Red, "Error: a lock held in memory does not block other processes\n")
+		return locker.InternalError
+	}
+
+	runID := newRunID()
+	cfg.ConnectionAttributes = connectionAttributes(holdArgs.LockName, runID)
+	lock, err := openBackend(cfg)
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	defer lock.Close()
+	if mysqlLock, ok := lock.(*locker.Locker); ok {
+		mysqlLock.SetQueryComment(hostname(), runID)
+	}
+
+	// Ctrl-C or SIGTERM releases the lock
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = holdLock(ctx, lock, holdArgs.LockName, holdArgs.Timeout, holdArgs.Duration, nil)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, locker.ErrLockLost) {
+		logging.Printf("Interrupted before lock '%s' was acquired\n", holdArgs.LockName)
+		return locker.LockTimeout
+	}
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.ExitCode(err)
+	}
+	return 0
+}
+
+// holdLock takes lockName and keeps it until duration has passed, or until
+// ctx ends when duration is 0. It returns an error wrapping ErrLockLost if
+// the lock is lost first.
+func holdLock(ctx context.Context, lock locker.Backend, lockName string, timeout int, duration time.Duration, clk clock.Clock) error {
+	return lock.WithLockCtx(ctx, lockName, timeout, func(lockCtx context.Context) error {
+		var expired <-chan time.Time
+		if duration > 0 {
+			timer := clock.OrReal(clk).NewTimer(duration)
+			defer timer.Stop()
+			expired = timer.C()
+			logging.Printf("Holding lock '%s' for %s (Ctrl-C to release early)\n", lockName, duration)
+		} else {
+			logging.Printf("Holding lock '%s' until interrupted (Ctrl-C to release)\n", lockName)
+		}
+
+		select {
+		case <-expired:
+		case <-lockCtx.Done():
+			if ctx.Err() == nil {
+				return context.Cause(lockCtx)
+			}
+		}
+		logging.Printf("Releasing lock '%s'\n", lockName)
+		return nil
+	})
+}
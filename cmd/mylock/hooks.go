@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/yammerjp/mylock/internal/executor"
+)
+
+// runHook runs a user-supplied hook command through the shell.
+// The hook receives MYLOCK_HOOK set to its name plus the given KEY=value pairs.
+func runHook(ctx context.Context, name, hook string, env ...string) (int, error) {
+	exec := executor.New()
+	exec.Env = append([]string{"MYLOCK_HOOK=" + name}, env...)
+	return exec.Execute(ctx, executor.ShellCommand(hook))
+}
+
+// envValue makes s safe to pass in an environment variable, which cannot
+// hold NUL bytes; with one, starting the hook would fail
+func envValue(s string) string {
+	return strings.ReplaceAll(s, "\x00", "")
+}
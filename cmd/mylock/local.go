@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/flock"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// hostSlotDir holds the lock files of --max-per-host, shared by every mylock
+// this user runs on the machine. The uid in its name keeps users from
+// blocking each other's jobs; on Windows the temp directory is per user.
+func hostSlotDir() string {
+	if uid := os.Geteuid(); uid >= 0 {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("mylock-slots-%d", uid))
+	}
+	return filepath.Join(os.TempDir(), "mylock-slots")
+}
+
+// acquireHostSlot waits until fewer than slots mylock processes on this
+// machine hold a host slot. On failure it returns a nil lock and the exit
+// code to use.
+func acquireHostSlot(deadline time.Time, slots int) (*flock.Lock, int) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	l, slot, err := flock.AcquireSlot(ctx, hostSlotDir(), slots)
+	if err != nil {
+		if errors.Is(err, flock.ErrTimeout) {
+			logging.Printc(logging.Yellow, "Failed to get a host slot (--max-per-host %d) before the timeout; other jobs are running on this machine\n", slots)
+			return nil, locker.LockTimeout
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return nil, locker.InternalError
+	}
+	logging.Debugf("took host slot %d of %d", slot, slots)
+	return l, 0
+}
+
+// acquireFileLock waits for the --also-flock lock on path. On failure it
+// returns a nil lock and the exit code to use.
+func acquireFileLock(deadline time.Time, path string) (*flock.Lock, int) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	l, err := flock.Acquire(ctx, path)
+	if err != nil {
+		if errors.Is(err, flock.ErrTimeout) {
+			logging.Printc(logging.Yellow, "Failed to lock %s before the timeout; another instance is running on this machine\n", path)
+			return nil, locker.LockTimeout
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return nil, locker.InternalError
+	}
+	logging.Debugf("locked %s", path)
+	return l, 0
+}
+
+// lockWait is the timeout for the MySQL lock: what is left of the --timeout
+// budget at deadline, or 0 for --timeout 0, which tries the lock once
+// without waiting
+func lockWait(timeout int, deadline time.Time) int {
+	if timeout == 0 {
+		return 0
+	}
+	return remainingTimeout(deadline)
+}
+
+// remainingTimeout is what is left of the --timeout budget at deadline, in
+// whole seconds and at least 1 as GET_LOCK takes it
+func remainingTimeout(deadline time.Time) int {
+	remaining := int((time.Until(deadline) + time.Second - 1) / time.Second)
+	if remaining < 1 {
+		return 1
+	}
+	return remaining
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// lostHookTimeout bounds the on-lock-lost hook, since the command runs on
+// without the lock until it returns
+var lostHookTimeout = 30 * time.Second
+
+// withLostHook runs the --on-lock-lost-hook hook with env before next, the
+// --lock-lost-policy handler, acts on a lost lock. A nil next kills the
+// command, as WithLockCtx does.
+func withLostHook(next locker.LostHandler, hook string, env ...string) locker.LostHandler {
+	return func(ctx context.Context, lost error) error {
+		hookCtx, cancel := context.WithTimeout(ctx, lostHookTimeout)
+		hookEnv := append(env, "MYLOCK_LOST_REASON="+envValue(lost.Error()))
+		if _, err := runHook(hookCtx, "on-lock-lost", hook, hookEnv...); err != nil {
+			logging.Printc(logging.Yellow, "Warning: on-lock-lost hook failed: %v\n", err)
+		}
+		cancel()
+		if next == nil {
+			return lost
+		}
+		return next(ctx, lost)
+	}
+}
+
+// lostHandler returns what --lock-lost-policy does when the lock session
+// dies, or nil for the default of killing the command
+func lostHandler(policy string, lock *locker.Locker, runner executor.CommandRunner, lockName string, timeout int) locker.LostHandler {
+	switch policy {
+	case cli.LostPolicyWarnOnly:
+		return func(ctx context.Context, lost error) error {
+			logging.Printc(logging.Yellow, "Warning: %v; the command keeps running without the lock\n", lost)
+			// Stop checking; the release at the end reports the lock as not held
+			<-ctx.Done()
+			return nil
+		}
+	case cli.LostPolicyReacquire:
+		return func(ctx context.Context, lost error) error {
+			logging.Printc(logging.Yellow, "Warning: %v; pausing the command to reacquire the lock\n", lost)
+			// Between commands there is nothing to pause; otherwise the
+			// command must not run on while the lock is not held
+			if err := runner.Pause(); err == nil {
+				defer func() {
+					if err := runner.Resume(); err != nil {
+						logging.Printc(logging.Yellow, "Warning: failed to resume the command: %v\n", err)
+					}
+				}()
+			} else if !errors.Is(err, executor.ErrNotRunning) {
+				return fmt.Errorf("failed to pause the command to reacquire the lock: %w", err)
+			}
+
+			acquired, err := lock.Reacquire(ctx, lockName, timeout)
+			if err != nil {
+				return fmt.Errorf("failed to reacquire lock: %w", err)
+			}
+			if !acquired {
+				return fmt.Errorf("failed to reacquire lock within %d seconds", timeout)
+			}
+			logging.Printf("Reacquired lock '%s' (connection id %d), resuming the command\n", lockName, lock.ConnectionID())
+			return nil
+		}
+	}
+	return nil
+}
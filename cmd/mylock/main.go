@@ -2,70 +2,786 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/clock"
 	"github.com/yammerjp/mylock/internal/executor"
 	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+	"github.com/yammerjp/mylock/internal/notify"
+	"github.com/yammerjp/mylock/internal/progress"
 )
 
+// outputTailSize is how many bytes of command output are kept for the on-failure hook
+const outputTailSize = 4096
+
+// geteuid reports the effective user ID, or -1 on Windows; tests replace it
+var geteuid = os.Geteuid
+
+// newRunner makes the runner of the protected command; tests replace it
+var newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner {
+	e := executor.New()
+	e.Env = env
+	e.Stdout, e.Stderr = stdout, stderr
+	return e
+}
+
 func main() {
 	os.Exit(run(os.Args))
 }
 
-func run(args []string) int {
+func run(args []string) (status int) {
+	// A child started for options such as --chroot sets itself up before becoming the command
+	if spec, ok := os.LookupEnv(envChildSetup); ok {
+		return runChildSetup(spec, args[1:])
+	}
+
+	// Dispatch subcommands before parsing the lock-and-run flags
+	if len(args) > 1 {
+		switch args[1] {
+		case "bench":
+			return runBench(args[2:])
+		case "whoami":
+			return runWhoami(args[2:])
+		case "wait":
+			return runWait(args[2:])
+		case "contend":
+			return runContend(args[2:])
+		case "config":
+			return runConfig(args[2:])
+		case "run-one":
+			return runRunOne(args[0], args[2:])
+		case "docs":
+			return runDocs(args[2:])
+		case "snapshot":
+			return runSnapshot(args[2:])
+		case "hold":
+			return runHold(args[2:])
+		case "block":
+			return runBlock(args[2:])
+		case "cron":
+			return runCron(args[2:])
+		case "require-lock-held":
+			return runRequireHeld(args[2:])
+		}
+	}
+
+	// Rewrite setlock/lckdo style invocations into mylock's own flags
+	if cli.IsCompat(args[1:]) {
+		translated, err := cli.TranslateCompat(args[1:])
+		if err != nil {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.InternalError
+		}
+		args = append([]string{args[0]}, translated...)
+	}
+
 	// Parse CLI arguments
 	cliArgs, err := cli.ParseCLI(args[1:])
 	if err != nil {
 		// Kong will output help automatically on --help
-		// Check if help was requested
-		for _, arg := range args {
-			if arg == "--help" || arg == "-h" {
-				return 0
-			}
+		if helpRequested(args) {
+			return 0
 		}
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		logging.Printc(logging.Red, "Error: %v\n", err)
 		return locker.InternalError
 	}
 
-	// Initialize locker
-	lock, err := locker.NewLocker(cliArgs.Config.DSN())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to MySQL: %v\n", err)
+	// Never print the password, even inside driver errors
+	logging.AddSecret(cliArgs.Config.Password)
+	logging.SetDebug(cliArgs.Debug)
+	logging.SetColor(!cliArgs.NoColor && logging.ColorAllowed(os.Stderr))
+
+	// Job scripts run from the system crontab as root by mistake get full privileges
+	if !cliArgs.AllowRoot && geteuid() == 0 {
+		logging.Printc(logging.Red, "Error: refusing to run as root; use --allow-root or MYLOCK_ALLOW_ROOT=1 if this is intended\n")
 		return locker.InternalError
 	}
-	defer lock.Close()
-
-	// Create executor
-	exec := executor.New()
 
 	// Determine lock name
 	lockName := cliArgs.LockName
 	if cliArgs.LockNameFromCommand {
 		lockName = cli.HashCommand(cliArgs.Command)
 	}
+	if cliArgs.Group != "" {
+		lockName = cliArgs.Group
+	}
+	// A --claim family is routed and named by its first lock until one is claimed
+	var claim cli.Claim
+	if cliArgs.Claim != "" {
+		claim, _ = cli.ParseClaim(cliArgs.Claim)
+		lockName = claim.Name(claim.First)
+	}
+	if cliArgs.UnicodeLockName {
+		lockName = locker.NormalizeLockName(lockName)
+	}
+	// A maintenance block on the name a --shards or --claim lock is derived
+	// from covers that lock too
+	var baseName string
+	switch {
+	case cliArgs.Shards > 0:
+		baseName = cli.FitLockName(lockName)
+	case cliArgs.Claim != "":
+		baseName = claim.Base()
+		if cliArgs.UnicodeLockName {
+			baseName = locker.NormalizeLockName(baseName)
+		}
+	}
+	if cliArgs.Shards > 0 {
+		lockName = cli.ShardLockName(lockName, cliArgs.ShardKey, cliArgs.Shards)
+		logging.Debugf("shard key %q maps to lock '%s'", cliArgs.ShardKey, lockName)
+	}
+	if fitted := cli.FitLockName(lockName); fitted != lockName {
+		logging.Debugf("lock name is longer than 64 bytes, using '%s'", fitted)
+		lockName = fitted
+	}
+
+	// Route the lock to the MySQL target that owns it
+	cfg, target, err := cliArgs.Config.Route(lockName, cliArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if target != "" {
+		logging.Debugf("lock '%s' routed to target %s", lockName, target)
+	}
+
+	// Options such as --sandbox start mylock in place of the command to set it up
+	command := cliArgs.Command
+	var setupEnv []string
+	setup, err := newChildSetup(cliArgs)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if setup != nil {
+		var spec string
+		command, spec, err = wrapCommand(cliArgs.Command, setup)
+		if err != nil {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.InternalError
+		}
+		setupEnv = append(setupEnv, spec)
+	}
+
+	// SIGUSR1 asks for a report of whether the run waits for the lock or
+	// runs the command; --status-file keeps the same state on disk
+	runID := newRunID()
+	startedAt := time.Now()
+	if id := os.Getenv(envExecHolder); id != "" {
+		// The --exec holder takes the run id of the mylock that became the command
+		runID = id
+	}
+	runState := newRunStatus(clock.Real, lockName)
+	defer reportStatusOnSignal(runState)()
+	if cliArgs.StatusFile != "" {
+		runState.saveTo(cliArgs.StatusFile, runID)
+		defer func() { runState.done(status) }()
+	}
+
+	// Outside its time window the run stops before touching any lock
+	if err := checkWindow(cliArgs, time.Now()); err != nil {
+		logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+		return err.(*windowError).code
+	}
+
+	// Heavy jobs check the host before they connect, so an unfit host never
+	// takes the lock from one that could finish the job
+	if err := checkPreconditions(cliArgs); err != nil {
+		if errors.Is(err, errPrecondition) {
+			logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+			return locker.PreconditionFailed
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	// In exec mode a holder process keeps the lock and mylock becomes the command
+	if cliArgs.Exec && os.Getenv(envExecHolder) == "" {
+		return execCommand(args, command, runID, setupEnv...)
+	}
+
+	// MYLOCK_DEADLINE bounds the whole run, the wait for the lock included
+	runCtx := context.Background()
+	if !cliArgs.Deadline.IsZero() {
+		if !time.Now().Before(cliArgs.Deadline) {
+			logging.Printc(logging.Yellow, "MYLOCK_DEADLINE %s has already passed, not waiting for lock '%s'\n", cliArgs.Deadline.Format(time.RFC3339), lockName)
+			return locker.LockTimeout
+		}
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithDeadline(runCtx, cliArgs.Deadline)
+		defer cancel()
+	}
+
+	// Local locks are taken first and share the --timeout budget with the MySQL lock
+	deadline := time.Now().Add(time.Duration(cliArgs.Timeout) * time.Second)
+	if !cliArgs.Deadline.IsZero() && cliArgs.Deadline.Before(deadline) {
+		deadline = cliArgs.Deadline
+	}
+	if cliArgs.MaxPerHost > 0 {
+		slot, code := acquireHostSlot(deadline, cliArgs.MaxPerHost)
+		if slot == nil {
+			return code
+		}
+		defer slot.Unlock()
+	}
+	if cliArgs.AlsoFlock != "" {
+		fileLock, code := acquireFileLock(deadline, cliArgs.AlsoFlock)
+		if fileLock == nil {
+			return code
+		}
+		defer fileLock.Unlock()
+	}
+	lockTimeout := lockWait(cliArgs.Timeout, deadline)
+
+	// Initialize locker, naming the session after this run
+	cfg.ConnectionAttributes = connectionAttributes(lockName, runID)
+	if cliArgs.CancelInProgress {
+		// Runs that preempt each other are ordered by this, on every session
+		cfg.ConnectionAttributes[locker.StartedAtAttribute] = strconv.FormatInt(startedAt.UnixNano(), 10)
+	}
+	lock, err := openBackend(cfg)
+	if err != nil {
+		if errors.Is(err, locker.ErrLockUnsupported) {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			logging.Printf("mylock needs a direct MySQL session; connect past proxies such as Vitess or connection poolers\n")
+			return locker.LockUnsupported
+		}
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	defer lock.Close()
+
+	// Keep the server from dropping the idle lock session during long jobs
+	if mysqlLock, ok := lock.(*locker.Locker); ok && cliArgs.ExpectedRuntime > 0 {
+		if err := mysqlLock.EnsureSessionTimeout(context.Background(), cliArgs.ExpectedRuntime+cliArgs.HoldAfter); err != nil {
+			logging.Printc(logging.Yellow, "Warning: %v\n", err)
+		}
+	}
+
+	if policy := lockNamePolicy(cliArgs); policy != locker.LockNamesSafe {
+		if b, ok := lock.(interface{ SetLockNamePolicy(locker.LockNamePolicy) }); ok {
+			b.SetLockNamePolicy(policy)
+		}
+	}
+
+	if cliArgs.NoRelease {
+		if mysqlLock, ok := lock.(*locker.Locker); ok {
+			mysqlLock.SetNoRelease(true)
+		} else {
+			logging.Printc(logging.Yellow, "Warning: --no-release only applies to a single MySQL server\n")
+		}
+	}
+
+	// Tag the lock queries so they can be attributed in the server's logs
+	if mysqlLock, ok := lock.(*locker.Locker); ok {
+		mysqlLock.SetQueryComment(hostname(), runID)
+	}
+
+	if cliArgs.StrictRelease {
+		if mysqlLock, ok := lock.(*locker.Locker); ok {
+			mysqlLock.SetStrictRelease(true)
+		} else {
+			logging.Printc(logging.Yellow, "Warning: --strict-release only applies to a single MySQL server\n")
+		}
+	}
+	if cliArgs.DetectFailover {
+		if mysqlLock, ok := lock.(*locker.Locker); ok {
+			mysqlLock.SetDetectFailover(true)
+		} else {
+			logging.Printc(logging.Yellow, "Warning: --detect-failover only applies to a single MySQL server\n")
+		}
+	}
+
+	if cliArgs.CancelInProgress {
+		if mysqlLock, ok := lock.(*locker.Locker); ok {
+			mysqlLock.SetPreempt(startedAt)
+		} else {
+			logging.Printc(logging.Yellow, "Warning: --cancel-in-progress only applies to a single MySQL server\n")
+		}
+	}
+
+	// --claim takes the first free lock of its family, which then stands in
+	// for --lock-name; taking it again below only nests on this session
+	var slotEnv []string
+	var claimed string
+	releaseClaim := func() {
+		if claimed != "" {
+			_, _ = lock.ReleaseLock(context.Background(), claimed)
+			claimed = ""
+		}
+	}
+	defer releaseClaim()
+	if cliArgs.Claim != "" {
+		claimer, ok := lock.(interface {
+			AcquireAny(ctx context.Context, names []string, timeout int) (string, error)
+		})
+		if !ok {
+			logging.Printc(logging.Red, "Error: --claim needs a single MySQL server or the memory backend\n")
+			return locker.InternalError
+		}
+		claimed, err = claimer.AcquireAny(runCtx, claim.Names(), lockTimeout)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// MYLOCK_DEADLINE came first
+			err = nil
+		}
+		if err != nil {
+			logging.Printc(logging.Red, "Error: %v (connection id %d)\n", err, lock.ConnectionID())
+			return locker.InternalError
+		}
+		if claimed == "" {
+			logging.Printc(logging.Yellow, "Failed to claim any of %s within %d seconds (connection id %d)\n", cliArgs.Claim, cliArgs.Timeout, lock.ConnectionID())
+			return locker.LockTimeout
+		}
+		slot, _ := claim.Slot(claimed)
+		logging.Debugf("claimed slot %d, lock '%s'", slot, claimed)
+		lockName = claimed
+		lockTimeout = lockWait(cliArgs.Timeout, deadline)
+		slotEnv = []string{fmt.Sprintf("MYLOCK_SLOT=%d", slot)}
+	}
+
+	// A maintenance block stops the run before it waits for the lock, and
+	// again once the lock is held in case it was set meanwhile. The time
+	// window is checked again then too, since the wait may outlast it.
+	var blocks *locker.Locker
+	if mysqlLock, ok := lock.(*locker.Locker); ok {
+		blocks = mysqlLock
+	}
+	checkBlocked := func(ctx context.Context) error {
+		if blocks == nil {
+			return nil
+		}
+		return checkBlock(ctx, blocks, lockName, baseName)
+	}
+	// --if-free skips the run while another job holds its lock, checked
+	// before the wait and again with the lock held
+	var ifFree freeWaiter
+	if len(cliArgs.IfFree) > 0 {
+		waiter, ok := lock.(freeWaiter)
+		if !ok {
+			logging.Printc(logging.Red, "Error: --if-free needs a single MySQL server or the memory backend\n")
+			return locker.InternalError
+		}
+		ifFree = waiter
+	}
+	checkAcquired := func(ctx context.Context) error {
+		if err := checkWindow(cliArgs, time.Now()); err != nil {
+			return err
+		}
+		if ifFree != nil {
+			if err := checkLocksFree(ctx, ifFree, cliArgs.IfFree); err != nil {
+				return err
+			}
+		}
+		return checkBlocked(ctx)
+	}
+	if ifFree != nil {
+		if err := checkLocksFree(runCtx, ifFree, cliArgs.IfFree); err != nil {
+			if errors.Is(err, errLockBusy) {
+				logging.Printf("Skipping: %v\n", err)
+				return 0
+			}
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.InternalError
+		}
+	}
+
+	// --after-lock-free orders this run after other jobs, sharing the
+	// --timeout budget with the wait for its own lock
+	if len(cliArgs.AfterLockFree) > 0 {
+		if code := waitLocksFree(runCtx, lock, cliArgs.AfterLockFree, deadline); code != 0 {
+			return code
+		}
+		lockTimeout = lockWait(cliArgs.Timeout, deadline)
+	}
+
+	if cliArgs.Exec {
+		return runExecHolder(runCtx, lock, lockName, lockTimeout, checkBlocked, checkAcquired)
+	}
+	if err := checkBlocked(runCtx); err != nil {
+		logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+		return locker.Blocked
+	}
+
+	// --dedupe-window keeps its records in a table on the MySQL server
+	var dedupe *locker.Locker
+	commandHash := cli.HashCommand(cliArgs.Command)
+	if cliArgs.DedupeWindow > 0 {
+		if mysqlLock, ok := lock.(*locker.Locker); ok {
+			dedupe = mysqlLock
+		} else {
+			logging.Printc(logging.Yellow, "Warning: --dedupe-window only applies to a single MySQL server\n")
+		}
+	}
+
+	var mailer *notify.Mailer
+	if len(cliArgs.MailTo) > 0 {
+		mailer, err = newMailer(cliArgs.MailTo, cliArgs.MailFrom)
+		if err != nil {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.InternalError
+		}
+	}
+
+	var pagerDuty *notify.PagerDuty
+	if cliArgs.PagerdutyRoutingKey != "" {
+		logging.AddSecret(cliArgs.PagerdutyRoutingKey)
+		pagerDuty = &notify.PagerDuty{RoutingKey: cliArgs.PagerdutyRoutingKey}
+	}
+
+	events, err := newEventPublisher()
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	connEnv := fmt.Sprintf("MYLOCK_CONNECTION_ID=%d", lock.ConnectionID())
+
+	// Create the command runner
+	commandEnv := append(append([]string{connEnv, "MYLOCK_RUN_ID=" + runID}, slotEnv...), setupEnv...)
+	stdout, stderr, flushOutput := commandOutput(cliArgs, lockName, runID)
+
+	// --stall-timeout watches the command's output for signs of life
+	var activity *outputActivity
+	var stallSignal os.Signal
+	if cliArgs.StallTimeout > 0 {
+		activity = newOutputActivity(clock.Real)
+		stdout, stderr = activity.wrap(stdout), activity.wrap(stderr)
+		if cliArgs.StallSignal != "" {
+			stallSignal, _ = executor.ParseSignal(cliArgs.StallSignal)
+		}
+	}
+
+	// Keep the tail of the command output for the on-failure hook and mail
+	var outputTail *executor.TailBuffer
+	if cliArgs.OnFailureHook != "" || mailer != nil {
+		outputTail = executor.NewTailBuffer(outputTailSize)
+		stdout = io.MultiWriter(stdout, outputTail)
+		stderr = io.MultiWriter(stderr, outputTail)
+	}
+	runner := newRunner(commandEnv, stdout, stderr)
 
 	// Run command with lock
 	ctx := context.Background()
-	err = lock.WithLock(ctx, lockName, cliArgs.Timeout, func() error {
-		_, execErr := exec.Execute(ctx, cliArgs.Command)
+	acquired := false
+	exitCode := -1
+	summary := runSummary{LockName: lockName}
+	if cliArgs.Summary || cliArgs.SummaryJSON || cliArgs.Rusage {
+		defer func() {
+			summary.Acquired = acquired
+			summary.ExitCode = status
+			if cliArgs.Rusage && acquired {
+				usage := runner.Usage()
+				summary.Usage = &usage
+			}
+			if mysqlLock, ok := lock.(*locker.Locker); ok {
+				stats := mysqlLock.DBStats()
+				summary.Pool = &stats
+			}
+			summary.print(cliArgs.SummaryJSON)
+		}()
+	}
+	if events != nil {
+		defer func() {
+			publishOutcome(ctx, events, lockName, acquired, status, summary)
+		}()
+	}
+	waitStart := time.Now()
+	var waitProgress *progress.Reporter
+	if !cliArgs.Quiet {
+		if progress.IsTerminal(os.Stderr) {
+			waitProgress = progress.StartSpinner(os.Stderr, lockName, lockTimeout)
+		} else {
+			waitProgress = progress.Start(lockName, lockTimeout, progress.DefaultInterval)
+		}
+	}
+	stopProgress := func() {
+		if waitProgress != nil {
+			waitProgress.Stop()
+		}
+	}
+	// A failure is only reported once the lock is released, so a slow
+	// notifier does not keep other runs waiting
+	var commandFailure notify.Failure
+	failed := false
+	work := func(lockCtx context.Context) error {
+		acquired = true
+		runState.acquired(lockName)
+		runStart := time.Now()
+		summary.Wait = runStart.Sub(waitStart)
+		defer func() { summary.Run = time.Since(runStart) }()
+		if waitProgress != nil {
+			waitProgress.Acquired()
+		}
+		if events != nil {
+			acquiredEvent := newEvent(notify.EventAcquired, lockName)
+			acquiredEvent.WaitSeconds = summary.Wait.Seconds()
+			publishEvent(ctx, events, acquiredEvent)
+		}
+		hookEnv := append([]string{"MYLOCK_LOCK_NAME=" + lockName, connEnv}, slotEnv...)
+
+		if err := checkAcquired(lockCtx); err != nil {
+			return err
+		}
+
+		// Checked with the lock held, so concurrent identical runs cannot both pass
+		if dedupe != nil {
+			age, found, err := dedupe.LastSuccess(lockCtx, commandHash)
+			if err != nil {
+				return err
+			}
+			if found && age < cliArgs.DedupeWindow {
+				logging.Printf("Skipping: the same command succeeded %s ago, within --dedupe-window %s\n", age.Round(time.Second), cliArgs.DedupeWindow)
+				exitCode = 0
+				return nil
+			}
+		}
+
+		if cliArgs.PreHook != "" {
+			hookCode, hookErr := runHook(lockCtx, "pre", cliArgs.PreHook, hookEnv...)
+			if hookErr != nil {
+				logging.Printc(logging.Red, "Pre-hook failed, skipping command: %v\n", hookErr)
+				exitCode = hookCode
+				return hookErr
+			}
+		}
+
+		var heartbeat *progress.Reporter
+		if cliArgs.HeartbeatLog > 0 {
+			heartbeat = progress.StartHeartbeat(lockName, cliArgs.HeartbeatLog)
+		}
+		cmdCtx := lockCtx
+		var stall *stallWatch
+		if activity != nil {
+			stall = watchStall(lockCtx, activity, cliArgs.StallTimeout, stallSignal, runner)
+			cmdCtx = stall.ctx
+		}
+		var execErr error
+		runState.running(runner)
+		exitCode, execErr = runner.ExecuteWithRetry(cmdCtx, command, cliArgs.CmdRetries, cliArgs.CmdRetryBackoff)
+		runState.finished()
+		flushOutput()
+		if heartbeat != nil {
+			heartbeat.Stop()
+		}
+		if stall != nil {
+			if stall.Stalled() {
+				execErr = fmt.Errorf("%w for %s, so it was killed", errStalled, cliArgs.StallTimeout)
+			}
+			stall.Stop()
+		}
+		if execErr == nil && dedupe != nil {
+			if err := dedupe.RecordSuccess(lockCtx, commandHash); err != nil {
+				logging.Printc(logging.Yellow, "Warning: %v\n", err)
+			}
+		}
+
+		if execErr != nil && cliArgs.OnFailureHook != "" {
+			failureEnv := append(hookEnv,
+				fmt.Sprintf("MYLOCK_EXIT_CODE=%d", exitCode),
+				"MYLOCK_OUTPUT_TAIL="+envValue(outputTail.String()),
+			)
+			if _, hookErr := runHook(lockCtx, "on-failure", cliArgs.OnFailureHook, failureEnv...); hookErr != nil {
+				logging.Printc(logging.Yellow, "Warning: on-failure hook failed: %v\n", hookErr)
+			}
+		}
+
+		if execErr != nil && (mailer != nil || pagerDuty != nil) {
+			commandFailure = failure(lockName, cliArgs.Command, exitCode, outputTail)
+			failed = true
+		}
+
+		if cliArgs.PostHook != "" {
+			postEnv := append(hookEnv, fmt.Sprintf("MYLOCK_EXIT_CODE=%d", exitCode))
+			if _, hookErr := runHook(lockCtx, "post", cliArgs.PostHook, postEnv...); hookErr != nil {
+				logging.Printc(logging.Yellow, "Warning: post-hook failed: %v\n", hookErr)
+			}
+		}
+
+		// Keep holding the lock to throttle the next run
+		if cliArgs.HoldAfter > 0 {
+			timer := time.NewTimer(cliArgs.HoldAfter)
+			select {
+			case <-lockCtx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
 		return execErr
-	})
+	}
+
+	var onLost locker.LostHandler
+	mysqlLock, isMySQL := lock.(*locker.Locker)
+	if isMySQL {
+		onLost = lostHandler(cliArgs.LockLostPolicy, mysqlLock, runner, lockName, cliArgs.Timeout)
+	} else if cliArgs.LockLostPolicy != "" && cliArgs.LockLostPolicy != cli.LostPolicyKillChild {
+		logging.Printc(logging.Yellow, "Warning: --lock-lost-policy only applies to a single MySQL server\n")
+	}
+	if cliArgs.RemapCollisions {
+		logging.Printc(logging.Yellow, "Warning: --remap-collisions is deprecated and no longer shifts exit codes; use --exit-code-file\n")
+	}
+	if cliArgs.OnLockLostHook != "" {
+		if isMySQL {
+			lostEnv := append([]string{"MYLOCK_LOCK_NAME=" + lockName, connEnv}, slotEnv...)
+			onLost = withLostHook(onLost, cliArgs.OnLockLostHook, lostEnv...)
+		} else {
+			logging.Printc(logging.Yellow, "Warning: --on-lock-lost-hook only applies to a single MySQL server\n")
+		}
+	}
+	if onLost != nil {
+		err = mysqlLock.WithLockCtxOnLost(runCtx, lockName, lockTimeout, work, onLost)
+	} else {
+		err = lock.WithLockCtx(runCtx, lockName, lockTimeout, work)
+	}
+	stopProgress()
+	if cliArgs.NoRelease {
+		// End the session now, which is what frees the lock
+		lock.Close()
+	} else {
+		releaseClaim()
+	}
+	if !acquired {
+		summary.Wait = time.Since(waitStart)
+	}
+
+	if failed {
+		notifyFailure(ctx, mailer, pagerDuty, commandFailure)
+	}
+
+	// The on-release hook runs once the lock has been released, whatever the outcome
+	if acquired && cliArgs.OnRelease != "" {
+		releaseEnv := []string{"MYLOCK_LOCK_NAME=" + lockName, connEnv, fmt.Sprintf("MYLOCK_EXIT_CODE=%d", exitCode)}
+		if _, hookErr := runHook(ctx, "on-release", cliArgs.OnRelease, releaseEnv...); hookErr != nil {
+			logging.Printc(logging.Yellow, "Warning: on-release hook failed: %v\n", hookErr)
+		}
+	}
+
+	if acquired && cliArgs.ExitCodeFile != "" {
+		if writeErr := os.WriteFile(cliArgs.ExitCodeFile, []byte(fmt.Sprintf("%d\n", exitCode)), 0o644); writeErr != nil {
+			logging.Printc(logging.Yellow, "Warning: failed to write exit code file: %v\n", writeErr)
+		}
+	}
 
 	if err != nil {
-		if err == locker.ErrLockTimeout {
-			fmt.Fprintf(os.Stderr, "Failed to acquire lock '%s' within %d seconds\n", lockName, cliArgs.Timeout)
+		if errors.Is(err, locker.ErrSuperseded) {
+			if acquired {
+				logging.Printc(logging.Yellow, "Cancelled: %v; the command was stopped\n", err)
+			} else {
+				logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+			}
+			return locker.Preempted
+		}
+		if errors.Is(err, locker.ErrLockLost) {
+			logging.Printc(logging.Red, "Error: %v; the command was stopped because mutual exclusion was no longer guaranteed\n", err)
+			return locker.LockLost
+		}
+		if errors.Is(err, errStalled) {
+			logging.Printc(logging.Red, "Error: %v\n", err)
+			return locker.Stalled
+		}
+		if errors.Is(err, locker.ErrGetLockNull) {
+			logging.Printc(logging.Red, "Error: %v (connection id %d)\n", err, lock.ConnectionID())
+			return locker.GetLockNull
+		}
+		if errors.Is(err, locker.ErrReleaseFailed) {
+			logging.Printc(logging.Red, "Error: %v (connection id %d); the lock may stay held until that session ends\n", err, lock.ConnectionID())
+			return locker.ReleaseFailed
+		}
+		if errors.Is(err, locker.ErrBlocked) {
+			logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+			return locker.Blocked
+		}
+		var outside *windowError
+		if errors.As(err, &outside) {
+			logging.Printc(logging.Yellow, "Skipping: %v\n", err)
+			return outside.code
+		}
+		if errors.Is(err, errLockBusy) {
+			logging.Printf("Skipping: %v\n", err)
+			return 0
+		}
+		if errors.Is(err, locker.ErrLockDeadlock) {
+			logging.Printc(logging.Yellow, "Failed to acquire lock '%s': %v (connection id %d)\n", lockName, err, lock.ConnectionID())
 			return locker.LockTimeout
 		}
+		if errors.Is(err, locker.ErrLockTimeout) {
+			logging.Printc(logging.Yellow, "Failed to acquire lock '%s' within %d seconds (connection id %d)\n", lockName, cliArgs.Timeout, lock.ConnectionID())
+			if pagerDuty != nil {
+				if pdErr := pagerDuty.TriggerTimeout(ctx, lockName, hostname(), cliArgs.Timeout); pdErr != nil {
+					logging.Printc(logging.Yellow, "Warning: %v\n", pdErr)
+				}
+			}
+			if cliArgs.OnTimeoutHook != "" {
+				timeoutEnv := []string{"MYLOCK_LOCK_NAME=" + lockName, connEnv, fmt.Sprintf("MYLOCK_TIMEOUT=%d", cliArgs.Timeout)}
+				if _, hookErr := runHook(ctx, "on-timeout", cliArgs.OnTimeoutHook, timeoutEnv...); hookErr != nil {
+					logging.Printc(logging.Yellow, "Warning: on-timeout hook failed: %v\n", hookErr)
+				}
+			}
+			return locker.LockTimeout
+		}
+		if errors.Is(err, context.DeadlineExceeded) && runCtx.Err() != nil {
+			if !acquired {
+				logging.Printc(logging.Yellow, "Failed to acquire lock '%s' before MYLOCK_DEADLINE %s\n", lockName, cliArgs.Deadline.Format(time.RFC3339))
+				return locker.LockTimeout
+			}
+			logging.Printc(logging.Red, "Error: MYLOCK_DEADLINE %s reached, the command was stopped\n", cliArgs.Deadline.Format(time.RFC3339))
+			return locker.InternalError
+		}
 		// Check if it's an execution error with specific exit code
-		exitCode := executor.GetExitCode(err)
-		if exitCode >= 0 {
-			return exitCode
+		if code := executor.GetExitCode(err); code >= 0 {
+			return commandExitCode(code, cliArgs.ExitCodeFile)
 		}
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		logging.Printc(logging.Red, "Error: %v (connection id %d)\n", err, lock.ConnectionID())
 		return locker.InternalError
 	}
 
+	if pagerDuty != nil && cliArgs.PagerdutyResolve {
+		if pdErr := pagerDuty.Resolve(ctx, lockName); pdErr != nil {
+			logging.Printc(logging.Yellow, "Warning: %v\n", pdErr)
+		}
+	}
 	return 0
 }
+
+// commandExitCode reports when the command's exit code collides with one of
+// mylock's own exit codes. The code is passed on unchanged, since any other
+// value could be one the command exits with too; exitCodeFile, when set,
+// tells the two apart.
+func commandExitCode(code int, exitCodeFile string) int {
+	if !locker.IsReservedExitCode(code) {
+		return code
+	}
+	if exitCodeFile != "" {
+		logging.Printc(logging.Yellow, "Warning: command exited with %d, which is also a mylock exit code; %s holds the command's exit code\n", code, exitCodeFile)
+		return code
+	}
+	logging.Printc(logging.Yellow, "Warning: command exited with %d, which is also a mylock exit code\n", code)
+	return code
+}
+
+// lockNamePolicy is the lock name policy selected by the flags
+func lockNamePolicy(args cli.CLI) locker.LockNamePolicy {
+	switch {
+	case args.AllowAnyLockName:
+		return locker.LockNamesAny
+	case args.UnicodeLockName:
+		return locker.LockNamesUnicode
+	}
+	return locker.LockNamesSafe
+}
+
+// helpRequested reports whether --help or -h was passed
+func helpRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			return true
+		}
+	}
+	return false
+}
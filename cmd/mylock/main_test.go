@@ -0,0 +1,859 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+	"github.com/yammerjp/mylock/internal/schedule"
+)
+
+// fakeRunner records the command it is asked to run and returns a fixed result
+type fakeRunner struct {
+	env      []string
+	command  []string
+	exitCode int
+	err      error
+	signals  []os.Signal
+	pid      int
+	pauseErr error
+	// onRun is called as the command would start
+	onRun func()
+}
+
+func (r *fakeRunner) ExecuteWithRetry(ctx context.Context, command []string, retries int, backoff time.Duration) (int, error) {
+	r.command = command
+	if r.onRun != nil {
+		r.onRun()
+	}
+	return r.exitCode, r.err
+}
+
+func (r *fakeRunner) Pause() error  { return r.pauseErr }
+func (r *fakeRunner) Resume() error { return nil }
+func (r *fakeRunner) Signal(sig os.Signal) error {
+	r.signals = append(r.signals, sig)
+	return nil
+}
+
+func (r *fakeRunner) PID() int { return r.pid }
+
+func (r *fakeRunner) Usage() executor.Usage { return executor.Usage{} }
+
+func TestRun_FakeRunner(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		err      error
+		want     int
+	}{
+		{name: "success", want: 0},
+		{
+			name:     "command exit code is passed through",
+			exitCode: 3,
+			err:      &executor.ExecError{Code: 3, Err: errors.New("exit status 3")},
+			want:     3,
+		},
+		{
+			name:     "command that cannot start",
+			exitCode: -1,
+			err:      errors.New("executable file not found"),
+			want:     locker.InternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MYLOCK_BACKEND", "memory")
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			defer logging.SetOutput(nil)
+
+			defer func(orig func() int) { geteuid = orig }(geteuid)
+			geteuid = func() int { return 1000 }
+
+			runner := &fakeRunner{exitCode: tt.exitCode, err: tt.err}
+			defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+			newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner {
+				runner.env = env
+				return runner
+			}
+
+			got := run([]string{"mylock", "--lock-name", "fake-runner", "--timeout", "1", "--", "deploy", "--now"})
+			if got != tt.want {
+				t.Errorf("run() = %d, want %d (log %q)", got, tt.want, logs.String())
+			}
+			if strings.Join(runner.command, " ") != "deploy --now" {
+				t.Errorf("runner got command %q, want deploy --now", runner.command)
+			}
+			if len(runner.env) == 0 || !strings.HasPrefix(runner.env[0], "MYLOCK_CONNECTION_ID=") {
+				t.Errorf("runner env = %q, want MYLOCK_CONNECTION_ID", runner.env)
+			}
+		})
+	}
+}
+
+func TestRun_StatusFile(t *testing.T) {
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 1000 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+
+	path := filepath.Join(t.TempDir(), "nightly.json")
+	readStatus := func() statusJSON {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		var status statusJSON
+		if err := json.Unmarshal(data, &status); err != nil {
+			t.Fatalf("status file %q: %v", data, err)
+		}
+		return status
+	}
+
+	var whileRunning statusJSON
+	runner := &fakeRunner{exitCode: 3, err: &executor.ExecError{Code: 3, Err: errors.New("exit status 3")}}
+	runner.onRun = func() { whileRunning = readStatus() }
+	newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner { return runner }
+
+	if got := run([]string{"mylock", "--lock-name", "nightly", "--timeout", "1", "--status-file", path, "--", "work"}); got != 3 {
+		t.Fatalf("run() = %d, want 3 (log %q)", got, logs.String())
+	}
+	if whileRunning.State != stateRunning || whileRunning.LockName != "nightly" || whileRunning.AcquiredAt == nil || whileRunning.ExitCode != nil {
+		t.Errorf("status while running = %+v, want running under nightly without an exit code", whileRunning)
+	}
+	done := readStatus()
+	if done.State != stateDone || done.ExitCode == nil || *done.ExitCode != 3 || done.RunID != whileRunning.RunID {
+		t.Errorf("final status = %+v, want done with exit code 3", done)
+	}
+}
+
+func TestRun_OnFailureHookOutputTail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook uses sh")
+	}
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 1000 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+
+	// Binary output with a NUL byte must not keep the hook from starting
+	runner := &fakeRunner{exitCode: 1, err: &executor.ExecError{Code: 1, Err: errors.New("exit status 1")}}
+	newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner {
+		runner.onRun = func() { stdout.Write([]byte("partial\x00record\n")) }
+		return runner
+	}
+	tail := filepath.Join(t.TempDir(), "tail")
+	hook := `printf %s "$MYLOCK_OUTPUT_TAIL" > ` + tail
+
+	if got := run([]string{"mylock", "--lock-name", "tail", "--timeout", "1", "--on-failure-hook", hook, "--", "work"}); got != 1 {
+		t.Fatalf("run() = %d, want 1 (log %q)", got, logs.String())
+	}
+	data, err := os.ReadFile(tail)
+	if err != nil {
+		t.Fatalf("on-failure hook did not run: %v (log %q)", err, logs.String())
+	}
+	if string(data) != "partialrecord\n" {
+		t.Errorf("MYLOCK_OUTPUT_TAIL = %q, want %q", data, "partialrecord\n")
+	}
+}
+
+func TestLostHandler_ReacquireCannotPause(t *testing.T) {
+	// The command would run on without the lock while it is reacquired
+	runner := &fakeRunner{pauseErr: errors.New("operation not permitted")}
+	onLost := lostHandler(cli.LostPolicyReacquire, nil, runner, "nightly", 5)
+	if err := onLost(context.Background(), locker.ErrLockLost); err == nil {
+		t.Error("reacquire handler succeeded although the command could not be paused")
+	}
+}
+
+func TestWithLostHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook uses sh")
+	}
+	out := filepath.Join(t.TempDir(), "lost")
+	hook := `printf '%s %s' "$MYLOCK_LOCK_NAME" "$MYLOCK_LOST_REASON" > ` + out
+	lost := errors.New("session closed")
+
+	// Without a policy handler the lost lock stops the command after the hook
+	if err := withLostHook(nil, hook, "MYLOCK_LOCK_NAME=nightly")(context.Background(), lost); err != lost {
+		t.Errorf("handler error = %v, want %v", err, lost)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("on-lock-lost hook did not run: %v", err)
+	}
+	if string(data) != "nightly session closed" {
+		t.Errorf("hook saw %q, want %q", data, "nightly session closed")
+	}
+
+	// The policy handler runs once the hook is done
+	os.Remove(out)
+	var hookDone bool
+	next := func(ctx context.Context, err error) error {
+		_, statErr := os.Stat(out)
+		hookDone = statErr == nil
+		return nil
+	}
+	if err := withLostHook(next, hook, "MYLOCK_LOCK_NAME=nightly")(context.Background(), lost); err != nil {
+		t.Errorf("handler error = %v, want the policy's nil", err)
+	}
+	if !hookDone {
+		t.Error("policy handler ran before the on-lock-lost hook")
+	}
+}
+
+func TestRunRunOne_GivesUpAtOnce(t *testing.T) {
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 1000 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+	runner := &fakeRunner{}
+	newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner { return runner }
+
+	other := locker.NewMemoryLocker()
+	defer other.Close()
+	name := cli.RunOneLockName(currentUser(), []string{"report"})
+	if acquired, err := other.TryLock(context.Background(), name); err != nil || !acquired {
+		t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+
+	// --timeout 0 must not wait the one second GET_LOCK takes at least
+	start := time.Now()
+	if got := runRunOne("mylock", []string{"report"}); got != locker.LockTimeout {
+		t.Errorf("runRunOne() = %d while the command runs elsewhere, want %d (log %q)", got, locker.LockTimeout, logs.String())
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("runRunOne() gave up after %s, want at once", elapsed)
+	}
+	if runner.command != nil {
+		t.Errorf("runner ran %q while the lock was held", runner.command)
+	}
+}
+
+func TestRun_CompatNoWait(t *testing.T) {
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 1000 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+	runner := &fakeRunner{}
+	newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner { return runner }
+
+	other := locker.NewMemoryLocker()
+	defer other.Close()
+	if acquired, err := other.TryLock(context.Background(), cli.CompatLockName("/var/lock/report")); err != nil || !acquired {
+		t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+
+	// setlock -n and lckdo without -w fail at once on a busy lock
+	for _, args := range [][]string{
+		{"mylock", "--compat", "setlock", "-n", "/var/lock/report", "work"},
+		{"mylock", "--compat", "lckdo", "/var/lock/report", "work"},
+	} {
+		start := time.Now()
+		if got := run(args); got != locker.LockTimeout {
+			t.Errorf("run(%q) = %d, want %d (log %q)", args, got, locker.LockTimeout, logs.String())
+		}
+		if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+			t.Errorf("run(%q) gave up after %s, want at once", args, elapsed)
+		}
+	}
+	if runner.command != nil {
+		t.Errorf("runner ran %q while the lock was held", runner.command)
+	}
+}
+
+func TestRun_IfFree(t *testing.T) {
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 1000 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	importer := locker.NewMemoryLocker()
+	defer importer.Close()
+
+	for _, busy := range []bool{false, true} {
+		if busy {
+			if acquired, err := importer.TryLock(context.Background(), "importer"); err != nil || !acquired {
+				t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+			}
+		}
+		var logs bytes.Buffer
+		logging.SetOutput(&logs)
+		runner := &fakeRunner{}
+		newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner { return runner }
+
+		got := run([]string{"mylock", "--lock-name", "cleanup", "--timeout", "1", "--if-free", "importer", "--", "cleanup"})
+		logging.SetOutput(nil)
+		if got != 0 {
+			t.Errorf("run() with importer busy=%v = %d, want 0 (log %q)", busy, got, logs.String())
+		}
+		if ran := runner.command != nil; ran == busy {
+			t.Errorf("command ran = %v with importer busy=%v (log %q)", ran, busy, logs.String())
+		}
+		if busy && !strings.Contains(logs.String(), "Skipping: lock 'importer'") {
+			t.Errorf("log = %q, want the skip explained", logs.String())
+		}
+	}
+}
+
+func TestRun_Claim(t *testing.T) {
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 1000 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	ctx := context.Background()
+	other := locker.NewMemoryLocker()
+	defer other.Close()
+	if acquired, err := other.TryLock(ctx, "claim-0"); err != nil || !acquired {
+		t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+	runner := &fakeRunner{}
+	newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner {
+		runner.env = env
+		return runner
+	}
+
+	if got := run([]string{"mylock", "--claim", "claim-{0..2}", "--timeout", "1", "--", "work"}); got != 0 {
+		t.Fatalf("run() = %d, want 0 (log %q)", got, logs.String())
+	}
+	if !slices.Contains(runner.env, "MYLOCK_SLOT=1") {
+		t.Errorf("runner env = %q, want MYLOCK_SLOT=1", runner.env)
+	}
+	if acquired, err := other.TryLock(ctx, "claim-1"); err != nil || !acquired {
+		t.Errorf("TryLock(claim-1) = (%v, %v) after the run, want the claimed lock released", acquired, err)
+	}
+
+	// With every slot held, the run gives up after --timeout
+	if acquired, err := other.TryLock(ctx, "claim-2"); err != nil || !acquired {
+		t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+	if got := run([]string{"mylock", "--claim", "claim-{0..2}", "--timeout", "1", "--", "work"}); got != locker.LockTimeout {
+		t.Errorf("run() with every slot held = %d, want %d", got, locker.LockTimeout)
+	}
+}
+
+func TestRun_RefusesRoot(t *testing.T) {
+	t.Setenv("MYLOCK_BACKEND", "memory")
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	geteuid = func() int { return 0 }
+	defer func(orig func([]string, io.Writer, io.Writer) executor.CommandRunner) { newRunner = orig }(newRunner)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantRun bool
+	}{
+		{name: "root without --allow-root", args: []string{"--lock-name", "root-check", "--timeout", "1", "--", "deploy"}},
+		{name: "root with --allow-root", args: []string{"--lock-name", "root-check", "--timeout", "1", "--allow-root", "--", "deploy"}, wantRun: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			defer logging.SetOutput(nil)
+
+			runner := &fakeRunner{}
+			newRunner = func(env []string, stdout, stderr io.Writer) executor.CommandRunner { return runner }
+
+			got := run(append([]string{"mylock"}, tt.args...))
+			if ran := runner.command != nil; ran != tt.wantRun {
+				t.Errorf("command ran = %v, want %v (log %q)", ran, tt.wantRun, logs.String())
+			}
+			if !tt.wantRun && (got != locker.InternalError || !strings.Contains(logs.String(), "--allow-root")) {
+				t.Errorf("run() = %d with log %q, want %d naming --allow-root", got, logs.String(), locker.InternalError)
+			}
+		})
+	}
+}
+
+func TestWrapCommand(t *testing.T) {
+	command, env, err := wrapCommand([]string{"backup", "--full"}, &childSetup{Chroot: "/srv/job", Sandbox: true, AllowPaths: []string{"/usr", "/var/backup"}})
+	if err != nil {
+		t.Fatalf("wrapCommand() error = %v", err)
+	}
+	self, _ := os.Executable()
+	if want := []string{self, "backup", "--full"}; !reflect.DeepEqual(command, want) {
+		t.Errorf("command = %q, want %q", command, want)
+	}
+	want := envChildSetup + `={"chroot":"/srv/job","sandbox":true,"allow_paths":["/usr","/var/backup"]}`
+	if env != want {
+		t.Errorf("env = %q, want %q", env, want)
+	}
+
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+	if got := runChildSetup("not json", []string{"backup"}); got != locker.InternalError {
+		t.Errorf("runChildSetup() with a bad spec = %d, want %d", got, locker.InternalError)
+	}
+}
+
+func TestNewChildSetup(t *testing.T) {
+	defer func(orig func() int) { geteuid = orig }(geteuid)
+	dir := t.TempDir()
+
+	geteuid = func() int { return 1000 }
+	if setup, err := newChildSetup(cli.CLI{}); setup != nil || err != nil {
+		t.Errorf("newChildSetup() without options = %v, %v, want nil", setup, err)
+	}
+	if _, err := newChildSetup(cli.CLI{Chroot: dir}); err == nil {
+		t.Error("newChildSetup() with --chroot as a regular user succeeded, want an error")
+	}
+
+	adj := 500
+	setup, err := newChildSetup(cli.CLI{OOMScoreAdj: &adj})
+	if runtime.GOOS == "linux" && (err != nil || setup == nil || *setup.OOMScoreAdj != adj) {
+		t.Errorf("newChildSetup() with --oom-score-adj = %v, %v, want oom_score_adj %d", setup, err, adj)
+	}
+
+	setup, err = newChildSetup(cli.CLI{CoreLimit: "512M"})
+	if runtime.GOOS == "linux" && (err != nil || setup == nil || *setup.CoreLimit != 512<<20) {
+		t.Errorf("newChildSetup() with --core-limit = %v, %v, want core limit %d", setup, err, 512<<20)
+	}
+
+	geteuid = func() int { return 0 }
+	setup, err = newChildSetup(cli.CLI{Chroot: dir})
+	if err != nil || setup == nil || setup.Chroot != dir {
+		t.Errorf("newChildSetup() with --chroot as root = %v, %v, want chroot %s", setup, err, dir)
+	}
+	if _, err := newChildSetup(cli.CLI{Chroot: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("newChildSetup() with a missing --chroot directory succeeded, want an error")
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return time.Date(2024, 3, 1, c.Hour(), c.Minute(), 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		cliArgs  cli.CLI
+		now      time.Time
+		wantCode int
+		wantSkip bool
+	}{
+		{name: "no window", now: at("12:00")},
+		{name: "inside --only-between", cliArgs: cli.CLI{OnlyBetween: "01:00-05:00/UTC"}, now: at("03:00")},
+		{name: "outside --only-between", cliArgs: cli.CLI{OnlyBetween: "01:00-05:00/UTC", WindowExitCode: 3}, now: at("05:00"), wantCode: 3, wantSkip: true},
+		{name: "inside --not-between", cliArgs: cli.CLI{NotBetween: "22:00-02:00/UTC"}, now: at("23:30"), wantSkip: true},
+		{name: "outside --not-between", cliArgs: cli.CLI{NotBetween: "22:00-02:00/UTC"}, now: at("02:00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWindow(tt.cliArgs, tt.now)
+			var outside *windowError
+			if skipped := errors.As(err, &outside); skipped != tt.wantSkip {
+				t.Fatalf("checkWindow() = %v, want skip %v", err, tt.wantSkip)
+			}
+			if outside != nil && outside.code != tt.wantCode {
+				t.Errorf("code = %d, want %d", outside.code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkPreconditions(cli.CLI{RequireFreeDisk: "1K", FreeDiskPath: dir}); err != nil {
+		t.Errorf("checkPreconditions(1K free) = %v, want nil", err)
+	}
+	err := checkPreconditions(cli.CLI{RequireFreeDisk: "16384T", FreeDiskPath: dir})
+	if !errors.Is(err, errPrecondition) {
+		t.Errorf("checkPreconditions(16384T free) = %v, want errPrecondition", err)
+	}
+	err = checkPreconditions(cli.CLI{RequireFreeDisk: "1K", FreeDiskPath: filepath.Join(dir, "missing")})
+	if err == nil || errors.Is(err, errPrecondition) {
+		t.Errorf("checkPreconditions(missing path) = %v, want a measurement error", err)
+	}
+
+	if runtime.GOOS == "linux" {
+		if err := checkPreconditions(cli.CLI{RequireMaxLoad: 1e9}); err != nil {
+			t.Errorf("checkPreconditions(max load 1e9) = %v, want nil", err)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512B", 1536: "1.5K", 10 << 30: "10.0G"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestWaitLocksFree(t *testing.T) {
+	ctx := context.Background()
+	holder := locker.NewMemoryLocker()
+	defer holder.Close()
+	if acquired, err := holder.TryLock(ctx, "after-load"); err != nil || !acquired {
+		t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+
+	lock := locker.NewMemoryLocker()
+	defer lock.Close()
+	if code := waitLocksFree(ctx, lock, []string{"after-extract"}, time.Now().Add(time.Second)); code != 0 {
+		t.Errorf("waitLocksFree(free lock) = %d, want 0", code)
+	}
+	if code := waitLocksFree(ctx, lock, []string{"after-extract", "after-load"}, time.Now().Add(time.Second)); code != locker.LockTimeout {
+		t.Errorf("waitLocksFree(held lock) = %d, want %d", code, locker.LockTimeout)
+	}
+	if acquired, err := lock.TryLock(ctx, "after-extract"); err != nil || !acquired {
+		t.Errorf("lock 'after-extract' was taken by waitLocksFree()")
+	}
+}
+
+// fakeHolders answers holderLookup from fixed tables
+type fakeHolders struct {
+	holders map[string]int64
+	runs    map[int64]string
+}
+
+func (f fakeHolders) LockHolder(ctx context.Context, lockName string) (int64, error) {
+	return f.holders[lockName], nil
+}
+
+func (f fakeHolders) SessionRunID(ctx context.Context, connID int64) (string, error) {
+	return f.runs[connID], nil
+}
+
+func TestCheckLockHeld(t *testing.T) {
+	lookup := fakeHolders{
+		holders: map[string]int64{"nightly": 42, "adhoc": 43},
+		runs:    map[int64]string{42: "run-a"},
+	}
+	tests := []struct {
+		name        string
+		lockName    string
+		runID       string
+		wantNotHeld bool
+	}{
+		{name: "held by any run", lockName: "nightly"},
+		{name: "held by the run", lockName: "nightly", runID: "run-a"},
+		{name: "held by another run", lockName: "nightly", runID: "run-b", wantNotHeld: true},
+		{name: "held outside mylock", lockName: "adhoc", runID: "run-a", wantNotHeld: true},
+		{name: "free", lockName: "weekly", wantNotHeld: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLockHeld(context.Background(), lookup, tt.lockName, tt.runID)
+			if notHeld := errors.Is(err, errNotHeld); notHeld != tt.wantNotHeld || (err != nil && !notHeld) {
+				t.Errorf("checkLockHeld() = %v, want not held %v", err, tt.wantNotHeld)
+			}
+		})
+	}
+}
+
+func TestScheduleRuns(t *testing.T) {
+	sched, err := schedule.Parse("*/5 * * * *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	fake := clock.NewFake(time.Date(2024, 3, 13, 10, 7, 0, 0, time.UTC))
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan time.Time)
+	done := make(chan error)
+	go func() {
+		done <- scheduleRuns(ctx, sched, 0, fake, func() { started <- fake.Now() })
+	}()
+
+	for _, want := range []time.Time{
+		time.Date(2024, 3, 13, 10, 10, 0, 0, time.UTC),
+		time.Date(2024, 3, 13, 10, 15, 0, 0, time.UTC),
+	} {
+		fake.BlockUntil(1)
+		fake.Advance(want.Sub(fake.Now()) - time.Second)
+		select {
+		case at := <-started:
+			t.Fatalf("run started at %v, before %v", at, want)
+		default:
+		}
+		fake.Advance(time.Second)
+		if at := <-started; !at.Equal(want) {
+			t.Errorf("run started at %v, want %v", at, want)
+		}
+	}
+
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("scheduleRuns() = %v after cancel, want nil", err)
+	}
+
+	never, _ := schedule.Parse("0 0 30 2 *")
+	if err := scheduleRuns(context.Background(), never, 0, fake, func() {}); err == nil {
+		t.Error("scheduleRuns() of a schedule that never fires succeeded")
+	}
+}
+
+func TestWatchStall(t *testing.T) {
+	logging.SetOutput(io.Discard)
+	defer logging.SetOutput(nil)
+
+	// Output pushes the deadline back; silence then kills the command
+	fake := clock.NewFake(time.Now())
+	activity := newOutputActivity(fake)
+	runner := &fakeRunner{}
+	w := watchStall(context.Background(), activity, time.Minute, nil, runner)
+	fake.BlockUntil(1)
+	fake.Advance(30 * time.Second)
+	activity.wrap(io.Discard).Write([]byte("still working\n"))
+	fake.Advance(30 * time.Second)
+	fake.BlockUntil(1)
+	if w.Stalled() {
+		t.Fatal("Stalled() = true before the command was silent for the timeout")
+	}
+	fake.Advance(30 * time.Second)
+	<-w.ctx.Done()
+	if !w.Stalled() {
+		t.Error("Stalled() = false after the command was silent for the timeout")
+	}
+	if len(runner.signals) != 0 {
+		t.Errorf("signals = %v without --stall-signal", runner.signals)
+	}
+	w.Stop()
+
+	// With a signal, the command gets another timeout before it is killed
+	activity = newOutputActivity(fake)
+	w = watchStall(context.Background(), activity, time.Minute, os.Interrupt, runner)
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	fake.BlockUntil(1)
+	if len(runner.signals) != 1 || runner.signals[0] != os.Interrupt {
+		t.Fatalf("signals = %v, want [%v]", runner.signals, os.Interrupt)
+	}
+	if w.Stalled() {
+		t.Fatal("Stalled() = true right after the signal")
+	}
+	fake.Advance(time.Minute)
+	<-w.ctx.Done()
+	if !w.Stalled() {
+		t.Error("Stalled() = false after the command ignored the signal")
+	}
+	w.Stop()
+
+	// Stopping a quiet watch does not count as a stall
+	w = watchStall(context.Background(), newOutputActivity(fake), time.Minute, nil, runner)
+	w.Stop()
+	if w.Stalled() {
+		t.Error("Stalled() = true after Stop()")
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC))
+	status := newRunStatus(fake, "nightly")
+	fake.Advance(90 * time.Second)
+	if got, want := status.String(), "waiting for lock 'nightly' for 1m30s"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	status.acquired("nightly")
+	runner := &fakeRunner{pid: 4242}
+	status.running(runner)
+	fake.Advance(5 * time.Minute)
+	if got, want := status.String(), "holding lock 'nightly' for 5m0s, the command is running as PID 4242 for 5m0s"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	runner.pid = 0
+	if got, want := status.String(), "holding lock 'nightly' for 5m0s, waiting to retry the command"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	status.finished()
+	if got, want := status.String(), "holding lock 'nightly' for 5m0s, the command is not running"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestHoldLock(t *testing.T) {
+	var logs bytes.Buffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(nil)
+
+	lock := locker.NewMemoryLocker()
+	clk := clock.NewFake(time.Now())
+	done := make(chan error, 1)
+	go func() {
+		done <- holdLock(context.Background(), lock, "maintenance", 1, 2*time.Hour, clk)
+	}()
+
+	other := locker.NewMemoryLocker()
+	clk.BlockUntil(1)
+	if ok, _ := other.TryLock(context.Background(), "maintenance"); ok {
+		t.Fatal("TryLock() succeeded while the lock is held")
+	}
+	clk.Advance(2 * time.Hour)
+	if err := <-done; err != nil {
+		t.Fatalf("holdLock() error = %v", err)
+	}
+	if ok, _ := other.TryLock(context.Background(), "maintenance"); !ok {
+		t.Error("TryLock() failed after the hold ended")
+	}
+	other.ReleaseLock(context.Background(), "maintenance")
+
+	// Without a duration the lock is held until the context ends
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- holdLock(ctx, locker.NewMemoryLocker(), "maintenance", 1, 0, clk)
+	}()
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("holdLock() error = %v, want nil or context.Canceled", err)
+	}
+}
+
+func TestWriteBlocks(t *testing.T) {
+	blocks := []locker.Block{
+		{LockName: "nightly-report", Reason: "disk swap", SetBy: "ops@host1", Age: 90 * time.Second, Remaining: time.Hour},
+		{LockName: "reindex", SetBy: "ops@host2", Age: time.Minute},
+	}
+
+	var out bytes.Buffer
+	if err := writeBlocks(&out, blocks, false); err != nil {
+		t.Fatalf("writeBlocks() error = %v", err)
+	}
+	want := "nightly-report                   set by ops@host1 1m30s ago, expires in 1h0m0s: disk swap\n" +
+		"reindex                          set by ops@host2 1m0s ago\n"
+	if out.String() != want {
+		t.Errorf("writeBlocks() = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeBlocks(&out, nil, true); err != nil {
+		t.Fatalf("writeBlocks() error = %v", err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("writeBlocks() of no blocks as JSON = %q, want []", out.String())
+	}
+	out.Reset()
+	if err := writeBlocks(&out, blocks[:1], true); err != nil {
+		t.Fatalf("writeBlocks() error = %v", err)
+	}
+	wantJSON := `[{"lock_name":"nightly-report","reason":"disk swap","set_by":"ops@host1","age_seconds":90,"remaining_seconds":3600}]` + "\n"
+	if out.String() != wantJSON {
+		t.Errorf("writeBlocks() as JSON = %q, want %q", out.String(), wantJSON)
+	}
+}
+
+func TestWriteSnapshot_JSON(t *testing.T) {
+	s := locker.Snapshot{
+		Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version: "8.0.36",
+		Held:    []locker.HeldLock{{Name: "nightly", ConnectionID: 42, Owner: "cron@10.0.0.5"}},
+		Waiting: []locker.LockWaiter{{ConnectionID: 43, Waited: 12 * time.Second, LockName: "nightly", Host: "web1", Run: "3f2a"}},
+	}
+	var out bytes.Buffer
+	if err := writeSnapshot(&out, s, "", true); err != nil {
+		t.Fatalf("writeSnapshot() error = %v", err)
+	}
+
+	want := `{"time":"2026-01-02T03:04:05Z","version":"8.0.36",` +
+		`"held":[{"name":"nightly","connection_id":42,"owner":"cron@10.0.0.5"}],` +
+		`"waiting":[{"connection_id":43,"waited_seconds":12,"lock_name":"nightly","host":"web1","run_id":"3f2a"}],` +
+		`"dedupe":[],"errors":[]}` + "\n"
+	if out.String() != want {
+		t.Errorf("writeSnapshot() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestCommandExitCode(t *testing.T) {
+	for _, code := range []int{0, 1, 199, 200, 205, 209, 210} {
+		if got := commandExitCode(code, ""); got != code {
+			t.Errorf("commandExitCode(%d) = %d, want it unchanged", code, got)
+		}
+	}
+}
+
+func TestLockNamePolicy(t *testing.T) {
+	tests := []struct {
+		args cli.CLI
+		want locker.LockNamePolicy
+	}{
+		{args: cli.CLI{}, want: locker.LockNamesSafe},
+		{args: cli.CLI{UnicodeLockName: true}, want: locker.LockNamesUnicode},
+		{args: cli.CLI{AllowAnyLockName: true, UnicodeLockName: true}, want: locker.LockNamesAny},
+	}
+	for _, tt := range tests {
+		if got := lockNamePolicy(tt.args); got != tt.want {
+			t.Errorf("lockNamePolicy(%+v) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestValidateConfig_LockNamePolicy(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_PASSWORD", "testpass")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	tests := []struct {
+		args    cli.ConfigValidateCLI
+		wantErr bool
+	}{
+		{args: cli.ConfigValidateCLI{LockName: []string{"tenant:42"}}, wantErr: true},
+		{args: cli.ConfigValidateCLI{LockName: []string{"tenant:42"}, AllowAnyLockName: true}},
+		{args: cli.ConfigValidateCLI{LockName: []string{"caf\u00e9"}}, wantErr: true},
+		{args: cli.ConfigValidateCLI{LockName: []string{"cafe\u0301"}, UnicodeLockName: true}},
+	}
+	for _, tt := range tests {
+		if problems := validateConfig(tt.args); (len(problems) > 0) != tt.wantErr {
+			t.Errorf("validateConfig(%+v) = %q, wantErr %v", tt.args, problems, tt.wantErr)
+		}
+	}
+}
+
+func TestConnectionAttributes(t *testing.T) {
+	attrs := connectionAttributes("nightly", "3f2a")
+	want := map[string]string{
+		"program_name":     "mylock",
+		"mylock_version":   buildVersion(),
+		"mylock_lock_name": "nightly",
+		"mylock_run_id":    "3f2a",
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("connectionAttributes() = %v, want %v", attrs, want)
+	}
+	if attrs := connectionAttributes("", ""); len(attrs) != 2 {
+		t.Errorf("connectionAttributes() without a lock = %v, want only program_name and mylock_version", attrs)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+	"github.com/yammerjp/mylock/internal/notify"
+)
+
+// newMailer sets up --mail-to from the MYLOCK_SMTP_* settings
+func newMailer(to []string, from string) (*notify.Mailer, error) {
+	server, err := config.NewSMTPConfig()
+	if err != nil {
+		return nil, err
+	}
+	logging.AddSecret(server.Password)
+	if from == "" {
+		from = "mylock@" + hostname()
+	}
+	return &notify.Mailer{Server: server, From: from, To: to}, nil
+}
+
+// notifyFailure sends the failure to each configured notifier; a notifier
+// that fails only produces a warning
+func notifyFailure(ctx context.Context, mailer *notify.Mailer, pagerDuty *notify.PagerDuty, f notify.Failure) {
+	if mailer != nil {
+		if err := mailer.SendFailure(f); err != nil {
+			logging.Printc(logging.Yellow, "Warning: %v\n", err)
+		}
+	}
+	if pagerDuty != nil {
+		if err := pagerDuty.TriggerFailure(ctx, f); err != nil {
+			logging.Printc(logging.Yellow, "Warning: %v\n", err)
+		}
+	}
+}
+
+// failure describes a failed command for notifications
+func failure(lockName string, command []string, exitCode int, tail *executor.TailBuffer) notify.Failure {
+	f := notify.Failure{LockName: lockName, Command: command, ExitCode: exitCode, Host: hostname()}
+	if tail != nil {
+		f.OutputTail = tail.String()
+	}
+	return f
+}
+
+// hostname is this machine's name, or "localhost" if it is unknown
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
+
+// newEventPublisher sets up lifecycle events from MYLOCK_EVENTS_*, or
+// returns nil if they are not enabled
+func newEventPublisher() (*notify.NATS, error) {
+	cfg, err := config.NewEventsConfig()
+	if err != nil || cfg.NATSURL == nil {
+		return nil, err
+	}
+	if user := cfg.NATSURL.User; user != nil {
+		if password, ok := user.Password(); ok {
+			logging.AddSecret(password)
+		} else {
+			logging.AddSecret(user.Username())
+		}
+	}
+	return &notify.NATS{URL: cfg.NATSURL, Subject: cfg.Subject}, nil
+}
+
+func newEvent(kind, lockName string) notify.Event {
+	return notify.Event{Event: kind, LockName: lockName, Host: hostname(), Time: time.Now().UTC()}
+}
+
+// publishEvent sends e, with only a warning if that fails
+func publishEvent(ctx context.Context, events *notify.NATS, e notify.Event) {
+	if err := events.Publish(ctx, e); err != nil {
+		logging.Printc(logging.Yellow, "Warning: %v\n", err)
+	}
+}
+
+// publishOutcome sends the released event of an acquired lock, and a failed
+// event if mylock is exiting non-zero
+func publishOutcome(ctx context.Context, events *notify.NATS, lockName string, acquired bool, status int, summary runSummary) {
+	if acquired {
+		released := newEvent(notify.EventReleased, lockName)
+		released.ExitCode = &status
+		released.WaitSeconds = summary.Wait.Seconds()
+		released.RunSeconds = summary.Run.Seconds()
+		publishEvent(ctx, events, released)
+	}
+	if status == 0 {
+		return
+	}
+
+	failed := newEvent(notify.EventFailed, lockName)
+	failed.ExitCode = &status
+	failed.WaitSeconds = summary.Wait.Seconds()
+	failed.RunSeconds = summary.Run.Seconds()
+	switch {
+	case !acquired && status == locker.LockTimeout:
+		failed.Reason = "timeout"
+	case status == locker.LockLost:
+		failed.Reason = "lock lost"
+	case acquired:
+		failed.Reason = "command"
+	default:
+		failed.Reason = "error"
+	}
+	publishEvent(ctx, events, failed)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/output"
+	"github.com/yammerjp/mylock/internal/progress"
+)
+
+// commandOutput returns the writers for the command's stdout and stderr
+// under --output-format, --merge-output and --strip-ansi, and a flush that
+// writes out their last partial lines once the command has exited
+func commandOutput(args cli.CLI, lockName, runID string) (stdout, stderr io.Writer, flush func()) {
+	var streams []*output.LineWriter
+	stream := func(sink *output.Sink, name string) io.Writer {
+		w := sink.Stream(name)
+		streams = append(streams, w)
+		return w
+	}
+	// formatFor strips escape sequences when --strip-ansi is set and f is
+	// not a terminal
+	formatFor := func(f *os.File, format output.FormatFunc) output.FormatFunc {
+		if args.StripANSI && !progress.IsTerminal(f) {
+			return output.StripANSI(format)
+		}
+		return format
+	}
+
+	switch {
+	case args.OutputFormat == cli.OutputFormatJSON:
+		sink := output.NewSink(os.Stdout, formatFor(os.Stdout, output.JSON(lockName, runID)))
+		stdout, stderr = stream(sink, "stdout"), stream(sink, "stderr")
+	case args.MergeOutput:
+		sink := output.NewSink(os.Stdout, formatFor(os.Stdout, output.Plain))
+		stdout, stderr = stream(sink, "stdout"), stream(sink, "stderr")
+	default:
+		// Streams that need no rewriting keep their file, so the command
+		// still sees a terminal
+		stdout, stderr = os.Stdout, os.Stderr
+		if args.StripANSI && !progress.IsTerminal(os.Stdout) {
+			stdout = stream(output.NewSink(os.Stdout, output.StripANSI(output.Plain)), "stdout")
+		}
+		if args.StripANSI && !progress.IsTerminal(os.Stderr) {
+			stderr = stream(output.NewSink(os.Stderr, output.StripANSI(output.Plain)), "stderr")
+		}
+	}
+	return stdout, stderr, func() {
+		for _, w := range streams {
+			_ = w.Flush()
+		}
+	}
+}
+
+// newRunID returns a random id for one mylock run
+func newRunID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
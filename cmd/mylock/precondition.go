@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/hostcheck"
+)
+
+// errPrecondition means the host does not meet a --require-* option, so the
+// run is skipped before it takes any lock
+var errPrecondition = errors.New("host precondition not met")
+
+// checkPreconditions measures the host against --require-free-disk and
+// --require-max-load. An error that does not wrap errPrecondition means a
+// measurement failed.
+func checkPreconditions(cliArgs cli.CLI) error {
+	if cliArgs.RequireFreeDisk != "" {
+		want, err := cli.ParseSize(cliArgs.RequireFreeDisk)
+		if err != nil {
+			return err
+		}
+		path := cliArgs.FreeDiskPath
+		if path == "" {
+			path = "."
+		}
+		free, err := hostcheck.FreeDisk(path)
+		if err != nil {
+			return fmt.Errorf("cannot check free disk space for --require-free-disk: %w", err)
+		}
+		if free < want {
+			return fmt.Errorf("%w: %s free on the filesystem of %s, --require-free-disk %s", errPrecondition, formatSize(free), path, cliArgs.RequireFreeDisk)
+		}
+	}
+	if cliArgs.RequireMaxLoad > 0 {
+		load, err := hostcheck.LoadAverage()
+		if err != nil {
+			return fmt.Errorf("cannot check the load average for --require-max-load: %w", err)
+		}
+		if load > cliArgs.RequireMaxLoad {
+			return fmt.Errorf("%w: load average %.2f is above --require-max-load %g", errPrecondition, load, cliArgs.RequireMaxLoad)
+		}
+	}
+	return nil
+}
+
+// formatSize writes a byte count in the largest unit of 1024 that keeps it
+// at 1 or more, e.g. 3.2G
+func formatSize(n uint64) string {
+	size := float64(n)
+	unit := ""
+	for _, u := range []string{"K", "M", "G", "T"} {
+		if size < 1024 {
+			break
+		}
+		size /= 1024
+		unit = u
+	}
+	if unit == "" {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.1f%s", size, unit)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// errNotHeld means the lock a helper requires is free or held by another run
+var errNotHeld = errors.New("lock is not held by the expected run")
+
+// holderLookup finds the session holding a lock and the run it belongs to
+type holderLookup interface {
+	LockHolder(ctx context.Context, lockName string) (int64, error)
+	SessionRunID(ctx context.Context, connID int64) (string, error)
+}
+
+// runRequireHeld implements "mylock require-lock-held"
+func runRequireHeld(args []string) int {
+	heldArgs, err := cli.ParseRequireHeldCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(heldArgs.Config.Password)
+	heldArgs.LockName = cli.FitLockName(heldArgs.LockName)
+
+	cfg, _, err := heldArgs.Config.Route(heldArgs.LockName, heldArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory {
+		logging.Printc(logging.Red, "Error: the memory backend cannot be observed from another process\n")
+		return locker.InternalError
+	}
+
+	cfg.ConnectionAttributes = connectionAttributes(heldArgs.LockName, "")
+	lock, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	err = checkLockHeld(context.Background(), lock, heldArgs.LockName, heldArgs.RunID)
+	lock.Close()
+	if errors.Is(err, errNotHeld) {
+		logging.Printc(logging.Red, "Refusing to run: %v\n", err)
+		return locker.LockLost
+	}
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+
+	_, err = newRunner(nil, os.Stdout, os.Stderr).ExecuteWithRetry(context.Background(), heldArgs.Command, 0, 0)
+	if err != nil {
+		if code := executor.GetExitCode(err); code >= 0 {
+			return code
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return 0
+}
+
+// checkLockHeld returns an error wrapping errNotHeld unless some session
+// holds lockName and, when runID is set, that session belongs to the run
+func checkLockHeld(ctx context.Context, lookup holderLookup, lockName, runID string) error {
+	holder, err := lookup.LockHolder(ctx, lockName)
+	if err != nil {
+		return err
+	}
+	if holder == 0 {
+		return fmt.Errorf("%w: lock '%s' is free", errNotHeld, lockName)
+	}
+	if runID == "" {
+		return nil
+	}
+	owner, err := lookup.SessionRunID(ctx, holder)
+	if err != nil {
+		return err
+	}
+	if owner != runID {
+		if owner == "" {
+			return fmt.Errorf("%w: lock '%s' is held by connection id %d, which is not mylock run %s", errNotHeld, lockName, holder, runID)
+		}
+		return fmt.Errorf("%w: lock '%s' is held by mylock run %s, not %s", errNotHeld, lockName, owner, runID)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/user"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runRunOne implements "mylock run-one" by rewriting it into a locked run
+func runRunOne(program string, args []string) int {
+	if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+		cli.PrintRunOneHelp()
+		return 0
+	}
+
+	translated, err := cli.RunOneArgs(args, currentUser())
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return run(append([]string{program}, translated...))
+}
+
+// currentUser is the invoking user's login name, or "" if it is unknown
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
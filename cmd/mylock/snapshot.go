@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// snapshotJSON is the "mylock snapshot --json" encoding of locker.Snapshot.
+// Lists are never null, so scrapers can iterate them unconditionally.
+type snapshotJSON struct {
+	Time    time.Time          `json:"time"`
+	Target  string             `json:"target,omitempty"`
+	Version string             `json:"version"`
+	Held    []heldLockJSON     `json:"held"`
+	Waiting []lockWaiterJSON   `json:"waiting"`
+	Dedupe  []dedupeRecordJSON `json:"dedupe"`
+	Errors  []string           `json:"errors"`
+}
+
+type heldLockJSON struct {
+	Name         string `json:"name"`
+	ConnectionID int64  `json:"connection_id"`
+	Owner        string `json:"owner,omitempty"`
+}
+
+type lockWaiterJSON struct {
+	ConnectionID  int64  `json:"connection_id"`
+	Owner         string `json:"owner,omitempty"`
+	WaitedSeconds int64  `json:"waited_seconds"`
+	LockName      string `json:"lock_name,omitempty"`
+	Host          string `json:"host,omitempty"`
+	RunID         string `json:"run_id,omitempty"`
+}
+
+type dedupeRecordJSON struct {
+	CommandHash string  `json:"command_hash"`
+	AgeSeconds  float64 `json:"age_seconds"`
+}
+
+// runSnapshot implements "mylock snapshot"
+func runSnapshot(args []string) int {
+	snapshotArgs, err := cli.ParseSnapshotCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(snapshotArgs.Config.Password)
+
+	cfg, target, err := snapshotArgs.Config.Route(snapshotArgs.LockName, snapshotArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory {
+		logging.Printc(logging.Red, "Error: the memory backend cannot be observed from another process\n")
+		return locker.InternalError
+	}
+
+	cfg.ConnectionAttributes = connectionAttributes("", "")
+	lock, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	defer lock.Close()
+
+	snapshot := lock.Snapshot(context.Background())
+	if err := writeSnapshot(os.Stdout, snapshot, target, snapshotArgs.JSON); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return 0
+}
+
+// writeSnapshot prints s as sections of aligned lines, or as JSON
+func writeSnapshot(w io.Writer, s locker.Snapshot, target string, asJSON bool) error {
+	if asJSON {
+		doc := snapshotJSON{
+			Time:    s.Time,
+			Target:  target,
+			Version: s.Version,
+			Held:    []heldLockJSON{},
+			Waiting: []lockWaiterJSON{},
+			Dedupe:  []dedupeRecordJSON{},
+			Errors:  []string{},
+		}
+		for _, h := range s.Held {
+			doc.Held = append(doc.Held, heldLockJSON{Name: h.Name, ConnectionID: h.ConnectionID, Owner: h.Owner})
+		}
+		for _, wt := range s.Waiting {
+			doc.Waiting = append(doc.Waiting, lockWaiterJSON{
+				ConnectionID:  wt.ConnectionID,
+				Owner:         wt.Owner,
+				WaitedSeconds: int64(wt.Waited / time.Second),
+				LockName:      wt.LockName,
+				Host:          wt.Host,
+				RunID:         wt.Run,
+			})
+		}
+		for _, r := range s.Dedupe {
+			doc.Dedupe = append(doc.Dedupe, dedupeRecordJSON{CommandHash: r.CommandHash, AgeSeconds: r.Age.Seconds()})
+		}
+		doc.Errors = append(doc.Errors, s.Errors...)
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	fmt.Fprintf(w, "time:    %s\nversion: %s\n", s.Time.Format(time.RFC3339), s.Version)
+	fmt.Fprintf(w, "held locks: %d\n", len(s.Held))
+	for _, h := range s.Held {
+		fmt.Fprintf(w, "  %-32s connection %d %s\n", h.Name, h.ConnectionID, h.Owner)
+	}
+	fmt.Fprintf(w, "waiting: %d\n", len(s.Waiting))
+	for _, wt := range s.Waiting {
+		name := wt.LockName
+		if name == "" {
+			name = "(unknown)"
+		}
+		fmt.Fprintf(w, "  %-32s connection %d %s for %s", name, wt.ConnectionID, wt.Owner, wt.Waited)
+		if wt.Host != "" {
+			fmt.Fprintf(w, " host=%s run=%s", wt.Host, wt.Run)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "dedupe records: %d\n", len(s.Dedupe))
+	for _, r := range s.Dedupe {
+		fmt.Fprintf(w, "  %s succeeded %s ago\n", r.CommandHash, r.Age.Round(time.Second))
+	}
+	for _, e := range s.Errors {
+		fmt.Fprintf(w, "error: %s\n", e)
+	}
+	return nil
+}
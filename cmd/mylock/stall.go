@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// errStalled means --stall-timeout killed a command that stopped writing output
+var errStalled = errors.New("the command produced no output")
+
+// outputActivity records when the command last wrote to stdout or stderr
+type outputActivity struct {
+	clk  clock.Clock
+	last atomic.Int64
+}
+
+func newOutputActivity(clk clock.Clock) *outputActivity {
+	a := &outputActivity{clk: clk}
+	a.touch()
+	return a
+}
+
+func (a *outputActivity) touch() {
+	a.last.Store(a.clk.Now().UnixNano())
+}
+
+func (a *outputActivity) lastOutput() time.Time {
+	return time.Unix(0, a.last.Load())
+}
+
+// wrap returns w, recording each write as activity
+func (a *outputActivity) wrap(w io.Writer) io.Writer {
+	return activityWriter{w: w, activity: a}
+}
+
+type activityWriter struct {
+	w        io.Writer
+	activity *outputActivity
+}
+
+func (w activityWriter) Write(p []byte) (int, error) {
+	w.activity.touch()
+	return w.w.Write(p)
+}
+
+// stallWatch kills the command once it has written nothing for a while
+type stallWatch struct {
+	// ctx is the context to run the command with
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// watchStall starts watching activity from now on. When the command has
+// written nothing for timeout, it is sent sig if that is set, and killed if
+// it stays silent for another timeout; without sig it is killed at once.
+func watchStall(ctx context.Context, activity *outputActivity, timeout time.Duration, sig os.Signal, runner executor.CommandRunner) *stallWatch {
+	cmdCtx, cancel := context.WithCancelCause(ctx)
+	w := &stallWatch{ctx: cmdCtx, cancel: cancel, done: make(chan struct{})}
+	activity.touch()
+
+	go func() {
+		defer close(w.done)
+		var signaledAt time.Time
+		for {
+			last := activity.lastOutput()
+			since := last
+			if signaledAt.After(since) {
+				since = signaledAt
+			}
+			if wait := timeout - activity.clk.Now().Sub(since); wait > 0 {
+				timer := activity.clk.NewTimer(wait)
+				select {
+				case <-cmdCtx.Done():
+					timer.Stop()
+					return
+				case <-timer.C():
+				}
+				continue
+			}
+
+			if sig != nil && !signaledAt.After(last) {
+				logging.Printc(logging.Yellow, "Warning: no output from the command for %s, sending %v\n", timeout, sig)
+				if err := runner.Signal(sig); err != nil {
+					logging.Printc(logging.Yellow, "Warning: %v\n", err)
+				}
+				signaledAt = activity.clk.Now()
+				continue
+			}
+			logging.Printc(logging.Red, "No output from the command for %s, killing it\n", timeout)
+			cancel(errStalled)
+			return
+		}
+	}()
+	return w
+}
+
+// Stop ends the watch; call it once the command has exited
+func (w *stallWatch) Stop() {
+	w.cancel(nil)
+	<-w.done
+}
+
+// Stalled reports whether the watch killed the command
+func (w *stallWatch) Stalled() bool {
+	return errors.Is(context.Cause(w.ctx), errStalled)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// States of a run in the --status-file
+const (
+	stateWaiting  = "waiting"
+	stateAcquired = "acquired"
+	stateRunning  = "running"
+	stateDone     = "done"
+)
+
+// runStatus tracks what a run is doing, for the report a status signal asks
+// for and the --status-file
+type runStatus struct {
+	clk clock.Clock
+
+	mu        sync.Mutex
+	state     string
+	lockName  string
+	waitStart time.Time
+	// heldSince is zero until the lock is held
+	heldSince time.Time
+	// runner is set while the command runs
+	runner   executor.CommandRunner
+	runStart time.Time
+	exitCode int
+
+	// path is the --status-file, empty when the status is not saved
+	path  string
+	runID string
+}
+
+func newRunStatus(clk clock.Clock, lockName string) *runStatus {
+	return &runStatus{clk: clk, state: stateWaiting, lockName: lockName, waitStart: clk.Now()}
+}
+
+// saveTo writes the status to path now and on every change of state
+func (s *runStatus) saveTo(path, runID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.runID = runID
+	s.save()
+}
+
+// acquired records that lockName is now held
+func (s *runStatus) acquired(lockName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = stateAcquired
+	s.lockName = lockName
+	s.heldSince = s.clk.Now()
+	s.save()
+}
+
+// running records that runner has started the command
+func (s *runStatus) running(runner executor.CommandRunner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = stateRunning
+	s.runner = runner
+	s.runStart = s.clk.Now()
+	s.save()
+}
+
+// finished records that the command has exited
+func (s *runStatus) finished() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runner = nil
+}
+
+// done records that the run is over and mylock exits with exitCode
+func (s *runStatus) done(exitCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = stateDone
+	s.runner = nil
+	s.exitCode = exitCode
+	s.save()
+}
+
+// statusJSON is the content of the --status-file
+type statusJSON struct {
+	State      string     `json:"state"`
+	LockName   string     `json:"lock_name"`
+	RunID      string     `json:"run_id"`
+	PID        int        `json:"pid"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	WaitStart  time.Time  `json:"wait_start"`
+	AcquiredAt *time.Time `json:"acquired_at,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+}
+
+// save replaces the --status-file with the current status; s.mu must be held
+func (s *runStatus) save() {
+	if s.path == "" {
+		return
+	}
+	status := statusJSON{
+		State:     s.state,
+		LockName:  s.lockName,
+		RunID:     s.runID,
+		PID:       os.Getpid(),
+		UpdatedAt: s.clk.Now(),
+		WaitStart: s.waitStart,
+	}
+	if !s.heldSince.IsZero() {
+		status.AcquiredAt = &s.heldSince
+	}
+	if !s.runStart.IsZero() {
+		status.StartedAt = &s.runStart
+	}
+	if s.state == stateDone {
+		status.ExitCode = &s.exitCode
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		logging.Printc(logging.Yellow, "Warning: %v\n", err)
+		return
+	}
+	if err := writeFileAtomic(s.path, append(data, '\n')); err != nil {
+		logging.Printc(logging.Yellow, "Warning: failed to write status file: %v\n", err)
+	}
+}
+
+// writeFileAtomic replaces path with data through a rename, so readers see
+// either the old content or the new, never a partial write
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *runStatus) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clk.Now()
+	if s.heldSince.IsZero() {
+		return fmt.Sprintf("waiting for lock '%s' for %s", s.lockName, now.Sub(s.waitStart).Round(time.Second))
+	}
+	held := fmt.Sprintf("holding lock '%s' for %s", s.lockName, now.Sub(s.heldSince).Round(time.Second))
+	if s.runner == nil {
+		return held + ", the command is not running"
+	}
+	pid := s.runner.PID()
+	if pid == 0 {
+		// Between --cmd-retries attempts
+		return held + ", waiting to retry the command"
+	}
+	return fmt.Sprintf("%s, the command is running as PID %d for %s", held, pid, now.Sub(s.runStart).Round(time.Second))
+}
+
+// reportStatusOnSignal logs status each time one of statusSignals arrives,
+// until the returned function is called
+func reportStatusOnSignal(status *runStatus) (stop func()) {
+	if len(statusSignals) == 0 {
+		return func() {}
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, statusSignals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigChan:
+				logging.Printf("Status: %s\n", status)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigChan)
+		close(done)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals ask a running mylock to report what it is doing
+var statusSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// statusSignals is empty on Windows, which has no SIGUSR1
+var statusSignals []os.Signal
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/executor"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runSummary is what --summary and --summary-json report once mylock is done
+type runSummary struct {
+	LockName string
+	Acquired bool
+	Wait     time.Duration
+	Run      time.Duration
+	ExitCode int
+	// Usage is the command's resource usage, set with --rusage
+	Usage *executor.Usage
+	// Pool is the MySQL connection pool statistics, nil for other backends
+	Pool *sql.DBStats
+}
+
+// summaryJSON is the --summary-json encoding of runSummary
+type summaryJSON struct {
+	LockName    string      `json:"lock_name"`
+	Acquired    bool        `json:"acquired"`
+	WaitSeconds float64     `json:"wait_seconds"`
+	RunSeconds  float64     `json:"run_seconds"`
+	ExitCode    int         `json:"exit_code"`
+	Rusage      *rusageJSON `json:"rusage,omitempty"`
+	Pool        *poolJSON   `json:"pool,omitempty"`
+}
+
+type rusageJSON struct {
+	UserSeconds   float64 `json:"user_seconds"`
+	SystemSeconds float64 `json:"system_seconds"`
+	MaxRSSBytes   int64   `json:"max_rss_bytes"`
+	MajorFaults   int64   `json:"major_faults"`
+	MinorFaults   int64   `json:"minor_faults"`
+}
+
+type poolJSON struct {
+	OpenConnections int     `json:"open_connections"`
+	InUse           int     `json:"in_use"`
+	Idle            int     `json:"idle"`
+	WaitCount       int64   `json:"wait_count"`
+	WaitSeconds     float64 `json:"wait_seconds"`
+}
+
+// print writes the summary to stderr as one line, or as a JSON object
+func (s runSummary) print(asJSON bool) {
+	if asJSON {
+		out := summaryJSON{
+			LockName:    s.LockName,
+			Acquired:    s.Acquired,
+			WaitSeconds: s.Wait.Seconds(),
+			RunSeconds:  s.Run.Seconds(),
+			ExitCode:    s.ExitCode,
+		}
+		if s.Usage != nil {
+			out.Rusage = &rusageJSON{
+				UserSeconds:   s.Usage.UserTime.Seconds(),
+				SystemSeconds: s.Usage.SystemTime.Seconds(),
+				MaxRSSBytes:   s.Usage.MaxRSS,
+				MajorFaults:   s.Usage.MajorFaults,
+				MinorFaults:   s.Usage.MinorFaults,
+			}
+		}
+		if s.Pool != nil {
+			out.Pool = &poolJSON{
+				OpenConnections: s.Pool.OpenConnections,
+				InUse:           s.Pool.InUse,
+				Idle:            s.Pool.Idle,
+				WaitCount:       s.Pool.WaitCount,
+				WaitSeconds:     s.Pool.WaitDuration.Seconds(),
+			}
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			logging.Printc(logging.Yellow, "Warning: failed to encode summary: %v\n", err)
+			return
+		}
+		logging.Printf("%s\n", data)
+		return
+	}
+
+	line := fmt.Sprintf("mylock summary: lock=%s acquired=%t wait=%.3fs run=%.3fs exit=%d",
+		s.LockName, s.Acquired, s.Wait.Seconds(), s.Run.Seconds(), s.ExitCode)
+	if s.Usage != nil {
+		line += fmt.Sprintf(" user=%.3fs sys=%.3fs maxrss=%dKB majflt=%d minflt=%d",
+			s.Usage.UserTime.Seconds(), s.Usage.SystemTime.Seconds(), s.Usage.MaxRSS/1024, s.Usage.MajorFaults, s.Usage.MinorFaults)
+	}
+	if s.Pool != nil {
+		line += fmt.Sprintf(" pool_open=%d pool_wait_count=%d pool_wait=%.3fs",
+			s.Pool.OpenConnections, s.Pool.WaitCount, s.Pool.WaitDuration.Seconds())
+	}
+	logging.Printf("%s\n", line)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// runWait implements "mylock wait"
+func runWait(args []string) int {
+	waitArgs, err := cli.ParseWaitCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(waitArgs.Config.Password)
+	waitArgs.LockName = cli.FitLockName(waitArgs.LockName)
+
+	cfg, _, err := waitArgs.Config.Route(waitArgs.LockName, waitArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory {
+		logging.Printc(logging.Red, "Error: the memory backend cannot be observed from another process\n")
+		return locker.InternalError
+	}
+
+	cfg.ConnectionAttributes = connectionAttributes(waitArgs.LockName, "")
+	lock, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	defer lock.Close()
+
+	free, err := lock.WaitFree(context.Background(), waitArgs.LockName, waitArgs.Timeout)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if !free {
+		logging.Printc(logging.Yellow, "Lock '%s' is still held after %d seconds\n", waitArgs.LockName, waitArgs.Timeout)
+		return locker.LockTimeout
+	}
+	return 0
+}
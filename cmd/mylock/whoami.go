@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yammerjp/mylock/internal/cli"
+	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/locker"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// identityJSON is the "mylock whoami --json" encoding of locker.Identity
+type identityJSON struct {
+	User         string `json:"user"`
+	CurrentUser  string `json:"current_user"`
+	Hostname     string `json:"hostname"`
+	RemoteAddr   string `json:"remote_addr,omitempty"`
+	Version      string `json:"version"`
+	ConnectionID int64  `json:"connection_id"`
+	Database     string `json:"database"`
+	TLS          bool   `json:"tls"`
+	TLSVersion   string `json:"tls_version,omitempty"`
+	TLSCipher    string `json:"tls_cipher,omitempty"`
+}
+
+// runWhoami implements "mylock whoami"
+func runWhoami(args []string) int {
+	whoamiArgs, err := cli.ParseWhoamiCLI(args)
+	if err != nil {
+		if helpRequested(args) {
+			return 0
+		}
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	logging.AddSecret(whoamiArgs.Config.Password)
+
+	cfg, target, err := whoamiArgs.Config.Route(whoamiArgs.LockName, whoamiArgs.Target)
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if cfg.Backend == config.BackendMemory {
+		logging.Printc(logging.Red, "Error: the memory backend has no server to connect to\n")
+		return locker.InternalError
+	}
+	if target != "" {
+		logging.Debugf("connecting to target %s", target)
+	}
+
+	cfg.ConnectionAttributes = connectionAttributes("", "")
+	lock, err := locker.NewLocker(cfg.DSN())
+	if err != nil {
+		logging.Printc(logging.Red, "Failed to connect to MySQL: %v\n", err)
+		return locker.InternalError
+	}
+	defer lock.Close()
+
+	id, err := lock.Identity(context.Background())
+	if err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	if err := writeIdentity(os.Stdout, id, whoamiArgs.JSON); err != nil {
+		logging.Printc(logging.Red, "Error: %v\n", err)
+		return locker.InternalError
+	}
+	return 0
+}
+
+// writeIdentity prints id as aligned "key: value" lines, or as JSON
+func writeIdentity(w io.Writer, id locker.Identity, asJSON bool) error {
+	tls := id.TLSCipher != ""
+	if asJSON {
+		data, err := json.Marshal(identityJSON{
+			User:         id.User,
+			CurrentUser:  id.CurrentUser,
+			Hostname:     id.Hostname,
+			RemoteAddr:   id.RemoteAddr,
+			Version:      id.Version,
+			ConnectionID: id.ConnectionID,
+			Database:     id.Database,
+			TLS:          tls,
+			TLSVersion:   id.TLSVersion,
+			TLSCipher:    id.TLSCipher,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	user := id.User
+	if id.CurrentUser != "" && id.CurrentUser != id.User {
+		user += fmt.Sprintf(" (authenticated as %s)", id.CurrentUser)
+	}
+	host := id.Hostname
+	if id.RemoteAddr != "" {
+		host += fmt.Sprintf(" (%s)", id.RemoteAddr)
+	}
+	database := id.Database
+	if database == "" {
+		database = "(none)"
+	}
+	tlsStatus := "disabled"
+	if tls {
+		tlsStatus = fmt.Sprintf("%s %s", id.TLSVersion, id.TLSCipher)
+	}
+
+	_, err := fmt.Fprintf(w, "user:          %s\nhost:          %s\nversion:       %s\nconnection id: %d\ndatabase:      %s\ntls:           %s\n",
+		user, host, id.Version, id.ConnectionID, database, tlsStatus)
+	return err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/cli"
+)
+
+// windowError means the run is outside its allowed time window, so the
+// command is skipped and mylock exits with code
+type windowError struct {
+	code   int
+	reason string
+}
+
+func (e *windowError) Error() string {
+	return e.reason
+}
+
+// checkWindow returns a *windowError if now is outside --only-between or
+// inside --not-between. The windows were validated by cli.ParseCLI.
+func checkWindow(cliArgs cli.CLI, now time.Time) error {
+	if cliArgs.OnlyBetween != "" {
+		w, err := cli.ParseTimeWindow(cliArgs.OnlyBetween)
+		if err == nil && !w.Contains(now) {
+			return &windowError{cliArgs.WindowExitCode, fmt.Sprintf("it is %s, outside --only-between %s", now.In(w.Location).Format("15:04 MST"), w)}
+		}
+	}
+	if cliArgs.NotBetween != "" {
+		w, err := cli.ParseTimeWindow(cliArgs.NotBetween)
+		if err == nil && w.Contains(now) {
+			return &windowError{cliArgs.WindowExitCode, fmt.Sprintf("it is %s, inside --not-between %s", now.In(w.Location).Format("15:04 MST"), w)}
+		}
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ toolchain go1.23.5
 require (
 	github.com/alecthomas/kong v1.12.0
 	github.com/go-sql-driver/mysql v1.9.3
+	golang.org/x/text v0.22.0
 )
 
 require filippo.io/edwards25519 v1.1.0 // indirect
@@ -0,0 +1,148 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session is one lock session, normally a *locker.Locker with its own connection
+type Session interface {
+	AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error)
+	ReleaseLock(ctx context.Context, lockName string) (bool, error)
+	Close() error
+}
+
+type Options struct {
+	LockName string
+	Workers  int
+	Duration time.Duration
+	Hold     time.Duration
+	Timeout  int
+	// Connect opens a new session for each worker
+	Connect func() (Session, error)
+}
+
+type Result struct {
+	// Waits holds the time each successful acquisition waited for the lock
+	Waits []time.Duration
+	// PerWorker holds the number of acquisitions made by each worker
+	PerWorker []int
+	Timeouts  int
+	Errors    int
+}
+
+// Run starts the workers, each on its own session, and lets them contend
+// for the same lock until the duration elapses
+func Run(ctx context.Context, opts Options) (Result, error) {
+	sessions := make([]Session, opts.Workers)
+	for i := range sessions {
+		s, err := opts.Connect()
+		if err != nil {
+			for _, opened := range sessions[:i] {
+				opened.Close()
+			}
+			return Result{}, fmt.Errorf("failed to connect worker %d: %w", i, err)
+		}
+		sessions[i] = s
+	}
+
+	result := Result{PerWorker: make([]int, opts.Workers)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	deadline := time.Now().Add(opts.Duration)
+	for i, s := range sessions {
+		wg.Add(1)
+		go func(worker int, s Session) {
+			defer wg.Done()
+			defer s.Close()
+
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				start := time.Now()
+				acquired, err := s.AcquireLock(ctx, opts.LockName, opts.Timeout)
+				wait := time.Since(start)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					result.Errors++
+				case !acquired:
+					result.Timeouts++
+				default:
+					result.Waits = append(result.Waits, wait)
+					result.PerWorker[worker]++
+				}
+				mu.Unlock()
+
+				if err != nil || !acquired {
+					continue
+				}
+				time.Sleep(opts.Hold)
+				if _, err := s.ReleaseLock(ctx, opts.LockName); err != nil {
+					mu.Lock()
+					result.Errors++
+					mu.Unlock()
+				}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	return result, nil
+}
+
+// Percentile returns the p-th percentile (0-100) of the wait times
+func (r Result) Percentile(p float64) time.Duration {
+	if len(r.Waits) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), r.Waits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// JainIndex measures how evenly acquisitions were spread across workers,
+// from 1/n (one worker got everything) to 1 (perfectly even)
+func (r Result) JainIndex() float64 {
+	var sum, sumSquares float64
+	for _, n := range r.PerWorker {
+		sum += float64(n)
+		sumSquares += float64(n) * float64(n)
+	}
+	if sumSquares == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(r.PerWorker)) * sumSquares)
+}
+
+// Report writes a human-readable summary of the result
+func (r Result) Report(w io.Writer, opts Options) {
+	minCount, maxCount := 0, 0
+	for i, n := range r.PerWorker {
+		if i == 0 || n < minCount {
+			minCount = n
+		}
+		if n > maxCount {
+			maxCount = n
+		}
+	}
+
+	fmt.Fprintf(w, "Lock: %s, workers: %d, duration: %s, hold: %s\n", opts.LockName, opts.Workers, opts.Duration, opts.Hold)
+	fmt.Fprintf(w, "Acquisitions: %d, timeouts: %d, errors: %d\n", len(r.Waits), r.Timeouts, r.Errors)
+	fmt.Fprintf(w, "Wait: p50 %s, p90 %s, p99 %s, max %s\n",
+		r.Percentile(50).Round(time.Microsecond),
+		r.Percentile(90).Round(time.Microsecond),
+		r.Percentile(99).Round(time.Microsecond),
+		r.Percentile(100).Round(time.Microsecond))
+	fmt.Fprintf(w, "Fairness: acquisitions per worker min %d, max %d, Jain index %.2f\n", minCount, maxCount, r.JainIndex())
+}
@@ -0,0 +1,156 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLock is a process-local lock shared by all fake sessions
+type fakeLock struct {
+	mu   sync.Mutex
+	held bool
+}
+
+type fakeSession struct {
+	lock *fakeLock
+}
+
+func (s *fakeSession) AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error) {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for time.Now().Before(deadline) {
+		s.lock.mu.Lock()
+		if !s.lock.held {
+			s.lock.held = true
+			s.lock.mu.Unlock()
+			return true, nil
+		}
+		s.lock.mu.Unlock()
+		time.Sleep(100 * time.Microsecond)
+	}
+	return false, nil
+}
+
+func (s *fakeSession) ReleaseLock(ctx context.Context, lockName string) (bool, error) {
+	s.lock.mu.Lock()
+	defer s.lock.mu.Unlock()
+	s.lock.held = false
+	return true, nil
+}
+
+func (s *fakeSession) Close() error {
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	lock := &fakeLock{}
+	opts := Options{
+		LockName: "bench-lock",
+		Workers:  4,
+		Duration: 100 * time.Millisecond,
+		Hold:     time.Millisecond,
+		Timeout:  1,
+		Connect: func() (Session, error) {
+			return &fakeSession{lock: lock}, nil
+		},
+	}
+
+	result, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(result.Waits) == 0 {
+		t.Fatal("Run() made no acquisitions")
+	}
+	if len(result.PerWorker) != opts.Workers {
+		t.Errorf("len(PerWorker) = %d, want %d", len(result.PerWorker), opts.Workers)
+	}
+
+	total := 0
+	for _, n := range result.PerWorker {
+		total += n
+	}
+	if total != len(result.Waits) {
+		t.Errorf("sum(PerWorker) = %d, want %d", total, len(result.Waits))
+	}
+
+	var buf bytes.Buffer
+	result.Report(&buf, opts)
+	for _, want := range []string{"workers: 4", "Acquisitions:", "p99", "Jain index"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Report() = %q, missing %q", buf.String(), want)
+		}
+	}
+}
+
+func TestRun_ConnectError(t *testing.T) {
+	connected := 0
+	opts := Options{
+		LockName: "bench-lock",
+		Workers:  3,
+		Duration: time.Millisecond,
+		Timeout:  1,
+		Connect: func() (Session, error) {
+			if connected == 2 {
+				return nil, errors.New("too many connections")
+			}
+			connected++
+			return &fakeSession{lock: &fakeLock{}}, nil
+		},
+	}
+
+	if _, err := Run(context.Background(), opts); err == nil {
+		t.Error("Run() error = nil, want connect error")
+	}
+}
+
+func TestResult_Percentile(t *testing.T) {
+	r := Result{}
+	for i := 10; i >= 1; i-- {
+		r.Waits = append(r.Waits, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0, want: time.Millisecond},
+		{p: 50, want: 5 * time.Millisecond},
+		{p: 90, want: 9 * time.Millisecond},
+		{p: 100, want: 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := r.Percentile(tt.p); got != tt.want {
+			t.Errorf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	if got := (Result{}).Percentile(50); got != 0 {
+		t.Errorf("Percentile() of empty result = %v, want 0", got)
+	}
+}
+
+func TestResult_JainIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		perWorker []int
+		want      float64
+	}{
+		{name: "perfectly even", perWorker: []int{5, 5, 5, 5}, want: 1},
+		{name: "one worker starves the rest", perWorker: []int{8, 0, 0, 0}, want: 0.25},
+		{name: "no acquisitions", perWorker: []int{0, 0}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Result{PerWorker: tt.perWorker}.JainIndex()
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("JainIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
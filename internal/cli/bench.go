@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// BenchCLI holds the arguments of the "mylock bench" subcommand
+type BenchCLI struct {
+	LockName string        `kong:"default='mylock-bench',help='Lock name the workers contend for.'"`
+	Workers  int           `kong:"default='10',help='Number of concurrent acquirers.'"`
+	Duration time.Duration `kong:"default='10s',help='How long to run the benchmark.'"`
+	Hold     time.Duration `kong:"default='10ms',help='How long each acquirer holds the lock.'"`
+	Timeout  int           `kong:"default='30',help='Max seconds each acquisition waits.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseBenchCLI(args []string) (BenchCLI, error) {
+	var cli BenchCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newBenchParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Workers < 1 {
+		return cli, fmt.Errorf("--workers must be at least 1")
+	}
+	if cli.Duration <= 0 {
+		return cli, fmt.Errorf("--duration must be positive")
+	}
+	if cli.Hold < 0 {
+		return cli, fmt.Errorf("--hold must not be negative")
+	}
+	if cli.Timeout <= 0 {
+		return cli, fmt.Errorf("--timeout must be positive")
+	}
+
+	return cli, nil
+}
+
+func isHelp(args []string) bool {
+	for _, arg := range args {
+		if arg == "--help" || arg == "-h" {
+			return true
+		}
+	}
+	return false
+}
+
+func newBenchParser(cli *BenchCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock bench"),
+		kong.Description("Measure lock contention against a MySQL server"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(benchHelpFormatter),
+	)
+}
+
+func benchHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock bench - Measure lock contention against a MySQL server
+
+Usage:
+  mylock bench [--workers N] [--duration 10s] [--hold 10ms] [--lock-name <name>]
+
+Options:
+  --lock-name              Lock name the workers contend for. Default: mylock-bench.
+  --workers                Number of concurrent acquirers, each on its own connection. Default: 10.
+  --duration               How long to run the benchmark. Default: 10s.
+  --hold                   How long each acquirer holds the lock. Default: 10ms.
+  --timeout                Max seconds each acquisition waits. Default: 30.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+Reports the wait-time distribution (p50/p90/p99/max) and how evenly the
+lock was shared between workers (Jain fairness index, 1.00 = perfectly fair).
+`)
+	return nil
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseBenchCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    BenchCLI
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			args: []string{},
+			want: BenchCLI{
+				LockName: "mylock-bench",
+				Workers:  10,
+				Duration: 10 * time.Second,
+				Hold:     10 * time.Millisecond,
+				Timeout:  30,
+				Config:   wantConfig,
+			},
+		},
+		{
+			name: "custom values",
+			args: []string{"--workers", "50", "--duration", "1m", "--hold", "0s", "--lock-name", "hot-lock", "--timeout", "5"},
+			want: BenchCLI{
+				LockName: "hot-lock",
+				Workers:  50,
+				Duration: time.Minute,
+				Hold:     0,
+				Timeout:  5,
+				Config:   wantConfig,
+			},
+		},
+		{
+			name:    "zero workers",
+			args:    []string{"--workers", "0"},
+			wantErr: true,
+		},
+		{
+			name:    "zero duration",
+			args:    []string{"--duration", "0s"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--parallel", "3"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+
+			got, err := ParseBenchCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBenchCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseBenchCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
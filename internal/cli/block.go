@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// BlockSetCLI holds the arguments of "mylock block set"
+type BlockSetCLI struct {
+	LockName string        `kong:"arg,name='lock-name',help='Lock whose runs to block.'"`
+	Reason   string        `kong:"help='Why the lock is blocked, shown to the runs it stops.'"`
+	Duration time.Duration `kong:"help='Clear the block by itself after this long.'"`
+	Target   string        `kong:"help='MYLOCK_TARGETS entry the lock is on.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseBlockSetCLI(args []string) (BlockSetCLI, error) {
+	var cli BlockSetCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newBlockSetParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Duration < 0 {
+		return cli, fmt.Errorf("--duration must not be negative")
+	}
+	if len(cli.Reason) > 255 {
+		return cli, fmt.Errorf("--reason must be at most 255 characters")
+	}
+
+	return cli, nil
+}
+
+func newBlockSetParser(cli *BlockSetCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock block set"),
+		kong.Description("Block runs of a lock for maintenance"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(blockSetHelpFormatter),
+	)
+}
+
+// BlockClearCLI holds the arguments of "mylock block clear"
+type BlockClearCLI struct {
+	LockName string `kong:"arg,name='lock-name',help='Lock whose runs to allow again.'"`
+	Target   string `kong:"help='MYLOCK_TARGETS entry the lock is on.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseBlockClearCLI(args []string) (BlockClearCLI, error) {
+	var cli BlockClearCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newBlockClearParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	return cli, nil
+}
+
+func newBlockClearParser(cli *BlockClearCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock block clear"),
+		kong.Description("Remove the maintenance block on a lock"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(blockClearHelpFormatter),
+	)
+}
+
+// BlockStatusCLI holds the arguments of "mylock block status"
+type BlockStatusCLI struct {
+	LockName string `kong:"arg,optional,name='lock-name',help='Lock to check; every block if not given.'"`
+	Target   string `kong:"help='MYLOCK_TARGETS entry to read.'"`
+	JSON     bool   `kong:"name='json',help='Print the blocks as JSON.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseBlockStatusCLI(args []string) (BlockStatusCLI, error) {
+	var cli BlockStatusCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newBlockStatusParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	return cli, nil
+}
+
+func newBlockStatusParser(cli *BlockStatusCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock block status"),
+		kong.Description("Show the maintenance blocks"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(blockStatusHelpFormatter),
+	)
+}
+
+// PrintBlockHelp prints the help of "mylock block" itself, which only
+// dispatches to its subcommands
+func PrintBlockHelp() {
+	fmt.Fprint(os.Stdout, `mylock block - Pause a job everywhere for maintenance
+
+Usage:
+  mylock block set <lock-name> [--reason <text>] [--duration 2h]
+  mylock block clear <lock-name>
+  mylock block status [<lock-name>] [--json]
+
+Commands:
+  set                      Block runs of a lock until cleared.
+  clear                    Allow runs of a lock again.
+  status                   Show the active blocks.
+
+Blocks are rows of the mylock_blocks table on the MySQL server the lock
+routes to. Every "mylock --lock-name <lock-name>" run checks it before
+waiting for the lock and again once the lock is held, and exits with 206
+instead of running the command while a block is active. A block on the
+--lock-name of a --shards run covers every shard, and a block on a --claim
+pattern without its range, e.g. shard for shard-{0..15}, every slot.
+
+See "mylock block <command> --help".
+`)
+}
+
+func blockSetHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock block set - Block runs of a lock for maintenance
+
+Usage:
+  mylock block set <lock-name> [--reason <text>] [--duration 2h] [--target <name>]
+
+Options:
+  --reason                 Why the lock is blocked, up to 255 characters. Runs that are
+                           stopped print it.
+  --duration               Clear the block by itself after this long, so a forgotten block
+                           does not pause the job forever.
+  --target                 MYLOCK_TARGETS entry the lock is on, instead of routing by
+                           lock name prefix.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself. The
+mylock_blocks table is created in MYLOCK_DATABASE if it does not exist.
+Setting a block again replaces its reason and expiry.
+`)
+	return nil
+}
+
+func blockClearHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock block clear - Remove the maintenance block on a lock
+
+Usage:
+  mylock block clear <lock-name> [--target <name>]
+
+Options:
+  --target                 MYLOCK_TARGETS entry the lock is on, instead of routing by
+                           lock name prefix.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+`)
+	return nil
+}
+
+func blockStatusHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock block status - Show the maintenance blocks
+
+Usage:
+  mylock block status [<lock-name>] [--target <name>] [--json]
+
+Options:
+  --target                 MYLOCK_TARGETS entry to read, instead of routing by lock name
+                           prefix.
+  --json                   Print the blocks as a JSON array.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+Without a lock name, every active block on the server is listed. With one,
+exits 206 if that lock is blocked and 0 if it is not.
+`)
+	return nil
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseBlockCLI(t *testing.T) {
+	for key, value := range map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_DATABASE": "testdb",
+	} {
+		old, had := os.LookupEnv(key)
+		os.Setenv(key, value)
+		defer func(key, old string, had bool) {
+			if had {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		}(key, old, had)
+	}
+	wantConfig := config.Config{Host: "localhost", Port: 3306, User: "testuser", Database: "testdb"}
+
+	set, err := ParseBlockSetCLI([]string{"nightly-report", "--reason", "disk swap", "--duration", "2h"})
+	if err != nil {
+		t.Fatalf("ParseBlockSetCLI() error = %v", err)
+	}
+	wantSet := BlockSetCLI{LockName: "nightly-report", Reason: "disk swap", Duration: 2 * time.Hour, Config: wantConfig}
+	if !reflect.DeepEqual(set, wantSet) {
+		t.Errorf("ParseBlockSetCLI() = %+v, want %+v", set, wantSet)
+	}
+	if _, err := ParseBlockSetCLI([]string{"--reason", "disk swap"}); err == nil {
+		t.Error("ParseBlockSetCLI() without a lock name succeeded")
+	}
+	if _, err := ParseBlockSetCLI([]string{"nightly-report", "--duration=-1h"}); err == nil {
+		t.Error("ParseBlockSetCLI() with a negative duration succeeded")
+	}
+
+	clear, err := ParseBlockClearCLI([]string{"nightly-report", "--target", "reports"})
+	if err != nil {
+		t.Fatalf("ParseBlockClearCLI() error = %v", err)
+	}
+	if want := (BlockClearCLI{LockName: "nightly-report", Target: "reports", Config: wantConfig}); !reflect.DeepEqual(clear, want) {
+		t.Errorf("ParseBlockClearCLI() = %+v, want %+v", clear, want)
+	}
+
+	status, err := ParseBlockStatusCLI([]string{"--json"})
+	if err != nil {
+		t.Fatalf("ParseBlockStatusCLI() error = %v", err)
+	}
+	if want := (BlockStatusCLI{JSON: true, Config: wantConfig}); !reflect.DeepEqual(status, want) {
+		t.Errorf("ParseBlockStatusCLI() = %+v, want %+v", status, want)
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxClaimSlots bounds the locks a --claim range expands to, since each
+// one is tried in turn while all are held
+const maxClaimSlots = 1024
+
+var claimRange = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// Claim is a --claim lock family such as shard-{0..15}: one lock per index
+// from First to Last, named Prefix, the index and Suffix
+type Claim struct {
+	Prefix string
+	Suffix string
+	First  int
+	Last   int
+	// Width zero-pads the index, as for shard-{00..15}
+	Width int
+}
+
+// ParseClaim reads a --claim pattern with one {first..last} range
+func ParseClaim(pattern string) (Claim, error) {
+	matches := claimRange.FindAllStringSubmatchIndex(pattern, -1)
+	if len(matches) != 1 {
+		return Claim{}, fmt.Errorf("%q must contain one range such as {0..15}", pattern)
+	}
+	m := matches[0]
+	first, err1 := strconv.Atoi(pattern[m[2]:m[3]])
+	last, err2 := strconv.Atoi(pattern[m[4]:m[5]])
+	if err1 != nil || err2 != nil || first > last {
+		return Claim{}, fmt.Errorf("%q must range from a lower to a higher number", pattern)
+	}
+	if last-first >= maxClaimSlots {
+		return Claim{}, fmt.Errorf("%q has more than %d slots", pattern, maxClaimSlots)
+	}
+	c := Claim{Prefix: pattern[:m[0]], Suffix: pattern[m[1]:], First: first, Last: last}
+	if bound := pattern[m[2]:m[3]]; len(bound) > 1 && strings.HasPrefix(bound, "0") {
+		c.Width = max(len(bound), len(pattern[m[4]:m[5]]))
+	}
+	if name := c.Name(last); len(name) > MaxLockNameBytes {
+		return Claim{}, fmt.Errorf("lock name '%s' is longer than %d bytes", name, MaxLockNameBytes)
+	}
+	return c, nil
+}
+
+// Name is the lock name of slot index
+func (c Claim) Name(index int) string {
+	return fmt.Sprintf("%s%0*d%s", c.Prefix, c.Width, index, c.Suffix)
+}
+
+// Base is the family's name without its range and the separators around
+// it, e.g. shard for shard-{0..15}, so one block can cover every slot
+func (c Claim) Base() string {
+	prefix := strings.TrimRight(c.Prefix, "-_.")
+	suffix := strings.TrimLeft(c.Suffix, "-_.")
+	if prefix == "" || suffix == "" {
+		return prefix + suffix
+	}
+	// Keep one separator between the parts, as in etl.worker for etl.{0..3}.worker
+	return c.Prefix[:len(prefix)+min(1, len(c.Prefix)-len(prefix))] + suffix
+}
+
+// Names lists the lock names of every slot, in order
+func (c Claim) Names() []string {
+	names := make([]string, 0, c.Last-c.First+1)
+	for i := c.First; i <= c.Last; i++ {
+		names = append(names, c.Name(i))
+	}
+	return names
+}
+
+// Slot returns the index of a lock name from Names
+func (c Claim) Slot(name string) (int, bool) {
+	for i := c.First; i <= c.Last; i++ {
+		if c.Name(i) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
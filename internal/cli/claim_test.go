@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseClaim(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		wantNames []string
+		wantErr   bool
+	}{
+		{pattern: "shard-{0..3}", wantNames: []string{"shard-0", "shard-1", "shard-2", "shard-3"}},
+		{pattern: "etl.{8..10}.worker", wantNames: []string{"etl.8.worker", "etl.9.worker", "etl.10.worker"}},
+		{pattern: "shard-{08..10}", wantNames: []string{"shard-08", "shard-09", "shard-10"}},
+		{pattern: "single-{5..5}", wantNames: []string{"single-5"}},
+		{pattern: "shard", wantErr: true},
+		{pattern: "shard-{3..0}", wantErr: true},
+		{pattern: "shard-{0..3}-{0..3}", wantErr: true},
+		{pattern: "shard-{0..5000}", wantErr: true},
+		{pattern: strings.Repeat("x", 62) + "-{0..100}", wantErr: true},
+	}
+	for _, tt := range tests {
+		c, err := ParseClaim(tt.pattern)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClaim(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := c.Names(); !reflect.DeepEqual(got, tt.wantNames) {
+			t.Errorf("ParseClaim(%q).Names() = %q, want %q", tt.pattern, got, tt.wantNames)
+		}
+		last := tt.wantNames[len(tt.wantNames)-1]
+		if slot, ok := c.Slot(last); !ok || slot != c.Last {
+			t.Errorf("Slot(%q) = %d, %v, want %d", last, slot, ok, c.Last)
+		}
+	}
+}
+
+func TestClaim_Base(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"shard-{0..15}":      "shard",
+		"etl.{8..10}.worker": "etl.worker",
+		"{0..3}":             "",
+	} {
+		c, err := ParseClaim(pattern)
+		if err != nil {
+			t.Fatalf("ParseClaim(%q) error = %v", pattern, err)
+		}
+		if got := c.Base(); got != want {
+			t.Errorf("ParseClaim(%q).Base() = %q, want %q", pattern, got, want)
+		}
+	}
+}
@@ -3,23 +3,108 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/yammerjp/mylock/internal/config"
+	"github.com/yammerjp/mylock/internal/executor"
+)
+
+// Formats for --output-format
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json"
+)
+
+// Policies for --lock-lost-policy
+const (
+	LostPolicyKillChild = "kill-child"
+	LostPolicyWarnOnly  = "warn-only"
+	LostPolicyReacquire = "reacquire"
 )
 
 type CLI struct {
-	LockName            string   `kong:"optional,help:'A unique name for the advisory lock.'"`
-	LockNameFromCommand bool     `kong:"optional,help:'Generate lock name from command hash.'"`
-	Timeout             int      `kong:"required,help:'Max seconds to wait for the lock.'"`
-	Command             []string `kong:"arg,required,name:'command',help:'Command to run once the lock is acquired.'"`
+	LockName            string        `kong:"optional,help='A unique name for the advisory lock.'"`
+	LockNameFromCommand bool          `kong:"optional,help='Generate lock name from command hash.'"`
+	AllowAnyLockName    bool          `kong:"optional,help='Accept any lock name of up to 64 characters.'"`
+	UnicodeLockName     bool          `kong:"optional,help='Accept non-ASCII letters and digits in lock names, NFC normalized.'"`
+	Dotenv              string        `kong:"optional,name='dotenv',help='Load MYLOCK_* variables that are not set from this .env file.'"`
+	AllowRoot           bool          `kong:"optional,env='MYLOCK_ALLOW_ROOT',help='Run the command even when mylock runs as root.'"`
+	Chroot              string        `kong:"optional,help='Run the command with this directory as its root (root only).'"`
+	OOMScoreAdj         *int          `kong:"optional,name='oom-score-adj',help='OOM killer score adjustment of the command, from -1000 to 1000.'"`
+	CoreLimit           string        `kong:"optional,help='Core dump size limit of the command: 0, unlimited or a size such as 512M.'"`
+	Sandbox             bool          `kong:"optional,help='Run the command with no-new-privs, and Landlock rules with --allow-path (Linux).'"`
+	AllowPath           []string      `kong:"optional,help='With --sandbox, a path the command may access; all other files are denied.'"`
+	Group               string        `kong:"optional,help='Concurrency group to run in; used as the lock name.'"`
+	Claim               string        `kong:"optional,help='Take the first free lock of a family such as shard-{0..15}; the index is passed as MYLOCK_SLOT.'"`
+	CancelInProgress    bool          `kong:"optional,help='Preempt an older run holding the lock instead of waiting for it.'"`
+	Timeout             int           `kong:"required,env='MYLOCK_TIMEOUT',help='Max seconds to wait for the lock.'"`
+	IfFree              []string      `kong:"optional,help='Skip the command (exit 0) while any of these locks is held.'"`
+	AfterLockFree       []string      `kong:"optional,help='Wait until these locks are free before taking the lock.'"`
+	Target              string        `kong:"optional,help='Named MySQL target to take the lock on.'"`
+	ShardKey            string        `kong:"optional,help='Key hashed into one of --shards lock names.'"`
+	Shards              int           `kong:"optional,help='Number of shards the lock name is split into.'"`
+	CmdRetries          int           `kong:"optional,help='Re-run the command up to N times while it exits non-zero.'"`
+	CmdRetryBackoff     time.Duration `kong:"optional,help='Delay between command retries.'"`
+	OnlyBetween         string        `kong:"optional,help='Only run the command within this daily window, e.g. 01:00-05:00/Asia/Tokyo.'"`
+	NotBetween          string        `kong:"optional,help='Do not run the command within this daily window.'"`
+	WindowExitCode      int           `kong:"optional,help='Exit code when the command is skipped for being outside its time window.'"`
+	RequireFreeDisk     string        `kong:"optional,help='Skip the run unless this much disk space is free, e.g. 10G.'"`
+	FreeDiskPath        string        `kong:"optional,help='Path whose filesystem --require-free-disk checks. Default: the working directory.'"`
+	RequireMaxLoad      float64       `kong:"optional,help='Skip the run while the one-minute load average is above this.'"`
+	HoldAfter           time.Duration `kong:"optional,help='Keep holding the lock for this long after the command exits.'"`
+	ExpectedRuntime     time.Duration `kong:"optional,help='Raise the session wait_timeout to cover this runtime.'"`
+	DedupeWindow        time.Duration `kong:"optional,help='Skip the command if it already succeeded within this window.'"`
+	MaxPerHost          int           `kong:"optional,help='Run at most N mylock jobs at once on this machine.'"`
+	AlsoFlock           string        `kong:"optional,help='Also hold a flock on this local file, taken before the MySQL lock.'"`
+	PreHook             string        `kong:"optional,help='Shell command run with the lock held before the command.'"`
+	PostHook            string        `kong:"optional,help='Shell command run with the lock held after the command.'"`
+	OnTimeoutHook       string        `kong:"optional,help='Shell command run when the lock cannot be acquired in time.'"`
+	OnFailureHook       string        `kong:"optional,help='Shell command run when the command exits non-zero.'"`
+	OnLockLostHook      string        `kong:"optional,help='Shell command run when the lock is lost, before --lock-lost-policy acts.'"`
+	OnRelease           string        `kong:"optional,help='Shell command run after the lock has been released.'"`
+	MailTo              []string      `kong:"optional,help='Mail a report to this address when the command fails.'"`
+	MailFrom            string        `kong:"optional,help='Sender address of failure mail.'"`
+	PagerdutyRoutingKey string        `kong:"optional,name='pagerduty-routing-key',env='MYLOCK_PAGERDUTY_ROUTING_KEY',help='PagerDuty Events API v2 routing key for lock timeouts and command failures.'"`
+	PagerdutyResolve    bool          `kong:"optional,name='pagerduty-resolve',help='Resolve the PagerDuty incident when a later run succeeds.'"`
+	LockLostPolicy      string        `kong:"optional,help='What to do when the lock session dies: kill-child, warn-only or reacquire.'"`
+	NoRelease           bool          `kong:"optional,help='Skip RELEASE_LOCK and let closing the session free the lock.'"`
+	StrictRelease       bool          `kong:"optional,help='Exit with 204 when the lock cannot be released, instead of only warning.'"`
+	DetectFailover      bool          `kong:"optional,help='Treat the MYLOCK_HOST name resolving to another server as a lost lock.'"`
+	Exec                bool          `kong:"optional,help='Replace mylock with the command while a helper process holds the lock.'"`
+	RemapCollisions     bool          `kong:"optional,hidden,help='Deprecated: command exit codes are no longer shifted.'"`
+	ExitCodeFile        string        `kong:"optional,help='Write the command exit code to this file.'"`
+	StatusFile          string        `kong:"optional,help='Keep the state of the run as JSON in this file.'"`
+	OutputFormat        string        `kong:"optional,help='Format of the command output: text or json.'"`
+	MergeOutput         bool          `kong:"optional,help='Merge the command stderr into stdout line by line.'"`
+	StripANSI           bool          `kong:"optional,name='strip-ansi',help='Remove terminal escape sequences from command output that is not going to a terminal.'"`
+	Debug               bool          `kong:"optional,help='Log each lock query with timings to stderr.'"`
+	NoColor             bool          `kong:"optional,help='Disable colored diagnostics.'"`
+	Quiet               bool          `kong:"optional,help='Do not report progress while waiting for the lock.'"`
+	StallTimeout        time.Duration `kong:"optional,help='Kill the command after it writes no output for this long.'"`
+	StallSignal         string        `kong:"optional,help='Signal sent first when --stall-timeout is reached, e.g. QUIT.'"`
+	HeartbeatLog        time.Duration `kong:"optional,help='Log a still running line at this interval while the command runs.'"`
+	Summary             bool          `kong:"optional,help='Print a final summary line to stderr.'"`
+	SummaryJSON         bool          `kong:"optional,help='Print the final summary as a JSON object.'"`
+	Rusage              bool          `kong:"optional,help='Add the command CPU time, max RSS and page faults to the summary.'"`
+	Command             []string      `kong:"arg,required,name='command',help='Command to run once the lock is acquired.'"`
 	// Config is populated from environment variables, not from CLI flags
 	Config config.Config `kong:"-"`
+	// Deadline is read from MYLOCK_DEADLINE and is zero when it is unset
+	Deadline time.Time `kong:"-"`
 }
 
 func ParseCLI(args []string) (CLI, error) {
 	var cli CLI
 
+	// A --dotenv file fills in the environment the rest is read from
+	if path := dotenvPath(args); path != "" {
+		if _, err := config.LoadDotenv(path); err != nil {
+			return cli, err
+		}
+	}
+
 	// Parse config from environment first
 	cfg, err := config.NewConfig()
 	if err != nil {
@@ -33,20 +118,7 @@ func ParseCLI(args []string) (CLI, error) {
 		cli.Config = cfg
 	}
 
-	parser, err := kong.New(&cli,
-		kong.Name("mylock"),
-		kong.Description("Acquire a MySQL advisory lock and run a command"),
-		kong.UsageOnError(),
-		kong.Exit(func(int) {}), // Prevent os.Exit during testing
-		kong.ConfigureHelp(kong.HelpOptions{
-			Compact: false,
-			Summary: false,
-		}),
-		kong.Help(helpFormatter),
-		kong.Vars{
-			"version": "1.0.0",
-		},
-	)
+	parser, err := newParser(&cli)
 	if err != nil {
 		return cli, err
 	}
@@ -60,17 +132,228 @@ func ParseCLI(args []string) (CLI, error) {
 		return cli, fmt.Errorf("help requested")
 	}
 
-	// Validate that exactly one of lock-name or lock-name-from-command is specified
-	if cli.LockName == "" && !cli.LockNameFromCommand {
-		return cli, fmt.Errorf("either --lock-name or --lock-name-from-command must be specified")
+	// MYLOCK_DEFAULT_LOCK_NAME only stands in when the lock is not named any
+	// other way. It is not MYLOCK_LOCK_NAME, which hooks receive, so a mylock
+	// run from a hook does not wait for the lock its parent holds.
+	if cli.LockName == "" && !cli.LockNameFromCommand && cli.Group == "" && cli.Claim == "" {
+		cli.LockName = os.Getenv("MYLOCK_DEFAULT_LOCK_NAME")
+	}
+
+	if value := os.Getenv("MYLOCK_DEADLINE"); value != "" {
+		deadline, err := ParseDeadline(value)
+		if err != nil {
+			return cli, fmt.Errorf("invalid MYLOCK_DEADLINE: %w", err)
+		}
+		cli.Deadline = deadline
+	}
+
+	// Validate that exactly one of lock-name, lock-name-from-command, group or claim is specified
+	if cli.LockName == "" && !cli.LockNameFromCommand && cli.Group == "" && cli.Claim == "" {
+		return cli, fmt.Errorf("either --lock-name, --lock-name-from-command, --group or --claim must be specified")
 	}
 	if cli.LockName != "" && cli.LockNameFromCommand {
 		return cli, fmt.Errorf("cannot specify both --lock-name and --lock-name-from-command")
 	}
+	if cli.Group != "" && (cli.LockName != "" || cli.LockNameFromCommand) {
+		return cli, fmt.Errorf("--group cannot be combined with --lock-name or --lock-name-from-command")
+	}
+	if cli.Claim != "" {
+		if cli.LockName != "" || cli.LockNameFromCommand || cli.Group != "" || cli.Shards > 0 {
+			return cli, fmt.Errorf("--claim cannot be combined with --lock-name, --lock-name-from-command, --group or --shards")
+		}
+		if _, err := ParseClaim(cli.Claim); err != nil {
+			return cli, fmt.Errorf("invalid --claim: %w", err)
+		}
+	}
+	if cli.Shards < 0 {
+		return cli, fmt.Errorf("--shards must not be negative")
+	}
+	if cli.ShardKey != "" && cli.Shards == 0 {
+		return cli, fmt.Errorf("--shard-key requires --shards")
+	}
+	if cli.Shards > 0 && cli.ShardKey == "" {
+		return cli, fmt.Errorf("--shards requires --shard-key")
+	}
+	if cli.CmdRetries < 0 {
+		return cli, fmt.Errorf("--cmd-retries must not be negative")
+	}
+	if cli.CmdRetryBackoff < 0 {
+		return cli, fmt.Errorf("--cmd-retry-backoff must not be negative")
+	}
+	for flag, names := range map[string][]string{"--if-free": cli.IfFree, "--after-lock-free": cli.AfterLockFree} {
+		for i, name := range names {
+			names[i] = strings.TrimSpace(name)
+			if names[i] == "" {
+				return cli, fmt.Errorf("%s needs lock names, e.g. %s extract,load", flag, flag)
+			}
+		}
+	}
+	for flag, value := range map[string]string{"--only-between": cli.OnlyBetween, "--not-between": cli.NotBetween} {
+		if value == "" {
+			continue
+		}
+		if _, err := ParseTimeWindow(value); err != nil {
+			return cli, fmt.Errorf("invalid %s: %w", flag, err)
+		}
+	}
+	if cli.WindowExitCode < 0 || cli.WindowExitCode > 255 {
+		return cli, fmt.Errorf("--window-exit-code must be between 0 and 255")
+	}
+	if cli.WindowExitCode != 0 && cli.OnlyBetween == "" && cli.NotBetween == "" {
+		return cli, fmt.Errorf("--window-exit-code requires --only-between or --not-between")
+	}
+	if cli.RequireFreeDisk != "" {
+		if _, err := ParseSize(cli.RequireFreeDisk); err != nil {
+			return cli, fmt.Errorf("invalid --require-free-disk: %w", err)
+		}
+	}
+	if cli.FreeDiskPath != "" && cli.RequireFreeDisk == "" {
+		return cli, fmt.Errorf("--free-disk-path requires --require-free-disk")
+	}
+	if cli.RequireMaxLoad < 0 {
+		return cli, fmt.Errorf("--require-max-load must not be negative")
+	}
+	if cli.StallTimeout < 0 {
+		return cli, fmt.Errorf("--stall-timeout must not be negative")
+	}
+	if cli.StallSignal != "" {
+		if cli.StallTimeout == 0 {
+			return cli, fmt.Errorf("--stall-signal requires --stall-timeout")
+		}
+		if _, err := executor.ParseSignal(cli.StallSignal); err != nil {
+			return cli, fmt.Errorf("invalid --stall-signal: %w", err)
+		}
+	}
+	if cli.HoldAfter < 0 {
+		return cli, fmt.Errorf("--hold-after must not be negative")
+	}
+	if cli.ExpectedRuntime < 0 {
+		return cli, fmt.Errorf("--expected-runtime must not be negative")
+	}
+	if cli.DedupeWindow < 0 {
+		return cli, fmt.Errorf("--dedupe-window must not be negative")
+	}
+	if cli.HeartbeatLog < 0 {
+		return cli, fmt.Errorf("--heartbeat-log must not be negative")
+	}
+	if cli.MaxPerHost < 0 {
+		return cli, fmt.Errorf("--max-per-host must not be negative")
+	}
+	switch cli.LockLostPolicy {
+	case "", LostPolicyKillChild, LostPolicyWarnOnly, LostPolicyReacquire:
+	default:
+		return cli, fmt.Errorf("invalid --lock-lost-policy %q (use %s, %s or %s)", cli.LockLostPolicy, LostPolicyKillChild, LostPolicyWarnOnly, LostPolicyReacquire)
+	}
+	if cli.MailFrom != "" && len(cli.MailTo) == 0 {
+		return cli, fmt.Errorf("--mail-from requires --mail-to")
+	}
+	if cli.StrictRelease && cli.NoRelease {
+		return cli, fmt.Errorf("--strict-release cannot be combined with --no-release")
+	}
+	if cli.PagerdutyResolve && cli.PagerdutyRoutingKey == "" {
+		return cli, fmt.Errorf("--pagerduty-resolve requires --pagerduty-routing-key")
+	}
+	switch cli.OutputFormat {
+	case "", OutputFormatText, OutputFormatJSON:
+	default:
+		return cli, fmt.Errorf("invalid --output-format %q (use %s or %s)", cli.OutputFormat, OutputFormatText, OutputFormatJSON)
+	}
+	if cli.OOMScoreAdj != nil && (*cli.OOMScoreAdj < -1000 || *cli.OOMScoreAdj > 1000) {
+		return cli, fmt.Errorf("--oom-score-adj must be between -1000 and 1000")
+	}
+	if cli.CoreLimit != "" {
+		if _, err := ParseCoreLimit(cli.CoreLimit); err != nil {
+			return cli, fmt.Errorf("invalid --core-limit: %w", err)
+		}
+	}
+	if len(cli.AllowPath) > 0 && !cli.Sandbox {
+		return cli, fmt.Errorf("--allow-path requires --sandbox")
+	}
+	if cli.Exec {
+		if opt := execConflict(cli); opt != "" {
+			return cli, fmt.Errorf("--exec cannot be combined with %s, since mylock does not outlive the command", opt)
+		}
+	}
 
 	return cli, nil
 }
 
+// dotenvPath finds the --dotenv option among mylock's own arguments, which
+// must be read before kong resolves the environment
+func dotenvPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--dotenv" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if path, ok := strings.CutPrefix(arg, "--dotenv="); ok {
+			return path
+		}
+	}
+	return ""
+}
+
+func newParser(cli *CLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock"),
+		kong.Description("Acquire a MySQL advisory lock and run a command"),
+		kong.UsageOnError(),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.ConfigureHelp(kong.HelpOptions{
+			Compact: false,
+			Summary: false,
+		}),
+		kong.Help(helpFormatter),
+		kong.Vars{
+			"version": "1.0.0",
+		},
+	)
+}
+
+// execConflict names an option that needs mylock to run after the command
+// exits, which --exec does not allow
+func execConflict(cli CLI) string {
+	switch {
+	case cli.CmdRetries > 0:
+		return "--cmd-retries"
+	case cli.HoldAfter > 0:
+		return "--hold-after"
+	case cli.PreHook != "", cli.PostHook != "", cli.OnTimeoutHook != "", cli.OnFailureHook != "", cli.OnLockLostHook != "", cli.OnRelease != "":
+		return "hooks"
+	case cli.ExitCodeFile != "":
+		return "--exit-code-file"
+	case cli.StatusFile != "":
+		return "--status-file"
+	case len(cli.MailTo) > 0:
+		return "--mail-to"
+	case cli.PagerdutyRoutingKey != "":
+		return "--pagerduty-routing-key"
+	case cli.DedupeWindow > 0:
+		return "--dedupe-window"
+	case cli.Summary, cli.SummaryJSON, cli.Rusage:
+		return "--summary"
+	case cli.OutputFormat == OutputFormatJSON:
+		return "--output-format json"
+	case cli.MergeOutput:
+		return "--merge-output"
+	case cli.StripANSI:
+		return "--strip-ansi"
+	case cli.HeartbeatLog > 0:
+		return "--heartbeat-log"
+	case cli.StrictRelease:
+		return "--strict-release"
+	case cli.Claim != "":
+		return "--claim"
+	case cli.StallTimeout > 0:
+		return "--stall-timeout"
+	case cli.LockLostPolicy != "" && cli.LockLostPolicy != LostPolicyKillChild:
+		return "--lock-lost-policy " + cli.LockLostPolicy
+	}
+	return ""
+}
+
 func helpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
 	w := os.Stdout
 	if options.NoExpandSubcommands {
@@ -83,6 +366,33 @@ func helpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
 Usage:
   mylock --lock-name <name> --timeout <seconds> -- <command> [args...]
   mylock --lock-name-from-command --timeout <seconds> -- <command> [args...]
+  mylock --group <name> [--cancel-in-progress] --timeout <seconds> -- <command> [args...]
+  mylock --claim 'shard-{0..15}' --timeout <seconds> -- <command> [args...]
+  mylock --compat setlock [-n] <lockfile> <command> [args...]
+  mylock --compat lckdo [-w | -W <seconds>] [-q] <lockfile> <command> [args...]
+
+Commands:
+  mylock bench             Measure lock acquisition latency and fairness under contention.
+                           See "mylock bench --help".
+  mylock whoami            Show the user, server, connection id, database and TLS status
+                           mylock connects with. See "mylock whoami --help".
+  mylock wait <lock-name>  Wait until a lock is free without taking it. See "mylock wait --help".
+  mylock contend <lock-name>  Report how often a lock is held, and by whom. See "mylock contend --help".
+  mylock config validate   Check the MYLOCK_* settings without connecting. See "mylock config validate --help".
+  mylock config print      Print the effective settings, password redacted. See "mylock config print --help".
+  mylock snapshot          Dump held locks, GET_LOCK waiters and dedupe records, optionally as
+                           JSON for monitoring. See "mylock snapshot --help".
+  mylock hold              Take a lock and hold it for --duration or until Ctrl-C, to keep a
+                           job family from running during maintenance. See "mylock hold --help".
+  mylock block set|clear|status  Pause a job on every host for maintenance: runs of a blocked
+                           lock exit with 206 instead of running. See "mylock block --help".
+  mylock require-lock-held Run a helper script only while the locked job that started it
+                           holds the lock, exiting 203 otherwise. See "mylock require-lock-held --help".
+  mylock cron              Run a locked job on a cron schedule as a long-lived process, for
+                           containers without crond. See "mylock cron --help".
+  mylock run-one <command> Run a command unless the same user is already running it, like
+                           Ubuntu's run-one. See "mylock run-one --help".
+  mylock docs man|markdown Print this reference as a man page or as Markdown.
 
 Environment Variables:
   MYLOCK_HOST         MySQL host (required, e.g., localhost)
@@ -90,26 +400,301 @@ Environment Variables:
   MYLOCK_USER         MySQL username (required)
   MYLOCK_PASSWORD     MySQL password (optional, empty allowed)
   MYLOCK_DATABASE     MySQL database name (required)
+  MYLOCK_CHARSET      Connection character set, or a comma-separated list to try in order
+  MYLOCK_COLLATION    Connection collation (e.g., utf8mb4_0900_ai_ci)
+  MYLOCK_COMPRESS     Set to 1 to use the compressed protocol (for slow or distant links)
+  MYLOCK_QUORUM_HOSTS Comma-separated hosts (host or host:port). When set, the lock must be
+                      held on a majority of them, and MYLOCK_HOST is not needed.
+  MYLOCK_TARGETS      Comma-separated names of extra MySQL targets. Each target <name> is
+                      set up with MYLOCK_TARGET_<NAME>_HOST (required), _PORT, _USER,
+                      _PASSWORD and _DATABASE, which default to the values above.
+                      Locks named "<name>.*" go to that target; change the prefix with
+                      MYLOCK_TARGET_<NAME>_PREFIX. Other locks use MYLOCK_HOST.
+  MYLOCK_BACKEND      "mysql" (default) or "memory". The memory backend needs no database;
+                      locks only exclude other users within the same process (for CI/dev).
+  MYLOCK_TIMEOUT      Default for --timeout.
+  MYLOCK_DEFAULT_LOCK_NAME
+                      Default for --lock-name, unless --lock-name-from-command or --group
+                      is given. MYLOCK_LOCK_NAME, which hooks receive, is not read.
+  MYLOCK_DEADLINE     Absolute end of the whole run, as RFC 3339 time or Unix epoch seconds,
+                      usually set by a parent scheduler. The wait for the lock is cut short
+                      to end by then, and a command still running is stopped.
+  MYLOCK_SMTP_HOST    Mail server for --mail-to. MYLOCK_SMTP_PORT (default: 587),
+                      MYLOCK_SMTP_USER and MYLOCK_SMTP_PASSWORD are optional; STARTTLS is
+                      used when the server offers it.
+  MYLOCK_PAGERDUTY_ROUTING_KEY  Default for --pagerduty-routing-key.
+  MYLOCK_EVENTS_NATS_URL  nats://[user:password@|token@]host[:port] to publish lifecycle
+                      events to, as JSON on <subject>.acquired, <subject>.released and
+                      <subject>.failed. The subject prefix is MYLOCK_EVENTS_NATS_SUBJECT
+                      (default: mylock.events). TLS-only servers are not supported.
+  MYLOCK_ALLOW_ROOT   Set to 1 to allow running as root, like --allow-root (e.g., in
+                      containers that have no other user).
+  NO_COLOR            When set to any value, disables colored diagnostics.
 
 Options:
-  --lock-name              A unique name for the advisory lock.
+  --lock-name              A unique name for the advisory lock. A name over 64 bytes, e.g.
+                           built from a template, is cut and ends with a hash of the full
+                           name, so long names that share a beginning stay distinct.
   --lock-name-from-command Generate lock name from command hash.
-  --timeout                Required. Max seconds to wait for the lock.
+  --allow-any-lock-name    Accept any lock name of up to 64 characters, such as names with
+                           spaces or colons generated by other systems. The name is always
+                           sent as a bound parameter; by default only letters, digits, '_',
+                           '-' and '.' are allowed.
+  --unicode-lock-name      Also accept letters and digits of any script in lock names. The
+                           name is normalized to Unicode NFC first, so clients sending
+                           composed or decomposed characters take the same lock, and is
+                           limited to 64 bytes. Combined with --allow-any-lock-name, only the
+                           normalization applies.
+  --group                  Concurrency group to run in, used as the lock name instead of
+                           --lock-name.
+  --claim                  Take the first free lock of a family instead of --lock-name, e.g.
+                           --claim 'shard-{0..15}' for shard-0 to shard-15, and pass its
+                           index to the command as MYLOCK_SLOT, so identical workers each
+                           pick their own partition. While all are held, they are tried
+                           again until --timeout. A leading zero ({00..15}) pads the index.
+  --cancel-in-progress     Take the lock over from an older run instead of waiting: its MySQL
+                           session is killed, so it loses the lock and its command is stopped
+                           at the next lock check. Runs are ordered by when they started,
+                           which each records in the mylock_started_at connection attribute.
+                           A run that finds a newer run holding the lock, or loses it to
+                           one, exits with 209. Needs performance_schema and the same MySQL
+                           user, or the CONNECTION_ADMIN privilege.
+  --timeout                Required unless MYLOCK_TIMEOUT is set. Max seconds to wait for
+                           the lock; 0 tries it once without waiting.
+  --dotenv                 Load MYLOCK_* variables from this .env file (KEY=VALUE lines,
+                           optionally quoted) before reading the environment. Variables
+                           already set win, and other names in the file are ignored.
+  --allow-root             Run even when mylock runs as root. Without it, mylock refuses to
+                           start as root, since a job script run from the system crontab
+                           by mistake would otherwise run with full privileges.
+  --chroot                 Run the command with this directory as its root directory, for
+                           legacy jobs that expect a constrained view of the filesystem.
+                           Needs root (and so --allow-root); the command and what it loads
+                           must exist inside the directory, and it starts in its top.
+                           Hooks run outside of it.
+  --oom-score-adj          Set the command's oom_score_adj, from -1000 to 1000 (Linux only).
+                           A positive value makes the kernel kill a memory-hungry batch job
+                           before the host's daemons; lowering it below the current value
+                           needs root. Write negative values as --oom-score-adj=-500.
+  --core-limit             Limit the size of core dumps of the command (Linux only): 0 to
+                           keep a crashing binary from filling the disk, unlimited to get
+                           cores for debugging, or a size such as 512M. Raising it above
+                           the hard limit needs root.
+  --sandbox                Run the command with no-new-privs set, so setuid programs and file
+                           capabilities cannot raise its privileges (Linux only). Hooks are
+                           not sandboxed.
+  --allow-path             With --sandbox, confine the command's file access to these paths
+                           and everything beneath them using Landlock (Linux 5.13+). Include
+                           what the command itself needs, e.g. --allow-path /usr
+                           --allow-path /lib --allow-path /tmp. With --chroot, the paths
+                           are inside the new root. Repeatable.
+  --if-free                Skip the command (exit 0) while any of these locks is held, e.g.
+                           --if-free importer to keep a cleanup from running during an
+                           import. The locks are only observed with IS_FREE_LOCK(), both
+                           before waiting and once the lock is held, and never taken.
+  --after-lock-free        Before taking the lock, wait until each of these locks is free, in
+                           order (comma-separated or repeated), so a job can follow others
+                           without a scheduler. The locks are only observed, not taken,
+                           and the wait counts against --timeout.
+  --target                 Take the lock on this target from MYLOCK_TARGETS instead of
+                           routing by lock name prefix.
+  --shard-key              Hash this value (e.g., a tenant or table name) into one of --shards
+                           locks named <lock-name>.<shard>, so different shards run in
+                           parallel while runs within a shard stay serialized.
+  --shards                 Number of shards for --shard-key.
+  --cmd-retries            Re-run the command up to N times while it exits non-zero.
+  --cmd-retry-backoff      Delay between command retries (e.g., 30s). Default: 0.
+  --hold-after             Keep the lock for this long after the command exits (e.g., 60s).
+  --only-between           Only run the command between these times of day, e.g. 01:00-05:00
+                           or 22:00-02:00/Asia/Tokyo (local time unless a zone is given).
+                           Checked before waiting for the lock and again once it is held,
+                           so a late cron trigger or a long wait cannot run it outside.
+  --not-between            Skip the command between these times of day, in the same form.
+  --window-exit-code       Exit code when the command is skipped for its time window.
+                           Default: 0.
+  --require-free-disk      Exit with 207 before connecting to MySQL unless at least this much
+                           disk space (e.g., 10G) is free, so a heavy job does not take the
+                           lock on a host that cannot finish it.
+  --free-disk-path         Where --require-free-disk looks. Default: the working directory.
+  --require-max-load       Exit with 207 before connecting to MySQL while the one-minute load
+                           average is above this (Linux only).
+  --expected-runtime       Raise the session wait_timeout to outlast this runtime (e.g., 2h).
+  --dedupe-window          Skip the command (exit 0) if the same command succeeded within this
+                           window (e.g., 10m) on any host. Successes are recorded by command
+                           hash in the mylock_dedupe table, created in MYLOCK_DATABASE.
+  --max-per-host           Run at most N mylock-wrapped jobs of this user at once on this
+                           machine, whatever their lock names. Waiting for a slot counts
+                           against --timeout.
+  --also-flock             Also hold an exclusive flock on this local file, taken before
+                           connecting to MySQL. Jobs on one machine stay serialized when
+                           the database is unreachable, and wait without a session.
+  --pre-hook               Shell command run with the lock held before the command.
+  --post-hook              Shell command run with the lock held after the command.
+  --on-timeout-hook        Shell command run when the lock cannot be acquired in time.
+  --on-failure-hook        Shell command run when the command exits non-zero.
+  --on-lock-lost-hook      Shell command run when the lock is lost while the command runs,
+                           before --lock-lost-policy kills, warns or reacquires, so the job
+                           can quiesce what it drives. Given 30 seconds.
+  --on-release             Shell command run after the lock has been released.
+  --mail-to                Mail the lock name, host, command, exit code and the end of its
+                           output to this address when the command exits non-zero. May be
+                           repeated or comma-separated. Sent through MYLOCK_SMTP_HOST once
+                           the lock is released, giving up after 30 seconds.
+  --mail-from              Sender of failure mail. Default: mylock@<hostname>.
+  --pagerduty-routing-key  Trigger a PagerDuty incident (Events API v2) when the lock is not
+                           acquired in time or the command exits non-zero. The dedup key is
+                           mylock:<lock-name>, so repeated failures update one incident.
+                           Prefer MYLOCK_PAGERDUTY_ROUTING_KEY, which keeps the key out of ps.
+  --pagerduty-resolve      Resolve the lock's incident when the command succeeds.
+  --lock-lost-policy       What to do if the lock or its session is lost while the command runs:
+                           kill-child (default), warn-only (keep running without the lock),
+                           or reacquire (pause the command with SIGSTOP, reconnect and take
+                           the lock again within --timeout, then SIGCONT). Any other locks of
+                           the session are taken again too. If the command cannot be
+                           paused, it is killed.
+  --no-release             Skip RELEASE_LOCK() and free the lock by closing the MySQL session.
+  --strict-release         Exit with 204 when RELEASE_LOCK() fails or finds the lock no longer
+                           held, instead of only warning, since the lock may be stuck with a
+                           stale session. Takes precedence over the command's exit code.
+  --detect-failover        Also count it as a lost lock when the MYLOCK_HOST name stops
+                           resolving to the server of the session, as a managed-MySQL
+                           endpoint does after a failover. Leave off for DNS round-robin.
+  --exec                   Replace mylock with the command (execve) while a helper process
+                           holds the lock, so supervisors see the command's own PID.
+                           Not available on Windows or together with hooks, retries,
+                           --hold-after, --exit-code-file, --status-file, --mail-to,
+                           --pagerduty-routing-key, --dedupe-window, --summary, --output-format
+                           json, --merge-output, --strip-ansi, --heartbeat-log,
+                           --strict-release, --claim, --stall-timeout or a --lock-lost-policy
+                           other than kill-child.
+  --exit-code-file         Write the command's exit code to this file.
+  --status-file            Keep the state of the run in this JSON file (e.g.,
+                           /run/mylock/nightly.json), replaced atomically as it moves through
+                           waiting, acquired, running and done, the last with the exit code,
+                           so monitoring agents can read it without parsing logs.
+  --output-format          text (default) passes the command's output through. json writes
+                           each line of its stdout and stderr to stdout as a JSON object with
+                           the stream, time, lock name and a run id, e.g.
+                           {"time":"...","stream":"stderr","lock_name":"nightly","run_id":"...","line":"..."}.
+  --merge-output           Pipe the command's stdout and stderr through mylock into stdout,
+                           one whole line at a time in about the order they were written,
+                           so partial lines of the two streams do not interleave (e.g. in
+                           cron mail). json output is always merged this way.
+  --strip-ansi             Remove colors and other terminal escape sequences from the
+                           command's output where it goes to a file, pipe or cron mail
+                           rather than a terminal, so archived logs stay readable.
+  --debug                  Log each lock query with its timing and connection id to stderr.
+  --no-color               Disable colored diagnostics on a terminal.
+  --quiet                  Do not print progress or a spinner while waiting for the lock.
+  --heartbeat-log          While the command runs, log "Still running under lock '<name>'
+                           (<elapsed> elapsed)" to stderr at this interval (e.g., 5m), so
+                           log-based monitoring can tell a long job from a dead one.
+  --stall-timeout          Kill the command if it writes nothing to stdout or stderr for this
+                           long (e.g., 30m), such as a job hung on a dead network connection
+                           while holding the lock, and exit with 208. The command's output
+                           then goes through a pipe instead of the terminal.
+  --stall-signal           Send this signal (e.g., QUIT or TERM) when --stall-timeout is
+                           reached instead of killing at once; the command is killed if it
+                           stays silent for another --stall-timeout.
+  --summary                Print one final line to stderr with the lock name, wait time,
+                           run time and exit code, and on MySQL the connection pool's open
+                           connections and wait count and time.
+  --summary-json           Like --summary, but print the summary as a JSON object.
+  --rusage                 Add the command's CPU time, max RSS and page faults to the
+                           summary. Implies --summary unless --summary-json is set.
+  --compat                 Must come first. Takes the rest of the arguments the way setlock
+                           (daemontools) or lckdo (moreutils) does: setlock waits for the lock
+                           unless -n is given; lckdo gives up at once unless -w (wait) or
+                           -W <seconds> is given, and -q is --quiet. "Waiting" means up to a
+                           year. The lock file path becomes the lock name, with a hash of
+                           the path added unless it already is a valid lock name, e.g.
+                           /var/lock/job.lock is locked as var_lock_job.lock.dfa54542e353.
+                           mylock's own exit codes still apply, so a held lock exits 200.
   --help                   Show this help message.
 
-Note: Either --lock-name or --lock-name-from-command must be specified (but not both).
+Note: Exactly one of --lock-name (or MYLOCK_DEFAULT_LOCK_NAME), --lock-name-from-command,
+--group or --claim must be specified.
 
 Behavior:
+  - With --max-per-host, first waits for one of N local slots, kept as file locks in
+    mylock-slots-<uid> in the system temp directory, so cron pileups cannot overload
+    the host. The directory is private to the user and refused if others can write to it.
+  - With --also-flock, then waits for the local file lock. Both waits count against --timeout.
   - Connects to MySQL using the environment variables above.
-  - Acquires a named advisory lock using GET_LOCK().
+    The session carries the connection attributes program_name=mylock, mylock_version,
+    mylock_lock_name and mylock_run_id, shown in performance_schema.session_connect_attrs.
+    The password is redacted from everything mylock itself prints.
+  - Checks with a canary lock that queries stay on one server session; behind a
+    multiplexing proxy (ProxySQL, RDS Proxy) mylock refuses to run and exits 202.
+  - Acquires a named advisory lock using GET_LOCK(), then confirms with IS_USED_LOCK()
+    that its own session holds it; if not, a proxy broke session affinity and mylock
+    exits 202 without running the command. MySQL and MariaDB are both detected from
+    VERSION() and their differing error codes are handled.
+    GET_LOCK() and RELEASE_LOCK() carry a comment such as
+    /* mylock name=nightly host=web1 run=<MYLOCK_RUN_ID> */ for slow logs and
+    performance_schema.
+    With --cancel-in-progress, an older run holding it is cancelled first.
+    While waiting, progress is printed to stderr every 15 seconds unless --quiet is set.
+    On a terminal, a spinner shows the elapsed wait instead.
   - If the lock is acquired within the timeout, runs the given command.
+    The command and hooks receive MYLOCK_CONNECTION_ID, the MySQL session id holding the lock.
+    The command also receives MYLOCK_RUN_ID, a random id for this run.
+    With --claim, the command and hooks receive MYLOCK_SLOT, the index of the claimed lock.
+  - With --dedupe-window, the command is skipped while the lock is held if the
+    mylock_dedupe table shows it succeeded within the window; a success is recorded.
+  - With --cmd-retries, a failing command is re-run while the lock is still held.
+  - While the command runs, the lock is checked every 5 seconds. If the session
+    or the lock is lost, the command is killed unless --lock-lost-policy says otherwise.
+    A failover also counts as a lost lock: the server turning read-only, or, with
+    --detect-failover, the MYLOCK_HOST name resolving to a different server than the
+    session's.
   - stdin/stdout/stderr are passed through. Signals (SIGINT, SIGTERM) are forwarded.
-  - Releases the lock using RELEASE_LOCK() after execution or interruption.
+    On Windows, the command runs in its own process group and receives CTRL_BREAK.
+    It is also placed in a Job Object before it starts running, so cancellation
+    terminates its whole process tree, and processes it leaves in the background
+    are killed when it exits, after each --cmd-retries attempt.
+  - On SIGUSR1, mylock logs its state to stderr: how long it has waited for the lock,
+    or how long it has held it and the PID and runtime of the command.
+  - Hooks receive MYLOCK_HOOK and MYLOCK_LOCK_NAME; the post-hook also gets MYLOCK_EXIT_CODE.
+    If the pre-hook fails, the command is skipped and its exit code is returned.
+  - The on-timeout hook receives MYLOCK_LOCK_NAME and MYLOCK_TIMEOUT; mylock still exits 200.
+  - The on-lock-lost hook receives MYLOCK_LOCK_NAME, the MYLOCK_CONNECTION_ID of the
+    lost session and the reason in MYLOCK_LOST_REASON. It applies to a single MySQL
+    server and runs again each time a reacquired lock is lost.
+  - The on-failure hook receives MYLOCK_EXIT_CODE and the last 4KB of output in
+    MYLOCK_OUTPUT_TAIL, with NUL bytes removed. Output is piped through mylock when
+    this hook is set.
+  - With --expected-runtime, the session wait_timeout and interactive_timeout are raised
+    so the server does not drop the idle lock session while the command runs.
+  - With --hold-after, the lock is kept for the given period after the command exits.
+  - Releases the lock using RELEASE_LOCK() after execution or interruption,
+    or with --no-release by closing the session. A failed RELEASE_LOCK() is retried
+    twice with backoff; if it still fails, the session is closed to free the lock.
+  - The on-release hook then runs with MYLOCK_LOCK_NAME and MYLOCK_EXIT_CODE, even if
+    the command or the release failed.
 
 Exit Codes:
    0–127   Exit code from the executed command
-   200     Failed to acquire lock within timeout
+   200     Failed to acquire lock within timeout, or the server refused the wait
+           as a deadlock (MySQL error 3058, MariaDB error 1213)
    201     Internal error in mylock (e.g., MySQL connection failure)
+   202     The server or a proxy in front of it does not support GET_LOCK()
+   203     The lock was lost while the command was running (the command is killed),
+           or mylock require-lock-held found it not held by the expected run
+   204     With --strict-release, the lock could not be released
+   205     GET_LOCK() returned NULL: an error on the server (e.g., out of memory or
+           the query was killed), not a busy lock
+   206     The lock is blocked for maintenance (see "mylock block --help")
+   207     A host precondition (--require-free-disk, --require-max-load) was not met
+   208     The command wrote no output for --stall-timeout and was killed
+   209     With --cancel-in-progress, a newer run holds the lock or took it over
+   200–209 are reserved for mylock. A command exiting with one of these codes
+   is reported with a warning and passed on unchanged, so use --exit-code-file
+   to tell the two apart. The file records the command's own exit code. It
+   holds the pre-hook's exit code when a failing pre-hook kept the command from
+   running, and -1 when the command could not start or mylock killed it, e.g.
+   because the lock was lost or --stall-timeout passed. It is not written when
+   the lock was never held.
 
 Example:
   MYLOCK_HOST=127.0.0.1 \
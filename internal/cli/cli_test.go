@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/yammerjp/mylock/internal/config"
 )
@@ -86,6 +89,54 @@ func TestParseCLI(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "allow any lock name",
+			args: []string{"--lock-name", "job: nightly", "--allow-any-lock-name", "--timeout", "30", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName:         "job: nightly",
+				AllowAnyLockName: true,
+				Timeout:          30,
+				Command:          []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unicode lock name",
+			args: []string{"--lock-name", "日次バッチ", "--unicode-lock-name", "--timeout", "30", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName:        "日次バッチ",
+				UnicodeLockName: true,
+				Timeout:         30,
+				Command:         []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "both lock-name and lock-name-from-command should fail",
 			args: []string{"--lock-name", "test", "--lock-name-from-command", "--timeout", "30", "--", "echo", "hello"},
@@ -95,61 +146,518 @@ func TestParseCLI(t *testing.T) {
 				"MYLOCK_PASSWORD": "testpass",
 				"MYLOCK_DATABASE": "testdb",
 			},
-			wantErr: true,
+			wantErr: true,
+		},
+		{
+			name: "missing both lock-name and lock-name-from-command",
+			args: []string{"--timeout", "30", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing timeout",
+			args: []string{"--lock-name", "test-lock", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing command",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing environment variable",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "help flag",
+			args: []string{"--help"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true, // kong prints help and returns error
+		},
+		{
+			name: "command retries",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--cmd-retries", "3", "--cmd-retry-backoff", "30s", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName:        "test-lock",
+				Timeout:         30,
+				CmdRetries:      3,
+				CmdRetryBackoff: 30 * time.Second,
+				Command:         []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative command retries",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--cmd-retries", "-1", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "shard key without shards",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--shard-key", "tenant-1", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "group with lock name",
+			args: []string{"--lock-name", "test-lock", "--group", "deploy", "--timeout", "30", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "group cancelling in progress runs",
+			args: []string{"--group", "deploy", "--cancel-in-progress", "--timeout", "30", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				Group:            "deploy",
+				CancelInProgress: true,
+				Timeout:          30,
+				Command:          []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+		},
+		{
+			name: "exec with dedupe window should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--dedupe-window", "10m", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with json output should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--output-format", "json", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with merged output should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--merge-output", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with status file should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--status-file", "/run/mylock/test-lock.json", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with strip ansi should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--strip-ansi", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "strict release with no release should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--strict-release", "--no-release", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with reacquire should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--lock-lost-policy", "reacquire", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with strict release should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--strict-release", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative heartbeat log",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--heartbeat-log", "-5m", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "mail from without mail to",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--mail-from", "cron@example.com", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "mail to several addresses",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--mail-to", "ops@example.com,dev@example.com", "--mail-to", "oncall@example.com", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName: "test-lock",
+				Timeout:  30,
+				MailTo:   []string{"ops@example.com", "dev@example.com", "oncall@example.com"},
+				Command:  []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+		},
+		{
+			name: "pagerduty resolve without routing key",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--pagerduty-resolve", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "pagerduty routing key from environment",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--pagerduty-resolve", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":                  "localhost",
+				"MYLOCK_USER":                  "testuser",
+				"MYLOCK_PASSWORD":              "testpass",
+				"MYLOCK_DATABASE":              "testdb",
+				"MYLOCK_PAGERDUTY_ROUTING_KEY": "R0UT1NG",
+			},
+			want: CLI{
+				LockName:            "test-lock",
+				Timeout:             30,
+				PagerdutyRoutingKey: "R0UT1NG",
+				PagerdutyResolve:    true,
+				Command:             []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+		},
+		{
+			name: "invalid output format",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--output-format", "xml", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "json output format",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--output-format", "json", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName:     "test-lock",
+				Timeout:      30,
+				OutputFormat: OutputFormatJSON,
+				Command:      []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+		},
+		{
+			name: "negative max per host",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--max-per-host", "-1", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "exec with a hook should fail",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--exec", "--post-hook", "true", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "sharded lock",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--shard-key", "tenant-1", "--shards", "8", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_PASSWORD": "testpass",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName: "test-lock",
+				Timeout:  30,
+				ShardKey: "tenant-1",
+				Shards:   8,
+				Command:  []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
 		},
 		{
-			name: "missing both lock-name and lock-name-from-command",
-			args: []string{"--timeout", "30", "--", "echo", "hello"},
+			name: "hold after with debug",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--hold-after", "1m", "--expected-runtime", "2h", "--debug", "--", "echo", "hello"},
 			envVars: map[string]string{
 				"MYLOCK_HOST":     "localhost",
 				"MYLOCK_USER":     "testuser",
 				"MYLOCK_PASSWORD": "testpass",
 				"MYLOCK_DATABASE": "testdb",
 			},
-			wantErr: true,
+			want: CLI{
+				LockName:        "test-lock",
+				Timeout:         30,
+				HoldAfter:       time.Minute,
+				ExpectedRuntime: 2 * time.Hour,
+				Debug:           true,
+				Command:         []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
 		},
 		{
-			name: "missing timeout",
-			args: []string{"--lock-name", "test-lock", "--", "echo", "hello"},
+			name: "pre and post hooks",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--pre-hook", "echo pre", "--post-hook", "echo post", "--on-release", "rm -f /tmp/marker", "--", "echo", "hello"},
 			envVars: map[string]string{
 				"MYLOCK_HOST":     "localhost",
 				"MYLOCK_USER":     "testuser",
 				"MYLOCK_PASSWORD": "testpass",
 				"MYLOCK_DATABASE": "testdb",
 			},
-			wantErr: true,
+			want: CLI{
+				LockName:  "test-lock",
+				Timeout:   30,
+				PreHook:   "echo pre",
+				PostHook:  "echo post",
+				OnRelease: "rm -f /tmp/marker",
+				Command:   []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
 		},
 		{
-			name: "missing command",
-			args: []string{"--lock-name", "test-lock", "--timeout", "30"},
+			name: "on-timeout and on-failure hooks",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--on-timeout-hook", "logger busy", "--on-failure-hook", "logger failed", "--", "echo", "hello"},
 			envVars: map[string]string{
 				"MYLOCK_HOST":     "localhost",
 				"MYLOCK_USER":     "testuser",
 				"MYLOCK_PASSWORD": "testpass",
 				"MYLOCK_DATABASE": "testdb",
 			},
-			wantErr: true,
+			want: CLI{
+				LockName:      "test-lock",
+				Timeout:       30,
+				OnTimeoutHook: "logger busy",
+				OnFailureHook: "logger failed",
+				Command:       []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
 		},
 		{
-			name: "missing environment variable",
-			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--", "echo", "hello"},
+			name: "exit code collision handling",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--remap-collisions", "--exit-code-file", "/tmp/exit-code", "--", "echo", "hello"},
 			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
 				"MYLOCK_USER":     "testuser",
 				"MYLOCK_PASSWORD": "testpass",
 				"MYLOCK_DATABASE": "testdb",
 			},
-			wantErr: true,
+			want: CLI{
+				LockName:        "test-lock",
+				Timeout:         30,
+				RemapCollisions: true,
+				ExitCodeFile:    "/tmp/exit-code",
+				Command:         []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
 		},
 		{
-			name: "help flag",
-			args: []string{"--help"},
+			name: "quiet with json summary",
+			args: []string{"--lock-name", "test-lock", "--timeout", "30", "--quiet", "--summary-json", "--", "echo", "hello"},
 			envVars: map[string]string{
 				"MYLOCK_HOST":     "localhost",
 				"MYLOCK_USER":     "testuser",
 				"MYLOCK_PASSWORD": "testpass",
 				"MYLOCK_DATABASE": "testdb",
 			},
-			wantErr: true, // kong prints help and returns error
+			want: CLI{
+				LockName:    "test-lock",
+				Timeout:     30,
+				Quiet:       true,
+				SummaryJSON: true,
+				Command:     []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Password: "testpass",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
 		},
 		{
 			name: "empty password allowed",
@@ -174,13 +682,190 @@ func TestParseCLI(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "timeout and lock name from environment",
+			args: []string{"--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":              "localhost",
+				"MYLOCK_USER":              "testuser",
+				"MYLOCK_DATABASE":          "testdb",
+				"MYLOCK_TIMEOUT":           "45",
+				"MYLOCK_DEFAULT_LOCK_NAME": "env-lock",
+			},
+			want: CLI{
+				LockName: "env-lock",
+				Timeout:  45,
+				Command:  []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "flags override environment defaults",
+			args: []string{"--lock-name", "flag-lock", "--timeout", "5", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":              "localhost",
+				"MYLOCK_USER":              "testuser",
+				"MYLOCK_DATABASE":          "testdb",
+				"MYLOCK_TIMEOUT":           "45",
+				"MYLOCK_DEFAULT_LOCK_NAME": "env-lock",
+			},
+			want: CLI{
+				LockName: "flag-lock",
+				Timeout:  5,
+				Command:  []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "group ignores MYLOCK_DEFAULT_LOCK_NAME",
+			args: []string{"--group", "deploy", "--timeout", "5", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":              "localhost",
+				"MYLOCK_USER":              "testuser",
+				"MYLOCK_DATABASE":          "testdb",
+				"MYLOCK_DEFAULT_LOCK_NAME": "env-lock",
+			},
+			want: CLI{
+				Group:   "deploy",
+				Timeout: 5,
+				Command: []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Database: "testdb",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "deadline from environment",
+			args: []string{"--lock-name", "test-lock", "--timeout", "5", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+				"MYLOCK_DEADLINE": "1893553445",
+			},
+			want: CLI{
+				LockName: "test-lock",
+				Timeout:  5,
+				Command:  []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Database: "testdb",
+				},
+				Deadline: time.Unix(1893553445, 0),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid MYLOCK_DEADLINE",
+			args: []string{"--lock-name", "test-lock", "--timeout", "5", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+				"MYLOCK_DEADLINE": "in an hour",
+			},
+			wantErr: true,
+		},
+		{
+			name: "sandbox with allowed paths",
+			args: []string{"--lock-name", "test-lock", "--timeout", "5", "--sandbox", "--allow-path", "/usr", "--allow-path", "/tmp", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			want: CLI{
+				LockName:  "test-lock",
+				Timeout:   5,
+				Sandbox:   true,
+				AllowPath: []string{"/usr", "/tmp"},
+				Command:   []string{"echo", "hello"},
+				Config: config.Config{
+					Host:     "localhost",
+					Port:     3306,
+					User:     "testuser",
+					Database: "testdb",
+				},
+			},
+		},
+		{
+			name: "oom score adjustment out of range",
+			args: []string{"--lock-name", "test-lock", "--timeout", "5", "--oom-score-adj", "1001", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid core limit",
+			args: []string{"--lock-name", "test-lock", "--timeout", "5", "--core-limit", "lots", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			name: "allow-path without sandbox",
+			args: []string{"--lock-name", "test-lock", "--timeout", "5", "--allow-path", "/usr", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+			},
+			wantErr: true,
+		},
+		{
+			// A mylock run from a hook must not take its parent's lock name
+			name: "MYLOCK_LOCK_NAME from a hook is not a default",
+			args: []string{"--timeout", "5", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":      "localhost",
+				"MYLOCK_USER":      "testuser",
+				"MYLOCK_DATABASE":  "testdb",
+				"MYLOCK_LOCK_NAME": "parent-lock",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid MYLOCK_TIMEOUT",
+			args: []string{"--lock-name", "test-lock", "--", "echo", "hello"},
+			envVars: map[string]string{
+				"MYLOCK_HOST":     "localhost",
+				"MYLOCK_USER":     "testuser",
+				"MYLOCK_DATABASE": "testdb",
+				"MYLOCK_TIMEOUT":  "soon",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Save and clear environment
 			oldEnv := make(map[string]string)
-			for _, key := range []string{"MYLOCK_HOST", "MYLOCK_PORT", "MYLOCK_USER", "MYLOCK_PASSWORD", "MYLOCK_DATABASE"} {
+			for _, key := range []string{"MYLOCK_HOST", "MYLOCK_PORT", "MYLOCK_USER", "MYLOCK_PASSWORD", "MYLOCK_DATABASE", "MYLOCK_TIMEOUT", "MYLOCK_DEFAULT_LOCK_NAME", "MYLOCK_LOCK_NAME", "MYLOCK_PAGERDUTY_ROUTING_KEY", "MYLOCK_DEADLINE"} {
 				oldEnv[key] = os.Getenv(key)
 				os.Unsetenv(key)
 			}
@@ -212,3 +897,220 @@ func TestParseCLI(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCLI_Dotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "MYLOCK_HOST=db.internal\nMYLOCK_USER=cron\nMYLOCK_PASSWORD=secret\nMYLOCK_DATABASE=jobs\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"MYLOCK_HOST", "MYLOCK_PORT", "MYLOCK_USER", "MYLOCK_PASSWORD", "MYLOCK_DATABASE"} {
+		old, had := os.LookupEnv(key)
+		os.Unsetenv(key)
+		defer func(key, old string, had bool) {
+			if had {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		}(key, old, had)
+	}
+	os.Setenv("MYLOCK_USER", "operator")
+
+	got, err := ParseCLI([]string{"--lock-name", "job", "--timeout", "5", "--dotenv", path, "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	want := CLI{
+		LockName: "job",
+		Timeout:  5,
+		Dotenv:   path,
+		Command:  []string{"true"},
+		Config: config.Config{
+			Host:     "db.internal",
+			Port:     3306,
+			User:     "operator",
+			Password: "secret",
+			Database: "jobs",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCLI() = %v, want %v", got, want)
+	}
+}
+
+func TestParseCLI_OOMScoreAdj(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	got, err := ParseCLI([]string{"--lock-name", "batch", "--timeout", "5", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if got.OOMScoreAdj != nil {
+		t.Errorf("OOMScoreAdj = %d without --oom-score-adj, want nil", *got.OOMScoreAdj)
+	}
+
+	// 0 is a setting of its own, resetting an adjustment mylock inherited
+	for _, value := range []int{0, 500, -1000} {
+		got, err := ParseCLI([]string{"--lock-name", "batch", "--timeout", "5", "--oom-score-adj=" + fmt.Sprint(value), "--", "true"})
+		if err != nil {
+			t.Fatalf("ParseCLI() error = %v", err)
+		}
+		if got.OOMScoreAdj == nil || *got.OOMScoreAdj != value {
+			t.Errorf("OOMScoreAdj = %v, want %d", got.OOMScoreAdj, value)
+		}
+	}
+}
+
+func TestParseCLI_TimeWindow(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	got, err := ParseCLI([]string{"--lock-name", "batch", "--timeout", "5", "--only-between", "01:00-05:00/UTC", "--window-exit-code", "3", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if got.OnlyBetween != "01:00-05:00/UTC" || got.WindowExitCode != 3 {
+		t.Errorf("OnlyBetween = %q, WindowExitCode = %d", got.OnlyBetween, got.WindowExitCode)
+	}
+
+	for _, args := range [][]string{
+		{"--only-between", "1am-5am"},
+		{"--not-between", "01:00-05:00/Nowhere/City"},
+		{"--window-exit-code", "3"},
+		{"--not-between", "01:00-05:00", "--window-exit-code", "256"},
+	} {
+		args = append(append([]string{"--lock-name", "batch", "--timeout", "5"}, args...), "--", "true")
+		if _, err := ParseCLI(args); err == nil {
+			t.Errorf("ParseCLI(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestParseCLI_Claim(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+	t.Setenv("MYLOCK_DEFAULT_LOCK_NAME", "inherited")
+
+	got, err := ParseCLI([]string{"--claim", "shard-{0..15}", "--timeout", "5", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if got.Claim != "shard-{0..15}" || got.LockName != "" {
+		t.Errorf("Claim = %q, LockName = %q, want the claim alone", got.Claim, got.LockName)
+	}
+
+	for _, args := range [][]string{
+		{"--claim", "shard"},
+		{"--claim", "shard-{0..15}", "--lock-name", "nightly"},
+		{"--claim", "shard-{0..15}", "--shard-key", "tenant", "--shards", "4"},
+		{"--claim", "shard-{0..15}", "--exec"},
+	} {
+		args = append(append(args, "--timeout", "5"), "--", "true")
+		if _, err := ParseCLI(args); err == nil {
+			t.Errorf("ParseCLI(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestParseCLI_StallTimeout(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	got, err := ParseCLI([]string{"--lock-name", "etl", "--timeout", "5", "--stall-timeout", "30m", "--stall-signal", "KILL", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if got.StallTimeout != 30*time.Minute || got.StallSignal != "KILL" {
+		t.Errorf("StallTimeout = %v, StallSignal = %q, want 30m0s and KILL", got.StallTimeout, got.StallSignal)
+	}
+
+	for _, args := range [][]string{
+		{"--stall-timeout=-1m"},
+		{"--stall-signal", "KILL"},
+		{"--stall-timeout", "30m", "--stall-signal", "NOPE"},
+		{"--stall-timeout", "30m", "--exec"},
+	} {
+		args = append(append([]string{"--lock-name", "etl", "--timeout", "5"}, args...), "--", "true")
+		if _, err := ParseCLI(args); err == nil {
+			t.Errorf("ParseCLI(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestParseCLI_LockDependencies(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	got, err := ParseCLI([]string{"--lock-name", "report", "--timeout", "5", "--after-lock-free", "extract, load", "--after-lock-free", "publish", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if want := []string{"extract", "load", "publish"}; !reflect.DeepEqual(got.AfterLockFree, want) {
+		t.Errorf("AfterLockFree = %q, want %q", got.AfterLockFree, want)
+	}
+
+	got, err = ParseCLI([]string{"--lock-name", "cleanup", "--timeout", "5", "--if-free", "importer, exporter", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if want := []string{"importer", "exporter"}; !reflect.DeepEqual(got.IfFree, want) {
+		t.Errorf("IfFree = %q, want %q", got.IfFree, want)
+	}
+	if _, err := ParseCLI([]string{"--lock-name", "cleanup", "--timeout", "5", "--if-free", ",", "--", "true"}); err == nil {
+		t.Errorf("ParseCLI() with an empty --if-free name succeeded, want an error")
+	}
+
+	if _, err := ParseCLI([]string{"--lock-name", "report", "--timeout", "5", "--after-lock-free", "extract,,load", "--", "true"}); err == nil {
+		t.Errorf("ParseCLI() with an empty --after-lock-free name succeeded, want an error")
+	}
+}
+
+func TestParseCLI_Preconditions(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	got, err := ParseCLI([]string{"--lock-name", "batch", "--timeout", "5", "--require-free-disk", "10G", "--free-disk-path", "/var/tmp", "--require-max-load", "4.5", "--", "true"})
+	if err != nil {
+		t.Fatalf("ParseCLI() error = %v", err)
+	}
+	if got.RequireFreeDisk != "10G" || got.FreeDiskPath != "/var/tmp" || got.RequireMaxLoad != 4.5 {
+		t.Errorf("RequireFreeDisk = %q, FreeDiskPath = %q, RequireMaxLoad = %v", got.RequireFreeDisk, got.FreeDiskPath, got.RequireMaxLoad)
+	}
+
+	for _, args := range [][]string{
+		{"--require-free-disk", "lots"},
+		{"--free-disk-path", "/var/tmp"},
+		{"--require-max-load=-1"},
+	} {
+		args = append(append([]string{"--lock-name", "batch", "--timeout", "5"}, args...), "--", "true")
+		if _, err := ParseCLI(args); err == nil {
+			t.Errorf("ParseCLI(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestDotenvPath(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--dotenv", "a.env", "--", "true"}, "a.env"},
+		{[]string{"--lock-name", "x", "--dotenv=b.env", "--", "true"}, "b.env"},
+		{[]string{"--lock-name", "x", "--", "cmd", "--dotenv", "c.env"}, ""},
+		{[]string{"--lock-name", "x", "--", "true"}, ""},
+	}
+	for _, tt := range tests {
+		if got := dotenvPath(tt.args); got != tt.want {
+			t.Errorf("dotenvPath(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
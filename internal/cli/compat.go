@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Styles of --compat
+const (
+	CompatSetlock = "setlock"
+	CompatLckdo   = "lckdo"
+)
+
+// compatWaitForever is the --timeout, one year, for compat styles that wait
+// for the lock without a limit
+const compatWaitForever = 365 * 24 * 60 * 60
+
+var compatInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+// IsCompat reports whether args, without the program name, start with
+// --compat
+func IsCompat(args []string) bool {
+	return len(args) > 0 && (args[0] == "--compat" || strings.HasPrefix(args[0], "--compat="))
+}
+
+// TranslateCompat rewrites a setlock or lckdo style invocation, starting
+// with --compat, into mylock's own flags:
+//
+//	--compat setlock [-nN] <lockfile> <command> [args...]
+//	--compat lckdo [-w] [-W <seconds>] [-q] <lockfile> <command> [args...]
+//
+// setlock waits for the lock unless -n is given; lckdo gives up at once
+// unless -w or -W is given. The lock file path is turned into a lock name.
+func TranslateCompat(args []string) ([]string, error) {
+	var style string
+	if strings.HasPrefix(args[0], "--compat=") {
+		style, args = strings.TrimPrefix(args[0], "--compat="), args[1:]
+	} else if len(args) > 1 {
+		style, args = args[1], args[2:]
+	} else {
+		return nil, fmt.Errorf("--compat requires a style: %s or %s", CompatSetlock, CompatLckdo)
+	}
+
+	var timeout int
+	var quiet bool
+	var err error
+	switch style {
+	case CompatSetlock:
+		timeout = compatWaitForever
+		args, err = compatOptions(args, "", func(opt byte, _ string) error {
+			switch opt {
+			case 'n':
+				timeout = 0
+			case 'N':
+				timeout = compatWaitForever
+			case 'X':
+				// Failing when the lock cannot be taken is mylock's only behavior
+			default:
+				return fmt.Errorf("setlock option -%c is not supported", opt)
+			}
+			return nil
+		})
+	case CompatLckdo:
+		args, err = compatOptions(args, "W", func(opt byte, value string) error {
+			switch opt {
+			case 'w':
+				timeout = compatWaitForever
+			case 'W':
+				seconds, err := strconv.Atoi(value)
+				if err != nil || seconds < 0 {
+					return fmt.Errorf("invalid lckdo -W value %q", value)
+				}
+				timeout = seconds
+			case 'q':
+				quiet = true
+			default:
+				return fmt.Errorf("lckdo option -%c is not supported", opt)
+			}
+			return nil
+		})
+	default:
+		return nil, fmt.Errorf("invalid --compat style %q (use %s or %s)", style, CompatSetlock, CompatLckdo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("--compat %s requires a lock file and a command", style)
+	}
+
+	translated := []string{"--lock-name", CompatLockName(args[0]), "--timeout", strconv.Itoa(timeout)}
+	if quiet {
+		translated = append(translated, "--quiet")
+	}
+	return append(append(translated, "--"), args[1:]...), nil
+}
+
+// compatOptions parses getopt-style short options, which may be grouped as
+// in "-nx", until the first argument that is not an option or until "--".
+// Options listed in withValue take the rest of their argument or the next
+// one as a value. It returns the remaining arguments.
+func compatOptions(args []string, withValue string, set func(opt byte, value string) error) ([]string, error) {
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i := 1; i < len(arg); i++ {
+			opt := arg[i]
+			if !strings.ContainsRune(withValue, rune(opt)) {
+				if err := set(opt, ""); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			value := arg[i+1:]
+			if value == "" {
+				if len(args) == 0 {
+					return nil, fmt.Errorf("option -%c requires a value", opt)
+				}
+				value, args = args[0], args[1:]
+			}
+			if err := set(opt, value); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return args, nil
+}
+
+// CompatLockName turns a setlock or lckdo lock file path into a lock name.
+// A path that is already a valid lock name is kept. Otherwise the leading
+// slash is dropped, other characters not allowed in lock names become "_",
+// and a hash of the path is added, so paths that only differ in those
+// characters still name different locks, e.g. "/var/lock/backup.lock"
+// becomes "var_lock_backup.lock.<hash>". The name is then shortened with
+// FitLockName.
+func CompatLockName(path string) string {
+	name := compatInvalidChars.ReplaceAllString(strings.TrimLeft(path, "/"), "_")
+	for strings.Contains(name, "..") {
+		name = strings.ReplaceAll(name, "..", "_")
+	}
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	if name != path {
+		name = strings.TrimRight(name, ".-")
+		if name == "" {
+			name = "_"
+		}
+		name += hashSuffix(path)
+	}
+	return FitLockName(name)
+}
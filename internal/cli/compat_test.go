@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateCompat(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "setlock waits by default",
+			args: []string{"--compat", "setlock", "/var/lock/backup.lock", "backup.sh", "-v"},
+			want: []string{"--lock-name", "var_lock_backup.lock.9e298e7024ab", "--timeout", "31536000", "--", "backup.sh", "-v"},
+		},
+		{
+			name: "setlock -n does not wait",
+			args: []string{"--compat=setlock", "-n", "backup", "backup.sh"},
+			want: []string{"--lock-name", "backup", "--timeout", "0", "--", "backup.sh"},
+		},
+		{
+			name: "setlock grouped options, last wins",
+			args: []string{"--compat", "setlock", "-nN", "backup", "backup.sh"},
+			want: []string{"--lock-name", "backup", "--timeout", "31536000", "--", "backup.sh"},
+		},
+		{
+			name:    "setlock -x is not supported",
+			args:    []string{"--compat", "setlock", "-x", "backup", "backup.sh"},
+			wantErr: true,
+		},
+		{
+			name: "lckdo gives up at once by default",
+			args: []string{"--compat", "lckdo", "/tmp/job.lock", "job"},
+			want: []string{"--lock-name", "tmp_job.lock.f3abf37752b6", "--timeout", "0", "--", "job"},
+		},
+		{
+			name: "lckdo -w waits",
+			args: []string{"--compat", "lckdo", "-w", "-q", "job", "job"},
+			want: []string{"--lock-name", "job", "--timeout", "31536000", "--quiet", "--", "job"},
+		},
+		{
+			name: "lckdo -W with separate and attached values",
+			args: []string{"--compat", "lckdo", "-qW", "30", "job", "job"},
+			want: []string{"--lock-name", "job", "--timeout", "30", "--quiet", "--", "job"},
+		},
+		{
+			name: "lckdo -W attached",
+			args: []string{"--compat", "lckdo", "-W5", "--", "job", "job"},
+			want: []string{"--lock-name", "job", "--timeout", "5", "--", "job"},
+		},
+		{
+			name:    "lckdo -W without a value",
+			args:    []string{"--compat", "lckdo", "-W"},
+			wantErr: true,
+		},
+		{
+			name:    "missing command",
+			args:    []string{"--compat", "setlock", "backup"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown style",
+			args:    []string{"--compat", "flock", "backup", "backup.sh"},
+			wantErr: true,
+		},
+		{
+			name:    "missing style",
+			args:    []string{"--compat"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TranslateCompat(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TranslateCompat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TranslateCompat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompatLockName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"backup", "backup"},
+		{"/var/lock/backup.lock", "var_lock_backup.lock.9e298e7024ab"},
+		{"./locks/../job lock", "._locks___job_lock.4273ee12e691"},
+		{"a--b", "a-b.90827a2e5636"},
+		{"/", "_.8a5edab28263"},
+		{"/var/lock/a b", "var_lock_a_b.9ad627b237f4"},
+		{"/var/lock/a_b", "var_lock_a_b.a0459ea1e221"},
+		{"/very/long/path/that/goes/on/and/on/and/on/until/it/is/past/the/limit.lock", "very_long_path_that_goes_on_and_on_and_on_until_it_.4160baeb3f15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := CompatLockName(tt.path); got != tt.want {
+				t.Errorf("CompatLockName(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
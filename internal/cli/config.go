@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// ConfigValidateCLI holds the arguments of "mylock config validate"
+type ConfigValidateCLI struct {
+	LockName         []string `kong:"help='Lock name to check, may be repeated.'"`
+	AllowAnyLockName bool     `kong:"help='Check lock names as --allow-any-lock-name accepts them.'"`
+	UnicodeLockName  bool     `kong:"help='Check lock names as --unicode-lock-name accepts them.'"`
+	Timeout          int      `kong:"help='Timeout in seconds to check.'"`
+	JSON             bool     `kong:"name='json',help='Print the result as JSON.'"`
+}
+
+// ParseConfigValidateCLI parses the flags of "mylock config validate". The
+// environment is not read here: reporting its problems is the command's job.
+func ParseConfigValidateCLI(args []string) (ConfigValidateCLI, error) {
+	var cli ConfigValidateCLI
+
+	parser, err := newConfigValidateParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	return cli, nil
+}
+
+func newConfigValidateParser(cli *ConfigValidateCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock config validate"),
+		kong.Description("Check the MYLOCK_* settings without connecting"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(configValidateHelpFormatter),
+	)
+}
+
+// ConfigPrintCLI holds the arguments of "mylock config print"
+type ConfigPrintCLI struct {
+	LockName string `kong:"help='Print the configuration this lock name routes to.'"`
+	Target   string `kong:"help='Print the configuration of this MYLOCK_TARGETS entry.'"`
+	JSON     bool   `kong:"name='json',help='Print the configuration as JSON.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseConfigPrintCLI(args []string) (ConfigPrintCLI, error) {
+	var cli ConfigPrintCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newConfigPrintParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Target != "" && cli.LockName != "" {
+		return cli, fmt.Errorf("cannot specify both --target and --lock-name")
+	}
+
+	return cli, nil
+}
+
+func newConfigPrintParser(cli *ConfigPrintCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock config print"),
+		kong.Description("Print the effective configuration, with the password redacted"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(configPrintHelpFormatter),
+	)
+}
+
+// PrintConfigHelp prints the help of "mylock config" itself, which only
+// dispatches to its subcommands
+func PrintConfigHelp() {
+	fmt.Fprint(os.Stdout, `mylock config - Inspect mylock's configuration
+
+Usage:
+  mylock config validate [--lock-name <name>]... [--timeout <seconds>] [--json]
+  mylock config print [--target <name> | --lock-name <name>] [--json]
+
+Commands:
+  validate                 Check the MYLOCK_* settings without connecting.
+  print                    Print the effective configuration.
+
+See "mylock config <command> --help".
+`)
+}
+
+func configValidateHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock config validate - Check the MYLOCK_* settings without connecting
+
+Usage:
+  mylock config validate [--lock-name <name>]... [--allow-any-lock-name] [--unicode-lock-name]
+                         [--timeout <seconds>] [--json]
+
+Options:
+  --lock-name              Lock name to check, may be repeated.
+  --allow-any-lock-name    Check lock names as --allow-any-lock-name accepts them.
+  --unicode-lock-name      Check lock names as --unicode-lock-name accepts them.
+  --timeout                Timeout in seconds to check.
+  --json                   Print the result as JSON.
+  --help                   Show this help message.
+
+Reads the same MYLOCK_* environment variables as mylock itself, without
+connecting to MySQL or running anything, for deployment pre-flight checks.
+Exits 0 when every check passes and 201 otherwise. With --json, prints
+{"valid": true|false, "errors": [...]}.
+`)
+	return nil
+}
+
+func configPrintHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock config print - Print the effective configuration, with the password redacted
+
+Usage:
+  mylock config print [--target <name> | --lock-name <name>] [--json]
+
+Options:
+  --lock-name              Print the configuration this lock name routes to.
+  --target                 Print the configuration of this MYLOCK_TARGETS entry.
+  --json                   Print the configuration as JSON.
+  --help                   Show this help message.
+
+Shows every setting as mylock resolves it from the MYLOCK_* environment
+variables, and which variable it came from, or "default". Target settings
+that are not set with MYLOCK_TARGET_<NAME>_* are inherited from the main
+ones. The password is never printed, only whether it is set.
+`)
+	return nil
+}
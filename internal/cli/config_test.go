@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseConfigValidateCLI(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    ConfigValidateCLI
+		wantErr bool
+	}{
+		{
+			name: "no flags",
+			args: []string{},
+			want: ConfigValidateCLI{},
+		},
+		{
+			name: "lock names, timeout and json",
+			args: []string{"--lock-name", "nightly", "--lock-name", "reports.daily", "--timeout", "30", "--json"},
+			want: ConfigValidateCLI{LockName: []string{"nightly", "reports.daily"}, Timeout: 30, JSON: true},
+		},
+		{
+			name: "lock name policy",
+			args: []string{"--lock-name", "tenant:42", "--allow-any-lock-name", "--unicode-lock-name"},
+			want: ConfigValidateCLI{LockName: []string{"tenant:42"}, AllowAnyLockName: true, UnicodeLockName: true},
+		},
+		{
+			name:    "non-numeric timeout",
+			args:    []string{"--timeout", "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConfigValidateCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConfigValidateCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseConfigValidateCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigPrintCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    ConfigPrintCLI
+		wantErr bool
+	}{
+		{
+			name: "no flags",
+			args: []string{},
+			want: ConfigPrintCLI{Config: wantConfig},
+		},
+		{
+			name: "lock name as json",
+			args: []string{"--lock-name", "nightly", "--json"},
+			want: ConfigPrintCLI{LockName: "nightly", JSON: true, Config: wantConfig},
+		},
+		{
+			name:    "target and lock name",
+			args:    []string{"--target", "reports", "--lock-name", "nightly"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+
+			got, err := ParseConfigPrintCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConfigPrintCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseConfigPrintCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// ContendCLI holds the arguments of the "mylock contend" subcommand
+type ContendCLI struct {
+	LockName string        `kong:"arg,name='lock-name',help='Lock to observe.'"`
+	Duration time.Duration `kong:"default='60s',help='How long to sample the lock.'"`
+	Interval time.Duration `kong:"default='1s',help='Time between samples.'"`
+	Target   string        `kong:"help='MYLOCK_TARGETS entry the lock is on.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseContendCLI(args []string) (ContendCLI, error) {
+	var cli ContendCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newContendParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Duration <= 0 {
+		return cli, fmt.Errorf("--duration must be positive")
+	}
+	if cli.Interval <= 0 {
+		return cli, fmt.Errorf("--interval must be positive")
+	}
+	if cli.Interval > cli.Duration {
+		return cli, fmt.Errorf("--interval cannot be longer than --duration")
+	}
+
+	return cli, nil
+}
+
+func newContendParser(cli *ContendCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock contend"),
+		kong.Description("Sample how often a lock is held, and by whom"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(contendHelpFormatter),
+	)
+}
+
+func contendHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock contend - Sample how often a lock is held, and by whom
+
+Usage:
+  mylock contend <lock-name> [--duration 60s] [--interval 1s] [--target <name>]
+
+Options:
+  --duration               How long to sample the lock. Default: 60s.
+  --interval               Time between samples. Default: 1s.
+  --target                 MYLOCK_TARGETS entry the lock is on, instead of routing by
+                           lock name prefix.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+The lock is only observed with IS_USED_LOCK(), never taken. The report shows
+the share of samples the lock was held in, how many times it changed hands,
+and each holding session as user@host from the processlist (this needs the
+PROCESS privilege to see other accounts' sessions). A lock held in most
+samples by many different hosts is a candidate for --shard-key.
+`)
+	return nil
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseContendCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    ContendCLI
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			args: []string{"nightly-report"},
+			want: ContendCLI{LockName: "nightly-report", Duration: time.Minute, Interval: time.Second, Config: wantConfig},
+		},
+		{
+			name: "custom duration and interval",
+			args: []string{"nightly-report", "--duration", "10m", "--interval", "200ms", "--target", "reports"},
+			want: ContendCLI{LockName: "nightly-report", Duration: 10 * time.Minute, Interval: 200 * time.Millisecond, Target: "reports", Config: wantConfig},
+		},
+		{
+			name:    "missing lock name",
+			args:    []string{},
+			wantErr: true,
+		},
+		{
+			name:    "zero interval",
+			args:    []string{"nightly-report", "--interval", "0s"},
+			wantErr: true,
+		},
+		{
+			name:    "interval longer than duration",
+			args:    []string{"nightly-report", "--duration", "1s", "--interval", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+
+			got, err := ParseContendCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContendCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseContendCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/schedule"
+)
+
+// CronCLI holds the arguments of "mylock cron": its own flags, and the
+// flags and command of each locked run
+type CronCLI struct {
+	Schedule *schedule.Schedule
+	Splay    time.Duration
+	// RunArgs are passed to mylock for every run
+	RunArgs []string
+}
+
+// ParseCronCLI separates --schedule and --splay from the arguments of each
+// run, which are checked the way mylock itself would parse them
+func ParseCronCLI(args []string) (CronCLI, error) {
+	var cli CronCLI
+	var spec, splay string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			cli.RunArgs = append(cli.RunArgs, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if name != "--schedule" && name != "--splay" {
+			cli.RunArgs = append(cli.RunArgs, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return cli, fmt.Errorf("%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if name == "--schedule" {
+			spec = value
+		} else {
+			splay = value
+		}
+	}
+
+	if spec == "" {
+		return cli, fmt.Errorf("--schedule is required, e.g. --schedule '*/5 * * * *'")
+	}
+	sched, err := schedule.Parse(spec)
+	if err != nil {
+		return cli, fmt.Errorf("invalid --schedule: %w", err)
+	}
+	cli.Schedule = sched
+	if splay != "" {
+		if cli.Splay, err = time.ParseDuration(splay); err != nil || cli.Splay < 0 {
+			return cli, fmt.Errorf("invalid --splay %q, e.g. --splay 30s", splay)
+		}
+	}
+
+	if _, err := ParseCLI(cli.RunArgs); err != nil {
+		return cli, err
+	}
+	return cli, nil
+}
+
+// PrintCronHelp prints the help of "mylock cron"
+func PrintCronHelp() {
+	fmt.Fprint(os.Stdout, `mylock cron - Run a locked job on a schedule, without crond
+
+Usage:
+  mylock cron --schedule '<cron expression>' [--splay <duration>] <mylock flags> -- <command> [args...]
+
+Options:
+  --schedule               Required. When to run, as five cron fields (minute hour
+                           day-of-month month day-of-week) in local time, e.g. '*/5 * * * *'
+                           or '30 2 * * mon-fri', or @hourly, @daily, @weekly, @monthly.
+  --splay                  Delay each run by a random time up to this (e.g., 30s), so
+                           replicas started from one image do not all hit MySQL at once.
+  --help                   Show this help message.
+
+All other flags, such as --lock-name and --timeout, are those of mylock itself
+and apply to every run. Meant as the long-lived process of a container: each
+run is a separate mylock process taking the lock, so replicas of the same job
+do not overlap, and a run still going when the next one is due keeps it from
+starting; with --timeout 0 that run exits 200 at once. SIGINT or SIGTERM stops
+scheduling, is passed on to the runs in progress, and mylock cron exits once
+they have finished.
+`)
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCronCLI(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantSplay   time.Duration
+		wantRunArgs []string
+		wantErr     bool
+	}{
+		{
+			name:        "schedule",
+			args:        []string{"--schedule", "*/5 * * * *", "--lock-name", "report", "--timeout", "0", "--", "report.sh", "--splay"},
+			wantRunArgs: []string{"--lock-name", "report", "--timeout", "0", "--", "report.sh", "--splay"},
+		},
+		{
+			name:        "with splay",
+			args:        []string{"--lock-name", "report", "--splay=30s", "--schedule=@hourly", "--timeout", "5", "--", "report.sh"},
+			wantSplay:   30 * time.Second,
+			wantRunArgs: []string{"--lock-name", "report", "--timeout", "5", "--", "report.sh"},
+		},
+		{
+			name:    "missing schedule",
+			args:    []string{"--lock-name", "report", "--timeout", "5", "--", "report.sh"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid schedule",
+			args:    []string{"--schedule", "every 5 minutes", "--lock-name", "report", "--timeout", "5", "--", "report.sh"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid splay",
+			args:    []string{"--schedule", "@daily", "--splay", "-1s", "--lock-name", "report", "--timeout", "5", "--", "report.sh"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid run arguments",
+			args:    []string{"--schedule", "@daily", "--timeout", "5", "--", "report.sh"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCronCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCronCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Schedule == nil || got.Splay != tt.wantSplay || !reflect.DeepEqual(got.RunArgs, tt.wantRunArgs) {
+				t.Errorf("ParseCronCLI() = %+v, want splay %v and run args %q", got, tt.wantSplay, tt.wantRunArgs)
+			}
+		})
+	}
+}
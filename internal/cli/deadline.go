@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDeadline reads an absolute deadline given as RFC 3339 time or as Unix
+// epoch seconds, which may have a fractional part
+func ParseDeadline(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 time nor Unix epoch seconds", value)
+	}
+	whole := int64(seconds)
+	return time.Unix(whole, int64((seconds-float64(whole))*float64(time.Second))), nil
+}
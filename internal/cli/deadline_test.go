@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "RFC 3339 UTC",
+			value: "2030-01-02T03:04:05Z",
+			want:  time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			name:  "RFC 3339 with offset",
+			value: "2030-01-02T12:04:05+09:00",
+			want:  time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			name:  "epoch seconds",
+			value: "1893553445",
+			want:  time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			name:  "fractional epoch seconds",
+			value: " 1893553445.5\n",
+			want:  time.Date(2030, 1, 2, 3, 4, 5, 500_000_000, time.UTC),
+		},
+		{
+			name:    "duration is not a deadline",
+			value:   "10m",
+			wantErr: true,
+		},
+		{
+			name:    "date without time",
+			value:   "2030-01-02",
+			wantErr: true,
+		},
+		{
+			name:    "zero epoch",
+			value:   "0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDeadline(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDeadline(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ParseDeadline(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+)
+
+// Formats of "mylock docs"
+const (
+	DocsFormatMan      = "man"
+	DocsFormatMarkdown = "markdown"
+)
+
+// DocsCLI holds the arguments of the "mylock docs" subcommand
+type DocsCLI struct {
+	Format string `kong:"arg,enum='man,markdown',help='Documentation format: man or markdown.'"`
+}
+
+func ParseDocsCLI(args []string) (DocsCLI, error) {
+	var cli DocsCLI
+
+	parser, err := kong.New(&cli,
+		kong.Name("mylock docs"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(docsHelpFormatter),
+	)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	return cli, nil
+}
+
+// Models returns the kong models of mylock and of each subcommand that
+// takes options, for generating reference documentation
+func Models() ([]*kong.Application, error) {
+	root, err := newParser(&CLI{})
+	if err != nil {
+		return nil, err
+	}
+	bench, err := newBenchParser(&BenchCLI{})
+	if err != nil {
+		return nil, err
+	}
+	whoami, err := newWhoamiParser(&WhoamiCLI{})
+	if err != nil {
+		return nil, err
+	}
+	wait, err := newWaitParser(&WaitCLI{})
+	if err != nil {
+		return nil, err
+	}
+	contend, err := newContendParser(&ContendCLI{})
+	if err != nil {
+		return nil, err
+	}
+	configValidate, err := newConfigValidateParser(&ConfigValidateCLI{})
+	if err != nil {
+		return nil, err
+	}
+	configPrint, err := newConfigPrintParser(&ConfigPrintCLI{})
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := newSnapshotParser(&SnapshotCLI{})
+	if err != nil {
+		return nil, err
+	}
+	hold, err := newHoldParser(&HoldCLI{})
+	if err != nil {
+		return nil, err
+	}
+	blockSet, err := newBlockSetParser(&BlockSetCLI{})
+	if err != nil {
+		return nil, err
+	}
+	blockClear, err := newBlockClearParser(&BlockClearCLI{})
+	if err != nil {
+		return nil, err
+	}
+	blockStatus, err := newBlockStatusParser(&BlockStatusCLI{})
+	if err != nil {
+		return nil, err
+	}
+	requireHeld, err := newRequireHeldParser(&RequireHeldCLI{})
+	if err != nil {
+		return nil, err
+	}
+	return []*kong.Application{root.Model, bench.Model, whoami.Model, wait.Model, contend.Model, configValidate.Model, configPrint.Model, snapshot.Model, hold.Model,
+		blockSet.Model, blockClear.Model, blockStatus.Model, requireHeld.Model}, nil
+}
+
+func docsHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock docs - Generate reference documentation
+
+Usage:
+  mylock docs man > mylock.1
+  mylock docs markdown > mylock.md
+
+Arguments:
+  man                      A roff man page for section 1.
+  markdown                 A Markdown page, e.g. for a wiki.
+
+Options:
+  --help                   Show this help message.
+
+The documentation is generated from the same option definitions mylock parses.
+`)
+	return nil
+}
@@ -0,0 +1,45 @@
+package cli
+
+import "testing"
+
+func TestParseDocsCLI(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "man", args: []string{"man"}, want: DocsFormatMan},
+		{name: "markdown", args: []string{"markdown"}, want: DocsFormatMarkdown},
+		{name: "unknown format", args: []string{"html"}, wantErr: true},
+		{name: "missing format", args: []string{}, wantErr: true},
+		{name: "help", args: []string{"--help"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDocsCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDocsCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Format != tt.want {
+				t.Errorf("ParseDocsCLI() format = %q, want %q", got.Format, tt.want)
+			}
+		})
+	}
+}
+
+func TestModels(t *testing.T) {
+	models, err := Models()
+	if err != nil {
+		t.Fatalf("Models() error = %v", err)
+	}
+	if len(models) != 13 || models[0].Name != "mylock" {
+		t.Fatalf("Models() = %d models, want mylock and its subcommands", len(models))
+	}
+	for _, flag := range models[0].Flags {
+		if flag.Name != "help" && flag.Help == "" {
+			t.Errorf("flag --%s has no help text", flag.Name)
+		}
+	}
+}
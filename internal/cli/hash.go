@@ -3,7 +3,10 @@ package cli
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"hash/fnv"
 	"strings"
+	"unicode/utf8"
 )
 
 // HashCommand generates a deterministic lock name from a command
@@ -26,3 +29,50 @@ func HashCommand(command []string) string {
 
 	return lockName
 }
+
+// ShardLockName derives the lock name of the shard that key hashes to, as
+// "<name>.<shard>" with shard in [0, shards). The name is shortened with
+// FitLockName if needed so the result still fits MySQL's 64 character limit.
+func ShardLockName(name, key string, shards int) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	suffix := fmt.Sprintf(".%d", h.Sum32()%uint32(shards))
+
+	return fitLockName(name, MaxLockNameBytes-len(suffix)) + suffix
+}
+
+// MaxLockNameBytes is MySQL's limit on lock names, counted in bytes so that
+// a name also fits with multi-byte characters
+const MaxLockNameBytes = 64
+
+// fitHashLen is how many hex digits of the full name's hash a shortened
+// name ends with
+const fitHashLen = 12
+
+// FitLockName returns name unchanged if it fits in 64 bytes. A longer name
+// is cut and ends with "." and a hash of the whole name instead, so two
+// long names that only differ past the cut still name different locks.
+func FitLockName(name string) string {
+	return fitLockName(name, MaxLockNameBytes)
+}
+
+// hashSuffix is "." and the first fitHashLen hex digits of the SHA256 of s
+func hashSuffix(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return "." + hex.EncodeToString(hash[:])[:fitHashLen]
+}
+
+func fitLockName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	suffix := hashSuffix(name)
+
+	// Do not split a multi-byte character, or end in a separator that would
+	// double up with the "." before the hash
+	cut := max - len(suffix)
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return strings.TrimRight(name[:cut], ".-") + suffix
+}
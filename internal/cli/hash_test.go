@@ -1,7 +1,12 @@
 package cli
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/yammerjp/mylock/internal/locker"
 )
 
 func TestHashCommand(t *testing.T) {
@@ -65,3 +70,118 @@ func TestHashCommand(t *testing.T) {
 		})
 	}
 }
+
+func FuzzHashCommand(f *testing.F) {
+	f.Add("echo", "hello")
+	f.Add("sh", "-c")
+	f.Add("", "")
+	f.Add("ロック", "\u200b")
+	f.Add("line\nbreak", "tab\targ")
+
+	f.Fuzz(func(t *testing.T, name, arg string) {
+		command := []string{name, arg}
+		got := HashCommand(command)
+
+		if len(got) != 64 {
+			t.Fatalf("HashCommand(%q) has length %d, want 64", command, len(got))
+		}
+		if !strings.HasPrefix(got, "mylock-") {
+			t.Fatalf("HashCommand(%q) = %q, want mylock- prefix", command, got)
+		}
+		for _, r := range strings.TrimPrefix(got, "mylock-") {
+			if !strings.ContainsRune("0123456789abcdef", r) {
+				t.Fatalf("HashCommand(%q) = %q contains non-hex character %q", command, got, r)
+			}
+		}
+		if again := HashCommand([]string{name, arg}); again != got {
+			t.Fatalf("HashCommand(%q) is not deterministic: %q then %q", command, got, again)
+		}
+
+		// Argument boundaries must matter. Real arguments cannot contain NUL,
+		// which is the separator used for hashing.
+		if !strings.Contains(name+arg, "\x00") {
+			if joined := HashCommand([]string{name + " " + arg}); joined == got {
+				t.Fatalf("HashCommand(%q) collides with the single-argument form", command)
+			}
+		}
+	})
+}
+
+func TestShardLockName(t *testing.T) {
+	// The same key always maps to the same shard
+	first := ShardLockName("reports", "tenant-42", 8)
+	if got := ShardLockName("reports", "tenant-42", 8); got != first {
+		t.Errorf("ShardLockName() = %q, then %q for the same key", first, got)
+	}
+	if !strings.HasPrefix(first, "reports.") {
+		t.Errorf("ShardLockName() = %q, want a reports.<shard> name", first)
+	}
+
+	// Keys spread over every shard, and never beyond
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		seen[ShardLockName("reports", fmt.Sprintf("tenant-%d", i), 4)] = true
+	}
+	want := map[string]bool{"reports.0": true, "reports.1": true, "reports.2": true, "reports.3": true}
+	if len(seen) != len(want) {
+		t.Errorf("ShardLockName() produced %v, want %v", seen, want)
+	}
+	for name := range seen {
+		if !want[name] {
+			t.Errorf("ShardLockName() produced unexpected %q", name)
+		}
+	}
+
+	// A single shard is the base name with suffix .0
+	if got := ShardLockName("reports", "anything", 1); got != "reports.0" {
+		t.Errorf("ShardLockName() with one shard = %q, want reports.0", got)
+	}
+
+	// Long names are shortened to fit the 64 character limit
+	long := HashCommand([]string{"echo", "hello"})
+	got := ShardLockName(long, "tenant-1", 16)
+	if len(got) > 64 {
+		t.Errorf("ShardLockName() = %q, longer than 64 characters", got)
+	}
+	if !strings.HasPrefix(got, long[:40]) {
+		t.Errorf("ShardLockName() = %q, want it to start with %q", got, long[:40])
+	}
+}
+
+func TestFitLockName(t *testing.T) {
+	short := "reports.daily"
+	if got := FitLockName(short); got != short {
+		t.Errorf("FitLockName(%q) = %q, want it unchanged", short, got)
+	}
+	exact := strings.Repeat("a", 64)
+	if got := FitLockName(exact); got != exact {
+		t.Errorf("FitLockName() changed a 64 byte name to %q", got)
+	}
+
+	// Long names that only differ past the cut stay distinct
+	base := "tenant.acme-corporation.reports.monthly-revenue-by-region-and-product-line."
+	first, second := FitLockName(base+"emea"), FitLockName(base+"apac")
+	if first == second {
+		t.Errorf("FitLockName() = %q for two different names", first)
+	}
+	for _, got := range []string{first, second} {
+		if len(got) > 64 {
+			t.Errorf("FitLockName() = %q, %d bytes", got, len(got))
+		}
+		if !strings.HasPrefix(got, base[:40]) {
+			t.Errorf("FitLockName() = %q, want it to keep the start of the name", got)
+		}
+		if err := locker.ValidateLockName(got); err != nil {
+			t.Errorf("FitLockName() = %q, rejected: %v", got, err)
+		}
+	}
+	if FitLockName(base+"emea") != first {
+		t.Error("FitLockName() is not deterministic")
+	}
+
+	// Multi-byte characters are not split
+	unicodeName := strings.Repeat("ロ", 30)
+	if got := FitLockName(unicodeName); len(got) > 64 || !utf8.ValidString(got) {
+		t.Errorf("FitLockName() = %q, want at most 64 bytes of valid UTF-8", got)
+	}
+}
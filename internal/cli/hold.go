@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// HoldCLI holds the arguments of the "mylock hold" subcommand
+type HoldCLI struct {
+	LockName string        `kong:"required,name='lock-name',help='Lock to hold.'"`
+	Duration time.Duration `kong:"help='How long to hold the lock; until interrupted if not set.'"`
+	Timeout  int           `kong:"default='60',env='MYLOCK_TIMEOUT',help='Max seconds to wait for the lock.'"`
+	Target   string        `kong:"help='MYLOCK_TARGETS entry the lock is on.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseHoldCLI(args []string) (HoldCLI, error) {
+	var cli HoldCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newHoldParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Duration < 0 {
+		return cli, fmt.Errorf("--duration must not be negative")
+	}
+	if cli.Timeout < 0 {
+		return cli, fmt.Errorf("--timeout must not be negative")
+	}
+
+	return cli, nil
+}
+
+func newHoldParser(cli *HoldCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock hold"),
+		kong.Description("Take a lock and hold it, to keep jobs from running"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(holdHelpFormatter),
+	)
+}
+
+func holdHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock hold - Take a lock and hold it, to keep jobs from running
+
+Usage:
+  mylock hold --lock-name <name> [--duration 2h] [--timeout <seconds>] [--target <name>]
+
+Options:
+  --lock-name              Required. Lock to hold.
+  --duration               How long to hold the lock. Without it, the lock is held until
+                           mylock hold is interrupted with Ctrl-C or SIGTERM.
+  --timeout                Max seconds to wait for the lock, e.g. for a running job to
+                           finish. Default: MYLOCK_TIMEOUT, or 60.
+  --target                 MYLOCK_TARGETS entry the lock is on, instead of routing by
+                           lock name prefix.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+Meant for maintenance: jobs that use the lock wait or time out while it is
+held. The session is checked periodically, which also keeps it from going
+idle. Exits 0 once the lock is released, 200 if it could not be taken within
+--timeout and 203 if the lock was lost while held.
+`)
+	return nil
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseHoldCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    HoldCLI
+		wantErr bool
+	}{
+		{
+			name: "until interrupted",
+			args: []string{"--lock-name", "nightly-report"},
+			want: HoldCLI{LockName: "nightly-report", Timeout: 60, Config: wantConfig},
+		},
+		{
+			name: "for a duration",
+			args: []string{"--lock-name", "nightly-report", "--duration", "2h", "--timeout", "600", "--target", "reports"},
+			want: HoldCLI{LockName: "nightly-report", Duration: 2 * time.Hour, Timeout: 600, Target: "reports", Config: wantConfig},
+		},
+		{
+			name:    "missing lock name",
+			args:    []string{"--duration", "2h"},
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			args:    []string{"--lock-name", "nightly-report", "--duration=-1h"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+			if old, had := os.LookupEnv("MYLOCK_TIMEOUT"); had {
+				os.Unsetenv("MYLOCK_TIMEOUT")
+				defer os.Setenv("MYLOCK_TIMEOUT", old)
+			}
+
+			got, err := ParseHoldCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHoldCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHoldCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
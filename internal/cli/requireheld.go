@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// RequireHeldCLI holds the arguments of the "mylock require-lock-held" subcommand
+type RequireHeldCLI struct {
+	LockName string   `kong:"arg,name='lock-name',help='Lock that must be held.'"`
+	RunID    string   `kong:"name='run-id',env='MYLOCK_RUN_ID',help='mylock run that must hold the lock.'"`
+	Target   string   `kong:"help='MYLOCK_TARGETS entry the lock is on.'"`
+	Command  []string `kong:"arg,required,name='command',help='Command to run if the lock is held.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseRequireHeldCLI(args []string) (RequireHeldCLI, error) {
+	var cli RequireHeldCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newRequireHeldParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	return cli, nil
+}
+
+func newRequireHeldParser(cli *RequireHeldCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock require-lock-held"),
+		kong.Description("Run a command only while a lock is held by its parent run"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(requireHeldHelpFormatter),
+	)
+}
+
+func requireHeldHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock require-lock-held - Run a command only while a lock is held by its parent run
+
+Usage:
+  mylock require-lock-held <lock-name> [--run-id <id>] [--target <name>] -- <command> [args...]
+
+Options:
+  --run-id                 Also require the lock to be held by this mylock run. Default:
+                           MYLOCK_RUN_ID, which mylock sets for the command it runs, so
+                           a helper started by a locked job checks that job's own run.
+  --target                 MYLOCK_TARGETS entry the lock is on, instead of routing by
+                           lock name prefix.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+Meant for helper scripts that must only run as a step of a locked job: the
+lock is observed with IS_USED_LOCK(), never taken, and the run holding it is
+read from performance_schema.session_connect_attrs. Runs the command and
+exits with its exit code if the lock is held, or exits 203 without running
+it if the lock is free or held by another run. Set MYLOCK_RUN_ID= (empty) to
+accept any holder.
+`)
+	return nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseRequireHeldCLI(t *testing.T) {
+	t.Setenv("MYLOCK_HOST", "localhost")
+	t.Setenv("MYLOCK_USER", "testuser")
+	t.Setenv("MYLOCK_PASSWORD", "testpass")
+	t.Setenv("MYLOCK_DATABASE", "testdb")
+	t.Setenv("MYLOCK_RUN_ID", "")
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		want    RequireHeldCLI
+		wantErr bool
+	}{
+		{
+			name: "any holder",
+			args: []string{"nightly", "--", "./step.sh", "--fast"},
+			want: RequireHeldCLI{LockName: "nightly", Command: []string{"./step.sh", "--fast"}, Config: wantConfig},
+		},
+		{
+			name: "run id from the parent",
+			env:  "0190a5d2c4e8",
+			args: []string{"nightly", "--target", "reports", "--", "./step.sh"},
+			want: RequireHeldCLI{LockName: "nightly", RunID: "0190a5d2c4e8", Target: "reports", Command: []string{"./step.sh"}, Config: wantConfig},
+		},
+		{
+			name: "run id flag",
+			env:  "0190a5d2c4e8",
+			args: []string{"nightly", "--run-id", "other", "--", "./step.sh"},
+			want: RequireHeldCLI{LockName: "nightly", RunID: "other", Command: []string{"./step.sh"}, Config: wantConfig},
+		},
+		{
+			name:    "missing command",
+			args:    []string{"nightly"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MYLOCK_RUN_ID", tt.env)
+			got, err := ParseRequireHeldCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRequireHeldCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRequireHeldCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
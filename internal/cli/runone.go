@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+// RunOneArgs rewrites "mylock run-one [--] <command> [args...]" into mylock's
+// own flags. Like Ubuntu's run-one, the lock is keyed on the invoking user
+// and the exact command, and a run that finds it taken gives up at once.
+func RunOneArgs(args []string, user string) ([]string, error) {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("run-one requires a command")
+	}
+	if user == "" {
+		return nil, fmt.Errorf("run-one could not determine the invoking user")
+	}
+	return append([]string{"--lock-name", RunOneLockName(user, args), "--timeout", "0", "--"}, args...), nil
+}
+
+// RunOneLockName is the lock name of a run-one command: the command hash of
+// HashCommand, with the user and a "run-one" marker hashed in, so the same
+// command run by another user or with --lock-name-from-command does not
+// contend with it
+func RunOneLockName(user string, command []string) string {
+	return HashCommand(append([]string{"run-one", user}, command...))
+}
+
+// PrintRunOneHelp prints the help of "mylock run-one"
+func PrintRunOneHelp() {
+	fmt.Fprint(os.Stdout, `mylock run-one - Run a command unless the same user is already running it
+
+Usage:
+  mylock run-one [--] <command> [args...]
+
+A drop-in for Ubuntu's run-one across a fleet: the lock name is derived from
+the invoking user and the command with its arguments, and if another run holds
+it, mylock exits 200 without running the command instead of waiting.
+Uses the same MYLOCK_* environment variables as mylock itself.
+`)
+}
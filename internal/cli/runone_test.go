@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunOneArgs(t *testing.T) {
+	name := RunOneLockName("alice", []string{"backup.sh", "-v"})
+	tests := []struct {
+		name    string
+		args    []string
+		user    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "command",
+			args: []string{"backup.sh", "-v"},
+			user: "alice",
+			want: []string{"--lock-name", name, "--timeout", "0", "--", "backup.sh", "-v"},
+		},
+		{
+			name: "command after --",
+			args: []string{"--", "backup.sh", "-v"},
+			user: "alice",
+			want: []string{"--lock-name", name, "--timeout", "0", "--", "backup.sh", "-v"},
+		},
+		{
+			name:    "no command",
+			args:    []string{"--"},
+			user:    "alice",
+			wantErr: true,
+		},
+		{
+			name:    "unknown user",
+			args:    []string{"backup.sh"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RunOneArgs(tt.args, tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunOneArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RunOneArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunOneLockName(t *testing.T) {
+	command := []string{"backup.sh", "-v"}
+	name := RunOneLockName("alice", command)
+	if len(name) > 64 {
+		t.Errorf("RunOneLockName() = %q, longer than 64 characters", name)
+	}
+	if name == RunOneLockName("bob", command) {
+		t.Error("RunOneLockName() should differ between users")
+	}
+	if name == HashCommand(command) {
+		t.Error("RunOneLockName() should differ from HashCommand()")
+	}
+	if name != RunOneLockName("alice", []string{"backup.sh", "-v"}) {
+		t.Error("RunOneLockName() should be deterministic")
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CoreLimitUnlimited is what ParseCoreLimit returns for "unlimited"
+const CoreLimitUnlimited = math.MaxUint64
+
+// ParseCoreLimit reads a --core-limit value: "unlimited" or a size in
+// bytes, optionally with a K, M, G or T suffix for powers of 1024
+func ParseCoreLimit(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "unlimited") {
+		return CoreLimitUnlimited, nil
+	}
+	size, err := ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither unlimited nor a size such as 0, 512M or 2G", value)
+	}
+	return size, nil
+}
+
+// ParseSize reads a size in bytes, optionally with a K, M, G or T suffix
+// for powers of 1024, e.g. 10G
+func ParseSize(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimSuffix(strings.ToUpper(value), "B")
+	shift := 0
+	if n := len(number); n > 0 {
+		if i := strings.IndexByte("KMGT", number[n-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			number = number[:n-1]
+		}
+	}
+	size, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || size > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("%q is not a size such as 512M or 10G", value)
+	}
+	return size << shift, nil
+}
@@ -0,0 +1,46 @@
+package cli
+
+import "testing"
+
+func TestParseCoreLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{value: "0", want: 0},
+		{value: "unlimited", want: CoreLimitUnlimited},
+		{value: "Unlimited", want: CoreLimitUnlimited},
+		{value: "4096", want: 4096},
+		{value: "512k", want: 512 << 10},
+		{value: "512M", want: 512 << 20},
+		{value: "2G", want: 2 << 30},
+		{value: "2GB", want: 2 << 30},
+		{value: "1T", want: 1 << 40},
+		{value: "", wantErr: true},
+		{value: "M", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "1.5G", wantErr: true},
+		{value: "10P", wantErr: true},
+		{value: "18446744073709551615T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCoreLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCoreLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseCoreLimit(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	if got, err := ParseSize("10G"); err != nil || got != uint64(10)<<30 {
+		t.Errorf("ParseSize(10G) = %d, %v, want %d", got, err, uint64(10)<<30)
+	}
+	if _, err := ParseSize("unlimited"); err == nil {
+		t.Errorf("ParseSize(unlimited) succeeded, want an error")
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// SnapshotCLI holds the arguments of the "mylock snapshot" subcommand
+type SnapshotCLI struct {
+	Target   string `kong:"help='MYLOCK_TARGETS entry to read.'"`
+	LockName string `kong:"help='Read the target this lock name routes to.'"`
+	JSON     bool   `kong:"name='json',help='Print the snapshot as one JSON document.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseSnapshotCLI(args []string) (SnapshotCLI, error) {
+	var cli SnapshotCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newSnapshotParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Target != "" && cli.LockName != "" {
+		return cli, fmt.Errorf("cannot specify both --target and --lock-name")
+	}
+
+	return cli, nil
+}
+
+func newSnapshotParser(cli *SnapshotCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock snapshot"),
+		kong.Description("Dump the held locks, waiters and dedupe records of a server"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(snapshotHelpFormatter),
+	)
+}
+
+func snapshotHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock snapshot - Dump the held locks, waiters and dedupe records of a server
+
+Usage:
+  mylock snapshot [--target <name> | --lock-name <name>] [--json]
+
+Options:
+  --target                 MYLOCK_TARGETS entry to read.
+  --lock-name              Read the target this lock name routes to.
+  --json                   Print the snapshot as one JSON document, for scraping
+                           into monitoring.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself. The snapshot lists:
+  - every user lock held on the server, with the holding session, from
+    performance_schema.metadata_locks (MySQL) or information_schema.METADATA_LOCK_INFO
+    (MariaDB, needs the metadata_lock_info plugin);
+  - every session waiting in GET_LOCK(), with the lock name, host and run id of
+    mylock's own waiters;
+  - the mylock_dedupe records of --dedupe-window.
+Other sessions are only visible with the PROCESS privilege. A part that cannot
+be read is listed under errors, and the rest is still printed.
+`)
+	return nil
+}
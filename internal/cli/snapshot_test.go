@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseSnapshotCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    SnapshotCLI
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			args: []string{},
+			want: SnapshotCLI{Config: wantConfig},
+		},
+		{
+			name: "json for a target",
+			args: []string{"--target", "reports", "--json"},
+			want: SnapshotCLI{Target: "reports", JSON: true, Config: wantConfig},
+		},
+		{
+			name:    "target and lock name",
+			args:    []string{"--target", "reports", "--lock-name", "reports.daily"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--watch"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+
+			got, err := ParseSnapshotCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSnapshotCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSnapshotCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
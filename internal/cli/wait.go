@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// WaitCLI holds the arguments of the "mylock wait" subcommand
+type WaitCLI struct {
+	LockName string `kong:"arg,name='lock-name',help='Lock to wait for.'"`
+	Timeout  int    `kong:"required,help='Max seconds to wait for the lock to become free.'"`
+	Target   string `kong:"help='MYLOCK_TARGETS entry the lock is on.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseWaitCLI(args []string) (WaitCLI, error) {
+	var cli WaitCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newWaitParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Timeout <= 0 {
+		return cli, fmt.Errorf("--timeout must be positive")
+	}
+
+	return cli, nil
+}
+
+func newWaitParser(cli *WaitCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock wait"),
+		kong.Description("Wait until a lock is free, without taking it"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(waitHelpFormatter),
+	)
+}
+
+func waitHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock wait - Wait until a lock is free, without taking it
+
+Usage:
+  mylock wait <lock-name> --timeout <seconds> [--target <name>]
+
+Options:
+  --timeout                Required. Max seconds to wait for the lock to become free.
+  --target                 MYLOCK_TARGETS entry the lock is on, instead of routing by
+                           lock name prefix.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself.
+Exits 0 as soon as no session holds the lock, or 200 if it is still held
+after --timeout. The lock is only observed with IS_FREE_LOCK(), so another
+job may take it right after mylock wait returns.
+`)
+	return nil
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseWaitCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    WaitCLI
+		wantErr bool
+	}{
+		{
+			name: "lock name and timeout",
+			args: []string{"nightly-report", "--timeout", "60"},
+			want: WaitCLI{LockName: "nightly-report", Timeout: 60, Config: wantConfig},
+		},
+		{
+			name: "on a target",
+			args: []string{"nightly-report", "--timeout", "60", "--target", "reports"},
+			want: WaitCLI{LockName: "nightly-report", Timeout: 60, Target: "reports", Config: wantConfig},
+		},
+		{
+			name:    "missing timeout",
+			args:    []string{"nightly-report"},
+			wantErr: true,
+		},
+		{
+			name:    "missing lock name",
+			args:    []string{"--timeout", "60"},
+			wantErr: true,
+		},
+		{
+			name:    "zero timeout",
+			args:    []string{"nightly-report", "--timeout", "0"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+
+			got, err := ParseWaitCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWaitCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWaitCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
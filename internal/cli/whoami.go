@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// WhoamiCLI holds the arguments of the "mylock whoami" subcommand
+type WhoamiCLI struct {
+	Target   string `kong:"help='MYLOCK_TARGETS entry to connect to.'"`
+	LockName string `kong:"help='Connect to the target this lock name routes to.'"`
+	JSON     bool   `kong:"name='json',help='Print the identity as JSON.'"`
+	// Config is populated from environment variables, not from CLI flags
+	Config config.Config `kong:"-"`
+}
+
+func ParseWhoamiCLI(args []string) (WhoamiCLI, error) {
+	var cli WhoamiCLI
+
+	cfg, err := config.NewConfig()
+	if err != nil && !isHelp(args) {
+		return cli, err
+	}
+	cli.Config = cfg
+
+	parser, err := newWhoamiParser(&cli)
+	if err != nil {
+		return cli, err
+	}
+
+	if _, err := parser.Parse(args); err != nil {
+		return cli, err
+	}
+	if isHelp(args) {
+		return cli, fmt.Errorf("help requested")
+	}
+
+	if cli.Target != "" && cli.LockName != "" {
+		return cli, fmt.Errorf("cannot specify both --target and --lock-name")
+	}
+
+	return cli, nil
+}
+
+func newWhoamiParser(cli *WhoamiCLI) (*kong.Kong, error) {
+	return kong.New(cli,
+		kong.Name("mylock whoami"),
+		kong.Description("Show which MySQL server and account mylock connects as"),
+		kong.Exit(func(int) {}), // Prevent os.Exit during testing
+		kong.Help(whoamiHelpFormatter),
+	)
+}
+
+func whoamiHelpFormatter(options kong.HelpOptions, ctx *kong.Context) error {
+	fmt.Fprint(os.Stdout, `mylock whoami - Show which MySQL server and account mylock connects as
+
+Usage:
+  mylock whoami [--target <name> | --lock-name <name>] [--json]
+
+Options:
+  --target                 MYLOCK_TARGETS entry to connect to.
+  --lock-name              Connect to the target this lock name routes to.
+  --json                   Print the identity as JSON.
+  --help                   Show this help message.
+
+Uses the same MYLOCK_* environment variables as mylock itself, and opens the
+session the same way, so it shows the user, server host and version,
+connection id, default database and TLS status a locked run would get.
+`)
+	return nil
+}
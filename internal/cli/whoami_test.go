@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestParseWhoamiCLI(t *testing.T) {
+	envVars := map[string]string{
+		"MYLOCK_HOST":     "localhost",
+		"MYLOCK_USER":     "testuser",
+		"MYLOCK_PASSWORD": "testpass",
+		"MYLOCK_DATABASE": "testdb",
+	}
+	wantConfig := config.Config{
+		Host:     "localhost",
+		Port:     3306,
+		User:     "testuser",
+		Password: "testpass",
+		Database: "testdb",
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    WhoamiCLI
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			args: []string{},
+			want: WhoamiCLI{Config: wantConfig},
+		},
+		{
+			name: "json for a lock name",
+			args: []string{"--lock-name", "reports.daily", "--json"},
+			want: WhoamiCLI{LockName: "reports.daily", JSON: true, Config: wantConfig},
+		},
+		{
+			name:    "target and lock name",
+			args:    []string{"--target", "reports", "--lock-name", "reports.daily"},
+			wantErr: true,
+		},
+		{
+			name:    "help",
+			args:    []string{"--help"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--timeout", "3"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range envVars {
+				old, had := os.LookupEnv(key)
+				os.Setenv(key, value)
+				defer func(key, old string, had bool) {
+					if had {
+						os.Setenv(key, old)
+					} else {
+						os.Unsetenv(key)
+					}
+				}(key, old, had)
+			}
+
+			got, err := ParseWhoamiCLI(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWhoamiCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWhoamiCLI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
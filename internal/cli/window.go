@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily span of wall-clock time, such as 01:00-05:00 in a
+// given time zone. End is exclusive, and a window whose end is before its
+// start runs past midnight.
+type TimeWindow struct {
+	// Start and End are offsets from midnight
+	Start, End time.Duration
+	Location   *time.Location
+	text       string
+}
+
+// ParseTimeWindow reads a window written as HH:MM-HH:MM, optionally followed
+// by /TZ with an IANA time zone name. Without a zone, local time is used.
+func ParseTimeWindow(value string) (TimeWindow, error) {
+	w := TimeWindow{Location: time.Local, text: value}
+	span, zone, hasZone := strings.Cut(value, "/")
+	if hasZone {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return w, fmt.Errorf("unknown time zone %q in %q", zone, value)
+		}
+		w.Location = loc
+	}
+	start, end, ok := strings.Cut(span, "-")
+	if !ok {
+		return w, fmt.Errorf("%q is not a window like 01:00-05:00[/TZ]", value)
+	}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return w, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return w, err
+	}
+	if w.Start == w.End {
+		return w, fmt.Errorf("window %q is empty", value)
+	}
+	return w, nil
+}
+
+// parseClock reads HH:MM as an offset from midnight; 24:00 is the end of the day
+func parseClock(value string) (time.Duration, error) {
+	var hour, minute int
+	if n, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || n != 2 || len(value) != 5 {
+		return 0, fmt.Errorf("%q is not a time like 05:30", value)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("%q is not a time of day", value)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window, read as wall-clock
+// time in the window's zone
+func (w TimeWindow) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// String returns the window as it was written
+func (w TimeWindow) String() string {
+	return w.text
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		value   string
+		at      time.Time
+		want    bool
+		wantErr bool
+	}{
+		{value: "01:00-05:00/UTC", at: time.Date(2026, 1, 2, 1, 0, 0, 0, time.UTC), want: true},
+		{value: "01:00-05:00/UTC", at: time.Date(2026, 1, 2, 4, 59, 59, 0, time.UTC), want: true},
+		{value: "01:00-05:00/UTC", at: time.Date(2026, 1, 2, 5, 0, 0, 0, time.UTC), want: false},
+		{value: "01:00-05:00/UTC", at: time.Date(2026, 1, 2, 0, 59, 0, 0, time.UTC), want: false},
+		// Past midnight
+		{value: "22:00-02:00/UTC", at: time.Date(2026, 1, 2, 23, 30, 0, 0, time.UTC), want: true},
+		{value: "22:00-02:00/UTC", at: time.Date(2026, 1, 2, 1, 30, 0, 0, time.UTC), want: true},
+		{value: "22:00-02:00/UTC", at: time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC), want: false},
+		{value: "18:00-24:00/UTC", at: time.Date(2026, 1, 2, 23, 59, 0, 0, time.UTC), want: true},
+		// 01:30 in Tokyo is 16:30 UTC the day before
+		{value: "01:00-05:00/Asia/Tokyo", at: time.Date(2026, 1, 1, 16, 30, 0, 0, time.UTC), want: true},
+		{value: "01:00-05:00/Asia/Tokyo", at: time.Date(2026, 1, 2, 1, 30, 0, 0, time.UTC), want: false},
+		{value: "01:00-05:00", at: time.Date(2026, 1, 2, 2, 0, 0, 0, time.Local), want: true},
+		{value: "01:00", wantErr: true},
+		{value: "1:00-5:00", wantErr: true},
+		{value: "01:00-25:00", wantErr: true},
+		{value: "01:60-05:00", wantErr: true},
+		{value: "03:00-03:00", wantErr: true},
+		{value: "01:00-05:00/Mars/Olympus", wantErr: true},
+	}
+	for _, tt := range tests {
+		w, err := ParseTimeWindow(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimeWindow(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := w.Contains(tt.at); got != tt.want {
+			t.Errorf("ParseTimeWindow(%q).Contains(%s) = %v, want %v", tt.value, tt.at, got, tt.want)
+		}
+		if w.String() != tt.value {
+			t.Errorf("String() = %q, want %q", w.String(), tt.value)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestFake_Timer(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Minute)
+
+	f.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before it was due")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case at := <-timer.C():
+		if !at.Equal(epoch.Add(time.Minute)) {
+			t.Errorf("timer fired at %v, want %v", at, epoch.Add(time.Minute))
+		}
+	default:
+		t.Fatal("timer did not fire when due")
+	}
+	if timer.Stop() {
+		t.Error("Stop() of a fired timer = true, want false")
+	}
+}
+
+func TestFake_TimerStop(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Minute)
+	if !timer.Stop() {
+		t.Error("Stop() of an active timer = false, want true")
+	}
+	f.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+}
+
+func TestFake_Ticker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		f.Advance(10 * time.Second)
+		select {
+		case at := <-ticker.C():
+			if want := epoch.Add(time.Duration(i) * 10 * time.Second); !at.Equal(want) {
+				t.Errorf("tick %d at %v, want %v", i, at, want)
+			}
+		default:
+			t.Fatalf("tick %d missing", i)
+		}
+	}
+
+	// Ticks nobody received are dropped, as with time.Ticker
+	f.Advance(time.Minute)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("ticker buffered more than one tick")
+	default:
+	}
+	if got, want := f.Now(), epoch.Add(90*time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := f.NewTimer(time.Hour)
+		<-timer.C()
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting goroutine was not released by Advance")
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	if OrReal(nil) != Real {
+		t.Error("OrReal(nil) is not the real clock")
+	}
+	f := NewFake(epoch)
+	if OrReal(f) != Clock(f) {
+		t.Error("OrReal(f) did not return f")
+	}
+}
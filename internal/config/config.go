@@ -1,9 +1,15 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -13,23 +19,97 @@ const (
 	MinPort = 1
 	// MaxPort is the maximum valid port number
 	MaxPort = 65535
+
+	// BackendMemory selects the in-process lock backend, which needs no database
+	BackendMemory = "memory"
+	// BackendMySQL selects MySQL advisory locks, the default
+	BackendMySQL = "mysql"
 )
 
+// ErrConfig matches, with errors.Is, every error about invalid or missing
+// settings in the environment
+var ErrConfig = errors.New("invalid configuration")
+
+// configError keeps the message of err while also matching ErrConfig
+type configError struct {
+	err error
+}
+
+func (e configError) Error() string {
+	return e.err.Error()
+}
+
+func (e configError) Unwrap() []error {
+	return []error{e.err, ErrConfig}
+}
+
+func configErrorf(format string, args ...any) error {
+	return configError{fmt.Errorf(format, args...)}
+}
+
 type Config struct {
+	// Backend is empty for the default MySQL backend
+	Backend  string
 	Host     string
 	Port     int
 	User     string
 	Password string
 	Database string
+	// QuorumHosts is a comma-separated list of host or host:port entries.
+	// When set, a lock must be held on a majority of them instead of on Host.
+	QuorumHosts string
+	// Compress enables the compressed client/server protocol
+	Compress bool
+	// Charset is the connection character set, or a comma-separated list
+	// tried in order; empty leaves the driver default
+	Charset string
+	// Collation is the connection collation; empty leaves the driver default
+	Collation string
+	// Targets are extra MySQL servers from MYLOCK_TARGETS, keyed by name
+	Targets map[string]Target
+	// ConnectionAttributes are sent to the server at connect time and shown
+	// in performance_schema.session_connect_attrs. They are set by mylock
+	// itself, not from the environment.
+	ConnectionAttributes map[string]string
 }
 
+// Target is a named MySQL server that locks can be routed to
+type Target struct {
+	// Prefix routes lock names starting with it to this target
+	Prefix string
+	Config Config
+}
+
+var (
+	targetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	charsetPattern    = regexp.MustCompile(`^[A-Za-z0-9_]+(,[A-Za-z0-9_]+)*$`)
+	collationPattern  = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
 func NewConfig() (Config, error) {
 	var cfg Config
 	var err error
 
+	cfg.Backend = os.Getenv("MYLOCK_BACKEND")
+	switch cfg.Backend {
+	case "", BackendMySQL:
+	case BackendMemory:
+		// No database settings are needed
+		return cfg, nil
+	default:
+		return cfg, configErrorf("invalid MYLOCK_BACKEND %q (use %q or %q)", cfg.Backend, BackendMySQL, BackendMemory)
+	}
+
+	cfg.QuorumHosts = os.Getenv("MYLOCK_QUORUM_HOSTS")
+	if cfg.QuorumHosts != "" {
+		if _, err := parseHosts(cfg.QuorumHosts); err != nil {
+			return cfg, configErrorf("invalid MYLOCK_QUORUM_HOSTS: %w", err)
+		}
+	}
+
 	cfg.Host = os.Getenv("MYLOCK_HOST")
-	if cfg.Host == "" {
-		return cfg, fmt.Errorf("MYLOCK_HOST environment variable is required")
+	if cfg.Host == "" && cfg.QuorumHosts == "" {
+		return cfg, configErrorf("MYLOCK_HOST environment variable is required")
 	}
 
 	portStr := os.Getenv("MYLOCK_PORT")
@@ -38,16 +118,16 @@ func NewConfig() (Config, error) {
 	} else {
 		cfg.Port, err = strconv.Atoi(portStr)
 		if err != nil {
-			return cfg, fmt.Errorf("invalid MYLOCK_PORT: %w", err)
+			return cfg, configErrorf("invalid MYLOCK_PORT: %w", err)
 		}
 		if cfg.Port < MinPort || cfg.Port > MaxPort {
-			return cfg, fmt.Errorf("MYLOCK_PORT must be between %d and %d", MinPort, MaxPort)
+			return cfg, configErrorf("MYLOCK_PORT must be between %d and %d", MinPort, MaxPort)
 		}
 	}
 
 	cfg.User = os.Getenv("MYLOCK_USER")
 	if cfg.User == "" {
-		return cfg, fmt.Errorf("MYLOCK_USER environment variable is required")
+		return cfg, configErrorf("MYLOCK_USER environment variable is required")
 	}
 
 	cfg.Password = os.Getenv("MYLOCK_PASSWORD")
@@ -55,18 +135,284 @@ func NewConfig() (Config, error) {
 
 	cfg.Database = os.Getenv("MYLOCK_DATABASE")
 	if cfg.Database == "" {
-		return cfg, fmt.Errorf("MYLOCK_DATABASE environment variable is required")
+		return cfg, configErrorf("MYLOCK_DATABASE environment variable is required")
+	}
+
+	if compress := os.Getenv("MYLOCK_COMPRESS"); compress != "" {
+		cfg.Compress, err = strconv.ParseBool(compress)
+		if err != nil {
+			return cfg, configErrorf("invalid MYLOCK_COMPRESS: %w", err)
+		}
+	}
+
+	cfg.Charset = os.Getenv("MYLOCK_CHARSET")
+	if cfg.Charset != "" && !charsetPattern.MatchString(cfg.Charset) {
+		return cfg, configErrorf("invalid MYLOCK_CHARSET %q", cfg.Charset)
+	}
+	cfg.Collation = os.Getenv("MYLOCK_COLLATION")
+	if cfg.Collation != "" && !collationPattern.MatchString(cfg.Collation) {
+		return cfg, configErrorf("invalid MYLOCK_COLLATION %q", cfg.Collation)
+	}
+
+	if names := os.Getenv("MYLOCK_TARGETS"); names != "" {
+		cfg.Targets = make(map[string]Target)
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !targetNamePattern.MatchString(name) {
+				return cfg, configErrorf("invalid target name %q in MYLOCK_TARGETS (use lowercase letters, digits, '-' and '_')", name)
+			}
+			target, err := loadTarget(name, cfg)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Targets[name] = target
+		}
 	}
 
 	return cfg, nil
 }
 
+// loadTarget reads MYLOCK_TARGET_<NAME>_* for one target. The host is
+// required; the other settings default to the main MYLOCK_* values.
+func loadTarget(name string, base Config) (Target, error) {
+	env := TargetEnvPrefix(name)
+	target := Target{Prefix: name + ".", Config: base}
+	target.Config.QuorumHosts = ""
+	target.Config.Targets = nil
+
+	if prefix, ok := os.LookupEnv(env + "PREFIX"); ok {
+		target.Prefix = prefix
+	}
+	target.Config.Host = os.Getenv(env + "HOST")
+	if target.Config.Host == "" {
+		return target, configErrorf("%sHOST environment variable is required for target %q", env, name)
+	}
+	if portStr := os.Getenv(env + "PORT"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < MinPort || port > MaxPort {
+			return target, configErrorf("invalid %sPORT: %q", env, portStr)
+		}
+		target.Config.Port = port
+	}
+	if user := os.Getenv(env + "USER"); user != "" {
+		target.Config.User = user
+	}
+	if password, ok := os.LookupEnv(env + "PASSWORD"); ok {
+		target.Config.Password = password
+	}
+	if database := os.Getenv(env + "DATABASE"); database != "" {
+		target.Config.Database = database
+	}
+	return target, nil
+}
+
+// TargetEnvPrefix is the prefix of the environment variables that set up
+// the named target, e.g. "MYLOCK_TARGET_EU_WEST_" for "eu-west"
+func TargetEnvPrefix(name string) string {
+	return "MYLOCK_TARGET_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// Route picks the configuration for a lock: the named target if one is
+// given, otherwise the target with the longest prefix matching lockName,
+// otherwise c itself. It also returns the chosen target name, or "".
+func (c Config) Route(lockName, target string) (Config, string, error) {
+	if target != "" {
+		t, ok := c.Targets[target]
+		if !ok {
+			return c, "", configErrorf("unknown target %q (set it up in MYLOCK_TARGETS)", target)
+		}
+		return t.Config, target, nil
+	}
+
+	best := ""
+	for name, t := range c.Targets {
+		if t.Prefix == "" || !strings.HasPrefix(lockName, t.Prefix) {
+			continue
+		}
+		if best == "" || len(t.Prefix) > len(c.Targets[best].Prefix) ||
+			(len(t.Prefix) == len(c.Targets[best].Prefix) && name < best) {
+			best = name
+		}
+	}
+	if best != "" {
+		return c.Targets[best].Config, best, nil
+	}
+	return c, "", nil
+}
+
 func (c Config) DSN() string {
 	// Handle empty password case
 	if c.Password == "" {
-		return fmt.Sprintf("%s@tcp(%s:%d)/%s",
-			c.User, c.Host, c.Port, c.Database)
+		return fmt.Sprintf("%s@tcp(%s:%d)/%s%s",
+			c.User, c.Host, c.Port, c.Database, c.dsnParams())
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s%s",
+		c.User, c.Password, c.Host, c.Port, c.Database, c.dsnParams())
+}
+
+// dsnParams returns the driver options for the DSN, including the leading
+// "?", or "" when there are none
+func (c Config) dsnParams() string {
+	params := url.Values{}
+	if c.Compress {
+		params.Set("compress", "true")
+	}
+	if c.Charset != "" {
+		params.Set("charset", c.Charset)
+	}
+	if c.Collation != "" {
+		params.Set("collation", c.Collation)
+	}
+	if len(c.ConnectionAttributes) > 0 {
+		params.Set("connectionAttributes", c.connectionAttributes())
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + params.Encode()
+}
+
+// connectionAttributes encodes ConnectionAttributes as the driver's
+// "key:value,key:value" list, sorted by key. Commas in a value would start
+// a new pair, so they are replaced.
+func (c Config) connectionAttributes() string {
+	keys := make([]string, 0, len(c.ConnectionAttributes))
+	for key := range c.ConnectionAttributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.ReplaceAll(c.ConnectionAttributes[key], ",", "_")
+		pairs = append(pairs, key+":"+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// QuorumDSNs returns one DSN per quorum host, sorted so that every mylock
+// sharing the same hosts tries them in the same order
+func (c Config) QuorumDSNs() []string {
+	hosts, err := parseHosts(c.QuorumHosts)
+	if err != nil {
+		return nil
+	}
+	var dsns []string
+	for _, h := range hosts {
+		target := c
+		target.Host = h.host
+		if h.port != 0 {
+			target.Port = h.port
+		}
+		dsns = append(dsns, target.DSN())
+	}
+	return dsns
+}
+
+type hostPort struct {
+	host string
+	// port is 0 when the entry did not specify one
+	port int
+}
+
+// parseHosts splits a comma-separated list of host or host:port entries
+// and sorts it
+func parseHosts(list string) ([]hostPort, error) {
+	var hosts []hostPort
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		h := hostPort{host: entry}
+		if host, portStr, err := net.SplitHostPort(entry); err == nil {
+			port, err := strconv.Atoi(portStr)
+			if err != nil || port < MinPort || port > MaxPort {
+				return nil, configErrorf("invalid port in %q", entry)
+			}
+			h = hostPort{host: host, port: port}
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		return nil, configErrorf("no hosts given")
 	}
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-		c.User, c.Password, c.Host, c.Port, c.Database)
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].host != hosts[j].host {
+			return hosts[i].host < hosts[j].host
+		}
+		return hosts[i].port < hosts[j].port
+	})
+	return hosts, nil
+}
+
+// DefaultSMTPPort is the mail submission port used when MYLOCK_SMTP_PORT is unset
+const DefaultSMTPPort = 587
+
+// SMTP is the mail server for failure notifications, from MYLOCK_SMTP_*
+type SMTP struct {
+	Host string
+	Port int
+	// User and Password are empty for servers that accept mail without login
+	User     string
+	Password string
+}
+
+// NewSMTPConfig reads the mail server settings. It is only called when mail
+// notifications are enabled, so MYLOCK_SMTP_HOST is required then.
+func NewSMTPConfig() (SMTP, error) {
+	cfg := SMTP{
+		Host:     os.Getenv("MYLOCK_SMTP_HOST"),
+		Port:     DefaultSMTPPort,
+		User:     os.Getenv("MYLOCK_SMTP_USER"),
+		Password: os.Getenv("MYLOCK_SMTP_PASSWORD"),
+	}
+	if cfg.Host == "" {
+		return cfg, configErrorf("MYLOCK_SMTP_HOST environment variable is required for --mail-to")
+	}
+	if portStr := os.Getenv("MYLOCK_SMTP_PORT"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < MinPort || port > MaxPort {
+			return cfg, configErrorf("invalid MYLOCK_SMTP_PORT: %q", portStr)
+		}
+		cfg.Port = port
+	}
+	return cfg, nil
+}
+
+// DefaultEventsSubject is the NATS subject prefix used when
+// MYLOCK_EVENTS_NATS_SUBJECT is unset
+const DefaultEventsSubject = "mylock.events"
+
+// Events is where lock lifecycle events are published, from MYLOCK_EVENTS_*.
+// A zero NATSURL disables publishing.
+type Events struct {
+	// NATSURL is nats://[user:password@|token@]host[:port]
+	NATSURL *url.URL
+	// Subject is the prefix of the subjects events are published on
+	Subject string
+}
+
+// NewEventsConfig reads the event publishing settings
+func NewEventsConfig() (Events, error) {
+	cfg := Events{Subject: DefaultEventsSubject}
+	if subject := os.Getenv("MYLOCK_EVENTS_NATS_SUBJECT"); subject != "" {
+		if strings.ContainsAny(subject, " \t\r\n*>") {
+			return cfg, configErrorf("invalid MYLOCK_EVENTS_NATS_SUBJECT %q", subject)
+		}
+		cfg.Subject = subject
+	}
+
+	raw := os.Getenv("MYLOCK_EVENTS_NATS_URL")
+	if raw == "" {
+		return cfg, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+		return cfg, configErrorf("invalid MYLOCK_EVENTS_NATS_URL: want nats://host[:port]")
+	}
+	cfg.NATSURL = u
+	return cfg, nil
 }
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+)
+
+// LoadDotenv sets the MYLOCK_* variables of a .env file that are not set
+// already, so the real environment always wins. Other variables in the
+// file are ignored. It returns the names it set.
+//
+// Lines are KEY=VALUE, optionally prefixed with "export ". Blank lines and
+// lines starting with # are skipped. Values may be single-quoted (taken
+// literally) or double-quoted (\n, \", \\ and \$ are unescaped); unquoted
+// values end at " #". Variables are not expanded.
+func LoadDotenv(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, configErrorf("failed to read dotenv file: %w", err)
+	}
+	defer f.Close()
+
+	var set []string
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return set, configErrorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value, err := dotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return set, configErrorf("%s:%d: %s %w", path, lineNo, key, err)
+		}
+
+		if !strings.HasPrefix(key, "MYLOCK_") {
+			continue
+		}
+		if _, exists := os.LookupEnv(key); exists {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return set, configErrorf("failed to set %s: %w", key, err)
+		}
+		set = append(set, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return set, configErrorf("failed to read dotenv file: %w", err)
+	}
+	return set, nil
+}
+
+// dotenvValue unquotes the value part of a .env line
+func dotenvValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", errors.New("has an unterminated quote")
+		}
+		return raw[1 : end+1], nil
+	case strings.HasPrefix(raw, `"`):
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			if c == '"' {
+				return b.String(), nil
+			}
+			if c == '\\' && i+1 < len(raw) {
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case '"', '\\', '$':
+					b.WriteByte(raw[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(raw[i])
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		return "", errors.New("has an unterminated quote")
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return raw, nil
+}
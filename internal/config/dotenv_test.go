@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := `# per-job settings
+MYLOCK_HOST=db.internal
+export MYLOCK_USER = cron
+MYLOCK_PASSWORD='p@ss #1'
+MYLOCK_DATABASE="jobs \"main\""
+MYLOCK_TIMEOUT=30 # seconds
+MYLOCK_PORT=3307
+OTHER_SETTING=ignored
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{"MYLOCK_HOST", "MYLOCK_USER", "MYLOCK_PASSWORD", "MYLOCK_DATABASE", "MYLOCK_TIMEOUT", "MYLOCK_PORT", "OTHER_SETTING"}
+	for _, key := range keys {
+		old, had := os.LookupEnv(key)
+		os.Unsetenv(key)
+		defer func(key, old string, had bool) {
+			if had {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		}(key, old, had)
+	}
+	// The real environment wins over the file
+	os.Setenv("MYLOCK_PORT", "3306")
+
+	set, err := LoadDotenv(path)
+	if err != nil {
+		t.Fatalf("LoadDotenv() error = %v", err)
+	}
+	wantSet := []string{"MYLOCK_HOST", "MYLOCK_USER", "MYLOCK_PASSWORD", "MYLOCK_DATABASE", "MYLOCK_TIMEOUT"}
+	if !reflect.DeepEqual(set, wantSet) {
+		t.Errorf("LoadDotenv() set %v, want %v", set, wantSet)
+	}
+
+	want := map[string]string{
+		"MYLOCK_HOST":     "db.internal",
+		"MYLOCK_USER":     "cron",
+		"MYLOCK_PASSWORD": "p@ss #1",
+		"MYLOCK_DATABASE": `jobs "main"`,
+		"MYLOCK_TIMEOUT":  "30",
+		"MYLOCK_PORT":     "3306",
+	}
+	for key, value := range want {
+		if got := os.Getenv(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if _, ok := os.LookupEnv("OTHER_SETTING"); ok {
+		t.Error("OTHER_SETTING was set, want only MYLOCK_* variables loaded")
+	}
+}
+
+func TestLoadDotenv_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"no equals":           "MYLOCK_HOST\n",
+		"unterminated quote":  "MYLOCK_HOST=\"db\n",
+		"space in key":        "MYLOCK HOST=db\n",
+		"unterminated single": "MYLOCK_HOST='db\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadDotenv(path); !errors.Is(err, ErrConfig) {
+				t.Errorf("LoadDotenv() error = %v, want ErrConfig", err)
+			}
+		})
+	}
+
+	if _, err := LoadDotenv(filepath.Join(dir, "missing")); !errors.Is(err, ErrConfig) {
+		t.Errorf("LoadDotenv() of a missing file error = %v, want ErrConfig", err)
+	}
+}
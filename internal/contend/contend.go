@@ -0,0 +1,124 @@
+package contend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Sampler observes a lock without taking it, normally a *locker.Locker
+type Sampler interface {
+	// LockHolder returns the connection id holding the lock, or 0 if it is free
+	LockHolder(ctx context.Context, lockName string) (int64, error)
+	// SessionOwner describes a session, or returns "" if it is unknown
+	SessionOwner(ctx context.Context, connID int64) (string, error)
+}
+
+type Options struct {
+	LockName string
+	Duration time.Duration
+	Interval time.Duration
+}
+
+// Holder is one session seen holding the lock
+type Holder struct {
+	ConnID int64
+	// Owner is the session's user@host, or empty if it could not be seen
+	Owner   string
+	Samples int
+}
+
+type Result struct {
+	Samples     int
+	HeldSamples int
+	// Acquisitions counts the times the lock was seen going from free, or
+	// from another holder, to a new holder
+	Acquisitions int
+	Errors       int
+	Holders      map[int64]*Holder
+}
+
+// Run samples the holder of the lock every interval until the duration
+// elapses or ctx is done
+func Run(ctx context.Context, s Sampler, opts Options) (Result, error) {
+	result := Result{Holders: make(map[int64]*Holder)}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(opts.Duration)
+
+	var last int64
+	for {
+		holder, err := s.LockHolder(ctx, opts.LockName)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, nil
+			}
+			result.Errors++
+		} else {
+			result.Samples++
+			if holder != 0 {
+				result.HeldSamples++
+				h, ok := result.Holders[holder]
+				if !ok {
+					h = &Holder{ConnID: holder}
+					// The owner is looked up once, while the session still exists
+					if owner, err := s.SessionOwner(ctx, holder); err == nil {
+						h.Owner = owner
+					}
+					result.Holders[holder] = h
+				}
+				h.Samples++
+				if holder != last {
+					result.Acquisitions++
+				}
+			}
+			last = holder
+		}
+
+		if !time.Now().Before(deadline) {
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			return result, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// HeldRatio is the fraction of samples in which the lock was held
+func (r Result) HeldRatio() float64 {
+	if r.Samples == 0 {
+		return 0
+	}
+	return float64(r.HeldSamples) / float64(r.Samples)
+}
+
+// Report writes a human-readable summary of the result, with the holders
+// that held the lock longest first
+func (r Result) Report(w io.Writer, opts Options) {
+	fmt.Fprintf(w, "Lock: %s, duration: %s, interval: %s\n", opts.LockName, opts.Duration, opts.Interval)
+	fmt.Fprintf(w, "Samples: %d, held: %.1f%%, acquisitions: %d, errors: %d\n",
+		r.Samples, r.HeldRatio()*100, r.Acquisitions, r.Errors)
+
+	holders := make([]*Holder, 0, len(r.Holders))
+	for _, h := range r.Holders {
+		holders = append(holders, h)
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if holders[i].Samples != holders[j].Samples {
+			return holders[i].Samples > holders[j].Samples
+		}
+		return holders[i].ConnID < holders[j].ConnID
+	})
+	for _, h := range holders {
+		owner := h.Owner
+		if owner == "" {
+			owner = "unknown"
+		}
+		fmt.Fprintf(w, "  connection %d (%s): held in %.1f%% of samples\n",
+			h.ConnID, owner, float64(h.Samples)/float64(r.Samples)*100)
+	}
+}
@@ -0,0 +1,81 @@
+package contend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSampler replays a fixed sequence of holders, then reports the lock free
+type fakeSampler struct {
+	holders []int64
+	errAt   int
+	calls   int
+}
+
+func (s *fakeSampler) LockHolder(ctx context.Context, lockName string) (int64, error) {
+	s.calls++
+	if s.calls == s.errAt {
+		return 0, errors.New("connection reset")
+	}
+	if s.calls > len(s.holders) {
+		return 0, nil
+	}
+	return s.holders[s.calls-1], nil
+}
+
+func (s *fakeSampler) SessionOwner(ctx context.Context, connID int64) (string, error) {
+	if connID == 7 {
+		return "", errors.New("access denied")
+	}
+	return "app@10.0.0.1", nil
+}
+
+func TestRun(t *testing.T) {
+	s := &fakeSampler{holders: []int64{0, 5, 5, 5, 7, 0, 5, 0}, errAt: 9}
+	opts := Options{LockName: "hot", Duration: 100 * time.Millisecond, Interval: time.Millisecond}
+
+	result, err := Run(context.Background(), s, opts)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Errors != 1 {
+		t.Errorf("Errors = %d, want 1", result.Errors)
+	}
+	if result.HeldSamples != 5 {
+		t.Errorf("HeldSamples = %d, want 5", result.HeldSamples)
+	}
+	if result.Acquisitions != 3 {
+		t.Errorf("Acquisitions = %d, want 3", result.Acquisitions)
+	}
+	if got := result.Holders[5]; got == nil || got.Samples != 4 || got.Owner != "app@10.0.0.1" {
+		t.Errorf("Holders[5] = %+v, want 4 samples by app@10.0.0.1", got)
+	}
+	if got := result.Holders[7]; got == nil || got.Samples != 1 || got.Owner != "" {
+		t.Errorf("Holders[7] = %+v, want 1 sample with an unknown owner", got)
+	}
+
+	var buf bytes.Buffer
+	result.Report(&buf, opts)
+	out := buf.String()
+	for _, want := range []string{"Lock: hot", "acquisitions: 3", "connection 5 (app@10.0.0.1)", "connection 7 (unknown)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Report() output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "connection 5") > strings.Index(out, "connection 7") {
+		t.Errorf("Report() should list the busiest holder first:\n%s", out)
+	}
+}
+
+func TestHeldRatio(t *testing.T) {
+	if got := (Result{}).HeldRatio(); got != 0 {
+		t.Errorf("HeldRatio() with no samples = %v, want 0", got)
+	}
+	if got := (Result{Samples: 4, HeldSamples: 3}).HeldRatio(); got != 0.75 {
+		t.Errorf("HeldRatio() = %v, want 0.75", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Package docs renders mylock's reference documentation, as a man page or
+// as Markdown, from the kong models of its command line
+package docs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+type entry struct {
+	name        string
+	description string
+}
+
+// environment lists the variables mylock reads, in the order of --help
+var environment = []entry{
+	{"MYLOCK_HOST", "MySQL host. Required unless MYLOCK_QUORUM_HOSTS is set."},
+	{"MYLOCK_PORT", "MySQL port. Default: 3306."},
+	{"MYLOCK_USER", "MySQL username. Required."},
+	{"MYLOCK_PASSWORD", "MySQL password. May be empty."},
+	{"MYLOCK_DATABASE", "MySQL database name. Required."},
+	{"MYLOCK_CHARSET", "Connection character set, or a comma-separated list to try in order."},
+	{"MYLOCK_COLLATION", "Connection collation."},
+	{"MYLOCK_COMPRESS", "Set to 1 to use the compressed protocol."},
+	{"MYLOCK_QUORUM_HOSTS", "Comma-separated hosts the lock must be held on a majority of."},
+	{"MYLOCK_TARGETS", "Comma-separated names of extra MySQL targets, set up with MYLOCK_TARGET_<NAME>_HOST, _PORT, _USER, _PASSWORD, _DATABASE and _PREFIX."},
+	{"MYLOCK_BACKEND", "mysql (default) or memory, for process-local locks without a database."},
+	{"MYLOCK_TIMEOUT", "Default for --timeout."},
+	{"MYLOCK_DEFAULT_LOCK_NAME", "Default for --lock-name, unless --lock-name-from-command or --group is given."},
+	{"MYLOCK_DEADLINE", "Absolute end of the whole run, as RFC 3339 time or Unix epoch seconds. The wait for the lock ends by then, and a command still running is stopped."},
+	{"MYLOCK_SMTP_HOST", "Mail server for --mail-to, with MYLOCK_SMTP_PORT (default 587), MYLOCK_SMTP_USER and MYLOCK_SMTP_PASSWORD."},
+	{"MYLOCK_PAGERDUTY_ROUTING_KEY", "Default for --pagerduty-routing-key."},
+	{"MYLOCK_EVENTS_NATS_URL", "NATS server to publish acquired, released and failed events to, on subjects under MYLOCK_EVENTS_NATS_SUBJECT (default mylock.events)."},
+	{"MYLOCK_ALLOW_ROOT", "Set to 1 to allow running as root, like --allow-root."},
+	{"NO_COLOR", "When set to any value, disables colored diagnostics."},
+}
+
+// exitStatus lists mylock's own exit codes
+var exitStatus = []entry{
+	{"0-127", "Exit code of the executed command."},
+	{"200", "The lock was not acquired within the timeout, or the server refused the wait as a deadlock."},
+	{"201", "Internal error, such as a MySQL connection failure."},
+	{"202", "The server or a proxy in front of it does not support GET_LOCK()."},
+	{"203", "The lock was lost while the command was running, or mylock require-lock-held found it not held by the expected run."},
+	{"204", "With --strict-release, the lock could not be released."},
+	{"205", "GET_LOCK() returned NULL: the server failed, e.g. ran out of memory or the query was killed."},
+	{"206", "The lock is blocked for maintenance with mylock block set."},
+	{"207", "A host precondition such as --require-free-disk or --require-max-load was not met."},
+	{"208", "The command wrote no output for --stall-timeout and was killed."},
+	{"209", "With --cancel-in-progress, a newer run holds the lock or took it over."},
+	{"200-209", "Reserved for mylock."},
+}
+
+// Man writes a section 1 man page. The first model is mylock itself; the
+// others are documented as its subcommands.
+func Man(w io.Writer, apps []*kong.Application) error {
+	if len(apps) == 0 {
+		return fmt.Errorf("no command to document")
+	}
+	root := apps[0]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"%s\" \"User Commands\"\n", strings.ToUpper(roff(root.Name)), roff(root.Name))
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff(root.Name), roff(root.Help))
+	b.WriteString(".SH SYNOPSIS\n")
+	for _, app := range apps {
+		fmt.Fprintf(&b, ".B %s\n%s\n.br\n", roff(app.Name), roff(synopsis(app)))
+	}
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n%s.\n", roff(root.Help))
+	b.WriteString(".SH OPTIONS\n")
+	manFlags(&b, root)
+	if len(apps) > 1 {
+		b.WriteString(".SH COMMANDS\n")
+		for _, app := range apps[1:] {
+			fmt.Fprintf(&b, ".SS %s\n%s.\n", roff(app.Name), roff(app.Help))
+			manFlags(&b, app)
+		}
+	}
+	b.WriteString(".SH ENVIRONMENT\n")
+	for _, e := range environment {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", roff(e.name), roff(e.description))
+	}
+	b.WriteString(".SH \"EXIT STATUS\"\n")
+	for _, e := range exitStatus {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", roff(e.name), roff(e.description))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func manFlags(b *strings.Builder, app *kong.Application) {
+	for _, flag := range flags(app) {
+		fmt.Fprintf(b, ".TP\n\\fB%s\\fR", roff("--"+flag.Name))
+		if !flag.IsBool() {
+			fmt.Fprintf(b, "=\\fI%s\\fR", roff(flag.FormatPlaceHolder()))
+		}
+		fmt.Fprintf(b, "\n%s\n", roff(flagHelp(flag)))
+	}
+}
+
+// Markdown writes the same reference as Man, as a Markdown page
+func Markdown(w io.Writer, apps []*kong.Application) error {
+	if len(apps) == 0 {
+		return fmt.Errorf("no command to document")
+	}
+	root := apps[0]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n%s.\n\n## Synopsis\n\n```\n", root.Name, root.Help)
+	for _, app := range apps {
+		fmt.Fprintf(&b, "%s %s\n", app.Name, synopsis(app))
+	}
+	b.WriteString("```\n\n## Options\n\n")
+	markdownFlags(&b, root)
+	if len(apps) > 1 {
+		b.WriteString("## Commands\n\n")
+		for _, app := range apps[1:] {
+			fmt.Fprintf(&b, "### %s\n\n%s.\n\n", app.Name, app.Help)
+			markdownFlags(&b, app)
+		}
+	}
+	b.WriteString("## Environment\n\n")
+	markdownTable(&b, "Variable", environment)
+	b.WriteString("## Exit status\n\n")
+	markdownTable(&b, "Code", exitStatus)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownFlags(b *strings.Builder, app *kong.Application) {
+	for _, flag := range flags(app) {
+		name := "--" + flag.Name
+		if !flag.IsBool() {
+			name += "=" + flag.FormatPlaceHolder()
+		}
+		fmt.Fprintf(b, "- `%s`: %s\n", name, flagHelp(flag))
+	}
+	b.WriteString("\n")
+}
+
+func markdownTable(b *strings.Builder, heading string, entries []entry) {
+	fmt.Fprintf(b, "| %s | Description |\n|---|---|\n", heading)
+	for _, e := range entries {
+		fmt.Fprintf(b, "| `%s` | %s |\n", e.name, strings.ReplaceAll(e.description, "|", "\\|"))
+	}
+	b.WriteString("\n")
+}
+
+// synopsis is the usage line of app after its name
+func synopsis(app *kong.Application) string {
+	return strings.TrimSpace(app.Summary())
+}
+
+// flags are the documented flags of app, without --help
+func flags(app *kong.Application) []*kong.Flag {
+	var out []*kong.Flag
+	for _, flag := range app.Flags {
+		if flag.Hidden || flag.Name == "help" {
+			continue
+		}
+		out = append(out, flag)
+	}
+	return out
+}
+
+func flagHelp(flag *kong.Flag) string {
+	help := flag.Help
+	if flag.Required {
+		help += " Required."
+	}
+	if len(flag.Envs) > 0 {
+		help += " May be set with " + strings.Join(flag.Envs, " or ") + "."
+	}
+	return help
+}
+
+// roff escapes text for a man page: backslashes and hyphens are escaped, and
+// a leading dot or quote is kept from being read as a request
+func roff(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
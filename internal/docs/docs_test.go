@@ -0,0 +1,109 @@
+package docs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+type testCLI struct {
+	LockName string   `kong:"help='A unique name for the lock.'"`
+	Timeout  int      `kong:"required,help='Max seconds to wait.'"`
+	Debug    bool     `kong:"help='Log queries.'"`
+	Hidden   bool     `kong:"hidden"`
+	Command  []string `kong:"arg,help='Command to run.'"`
+}
+
+type testSubCLI struct {
+	Workers int `kong:"default='10',help='Number of workers.'"`
+}
+
+func testModels(t *testing.T) []*kong.Application {
+	t.Helper()
+	root, err := kong.New(&testCLI{}, kong.Name("mylock"), kong.Description("Acquire a lock and run a command"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := kong.New(&testSubCLI{}, kong.Name("mylock bench"), kong.Description("Measure contention"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*kong.Application{root.Model, sub.Model}
+}
+
+func TestMan(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Man(&buf, testModels(t)); err != nil {
+		t.Fatalf("Man() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		".TH MYLOCK 1",
+		"mylock \\- Acquire a lock and run a command\n",
+		"\\fB\\-\\-lock\\-name\\fR=\\fISTRING\\fR\nA unique name for the lock.\n",
+		"\\fB\\-\\-timeout\\fR=\\fIINT\\fR\nMax seconds to wait. Required.\n",
+		"\\fB\\-\\-debug\\fR\nLog queries.\n",
+		".SS mylock bench\nMeasure contention.\n",
+		"\\fB\\-\\-workers\\fR=\\fI10\\fR\n",
+		".B MYLOCK_HOST\n",
+		".SH \"EXIT STATUS\"\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Man() output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "hidden") || strings.Contains(out, "\\-\\-help") {
+		t.Errorf("Man() documents hidden or help flags:\n%s", out)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Markdown(&buf, testModels(t)); err != nil {
+		t.Fatalf("Markdown() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# mylock\n\nAcquire a lock and run a command.\n",
+		"mylock --timeout=INT <command> ... [flags]\n",
+		"- `--lock-name=STRING`: A unique name for the lock.\n",
+		"- `--debug`: Log queries.\n",
+		"### mylock bench\n",
+		"| `MYLOCK_HOST` |",
+		"| `203` |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Markdown() output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestNoModels(t *testing.T) {
+	if err := Man(&bytes.Buffer{}, nil); err == nil {
+		t.Error("Man() with no models should fail")
+	}
+	if err := Markdown(&bytes.Buffer{}, nil); err == nil {
+		t.Error("Markdown() with no models should fail")
+	}
+}
+
+func TestRoff(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"--flag", "\\-\\-flag"},
+		{`a\b`, `a\eb`},
+		{".starts with a dot", "\\&.starts with a dot"},
+		{"'quoted", "\\&'quoted"},
+	}
+	for _, tt := range tests {
+		if got := roff(tt.in); got != tt.want {
+			t.Errorf("roff(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -4,15 +4,49 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
-	"syscall"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/logging"
 )
 
 type Executor struct {
+	// Env holds extra KEY=value pairs added to the inherited environment
+	Env []string
+	// Stdout and Stderr override the passed-through streams when set
+	Stdout io.Writer
+	Stderr io.Writer
+	// Clock times the retry backoff; nil uses the system clock
+	Clock clock.Clock
+
+	usage Usage
+
+	mu sync.Mutex
+	// running is the command process while Execute waits for it
+	running *os.Process
 }
 
+// Usage is the resource usage of the commands an Executor has run
+type Usage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSS is the peak resident set size in bytes, or 0 where unknown
+	MaxRSS      int64
+	MajorFaults int64
+	MinorFaults int64
+}
+
+// outputWaitDelay bounds how long Execute waits for the command's output
+// pipes to close once it has exited, since processes it left in the
+// background may keep them open for much longer
+const outputWaitDelay = time.Second
+
 func New() *Executor {
 	return &Executor{}
 }
@@ -23,15 +57,26 @@ func (e *Executor) Execute(ctx context.Context, command []string) (int, error) {
 	}
 
 	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	setupCommand(cmd)
+	if len(e.Env) > 0 {
+		cmd.Env = append(os.Environ(), e.Env...)
+	}
 
 	// Pass through stdin, stdout, stderr
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if e.Stdout != nil {
+		cmd.Stdout = e.Stdout
+	}
+	if e.Stderr != nil {
+		cmd.Stderr = e.Stderr
+	}
+	cmd.WaitDelay = outputWaitDelay
 
 	// Set up signal handling with a local channel
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, forwardedSignals...)
 	defer signal.Stop(sigChan)
 
 	// Start the command
@@ -39,44 +84,201 @@ func (e *Executor) Execute(ctx context.Context, command []string) (int, error) {
 		return -1, fmt.Errorf("failed to start command: %w", err)
 	}
 
+	e.mu.Lock()
+	e.running = cmd.Process
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.running = nil
+		e.mu.Unlock()
+	}()
+
+	// Track the command's process tree so cancellation also reaches its children
+	tree, err := attachProcessTree(cmd)
+	if err != nil {
+		logging.Printc(logging.Yellow, "Warning: failed to track child processes: %v\n", err)
+	}
+	defer tree.Close()
+
 	// Wait for command completion or signal
 	done := make(chan error, 1)
 	go func() {
-		done <- cmd.Wait()
+		err := cmd.Wait()
+		if errors.Is(err, exec.ErrWaitDelay) {
+			// The command succeeded but left background processes holding its output
+			err = nil
+		}
+		done <- err
 	}()
 
 	select {
 	case <-ctx.Done():
 		// Context cancelled
-		if err := cmd.Process.Kill(); err != nil {
+		if err := tree.Kill(); err != nil {
 			return -1, fmt.Errorf("failed to kill process: %w", err)
 		}
 		return -1, ctx.Err()
 	case sig := <-sigChan:
 		// Forward signal to child process
-		if err := cmd.Process.Signal(sig); err != nil {
+		if err := forwardSignal(cmd, sig); err != nil {
 			return -1, fmt.Errorf("failed to forward signal: %w", err)
 		}
 		// Wait for process to handle the signal
 		err := <-done
-		return GetExitCode(err), err
+		e.addUsage(cmd.ProcessState)
+		return exitResult(err)
 	case err := <-done:
 		// Command completed
-		return GetExitCode(err), err
+		e.addUsage(cmd.ProcessState)
+		return exitResult(err)
+	}
+}
+
+// ErrNotRunning is returned by Pause, Resume and Signal between commands
+var ErrNotRunning = errors.New("no command is running")
+
+// Pause stops the running command until Resume is called
+func (e *Executor) Pause() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running == nil {
+		return ErrNotRunning
+	}
+	return pauseProcess(e.running)
+}
+
+// Resume continues a command stopped by Pause
+func (e *Executor) Resume() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running == nil {
+		return ErrNotRunning
+	}
+	return resumeProcess(e.running)
+}
+
+// Signal sends sig to the running command
+func (e *Executor) Signal(sig os.Signal) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running == nil {
+		return ErrNotRunning
+	}
+	return e.running.Signal(sig)
+}
+
+// PID returns the process ID of the running command, or 0 when none is running
+func (e *Executor) PID() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running == nil {
+		return 0
 	}
+	return e.running.Pid
 }
 
+// Usage returns the resource usage summed over every command that has run
+// to completion, with MaxRSS being the largest of them
+func (e *Executor) Usage() Usage {
+	return e.usage
+}
+
+func (e *Executor) addUsage(state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+	e.usage.UserTime += state.UserTime()
+	e.usage.SystemTime += state.SystemTime()
+	addSysUsage(&e.usage, state)
+}
+
+// CommandRunner runs the command mylock protects. Executor runs it as a
+// child process; other runners can take its place in cmd/mylock.
+type CommandRunner interface {
+	// ExecuteWithRetry runs command and returns its exit code, retrying as
+	// Executor.ExecuteWithRetry does
+	ExecuteWithRetry(ctx context.Context, command []string, retries int, backoff time.Duration) (int, error)
+	// Pause and Resume stop and continue the running command
+	Pause() error
+	Resume() error
+	// Signal sends a signal to the running command
+	Signal(sig os.Signal) error
+	// PID is the process ID of the running command, or 0 between runs
+	PID() int
+	// Usage is the resource usage of the finished runs
+	Usage() Usage
+}
+
+var _ CommandRunner = (*Executor)(nil)
+
+// ExecuteWithRetry runs the command and re-runs it up to retries more times
+// while it exits with a non-zero status. Commands that fail to start or are
+// terminated by a signal are not retried.
+func (e *Executor) ExecuteWithRetry(ctx context.Context, command []string, retries int, backoff time.Duration) (int, error) {
+	exitCode, err := e.Execute(ctx, command)
+	for attempt := 1; attempt <= retries && exitCode > 0; attempt++ {
+		logging.Printf("Command exited with code %d, retrying in %s (attempt %d/%d)\n", exitCode, backoff, attempt, retries)
+
+		timer := clock.OrReal(e.Clock).NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return exitCode, err
+		case <-timer.C():
+		}
+
+		exitCode, err = e.Execute(ctx, command)
+	}
+	return exitCode, err
+}
+
+// ShellCommand wraps a command line so it is interpreted by the platform shell
+func ShellCommand(line string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", line}
+	}
+	return []string{"sh", "-c", line}
+}
+
+// ExecError is returned when the command ran and exited with a non-zero
+// code, so callers can tell its failure from a failure to run it
+type ExecError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExecError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// exitResult turns the error of cmd.Wait into Execute's results
+func exitResult(err error) (int, error) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitStatus(exitErr)
+		return code, &ExecError{Code: code, Err: err}
+	}
+	return GetExitCode(err), err
+}
+
+// GetExitCode is the exit code of the command that err reports, 0 for nil
+// and -1 when err is not a command exit
 func GetExitCode(err error) int {
 	if err == nil {
 		return 0
 	}
 
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-			return status.ExitStatus()
-		}
-		// Fallback if we can't get the exact exit status
-		return 1
+	var execErr *ExecError
+	if errors.As(err, &execErr) {
+		return execErr.Code
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitStatus(exitErr)
 	}
 
 	return -1
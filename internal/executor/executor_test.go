@@ -3,12 +3,17 @@ package executor
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
 )
 
 func TestExecute(t *testing.T) {
@@ -219,6 +224,258 @@ func TestExecute_Context(t *testing.T) {
 	}
 }
 
+func TestExecuteWithRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell test on Windows")
+	}
+
+	tests := []struct {
+		name         string
+		script       string
+		retries      int
+		wantExitCode int
+		wantRuns     int
+	}{
+		{
+			name:         "success is not retried",
+			script:       "exit 0",
+			retries:      3,
+			wantExitCode: 0,
+			wantRuns:     1,
+		},
+		{
+			name:         "failure retried until retries exhausted",
+			script:       "exit 3",
+			retries:      2,
+			wantExitCode: 3,
+			wantRuns:     3,
+		},
+		{
+			name:         "succeeds on second attempt",
+			script:       "[ \"$(wc -l < \"$0\")\" -ge 2 ] || exit 4",
+			retries:      3,
+			wantExitCode: 0,
+			wantRuns:     2,
+		},
+		{
+			name:         "no retries configured",
+			script:       "exit 5",
+			retries:      0,
+			wantExitCode: 5,
+			wantRuns:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each run appends a line to the counter file before running the script
+			counter := filepath.Join(t.TempDir(), "runs")
+			command := []string{"sh", "-c", "echo run >> \"$0\"; " + tt.script, counter}
+
+			exitCode, _ := New().ExecuteWithRetry(context.Background(), command, tt.retries, time.Millisecond)
+			if exitCode != tt.wantExitCode {
+				t.Errorf("ExecuteWithRetry() exitCode = %v, want %v", exitCode, tt.wantExitCode)
+			}
+
+			data, err := os.ReadFile(counter)
+			if err != nil {
+				t.Fatalf("Failed to read counter file: %v", err)
+			}
+			if runs := strings.Count(string(data), "run"); runs != tt.wantRuns {
+				t.Errorf("command ran %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetry_Backoff(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell test on Windows")
+	}
+
+	fake := clock.NewFake(time.Now())
+	e := New()
+	e.Clock = fake
+
+	done := make(chan int, 1)
+	go func() {
+		exitCode, _ := e.ExecuteWithRetry(context.Background(), []string{"sh", "-c", "exit 3"}, 2, time.Hour)
+		done <- exitCode
+	}()
+
+	// Each retry waits a full hour of the fake clock
+	for retry := 1; retry <= 2; retry++ {
+		fake.BlockUntil(1)
+		select {
+		case <-done:
+			t.Fatalf("ExecuteWithRetry() returned before backoff %d elapsed", retry)
+		default:
+		}
+		fake.Advance(time.Hour)
+	}
+
+	select {
+	case exitCode := <-done:
+		if exitCode != 3 {
+			t.Errorf("ExecuteWithRetry() exitCode = %d, want 3", exitCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ExecuteWithRetry() did not return after the last backoff")
+	}
+}
+
+func TestExecute_Env(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell test on Windows")
+	}
+
+	executor := New()
+	executor.Env = []string{"MYLOCK_TEST_VALUE=expected"}
+
+	exitCode, err := executor.Execute(context.Background(), ShellCommand(`[ "$MYLOCK_TEST_VALUE" = expected ]`))
+	if err != nil || exitCode != 0 {
+		t.Errorf("Execute() with Env = (%v, %v), want (0, nil)", exitCode, err)
+	}
+}
+
+func TestExecute_Usage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell test on Windows")
+	}
+
+	executor := New()
+	if usage := executor.Usage(); usage != (Usage{}) {
+		t.Errorf("Usage() before any run = %+v, want zero", usage)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := executor.Execute(context.Background(), []string{"sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done"}); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+
+	usage := executor.Usage()
+	if usage.UserTime+usage.SystemTime <= 0 {
+		t.Errorf("Usage() CPU time = %v, want more than zero", usage.UserTime+usage.SystemTime)
+	}
+	if usage.MaxRSS <= 0 {
+		t.Errorf("Usage() MaxRSS = %d, want more than zero", usage.MaxRSS)
+	}
+	if usage.MinorFaults <= 0 {
+		t.Errorf("Usage() MinorFaults = %d, want more than zero", usage.MinorFaults)
+	}
+}
+
+func TestExecute_PauseResume(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping signal test on Windows")
+	}
+
+	executor := New()
+	if err := executor.Pause(); err == nil {
+		t.Error("Pause() with no running command should fail")
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		exitCode, _ := executor.Execute(context.Background(), []string{"sleep", "0.3"})
+		done <- exitCode
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := executor.Pause(); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	// A stopped command does not finish on its own
+	select {
+	case <-done:
+		t.Fatal("command finished while paused")
+	case <-time.After(400 * time.Millisecond):
+	}
+
+	if err := executor.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	select {
+	case exitCode := <-done:
+		if exitCode != 0 {
+			t.Errorf("Execute() exitCode = %v, want 0", exitCode)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("command did not finish after Resume()")
+	}
+}
+
+func TestExecute_BackgroundedGrandchild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping shell test on Windows")
+	}
+
+	// A piped stdout stays open in the backgrounded sleep after sh exits
+	var stdout, stderr bytes.Buffer
+	executor := &Executor{Stdout: &stdout, Stderr: &stderr}
+	start := time.Now()
+	exitCode, err := executor.Execute(context.Background(), []string{"sh", "-c", "sleep 5 & echo started"})
+	if err != nil || exitCode != 0 {
+		t.Fatalf("Execute() = (%d, %v), want (0, nil)", exitCode, err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Execute() returned after %s, waiting for the backgrounded grandchild", elapsed)
+	}
+	if !strings.Contains(stdout.String(), "started") {
+		t.Errorf("stdout = %q, want started", stdout.String())
+	}
+}
+
+func TestExecute_Signal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping signal test on Windows")
+	}
+
+	executor := New()
+	sig, err := ParseSignal("sigterm")
+	if err != nil {
+		t.Fatalf("ParseSignal() error = %v", err)
+	}
+	if err := executor.Signal(sig); err == nil {
+		t.Error("Signal() with no running command should fail")
+	}
+	if pid := executor.PID(); pid != 0 {
+		t.Errorf("PID() = %d with no running command, want 0", pid)
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		exitCode, _ := executor.Execute(context.Background(), []string{"sh", "-c", "trap 'exit 7' TERM; while :; do sleep 0.05; done"})
+		done <- exitCode
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if executor.PID() <= 0 {
+		t.Errorf("PID() = %d while the command runs, want its process ID", executor.PID())
+	}
+
+	if err := executor.Signal(sig); err != nil {
+		t.Fatalf("Signal() error = %v", err)
+	}
+	select {
+	case exitCode := <-done:
+		if exitCode != 7 {
+			t.Errorf("Execute() exitCode = %v, want 7 from the TERM trap", exitCode)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("command did not exit after Signal()")
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	if _, err := ParseSignal("KILL"); err != nil {
+		t.Errorf("ParseSignal(KILL) error = %v", err)
+	}
+	if _, err := ParseSignal("SIGWINCHESTER"); err == nil {
+		t.Error("ParseSignal() of an unknown signal succeeded")
+	}
+}
+
 func TestGetExitCode(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -235,6 +492,11 @@ func TestGetExitCode(t *testing.T) {
 			err:      &exec.ExitError{ProcessState: &os.ProcessState{}},
 			wantCode: -1, // Can't easily mock ProcessState.ExitCode()
 		},
+		{
+			name:     "wrapped ExecError",
+			err:      fmt.Errorf("run failed: %w", &ExecError{Code: 3, Err: errors.New("exit status 3")}),
+			wantCode: 3,
+		},
 		{
 			name:     "other error",
 			err:      os.ErrNotExist,
@@ -250,3 +512,27 @@ func TestGetExitCode(t *testing.T) {
 		})
 	}
 }
+
+func TestExecute_ExecError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows")
+	}
+
+	_, err := New().Execute(context.Background(), []string{"sh", "-c", "exit 3"})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("Execute() error = %v, want an *ExecError", err)
+	}
+	if execErr.Code != 3 {
+		t.Errorf("ExecError.Code = %d, want 3", execErr.Code)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Error("ExecError does not unwrap to *exec.ExitError")
+	}
+
+	_, err = New().Execute(context.Background(), []string{"mylock-no-such-command"})
+	if errors.As(err, &execErr) {
+		t.Errorf("Execute() of a missing command returned an ExecError: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// forwardedSignals are relayed from mylock to the running command
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// signalsByName are the signals ParseSignal accepts
+var signalsByName = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+func setupCommand(cmd *exec.Cmd) {
+}
+
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+func exitStatus(exitErr *exec.ExitError) int {
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+		return status.ExitStatus()
+	}
+	// Fallback if we can't get the exact exit status
+	return 1
+}
+
+func pauseProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGSTOP)
+}
+
+func resumeProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGCONT)
+}
+
+// addSysUsage adds the memory and page fault counts from the rusage of a
+// finished process
+func addSysUsage(u *Usage, state *os.ProcessState) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+	// ru_maxrss is in kilobytes, except on macOS where it is in bytes
+	maxRSS := int64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024
+	}
+	if maxRSS > u.MaxRSS {
+		u.MaxRSS = maxRSS
+	}
+	u.MajorFaults += int64(rusage.Majflt)
+	u.MinorFaults += int64(rusage.Minflt)
+}
+
+// processTree is the set of processes killed when the command is cancelled.
+// On Unix it is just the command process itself.
+type processTree struct {
+	cmd *exec.Cmd
+}
+
+func attachProcessTree(cmd *exec.Cmd) (*processTree, error) {
+	return &processTree{cmd: cmd}, nil
+}
+
+func (t *processTree) Kill() error {
+	return t.cmd.Process.Kill()
+}
+
+func (t *processTree) Close() error {
+	return nil
+}
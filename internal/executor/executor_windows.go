@@ -0,0 +1,241 @@
+//go:build windows
+
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// forwardedSignals are relayed from mylock to the running command.
+// On Windows, os.Interrupt covers CTRL_C and CTRL_BREAK, and SIGTERM covers
+// console close, logoff and shutdown events.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// signalsByName are the signals ParseSignal accepts; Windows can only kill
+var signalsByName = map[string]os.Signal{
+	"KILL": os.Kill,
+}
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+	procThread32First            = kernel32.NewProc("Thread32First")
+	procThread32Next             = kernel32.NewProc("Thread32Next")
+	procOpenThread               = kernel32.NewProc("OpenThread")
+	procResumeThread             = kernel32.NewProc("ResumeThread")
+)
+
+const (
+	jobObjectExtendedLimitInformationClass = 9
+	jobObjectLimitKillOnJobClose           = 0x2000
+	processSetQuota                        = 0x0100
+	processTerminate                       = 0x0001
+	createSuspended                        = 0x00000004
+	threadSuspendResume                    = 0x0002
+)
+
+type threadEntry32 struct {
+	Size           uint32
+	Usage          uint32
+	ThreadID       uint32
+	OwnerProcessID uint32
+	BasePri        int32
+	DeltaPri       int32
+	Flags          uint32
+}
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// setupCommand starts the command in its own process group so that console
+// control events can be delivered to it without also hitting mylock. It is
+// also started suspended, so it cannot start children before
+// attachProcessTree has placed it in a Job Object; attachProcessTree resumes
+// it.
+func setupCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | createSuspended,
+	}
+}
+
+// forwardSignal delivers CTRL_BREAK to the command's process group, since
+// Windows has no way to send an arbitrary signal to another process.
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) error {
+	r, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(cmd.Process.Pid))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func exitStatus(exitErr *exec.ExitError) int {
+	return exitErr.ExitCode()
+}
+
+// pauseProcess is not supported, as Windows has no SIGSTOP
+func pauseProcess(p *os.Process) error {
+	return errors.New("pausing a command is not supported on Windows")
+}
+
+func resumeProcess(p *os.Process) error {
+	return errors.New("resuming a command is not supported on Windows")
+}
+
+// addSysUsage does nothing on Windows, where only CPU times are reported
+func addSysUsage(u *Usage, state *os.ProcessState) {
+}
+
+// processTree is the set of processes killed when the command is cancelled.
+// On Windows the command is placed in a Job Object, so terminating the job
+// also terminates every process the command started. The job is created with
+// KILL_ON_JOB_CLOSE and closed when Execute returns, so processes the command
+// left running in the background are killed then, after each attempt of
+// ExecuteWithRetry, rather than outliving the lock.
+type processTree struct {
+	cmd *exec.Cmd
+	job syscall.Handle
+}
+
+func attachProcessTree(cmd *exec.Cmd) (*processTree, error) {
+	tree := &processTree{cmd: cmd}
+	job, jobErr := assignJob(cmd.Process.Pid)
+	if jobErr == nil {
+		tree.job = job
+	}
+
+	// The command was started suspended, and is resumed even without a job
+	if err := resumeThreads(uint32(cmd.Process.Pid)); err != nil {
+		_ = tree.Kill()
+		return tree, fmt.Errorf("failed to resume the command, so it was killed: %w", err)
+	}
+	return tree, jobErr
+}
+
+// assignJob places the process in a new Job Object that terminates it, and
+// every process it started, once the job is closed
+func assignJob(pid int) (syscall.Handle, error) {
+	r, _, err := procCreateJobObjectW.Call(0, 0)
+	if r == 0 {
+		return 0, fmt.Errorf("CreateJobObject: %w", err)
+	}
+	job := syscall.Handle(r)
+
+	var info jobObjectExtendedLimitInformation
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	r, _, err = procSetInformationJobObject.Call(
+		uintptr(job),
+		jobObjectExtendedLimitInformationClass,
+		uintptr(unsafe.Pointer(&info)),
+		unsafe.Sizeof(info),
+	)
+	if r == 0 {
+		syscall.CloseHandle(job)
+		return 0, fmt.Errorf("SetInformationJobObject: %w", err)
+	}
+
+	process, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(pid))
+	if err != nil {
+		syscall.CloseHandle(job)
+		return 0, fmt.Errorf("OpenProcess: %w", err)
+	}
+	defer syscall.CloseHandle(process)
+
+	r, _, err = procAssignProcessToJobObject.Call(uintptr(job), uintptr(process))
+	if r == 0 {
+		syscall.CloseHandle(job)
+		return 0, fmt.Errorf("AssignProcessToJobObject: %w", err)
+	}
+	return job, nil
+}
+
+// resumeThreads resumes the threads of a process started suspended. Windows
+// only hands the thread handle to CreateProcess's caller, so the threads are
+// found with a Toolhelp snapshot.
+func resumeThreads(pid uint32) error {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return fmt.Errorf("CreateToolhelp32Snapshot: %w", err)
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry threadEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	r, _, err := procThread32First.Call(uintptr(snapshot), uintptr(unsafe.Pointer(&entry)))
+	if r == 0 {
+		return fmt.Errorf("Thread32First: %w", err)
+	}
+	resumed := false
+	for ; r != 0; r, _, _ = procThread32Next.Call(uintptr(snapshot), uintptr(unsafe.Pointer(&entry))) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, _, err := procOpenThread.Call(threadSuspendResume, 0, uintptr(entry.ThreadID))
+		if thread == 0 {
+			return fmt.Errorf("OpenThread: %w", err)
+		}
+		r, _, err := procResumeThread.Call(thread)
+		syscall.CloseHandle(syscall.Handle(thread))
+		if uint32(r) == ^uint32(0) {
+			return fmt.Errorf("ResumeThread: %w", err)
+		}
+		resumed = true
+	}
+	if !resumed {
+		return errors.New("no thread of the command was found")
+	}
+	return nil
+}
+
+func (t *processTree) Kill() error {
+	if t.job == 0 {
+		return t.cmd.Process.Kill()
+	}
+	r, _, err := procTerminateJobObject.Call(uintptr(t.job), 1)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func (t *processTree) Close() error {
+	if t.job == 0 {
+		return nil
+	}
+	return syscall.CloseHandle(t.job)
+}
@@ -0,0 +1,16 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ParseSignal reads a signal name such as TERM or SIGUSR1
+func ParseSignal(name string) (os.Signal, error) {
+	sig, ok := signalsByName[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unknown or unsupported signal %q", name)
+	}
+	return sig, nil
+}
@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		writes []string
+		want   string
+	}{
+		{
+			name:   "shorter than size",
+			size:   16,
+			writes: []string{"hello"},
+			want:   "hello",
+		},
+		{
+			name:   "single write truncated",
+			size:   5,
+			writes: []string{"hello world"},
+			want:   "world",
+		},
+		{
+			name:   "multiple writes truncated",
+			size:   8,
+			writes: []string{"line1\n", "line2\n", "line3\n"},
+			want:   "2\nline3\n",
+		},
+		{
+			name:   "no writes",
+			size:   8,
+			writes: nil,
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := NewTailBuffer(tt.size)
+			for _, w := range tt.writes {
+				n, err := fmt.Fprint(tail, w)
+				if err != nil || n != len(w) {
+					t.Fatalf("Write() = (%d, %v), want (%d, nil)", n, err, len(w))
+				}
+			}
+			if got := tail.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
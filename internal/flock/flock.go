@@ -0,0 +1,113 @@
+// Package flock takes advisory locks on local files, to coordinate mylock
+// processes on the same machine without a database
+package flock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often a busy file lock is retried while waiting
+const pollInterval = 100 * time.Millisecond
+
+// ErrTimeout means the file lock did not become free before the context ended
+var ErrTimeout = errors.New("timed out waiting for a local file lock")
+
+// Lock is an exclusive lock on a local file, held until Unlock is called or
+// the process exits
+type Lock struct {
+	f *os.File
+}
+
+// TryLock takes the lock on path if no other process holds it. It returns
+// nil and no error when the lock is busy.
+func TryLock(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	ok, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	if !ok {
+		f.Close()
+		return nil, nil
+	}
+	return &Lock{f: f}, nil
+}
+
+// Acquire waits for the lock on path until ctx ends, in which case it
+// returns ErrTimeout or the context error
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	return poll(ctx, func() (*Lock, error) {
+		return TryLock(path)
+	})
+}
+
+// AcquireSlot waits until one of slots lock files in dir is free and takes
+// it, so at most slots processes hold a slot in dir at the same time. It
+// returns the lock and the index of the slot. dir is created private to
+// this user, and refused if another user owns it or can write to it, as
+// they could then hold every slot.
+func AcquireSlot(ctx context.Context, dir string, slots int) (*Lock, int, error) {
+	if slots < 1 {
+		return nil, -1, errors.New("slots must be at least 1")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, -1, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return nil, -1, fmt.Errorf("refusing lock directory: %w", err)
+	}
+	slot := -1
+	l, err := poll(ctx, func() (*Lock, error) {
+		for i := 0; i < slots; i++ {
+			l, err := TryLock(filepath.Join(dir, fmt.Sprintf("slot-%d.lock", i)))
+			if err != nil || l != nil {
+				slot = i
+				return l, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+	return l, slot, nil
+}
+
+// poll calls try until it returns a lock or an error, or ctx ends
+func poll(ctx context.Context, try func() (*Lock, error)) (*Lock, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		l, err := try()
+		if err != nil || l != nil {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrTimeout
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Unlock releases the lock. The lock file is left in place, since removing
+// it could let two processes lock different files of the same name.
+func (l *Lock) Unlock() error {
+	if err := unlock(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
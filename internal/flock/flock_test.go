@@ -0,0 +1,130 @@
+package flock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+
+	first, err := TryLock(path)
+	if err != nil || first == nil {
+		t.Fatalf("TryLock() = %v, %v, want a lock", first, err)
+	}
+	second, err := TryLock(path)
+	if err != nil || second != nil {
+		t.Fatalf("TryLock() on a held file = %v, %v, want nil, nil", second, err)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	third, err := TryLock(path)
+	if err != nil || third == nil {
+		t.Fatalf("TryLock() after Unlock = %v, %v, want a lock", third, err)
+	}
+	third.Unlock()
+}
+
+func TestAcquire_Timeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	held, err := TryLock(path)
+	if err != nil || held == nil {
+		t.Fatalf("TryLock() = %v, %v", held, err)
+	}
+	defer held.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Acquire() on a held file error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestAcquire_WaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	held, err := TryLock(path)
+	if err != nil || held == nil {
+		t.Fatalf("TryLock() = %v, %v", held, err)
+	}
+	time.AfterFunc(150*time.Millisecond, func() { held.Unlock() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l, err := Acquire(ctx, path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	l.Unlock()
+}
+
+func TestAcquireSlot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "slots")
+	ctx := context.Background()
+
+	a, slotA, err := AcquireSlot(ctx, dir, 2)
+	if err != nil {
+		t.Fatalf("AcquireSlot() error = %v", err)
+	}
+	b, slotB, err := AcquireSlot(ctx, dir, 2)
+	if err != nil {
+		t.Fatalf("AcquireSlot() error = %v", err)
+	}
+	if slotA == slotB {
+		t.Fatalf("both holders got slot %d", slotA)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	if _, _, err := AcquireSlot(timeoutCtx, dir, 2); !errors.Is(err, ErrTimeout) {
+		t.Errorf("AcquireSlot() with every slot taken error = %v, want ErrTimeout", err)
+	}
+
+	b.Unlock()
+	c, slotC, err := AcquireSlot(ctx, dir, 2)
+	if err != nil {
+		t.Fatalf("AcquireSlot() after a release error = %v", err)
+	}
+	if slotC != slotB {
+		t.Errorf("AcquireSlot() = slot %d, want freed slot %d", slotC, slotB)
+	}
+	a.Unlock()
+	c.Unlock()
+
+	if _, _, err := AcquireSlot(ctx, dir, 0); err == nil {
+		t.Error("AcquireSlot() with 0 slots should fail")
+	}
+}
+
+func TestAcquireSlot_SharedDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not checked on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "slots")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// Another user could pre-create slot files here and hold them
+	if err := os.Chmod(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AcquireSlot(context.Background(), dir, 1); err == nil {
+		t.Error("AcquireSlot() in a directory others can write to succeeded")
+	}
+
+	created := filepath.Join(t.TempDir(), "new")
+	l, _, err := AcquireSlot(context.Background(), created, 1)
+	if err != nil {
+		t.Fatalf("AcquireSlot() error = %v", err)
+	}
+	l.Unlock()
+	if info, err := os.Stat(created); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("created lock directory mode = %v (%v), want 0700", info.Mode().Perm(), err)
+	}
+}
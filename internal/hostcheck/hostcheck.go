@@ -0,0 +1,19 @@
+// Package hostcheck measures the local host, for preconditions a job
+// checks before it takes its lock
+package hostcheck
+
+import "errors"
+
+// ErrUnsupported means the measurement is not available on this system
+var ErrUnsupported = errors.New("not supported on this system")
+
+// FreeDisk returns the bytes available to unprivileged users on the
+// filesystem holding path
+func FreeDisk(path string) (uint64, error) {
+	return freeDisk(path)
+}
+
+// LoadAverage returns the one-minute load average
+func LoadAverage() (float64, error) {
+	return loadAverage()
+}
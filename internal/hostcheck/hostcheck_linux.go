@@ -0,0 +1,32 @@
+//go:build linux
+
+package hostcheck
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func loadAverage() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadavg(string(data))
+}
+
+// parseLoadavg reads the one-minute figure from /proc/loadavg, e.g.
+// "0.52 0.58 0.59 1/467 12345"
+func parseLoadavg(data string) (float64, error) {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg %q", data)
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected /proc/loadavg %q", data)
+	}
+	return load, nil
+}
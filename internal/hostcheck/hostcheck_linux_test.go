@@ -0,0 +1,17 @@
+//go:build linux
+
+package hostcheck
+
+import "testing"
+
+func TestParseLoadavg(t *testing.T) {
+	got, err := parseLoadavg("3.25 0.58 0.59 1/467 12345\n")
+	if err != nil || got != 3.25 {
+		t.Errorf("parseLoadavg() = %v, %v, want 3.25", got, err)
+	}
+	for _, data := range []string{"", "busy 0.58 0.59"} {
+		if _, err := parseLoadavg(data); err == nil {
+			t.Errorf("parseLoadavg(%q) succeeded, want an error", data)
+		}
+	}
+}
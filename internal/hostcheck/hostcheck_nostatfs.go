@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package hostcheck
+
+// freeDisk is unsupported where syscall.Statfs is missing or lays out its
+// fields differently, as on OpenBSD and NetBSD
+func freeDisk(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package hostcheck
+
+func loadAverage() (float64, error) {
+	return 0, ErrUnsupported
+}
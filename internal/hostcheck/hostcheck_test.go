@@ -0,0 +1,37 @@
+package hostcheck
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestFreeDisk(t *testing.T) {
+	free, err := FreeDisk(t.TempDir())
+	if errors.Is(err, ErrUnsupported) {
+		t.Skipf("FreeDisk() is not supported on %s", runtime.GOOS)
+	}
+	if err != nil {
+		t.Fatalf("FreeDisk() error = %v", err)
+	}
+	if free == 0 {
+		t.Errorf("FreeDisk() = 0, want the space left on the test filesystem")
+	}
+
+	if _, err := FreeDisk("/nonexistent/mylock"); err == nil {
+		t.Errorf("FreeDisk() of a missing path succeeded, want an error")
+	}
+}
+
+func TestLoadAverage(t *testing.T) {
+	load, err := LoadAverage()
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("LoadAverage() error = %v, want ErrUnsupported", err)
+		}
+		return
+	}
+	if err != nil || load < 0 {
+		t.Errorf("LoadAverage() = %v, %v, want a load average", load, err)
+	}
+}
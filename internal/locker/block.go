@@ -0,0 +1,178 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// blockTable holds the maintenance blocks set with "mylock block set". It is
+// created in the connection's database when the first block is set.
+const blockTable = "mylock_blocks"
+
+// ErrBlocked means a maintenance block is set on the lock, so the command
+// must not run
+var ErrBlocked = errors.New("blocked for maintenance")
+
+// ER_TABLEACCESS_DENIED_ERROR and ER_DBACCESS_DENIED_ERROR, which an account
+// with only the rights to take locks gets for the block table
+const (
+	errTableAccessDenied = 1142
+	errDBAccessDenied    = 1044
+)
+
+// Block is an active maintenance block on a lock name
+type Block struct {
+	LockName string
+	Reason   string
+	// SetBy is who set the block, as given to SetBlock
+	SetBy string
+	// Age is how long ago the block was set, by the server's clock
+	Age time.Duration
+	// Remaining is how long until the block expires, or 0 if it does not
+	Remaining time.Duration
+}
+
+func (l *Locker) ensureBlockTable(ctx context.Context) error {
+	err := l.exec(ctx, "CREATE TABLE IF NOT EXISTS "+blockTable+" ("+
+		"lock_name VARCHAR(64) NOT NULL PRIMARY KEY, "+
+		"reason VARCHAR(255) NOT NULL, "+
+		"set_by VARCHAR(255) NOT NULL, "+
+		"set_at DATETIME(6) NOT NULL, "+
+		"expires_at DATETIME(6) NULL)")
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", blockTable, err)
+	}
+	return nil
+}
+
+// SetBlock blocks runs of lockName until ClearBlock is called or, if
+// duration is positive, until it has passed. Setting it again replaces the
+// reason and the expiry.
+func (l *Locker) SetBlock(ctx context.Context, lockName, reason, setBy string, duration time.Duration) error {
+	if err := l.checkName(lockName); err != nil {
+		return err
+	}
+	if err := l.ensureBlockTable(ctx); err != nil {
+		return err
+	}
+	var expires any
+	if duration > 0 {
+		expires = duration.Microseconds()
+	}
+	err := l.exec(ctx,
+		"REPLACE INTO "+blockTable+" (lock_name, reason, set_by, set_at, expires_at) "+
+			"VALUES (?, ?, ?, NOW(6), NOW(6) + INTERVAL ? MICROSECOND)",
+		lockName, reason, setBy, expires)
+	if err != nil {
+		return fmt.Errorf("failed to set block: %w", err)
+	}
+	return nil
+}
+
+// ClearBlock removes the block on lockName. It reports whether an active
+// block was removed.
+func (l *Locker) ClearBlock(ctx context.Context, lockName string) (bool, error) {
+	block, err := l.ActiveBlock(ctx, lockName)
+	if err != nil || block == nil {
+		return false, err
+	}
+	if err := l.exec(ctx, "DELETE FROM "+blockTable+" WHERE lock_name = ?", lockName); err != nil {
+		return false, fmt.Errorf("failed to clear block: %w", err)
+	}
+	return true, nil
+}
+
+// ActiveBlock returns the block on lockName, or nil if there is none or it
+// has expired
+func (l *Locker) ActiveBlock(ctx context.Context, lockName string) (*Block, error) {
+	if err := l.checkName(lockName); err != nil {
+		return nil, err
+	}
+	blocks, err := l.blocks(ctx, " AND lock_name = ?", lockName)
+	if err != nil || len(blocks) == 0 {
+		return nil, err
+	}
+	return &blocks[0], nil
+}
+
+// FirstBlock returns the active block on the first of lockNames that has
+// one, or nil if none has. Names the lock name policy rejects cannot be
+// blocked and are skipped. An account that may not read the block table is
+// treated like a missing table, so runs with only the rights to take locks
+// do not warn about it.
+func (l *Locker) FirstBlock(ctx context.Context, lockNames ...string) (*Block, error) {
+	var names []string
+	for _, name := range lockNames {
+		if l.checkName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	blocks, err := l.blocks(ctx, " AND lock_name IN (?"+strings.Repeat(", ?", len(names)-1)+")", args...)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && (mysqlErr.Number == errTableAccessDenied || mysqlErr.Number == errDBAccessDenied) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		for i := range blocks {
+			if blocks[i].LockName == name {
+				return &blocks[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Blocks lists every active block
+func (l *Locker) Blocks(ctx context.Context) ([]Block, error) {
+	return l.blocks(ctx, "")
+}
+
+// blocks reads the unexpired blocks matching the extra condition. A missing
+// table means no block was ever set.
+func (l *Locker) blocks(ctx context.Context, condition string, args ...any) ([]Block, error) {
+	rows, err := l.query(ctx, "SELECT lock_name, reason, set_by, TIMESTAMPDIFF(MICROSECOND, set_at, NOW(6)), "+
+		"TIMESTAMPDIFF(MICROSECOND, NOW(6), expires_at) FROM "+blockTable+
+		" WHERE (expires_at IS NULL OR expires_at > NOW(6))"+condition+" ORDER BY lock_name", args...)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", blockTable, err)
+	}
+	defer rows.Close()
+	var blocks []Block
+	for rows.Next() {
+		var b Block
+		var age int64
+		var remaining sql.NullInt64
+		if err := rows.Scan(&b.LockName, &b.Reason, &b.SetBy, &age, &remaining); err != nil {
+			return blocks, fmt.Errorf("failed to read %s: %w", blockTable, err)
+		}
+		b.Age = time.Duration(age) * time.Microsecond
+		if remaining.Valid {
+			b.Remaining = time.Duration(remaining.Int64) * time.Microsecond
+		}
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return blocks, fmt.Errorf("failed to read %s: %w", blockTable, err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,59 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+// claimPollInterval is how often AcquireAny tries the locks again while
+// all of them are held
+const claimPollInterval = 500 * time.Millisecond
+
+// AcquireAny takes the first lock in names that is free, trying them in
+// order, and returns its name. While all are held it keeps trying until
+// timeout seconds have passed, then returns an empty name.
+func (l *Locker) AcquireAny(ctx context.Context, names []string, timeout int) (string, error) {
+	return acquireAny(ctx, l, l.clock, names, timeout)
+}
+
+// AcquireAny takes the first lock in names that is free; see
+// Locker.AcquireAny
+func (l *MemoryLocker) AcquireAny(ctx context.Context, names []string, timeout int) (string, error) {
+	return acquireAny(ctx, l, l.clock, names, timeout)
+}
+
+func acquireAny(ctx context.Context, b Backend, c clock.Clock, names []string, timeout int) (string, error) {
+	if len(names) == 0 {
+		return "", errors.New("no lock names given")
+	}
+	if timeout < 0 {
+		return "", errors.New("timeout must not be negative")
+	}
+	c = clock.OrReal(c)
+	timer := c.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+	ticker := c.NewTicker(claimPollInterval)
+	defer ticker.Stop()
+	for {
+		for _, name := range names {
+			acquired, err := b.TryLock(ctx, name)
+			if err != nil {
+				return "", fmt.Errorf("failed to acquire lock '%s': %w", name, err)
+			}
+			if acquired {
+				return name, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timer.C():
+			return "", nil
+		case <-ticker.C():
+		}
+	}
+}
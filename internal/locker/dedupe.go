@@ -0,0 +1,56 @@
+package locker
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// dedupeTable records when each command last succeeded, in UTC so that
+// sessions with different time zones agree. It is created in the
+// connection's database on first use.
+const dedupeTable = "mylock_dedupe"
+
+func (l *Locker) ensureDedupeTable(ctx context.Context) error {
+	err := l.exec(ctx, "CREATE TABLE IF NOT EXISTS "+dedupeTable+" ("+
+		"command_hash VARCHAR(64) NOT NULL PRIMARY KEY, "+
+		"succeeded_at DATETIME(6) NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %w", dedupeTable, err)
+	}
+	return nil
+}
+
+// LastSuccess reports how long ago a command with this hash last succeeded,
+// by the server's clock so it agrees across hosts. found is false if it
+// never did.
+func (l *Locker) LastSuccess(ctx context.Context, commandHash string) (age time.Duration, found bool, err error) {
+	if err := l.ensureDedupeTable(ctx); err != nil {
+		return 0, false, err
+	}
+	micros, err := l.queryInt(ctx,
+		"SELECT COALESCE(MAX(TIMESTAMPDIFF(MICROSECOND, succeeded_at, UTC_TIMESTAMP(6))), -1) FROM "+dedupeTable+" WHERE command_hash = ?",
+		commandHash)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read last success: %w", err)
+	}
+	if !micros.Valid || micros.Int64 < 0 {
+		return 0, false, nil
+	}
+	return time.Duration(micros.Int64) * time.Microsecond, true, nil
+}
+
+// RecordSuccess stores that a command with this hash succeeded just now
+func (l *Locker) RecordSuccess(ctx context.Context, commandHash string) error {
+	if err := l.ensureDedupeTable(ctx); err != nil {
+		return err
+	}
+	err := l.exec(ctx,
+		"INSERT INTO "+dedupeTable+" (command_hash, succeeded_at) VALUES (?, UTC_TIMESTAMP(6)) "+
+			"ON DUPLICATE KEY UPDATE succeeded_at = UTC_TIMESTAMP(6)",
+		commandHash)
+	if err != nil {
+		return fmt.Errorf("failed to record success: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package locker
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Server error numbers for a GET_LOCK wait that would deadlock. MySQL
+// reports ER_USER_LOCK_DEADLOCK; MariaDB implements user locks with
+// metadata locks and reports the generic ER_LOCK_DEADLOCK instead.
+const (
+	errUserLockDeadlock = 3058
+	errLockDeadlock     = 1213
+)
+
+// ErrLockDeadlock means the server refused a GET_LOCK wait because another
+// session waiting for a lock this session holds would never be woken
+var ErrLockDeadlock = errors.New("waiting for the lock would deadlock")
+
+// Flavor returns "MariaDB" or "MySQL"
+func (v ServerVersion) Flavor() string {
+	if v.MariaDB {
+		return "MariaDB"
+	}
+	return "MySQL"
+}
+
+// isDeadlock reports whether err is the server's deadlock error for
+// GET_LOCK. ER_LOCK_DEADLOCK is only taken as one on MariaDB (or an
+// unknown server), since MySQL uses it for InnoDB row locks only.
+func (l *Locker) isDeadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case errUserLockDeadlock:
+		return true
+	case errLockDeadlock:
+		return l.version == nil || l.version.MariaDB
+	}
+	return false
+}
+
+// lockError describes a failed GET_LOCK query
+func (l *Locker) lockError(lockName string, err error) error {
+	if l.isDeadlock(err) {
+		return fmt.Errorf("%w: another session waits for a lock this session holds while '%s' is held: %v", ErrLockDeadlock, lockName, err)
+	}
+	return fmt.Errorf("failed to acquire lock: %w", err)
+}
@@ -0,0 +1,111 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// dialFunc dials like the driver would and remembers the server address of
+// the session, so a later DNS change of the endpoint can be noticed
+func (l *Locker) dialFunc(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err == nil && conn.RemoteAddr() != nil {
+		l.mu.Lock()
+		l.remoteAddr = conn.RemoteAddr().String()
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+// openDB opens a pool for dsn whose connections are dialed through l
+func (l *Locker) openDB(dsn string) error {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if cfg.Net == "tcp" {
+		if host, _, err := net.SplitHostPort(cfg.Addr); err == nil {
+			l.host = host
+		}
+		cfg.DialFunc = l.dialFunc
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	l.connector = connector
+	l.db = sql.OpenDB(connector)
+	return nil
+}
+
+// detectWriter turns on the read-only check when the session starts on a
+// writable server, as a managed-MySQL writer does
+func (l *Locker) detectWriter(ctx context.Context) error {
+	readOnly, err := l.queryInt(ctx, "SELECT @@global.innodb_read_only")
+	if err != nil || !readOnly.Valid {
+		logging.Debugf("cannot tell whether the server is writable: %v", err)
+		return nil
+	}
+	if readOnly.Int64 != 0 {
+		if l.checkWriter {
+			return errors.New("the server is read-only, likely a replica after a failover")
+		}
+		return nil
+	}
+	l.checkWriter = true
+	return nil
+}
+
+// checkFailover detects a managed-MySQL failover that left the session
+// alive: the server turned read-only, or, with SetDetectFailover, the
+// endpoint now resolves to a different server
+func (l *Locker) checkFailover(ctx context.Context) error {
+	if l.checkWriter {
+		readOnly, err := l.queryInt(ctx, "SELECT @@global.innodb_read_only")
+		if err == nil && readOnly.Valid && readOnly.Int64 != 0 {
+			return errors.New("the server became read-only, likely after a failover")
+		}
+	}
+	l.mu.Lock()
+	detect := l.detectFailover
+	l.mu.Unlock()
+	if !detect {
+		return nil
+	}
+	return l.checkEndpoint(ctx)
+}
+
+// checkEndpoint reports an error when the host the session was opened to
+// no longer resolves to the server it is connected to
+func (l *Locker) checkEndpoint(ctx context.Context) error {
+	l.mu.Lock()
+	remote := l.remoteAddr
+	l.mu.Unlock()
+	if remote == "" || l.host == "" || net.ParseIP(l.host) != nil {
+		return nil
+	}
+	remoteIP, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, l.host)
+	if err != nil {
+		logging.Debugf("failed to resolve %s: %v", l.host, err)
+		return nil
+	}
+	for _, addr := range addrs {
+		if addr == remoteIP {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s now resolves to %s instead of %s, likely after a failover", l.host, strings.Join(addrs, ", "), remoteIP)
+}
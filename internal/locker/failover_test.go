@@ -0,0 +1,99 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestLocker_CheckEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		wantErr    bool
+	}{
+		{
+			name:       "endpoint still resolves to the server",
+			host:       "localhost",
+			remoteAddr: "127.0.0.1:3306",
+		},
+		{
+			name:       "endpoint moved to another server",
+			host:       "localhost",
+			remoteAddr: "192.0.2.10:3306",
+			wantErr:    true,
+		},
+		{
+			name:       "IP address endpoints cannot move",
+			host:       "192.0.2.10",
+			remoteAddr: "192.0.2.10:3306",
+		},
+		{
+			name: "unknown remote address",
+			host: "localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Locker{host: tt.host, remoteAddr: tt.remoteAddr}
+			err := l.checkEndpoint(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocker_CheckFailover_Endpoint(t *testing.T) {
+	// DNS round-robin answers may leave out the server without a failover
+	l := &Locker{host: "localhost", remoteAddr: "192.0.2.10:3306"}
+	if err := l.checkFailover(context.Background()); err != nil {
+		t.Errorf("checkFailover() error = %v without SetDetectFailover, want nil", err)
+	}
+	l.SetDetectFailover(true)
+	if err := l.checkFailover(context.Background()); err == nil {
+		t.Error("checkFailover() with SetDetectFailover succeeded for a moved endpoint")
+	}
+}
+
+func TestLocker_CheckFailover_ReadOnly(t *testing.T) {
+	md := &mockDriver{queryResult: 0}
+	sql.Register("mock-failover-readonly", md)
+
+	db, _ := sql.Open("mock-failover-readonly", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	// A writable server at connect time turns on the check
+	if err := l.detectWriter(context.Background()); err != nil || !l.checkWriter {
+		t.Fatalf("detectWriter() = %v with checkWriter %v, want nil and true", err, l.checkWriter)
+	}
+	if err := l.checkFailover(context.Background()); err != nil {
+		t.Errorf("checkFailover() on a writer error = %v, want nil", err)
+	}
+
+	md.queryResult = 1
+	err := l.checkFailover(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("checkFailover() after the server turned read-only error = %v, want a read-only error", err)
+	}
+	if err := l.detectWriter(context.Background()); err == nil {
+		t.Error("detectWriter() after reconnecting to a read-only server should fail")
+	}
+}
+
+func TestLocker_DetectWriter_Replica(t *testing.T) {
+	sql.Register("mock-failover-replica", &mockDriver{queryResult: 1})
+
+	db, _ := sql.Open("mock-failover-replica", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	// Locking on a replica on purpose is allowed, but not watched for failover
+	if err := l.detectWriter(context.Background()); err != nil || l.checkWriter {
+		t.Errorf("detectWriter() on a replica = %v with checkWriter %v, want nil and false", err, l.checkWriter)
+	}
+}
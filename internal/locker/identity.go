@@ -0,0 +1,73 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Identity describes who the lock session is connected as and to
+type Identity struct {
+	// User is the account the client asked for, as USER() reports it
+	User string
+	// CurrentUser is the account the server authenticated, which may be a
+	// wildcard or anonymous account
+	CurrentUser string
+	// Hostname is the server's own @@hostname
+	Hostname string
+	// RemoteAddr is the address the session was dialed to, if known
+	RemoteAddr   string
+	Version      string
+	ConnectionID int64
+	// Database is empty when no default database is selected
+	Database string
+	// TLSVersion and TLSCipher are empty when the session is not encrypted
+	TLSVersion string
+	TLSCipher  string
+}
+
+// Identity reports the effective identity of the lock session
+func (l *Locker) Identity(ctx context.Context) (Identity, error) {
+	id := Identity{ConnectionID: l.ConnectionID()}
+
+	var database sql.NullString
+	err := l.queryRow(ctx, "SELECT USER(), CURRENT_USER(), @@hostname, VERSION(), DATABASE()").
+		Scan(&id.User, &id.CurrentUser, &id.Hostname, &id.Version, &database)
+	if err != nil {
+		return id, fmt.Errorf("failed to fetch session identity: %w", err)
+	}
+	id.Database = database.String
+
+	rows, err := l.query(ctx, "SHOW SESSION STATUS WHERE Variable_name IN ('Ssl_version', 'Ssl_cipher')")
+	if err != nil {
+		return id, fmt.Errorf("failed to fetch TLS status: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return id, fmt.Errorf("failed to fetch TLS status: %w", err)
+		}
+		switch name {
+		case "Ssl_version":
+			id.TLSVersion = value
+		case "Ssl_cipher":
+			id.TLSCipher = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return id, fmt.Errorf("failed to fetch TLS status: %w", err)
+	}
+
+	l.mu.Lock()
+	id.RemoteAddr = l.remoteAddr
+	l.mu.Unlock()
+	return id, nil
+}
+
+func (l *Locker) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if conn, _ := l.session(); conn != nil {
+		return conn.QueryContext(ctx, query, args...)
+	}
+	return l.db.QueryContext(ctx, query, args...)
+}
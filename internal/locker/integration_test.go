@@ -5,13 +5,45 @@ package locker
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/yammerjp/mylock/internal/mysqltest"
 )
 
+// TestMain starts a server for the tests when -mysql-image is given;
+// otherwise they use the TEST_MYSQL_* variables below
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if *mysqltest.Image == "" {
+		os.Exit(m.Run())
+	}
+
+	server, err := mysqltest.Start(*mysqltest.Image)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("TEST_MYSQL_HOST", server.Host)
+	os.Setenv("TEST_MYSQL_PORT", strconv.Itoa(server.Port))
+	os.Setenv("TEST_MYSQL_USER", mysqltest.User)
+	os.Setenv("TEST_MYSQL_PASSWORD", mysqltest.Password)
+	os.Setenv("TEST_MYSQL_DATABASE", mysqltest.Database)
+
+	code := m.Run()
+	if err := server.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
+
 func getTestDSN() string {
 	host := os.Getenv("TEST_MYSQL_HOST")
 	if host == "" {
@@ -236,3 +268,250 @@ func TestLocker_Integration_MultipleLocksNonBlocking(t *testing.T) {
 		}
 	}
 }
+
+func TestLocker_Integration_ConnectionID(t *testing.T) {
+	dsn := getTestDSN()
+	locker, err := NewLocker(dsn)
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer locker.Close()
+
+	if locker.ConnectionID() <= 0 {
+		t.Fatalf("Expected a positive connection id, got %d", locker.ConnectionID())
+	}
+
+	ctx := context.Background()
+	lockName := "test-lock-connection-id"
+	if _, err := locker.AcquireLock(ctx, lockName, 5); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer locker.ReleaseLock(ctx, lockName)
+
+	// The lock must be held by the session we reported
+	var holder int64
+	if err := locker.queryRow(ctx, "SELECT IS_USED_LOCK(?)", lockName).Scan(&holder); err != nil {
+		t.Fatalf("Failed to query lock holder: %v", err)
+	}
+	if holder != locker.ConnectionID() {
+		t.Errorf("IS_USED_LOCK() = %d, want connection id %d", holder, locker.ConnectionID())
+	}
+}
+
+func TestLocker_Integration_Identity(t *testing.T) {
+	locker, err := NewLocker(getTestDSN())
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer locker.Close()
+
+	id, err := locker.Identity(context.Background())
+	if err != nil {
+		t.Fatalf("Identity() error = %v", err)
+	}
+	if id.ConnectionID != locker.ConnectionID() {
+		t.Errorf("ConnectionID = %d, want %d", id.ConnectionID, locker.ConnectionID())
+	}
+	if id.User == "" || id.Version == "" {
+		t.Errorf("Identity() = %+v, want user and version set", id)
+	}
+}
+
+func TestLocker_Integration_Dialect(t *testing.T) {
+	locker, err := NewLocker(getTestDSN())
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer locker.Close()
+
+	version := locker.ServerVersion()
+	if version == nil {
+		t.Fatal("ServerVersion() = nil, want the detected version")
+	}
+	if *mysqltest.Image != "" {
+		wantMariaDB := strings.Contains(*mysqltest.Image, "mariadb")
+		if version.MariaDB != wantMariaDB {
+			t.Errorf("MariaDB = %v for image %s (version %s)", version.MariaDB, *mysqltest.Image, version)
+		}
+	}
+}
+
+func TestLocker_Integration_Deadlock(t *testing.T) {
+	dsn := getTestDSN()
+	first, err := NewLocker(dsn)
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer first.Close()
+	second, err := NewLocker(dsn)
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer second.Close()
+
+	ctx := context.Background()
+	if _, err := first.AcquireLock(ctx, "test-deadlock-a", 5); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer first.ReleaseLock(ctx, "test-deadlock-a")
+	if _, err := second.AcquireLock(ctx, "test-deadlock-b", 5); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer second.ReleaseLock(ctx, "test-deadlock-b")
+
+	// first waits for b; second then waiting for a closes the cycle
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := first.AcquireLock(ctx, "test-deadlock-b", 10)
+		firstErr <- err
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	_, secondErr := second.AcquireLock(ctx, "test-deadlock-a", 10)
+	if !errors.Is(secondErr, ErrLockDeadlock) {
+		// The server may pick the other session as the victim
+		second.ReleaseLock(ctx, "test-deadlock-b")
+		if err := <-firstErr; !errors.Is(err, ErrLockDeadlock) {
+			t.Fatalf("AcquireLock() errors = %v and %v, want one to match ErrLockDeadlock", secondErr, err)
+		}
+		return
+	}
+	second.ReleaseLock(ctx, "test-deadlock-b")
+	if err := <-firstErr; err != nil {
+		t.Errorf("AcquireLock() after the deadlock was broken: %v", err)
+	}
+	first.ReleaseLock(ctx, "test-deadlock-b")
+}
+
+func TestLocker_Integration_Snapshot(t *testing.T) {
+	dsn := getTestDSN()
+	holder, err := NewLocker(dsn)
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer holder.Close()
+	observer, err := NewLocker(dsn)
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer observer.Close()
+
+	ctx := context.Background()
+	if _, err := holder.AcquireLock(ctx, "test-snapshot-lock", 5); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer holder.ReleaseLock(ctx, "test-snapshot-lock")
+
+	s := observer.Snapshot(ctx)
+	if len(s.Errors) > 0 {
+		// MariaDB lists held locks only with the metadata_lock_info plugin
+		t.Skipf("Snapshot() errors: %v", s.Errors)
+	}
+	found := false
+	for _, h := range s.Held {
+		found = found || (h.Name == "test-snapshot-lock" && h.ConnectionID == holder.ConnectionID())
+	}
+	if !found {
+		t.Errorf("Snapshot().Held = %+v, want test-snapshot-lock held by %d", s.Held, holder.ConnectionID())
+	}
+}
+
+func TestLocker_Integration_ConnectionAttributes(t *testing.T) {
+	locker, err := NewLocker(getTestDSN() + "?connectionAttributes=program_name:mylock-test")
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer locker.Close()
+
+	var program string
+	err = locker.queryRow(context.Background(),
+		"SELECT ATTR_VALUE FROM performance_schema.session_connect_attrs WHERE PROCESSLIST_ID = CONNECTION_ID() AND ATTR_NAME = 'program_name'").
+		Scan(&program)
+	if err != nil {
+		// performance_schema is off by default on MariaDB
+		t.Skipf("session_connect_attrs not readable: %v", err)
+	}
+	if program != "mylock-test" {
+		t.Errorf("program_name = %q, want mylock-test", program)
+	}
+}
+
+func TestLocker_Integration_SessionRunID(t *testing.T) {
+	ctx := context.Background()
+	holder, err := NewLocker(getTestDSN() + "?connectionAttributes=mylock_run_id:run-1")
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer holder.Close()
+	observer, err := NewLocker(getTestDSN())
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer observer.Close()
+
+	if acquired, err := holder.AcquireLock(ctx, "test-run-id-lock", 1); err != nil || !acquired {
+		t.Fatalf("AcquireLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+	defer holder.ReleaseLock(ctx, "test-run-id-lock")
+
+	connID, err := observer.LockHolder(ctx, "test-run-id-lock")
+	if err != nil || connID != holder.ConnectionID() {
+		t.Fatalf("LockHolder() = (%d, %v), want %d", connID, err, holder.ConnectionID())
+	}
+	runID, err := observer.SessionRunID(ctx, connID)
+	if err != nil {
+		// performance_schema is off by default on MariaDB
+		t.Skipf("session_connect_attrs not readable: %v", err)
+	}
+	if runID != "run-1" {
+		t.Errorf("SessionRunID() = %q, want run-1", runID)
+	}
+	if runID, err := observer.SessionRunID(ctx, observer.ConnectionID()); err != nil || runID != "" {
+		t.Errorf("SessionRunID() of a session without a run = (%q, %v), want empty", runID, err)
+	}
+}
+
+func TestLocker_Integration_Blocks(t *testing.T) {
+	locker, err := NewLocker(getTestDSN())
+	if err != nil {
+		t.Fatalf("Failed to create locker: %v", err)
+	}
+	defer locker.Close()
+	ctx := context.Background()
+	defer locker.exec(ctx, "DROP TABLE IF EXISTS "+blockTable)
+
+	if err := locker.exec(ctx, "DROP TABLE IF EXISTS "+blockTable); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+	if block, err := locker.ActiveBlock(ctx, "test-block"); block != nil || err != nil {
+		t.Fatalf("ActiveBlock() without the table = %+v, %v, want nil", block, err)
+	}
+
+	if err := locker.SetBlock(ctx, "test-block", "disk swap", "ops@host1", 0); err != nil {
+		t.Fatalf("SetBlock() error = %v", err)
+	}
+	block, err := locker.ActiveBlock(ctx, "test-block")
+	if err != nil || block == nil {
+		t.Fatalf("ActiveBlock() = %+v, %v, want a block", block, err)
+	}
+	if block.Reason != "disk swap" || block.SetBy != "ops@host1" || block.Remaining != 0 {
+		t.Errorf("ActiveBlock() = %+v, want reason, setter and no expiry", block)
+	}
+
+	// An expired block no longer counts
+	if err := locker.SetBlock(ctx, "test-block-expired", "", "ops@host1", time.Millisecond); err != nil {
+		t.Fatalf("SetBlock() error = %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	blocks, err := locker.Blocks(ctx)
+	if err != nil || len(blocks) != 1 || blocks[0].LockName != "test-block" {
+		t.Errorf("Blocks() = %+v, %v, want only test-block", blocks, err)
+	}
+
+	if cleared, err := locker.ClearBlock(ctx, "test-block"); !cleared || err != nil {
+		t.Errorf("ClearBlock() = %v, %v, want true", cleared, err)
+	}
+	if cleared, err := locker.ClearBlock(ctx, "test-block"); cleared || err != nil {
+		t.Errorf("ClearBlock() again = %v, %v, want false", cleared, err)
+	}
+}
@@ -3,33 +3,92 @@ package locker
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
-	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/logging"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
 	// Exit codes
-	LockTimeout   = 200
-	InternalError = 201
+	LockTimeout        = 200
+	InternalError      = 201
+	LockUnsupported    = 202
+	LockLost           = 203
+	ReleaseFailed      = 204
+	GetLockNull        = 205
+	Blocked            = 206
+	PreconditionFailed = 207
+	Stalled            = 208
+	Preempted          = 209
+
+	// ReservedExitCodeMin and ReservedExitCodeMax bound the exit codes
+	// mylock keeps for its own results
+	ReservedExitCodeMin = 200
+	ReservedExitCodeMax = 209
 
 	// DefaultPingTimeout is the default timeout for database ping operations
 	DefaultPingTimeout = 5 * time.Second
+	// DefaultLockCheckInterval is how often a held lock is checked by WithLockCtx
+	DefaultLockCheckInterval = 5 * time.Second
+	// lockCheckTimeout bounds one check of a held lock, so a session that
+	// stops answering counts as lost
+	lockCheckTimeout = 30 * time.Second
+
+	// releaseAttempts is how many times RELEASE_LOCK is tried before the
+	// session is closed to free the lock
+	releaseAttempts = 3
+	// releaseBackoff is the wait before the second attempt; it doubles after
+	releaseBackoff = 200 * time.Millisecond
 )
 
 var (
 	ErrLockTimeout = errors.New("failed to acquire lock within timeout")
+	// ErrLockUnsupported means the server or a proxy in front of it does not
+	// implement the advisory lock functions
+	ErrLockUnsupported = errors.New("advisory locks (GET_LOCK) are not supported by this server")
+	// ErrLockLost means the lock stopped being held while work was running
+	ErrLockLost = errors.New("lock lost")
+	// ErrGetLockNull means GET_LOCK returned NULL, which the server does on
+	// an error such as running out of memory or the query being killed,
+	// rather than when the lock is busy
+	ErrGetLockNull = errors.New("GET_LOCK returned NULL")
+	// ErrConnect matches the errors of NewLocker failing to reach the server
+	ErrConnect = errors.New("failed to connect")
+	// ErrReleaseFailed matches the errors of RELEASE_LOCK not reaching the
+	// server, when whether the lock was freed is unknown
+	ErrReleaseFailed = errors.New("failed to release lock")
 	// Safe pattern for lock names: alphanumeric, underscore, hyphen, dot
 	lockNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
 )
 
-// validateLockName ensures the lock name is safe for MySQL
-func validateLockName(lockName string) error {
+// kindError keeps the message of err while also matching kind with errors.Is
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e kindError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// ValidateLockName ensures the lock name is safe for MySQL
+func ValidateLockName(lockName string) error {
 	if lockName == "" {
 		return errors.New("lock name is required")
 	}
@@ -48,8 +107,154 @@ func validateLockName(lockName string) error {
 	return nil
 }
 
+// ValidateUnicodeLockName is ValidateLockName extended to letters, digits
+// and combining marks of any script. The name must be in NFC, as returned
+// by NormalizeLockName, so that every client sends the same bytes, and is
+// limited to 64 bytes rather than characters.
+func ValidateUnicodeLockName(lockName string) error {
+	if lockName == "" {
+		return errors.New("lock name is required")
+	}
+	if len(lockName) > 64 {
+		return errors.New("lock name too long (max 64 bytes)")
+	}
+	if !utf8.ValidString(lockName) {
+		return errors.New("lock name is not valid UTF-8")
+	}
+	if !norm.NFC.IsNormalString(lockName) {
+		return errors.New("lock name is not NFC normalized")
+	}
+	for _, r := range lockName {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && !strings.ContainsRune("_-.", r) {
+			return errors.New("lock name contains invalid characters (use only letters, digits, underscore, hyphen, dot)")
+		}
+	}
+	if strings.Contains(lockName, "..") {
+		return errors.New("lock name contains consecutive dots")
+	}
+	if strings.Contains(lockName, "--") {
+		return errors.New("lock name contains consecutive hyphens")
+	}
+	return nil
+}
+
+// NormalizeLockName returns lockName in Unicode NFC, so a name typed or
+// generated as decomposed characters names the same lock as its composed
+// form
+func NormalizeLockName(lockName string) string {
+	return norm.NFC.String(lockName)
+}
+
+// ValidateAnyLockName accepts any name GET_LOCK can take: since the name is
+// always a bound parameter, only emptiness and MySQL's 64 character limit
+// matter
+func ValidateAnyLockName(lockName string) error {
+	if lockName == "" {
+		return errors.New("lock name is required")
+	}
+	if !utf8.ValidString(lockName) {
+		return errors.New("lock name is not valid UTF-8")
+	}
+	if utf8.RuneCountInString(lockName) > 64 {
+		return errors.New("lock name too long (max 64 characters)")
+	}
+	return nil
+}
+
+// LockNamePolicy selects which lock names a backend accepts
+type LockNamePolicy int
+
+const (
+	// LockNamesSafe accepts the names of ValidateLockName
+	LockNamesSafe LockNamePolicy = iota
+	// LockNamesUnicode accepts the names of ValidateUnicodeLockName
+	LockNamesUnicode
+	// LockNamesAny accepts the names of ValidateAnyLockName
+	LockNamesAny
+)
+
+// Validate checks lockName against the policy
+func (p LockNamePolicy) Validate(lockName string) error {
+	switch p {
+	case LockNamesUnicode:
+		return ValidateUnicodeLockName(lockName)
+	case LockNamesAny:
+		return ValidateAnyLockName(lockName)
+	}
+	return ValidateLockName(lockName)
+}
+
+// nameChecker is a Backend whose accepted lock names can be changed with
+// SetLockNamePolicy
+type nameChecker interface {
+	checkName(lockName string) error
+}
+
+// Backend is a named-lock implementation: MySQL advisory locks via Locker,
+// or process-local locks via MemoryLocker. Locks are reentrant: acquiring a
+// lock the backend already holds succeeds at once, and it is only freed when
+// every acquisition has been released.
+type Backend interface {
+	AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error)
+	// TryLock acquires the lock only if it is free right now
+	TryLock(ctx context.Context, lockName string) (bool, error)
+	// Extend confirms the lock is still held and keeps it alive; it returns
+	// an error wrapping ErrLockLost if it is not
+	Extend(ctx context.Context, lockName string) error
+	ReleaseLock(ctx context.Context, lockName string) (bool, error)
+	WithLock(ctx context.Context, lockName string, timeout int, fn func() error) error
+	WithLockCtx(ctx context.Context, lockName string, timeout int, fn func(context.Context) error) error
+	// ConnectionID identifies the server session holding the locks, or 0
+	ConnectionID() int64
+	Close() error
+}
+
 type Locker struct {
 	db *sql.DB
+	// conn pins a single session, since advisory locks belong to the session
+	// that acquired them. It is nil for lockers built directly on a *sql.DB.
+	// Guarded by mu, as Reacquire replaces it; read it with session.
+	conn *sql.Conn
+	// connID is the server-side session id returned by CONNECTION_ID();
+	// guarded by mu
+	connID int64
+	// version is nil when the server version could not be determined
+	version *ServerVersion
+	// mu guards held, conn, connID and the settings changed after NewLocker
+	mu sync.Mutex
+	// sessionRuntime is the expected runtime of the last
+	// EnsureSessionTimeout, applied again to a session Reacquire opens
+	sessionRuntime time.Duration
+	// held counts how many times each lock is held by this session, so
+	// nested acquisitions of the same name are reentrant
+	held map[string]int
+	// checkInterval overrides DefaultLockCheckInterval when positive
+	checkInterval time.Duration
+	// clock times waits and lock checks; nil uses the system clock
+	clock clock.Clock
+	// noRelease leaves locks to be freed by the server when the session ends
+	noRelease bool
+	// strictRelease makes WithLockCtx return a failed release; see SetStrictRelease
+	strictRelease bool
+	// commentHost and commentRun are added to the SQL comment of lock queries
+	commentHost, commentRun string
+	// names is the policy for accepted lock names; see SetLockNamePolicy
+	names LockNamePolicy
+	// preemptStart is when this run started, if it takes locks over from
+	// older runs; see SetPreempt
+	preemptStart time.Time
+	// connector opens sessions outside the pool, whose only connection is
+	// the lock session; nil for lockers built directly on a *sql.DB
+	connector driver.Connector
+	// host is the endpoint name from the DSN, re-resolved to spot failovers
+	// when detectFailover is set; see SetDetectFailover
+	host           string
+	detectFailover bool
+	// remoteAddr is the server address the session was dialed to; guarded by mu
+	remoteAddr string
+	// checkWriter is set when the session started on a writable server, so
+	// the server turning read-only is treated as a failover
+	checkWriter bool
 }
 
 func NewLocker(dsn string) (*Locker, error) {
@@ -57,10 +262,11 @@ func NewLocker(dsn string) (*Locker, error) {
 		return nil, errors.New("DSN is required")
 	}
 
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	l := &Locker{}
+	if err := l.openDB(dsn); err != nil {
+		return nil, err
 	}
+	db := l.db
 
 	// Configure connection pool for advisory lock usage
 	// We only need 1 connection since advisory locks are session-based
@@ -73,13 +279,308 @@ func NewLocker(dsn string) (*Locker, error) {
 
 	if err := db.PingContext(ctx); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, kindError{ErrConnect, fmt.Errorf("failed to ping database: %w", err)}
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, kindError{ErrConnect, fmt.Errorf("failed to open session: %w", err)}
+	}
+
+	if err := l.startSession(ctx, conn); err != nil {
+		conn.Close()
+		l.Close()
+		return nil, err
+	}
+
+	var rawVersion string
+	if err := conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&rawVersion); err != nil {
+		logging.Printc(logging.Yellow, "Warning: failed to detect server version: %v\n", err)
+	} else if version, err := ParseServerVersion(rawVersion); err != nil {
+		logging.Printc(logging.Yellow, "Warning: %v\n", err)
+	} else {
+		l.version = &version
+		logging.Debugf("server version %s (%s)", version, version.Flavor())
+		if !version.SupportsMultipleLocks() {
+			logging.Printc(logging.Yellow, "Warning: server %s allows only one advisory lock per session\n", version)
+		}
+	}
+
+	return l, nil
+}
+
+// startSession pins conn as the lock session and checks that advisory locks
+// work on it. Reacquire sets up its new session the same way, along with
+// the timeouts of EnsureSessionTimeout.
+func (l *Locker) startSession(ctx context.Context, conn *sql.Conn) error {
+	var connID int64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connID); err != nil {
+		return kindError{ErrConnect, fmt.Errorf("failed to fetch connection id: %w", err)}
+	}
+	l.mu.Lock()
+	l.conn = conn
+	l.connID = connID
+	runtime := l.sessionRuntime
+	l.mu.Unlock()
+	logging.Debugf("connected (connection id %d)", connID)
+
+	if err := l.probeLockSupport(ctx); err != nil {
+		return err
+	}
+	if err := l.detectMultiplexing(ctx); err != nil {
+		return err
+	}
+	if err := l.detectWriter(ctx); err != nil {
+		return err
+	}
+	if runtime > 0 {
+		return l.EnsureSessionTimeout(ctx, runtime)
+	}
+	return nil
+}
+
+// session returns the lock session and its id
+func (l *Locker) session() (*sql.Conn, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn, l.connID
+}
+
+// probeLockSupport checks that the advisory lock functions can be called at
+// all, so backends like Vitess or some poolers fail early with a clear error
+func (l *Locker) probeLockSupport(ctx context.Context) error {
+	if _, err := l.queryInt(ctx, "SELECT IS_FREE_LOCK(?)", "mylock-probe"); err != nil {
+		return fmt.Errorf("%w: %v", ErrLockUnsupported, err)
+	}
+	return nil
+}
+
+// detectMultiplexing takes a canary lock and checks that the server sees it
+// held by this session. Proxies such as ProxySQL or RDS Proxy may run each
+// query on a different backend session, which makes GET_LOCK meaningless.
+func (l *Locker) detectMultiplexing(ctx context.Context) error {
+	sessionID := l.ConnectionID()
+	canary := fmt.Sprintf("mylock-canary.%d", sessionID)
+
+	acquired, err := l.queryInt(ctx, "SELECT GET_LOCK(?, 0)", canary)
+	if err != nil {
+		return fmt.Errorf("canary lock failed: %w", err)
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return fmt.Errorf("%w: canary lock '%s' could not be taken", ErrLockUnsupported, canary)
+	}
+	defer func() {
+		if _, err := l.queryInt(ctx, "SELECT RELEASE_LOCK(?)", canary); err != nil {
+			logging.Printc(logging.Yellow, "Warning: failed to release canary lock: %v\n", err)
+		}
+	}()
+
+	holder, err := l.queryInt(ctx, "SELECT IS_USED_LOCK(?)", canary)
+	if err != nil {
+		return fmt.Errorf("canary lock check failed: %w", err)
+	}
+	connID, err := l.queryInt(ctx, "SELECT CONNECTION_ID()")
+	if err != nil {
+		return kindError{ErrConnect, fmt.Errorf("failed to fetch connection id: %w", err)}
+	}
+	if !holder.Valid || holder.Int64 != sessionID || connID.Int64 != sessionID {
+		return fmt.Errorf("%w: queries ran on different server sessions (%d, %d and %d), so a proxy is multiplexing connections",
+			ErrLockUnsupported, sessionID, holder.Int64, connID.Int64)
+	}
+	return nil
+}
+
+// sessionTimeoutMargin is added on top of the expected runtime when raising
+// the session idle timeouts
+const sessionTimeoutMargin = time.Minute
+
+// EnsureSessionTimeout raises the session's wait_timeout and
+// interactive_timeout so the server does not drop the idle lock session
+// while a command expected to run for the given duration is still running.
+// Timeouts that are already long enough are left untouched.
+func (l *Locker) EnsureSessionTimeout(ctx context.Context, expectedRuntime time.Duration) error {
+	l.mu.Lock()
+	l.sessionRuntime = expectedRuntime
+	l.mu.Unlock()
+	want := int64((expectedRuntime + sessionTimeoutMargin + time.Second - 1) / time.Second)
+
+	current, err := l.queryInt(ctx, "SELECT @@SESSION.wait_timeout")
+	if err != nil {
+		return fmt.Errorf("failed to read wait_timeout: %w", err)
+	}
+	if current.Valid && current.Int64 >= want {
+		logging.Debugf("wait_timeout %d already covers expected runtime %s", current.Int64, expectedRuntime)
+		return nil
+	}
+
+	// want is an integer we computed, so formatting it into the statement is safe
+	query := fmt.Sprintf("SET SESSION wait_timeout = %d, SESSION interactive_timeout = %d", want, want)
+	if err := l.exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to set session timeouts: %w", err)
+	}
+	return nil
+}
+
+func (l *Locker) exec(ctx context.Context, query string, args ...any) error {
+	start := time.Now()
+	conn, connID := l.session()
+	var err error
+	if conn != nil {
+		_, err = conn.ExecContext(ctx, query, args...)
+	} else {
+		_, err = l.db.ExecContext(ctx, query, args...)
+	}
+	logging.Debugf("conn=%d exec=%q args=%v err=%v took=%s", connID, query, args, err, time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+// ServerVersion returns the detected server version, or nil if unknown
+func (l *Locker) ServerVersion() *ServerVersion {
+	return l.version
+}
+
+// DBStats returns the statistics of the connection pool under the lock
+// session. WaitCount and WaitDuration grow when queries queue for the
+// single connection the pool allows.
+func (l *Locker) DBStats() sql.DBStats {
+	return l.db.Stats()
+}
+
+// ConnectionID returns the MySQL session id holding the locks, as shown in
+// the server processlist
+func (l *Locker) ConnectionID() int64 {
+	_, connID := l.session()
+	return connID
+}
+
+func (l *Locker) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if conn, _ := l.session(); conn != nil {
+		return conn.QueryRowContext(ctx, query, args...)
+	}
+	return l.db.QueryRowContext(ctx, query, args...)
+}
+
+// queryInt runs a query returning a single nullable integer, logging it in debug mode
+func (l *Locker) queryInt(ctx context.Context, query string, args ...any) (sql.NullInt64, error) {
+	var result sql.NullInt64
+	start := time.Now()
+	err := l.queryRow(ctx, query, args...).Scan(&result)
+	if logging.DebugEnabled() {
+		value := "NULL"
+		if result.Valid {
+			value = fmt.Sprint(result.Int64)
+		}
+		if err != nil {
+			value = "error: " + err.Error()
+		}
+		logging.Debugf("conn=%d query=%q args=%v result=%s took=%s", l.ConnectionID(), query, args, value, time.Since(start).Round(time.Millisecond))
+	}
+	return result, err
+}
+
+// SetNoRelease makes ReleaseLock skip RELEASE_LOCK. The server then frees
+// the lock only when the session ends, at Close or when the process dies,
+// so a lock is never released while the session that took it lives on.
+func (l *Locker) SetNoRelease(noRelease bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.noRelease = noRelease
+}
+
+// SetClock replaces the clock that times WaitFree, preemption and the lock
+// checks of WithLockCtx, for tests. Call it before taking any lock.
+func (l *Locker) SetClock(c clock.Clock) {
+	l.clock = c
+}
+
+// SetStrictRelease makes WithLock and WithLockCtx return an error matching
+// ErrReleaseFailed when the lock cannot be released or is found no longer
+// held at release, instead of logging a warning
+func (l *Locker) SetStrictRelease(strict bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.strictRelease = strict
+}
+
+// SetDetectFailover makes the lock checks of WithLockCtx also re-resolve
+// the endpoint host name and report the lock lost once it no longer leads
+// to the server of the session. Leave it off for DNS round-robin endpoints,
+// whose answers rotate without a failover.
+func (l *Locker) SetDetectFailover(detect bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.detectFailover = detect
+}
+
+// SetLockNamePolicy widens the lock names the Locker accepts beyond
+// letters, digits, '_', '-' and '.', e.g. to names with spaces or colons
+// generated by other systems
+func (l *Locker) SetLockNamePolicy(p LockNamePolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.names = p
+}
+
+func (l *Locker) checkName(lockName string) error {
+	l.mu.Lock()
+	names := l.names
+	l.mu.Unlock()
+	return names.Validate(lockName)
+}
+
+// SetQueryComment adds host and run to the SQL comment that prefixes
+// GET_LOCK and RELEASE_LOCK, e.g. /* mylock name=nightly host=web1 run=3f2a */,
+// so the queries can be attributed in slow logs and performance_schema.
+// Call it before taking any lock.
+func (l *Locker) SetQueryComment(host, run string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.commentHost = host
+	l.commentRun = run
+}
+
+// lockQuery prefixes query with the SQL comment for lockName
+func (l *Locker) lockQuery(lockName, query string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	comment := "/* mylock name=" + commentValue(lockName)
+	if l.commentHost != "" {
+		comment += " host=" + commentValue(l.commentHost)
 	}
+	if l.commentRun != "" {
+		comment += " run=" + commentValue(l.commentRun)
+	}
+	return comment + " */ " + query
+}
 
-	return &Locker{db: db}, nil
+// commentValue replaces anything that could end the comment or be taken
+// for a placeholder by the driver's parameter interpolation
+func commentValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-:", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func (l *Locker) isStrictRelease() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.strictRelease
 }
 
 func (l *Locker) Close() error {
+	if l.db != nil && logging.DebugEnabled() {
+		stats := l.db.Stats()
+		logging.Debugf("pool open=%d in_use=%d idle=%d wait_count=%d wait_duration=%s max_idle_closed=%d max_lifetime_closed=%d",
+			stats.OpenConnections, stats.InUse, stats.Idle, stats.WaitCount, stats.WaitDuration,
+			stats.MaxIdleClosed, stats.MaxLifetimeClosed)
+	}
+	if conn, _ := l.session(); conn != nil {
+		conn.Close()
+	}
 	if l.db != nil {
 		return l.db.Close()
 	}
@@ -87,38 +588,124 @@ func (l *Locker) Close() error {
 }
 
 func (l *Locker) AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error) {
-	if err := validateLockName(lockName); err != nil {
+	if err := l.checkName(lockName); err != nil {
 		return false, err
 	}
 	if timeout <= 0 {
 		return false, errors.New("timeout must be positive")
 	}
+	l.mu.Lock()
+	preempt := !l.preemptStart.IsZero() && l.held[lockName] == 0
+	l.mu.Unlock()
+	if preempt {
+		return l.preemptLock(ctx, lockName, timeout)
+	}
+	return l.getLock(ctx, lockName, timeout)
+}
 
-	var result sql.NullInt64
-	query := "SELECT GET_LOCK(?, ?)"
-	err := l.db.QueryRowContext(ctx, query, lockName, timeout).Scan(&result)
+// TryLock acquires the lock without waiting and reports false if another
+// session holds it
+func (l *Locker) TryLock(ctx context.Context, lockName string) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+	return l.getLock(ctx, lockName, 0)
+}
+
+// getLock runs GET_LOCK with a timeout in seconds, where 0 does not wait
+func (l *Locker) getLock(ctx context.Context, lockName string, timeout int) (bool, error) {
+	// A lock this session already holds is only counted again
+	l.mu.Lock()
+	if l.held[lockName] > 0 {
+		l.held[lockName]++
+		l.mu.Unlock()
+		return true, nil
+	}
+	l.mu.Unlock()
+
+	if err := l.checkSingleLockSemantics(lockName); err != nil {
+		return false, err
+	}
+
+	result, err := l.queryInt(ctx, l.lockQuery(lockName, "SELECT GET_LOCK(?, ?)"), lockName, timeout)
 	if err != nil {
-		return false, fmt.Errorf("failed to acquire lock: %w", err)
+		return false, l.lockError(lockName, err)
 	}
 
-	if !result.Valid || result.Int64 != 1 {
+	if !result.Valid {
+		return false, fmt.Errorf("%w for '%s': the server failed, for example it ran out of memory or the query was killed", ErrGetLockNull, lockName)
+	}
+	if result.Int64 != 1 {
 		return false, nil
 	}
 
+	// A proxy or pool that ran GET_LOCK on another session leaves the lock
+	// with a session this Locker cannot check or release
+	owned, err := l.queryInt(ctx, "SELECT IS_USED_LOCK(?) <=> CONNECTION_ID()", lockName)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify lock ownership: %w", err)
+	}
+	if !owned.Valid || owned.Int64 != 1 {
+		return false, fmt.Errorf("%w: GET_LOCK('%s') succeeded, but another session holds the lock, so a proxy or pool moved queries between sessions", ErrLockUnsupported, lockName)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		l.held = make(map[string]int)
+	}
+	l.held[lockName]++
 	return true, nil
 }
 
+// checkSingleLockSemantics refuses to take a second lock on servers where
+// GET_LOCK would silently release the first one
+func (l *Locker) checkSingleLockSemantics(lockName string) error {
+	if l.version == nil || l.version.SupportsMultipleLocks() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for held := range l.held {
+		if held != lockName {
+			return fmt.Errorf("server %s allows only one advisory lock per session, and '%s' is already held", l.version, held)
+		}
+	}
+	return nil
+}
+
 func (l *Locker) ReleaseLock(ctx context.Context, lockName string) (bool, error) {
-	if err := validateLockName(lockName); err != nil {
+	if err := l.checkName(lockName); err != nil {
 		return false, err
 	}
 
-	var result sql.NullInt64
-	query := "SELECT RELEASE_LOCK(?)"
-	err := l.db.QueryRowContext(ctx, query, lockName).Scan(&result)
+	// Nested holders only drop their reference
+	l.mu.Lock()
+	if l.held[lockName] > 1 {
+		l.held[lockName]--
+		l.mu.Unlock()
+		return true, nil
+	}
+	if l.noRelease {
+		_, held := l.held[lockName]
+		delete(l.held, lockName)
+		l.mu.Unlock()
+		logging.Debugf("conn=%d skipping RELEASE_LOCK('%s'), the lock is freed when the session closes", l.ConnectionID(), lockName)
+		return held, nil
+	}
+	l.mu.Unlock()
+
+	result, err := l.releaseWithRetry(ctx, lockName)
 	if err != nil {
-		return false, fmt.Errorf("failed to release lock: %w", err)
+		// As a last resort, end the session so the server frees the lock
+		if l.dropSession() {
+			logging.Printc(logging.Yellow, "Warning: closed connection id %d so the server frees lock '%s'\n", l.ConnectionID(), lockName)
+		}
+		return false, kindError{ErrReleaseFailed, fmt.Errorf("failed to release lock after %d attempts: %w", releaseAttempts, err)}
 	}
+	l.mu.Lock()
+	delete(l.held, lockName)
+	l.mu.Unlock()
 
 	if !result.Valid || result.Int64 != 1 {
 		return false, nil
@@ -127,8 +714,240 @@ func (l *Locker) ReleaseLock(ctx context.Context, lockName string) (bool, error)
 	return true, nil
 }
 
+// releaseWithRetry runs RELEASE_LOCK up to releaseAttempts times, waiting
+// between attempts so a brief network problem does not leave the lock held
+func (l *Locker) releaseWithRetry(ctx context.Context, lockName string) (sql.NullInt64, error) {
+	backoff := releaseBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := l.queryInt(ctx, l.lockQuery(lockName, "SELECT RELEASE_LOCK(?)"), lockName)
+		if err == nil || attempt == releaseAttempts || ctx.Err() != nil {
+			return result, err
+		}
+		logging.Debugf("conn=%d RELEASE_LOCK('%s') failed (attempt %d/%d), retrying in %s: %v", l.ConnectionID(), lockName, attempt, releaseAttempts, backoff, err)
+
+		timer := clock.OrReal(l.clock).NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C():
+		}
+		backoff *= 2
+	}
+}
+
+// dropSession closes the lock session without returning it to the pool, so
+// the server ends it and frees every lock it holds. It reports false for
+// lockers without a pinned session.
+func (l *Locker) dropSession() bool {
+	conn, _ := l.session()
+	if conn == nil {
+		return false
+	}
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+	l.mu.Lock()
+	clear(l.held)
+	l.mu.Unlock()
+	return true
+}
+
 func (l *Locker) WithLock(ctx context.Context, lockName string, timeout int, fn func() error) error {
-	acquired, err := l.AcquireLock(ctx, lockName, timeout)
+	return withLock(ctx, l, lockName, timeout, fn)
+}
+
+// WithLockCtx is like WithLock, but fn receives a context that is cancelled
+// with ErrLockLost as its cause if the lock or the session is lost while fn
+// runs. In that case WithLockCtx returns an error wrapping ErrLockLost.
+func (l *Locker) WithLockCtx(ctx context.Context, lockName string, timeout int, fn func(context.Context) error) error {
+	return withLockCtx(ctx, l, lockName, timeout, fn, l.watchLock)
+}
+
+// LostHandler decides what happens when a lock held by WithLockCtxOnLost is
+// lost. Returning nil means the lock is held again and checking resumes;
+// an error cancels the work context with ErrLockLost and that error.
+type LostHandler func(ctx context.Context, lost error) error
+
+// WithLockCtxOnLost is like WithLockCtx, but calls onLost instead of
+// cancelling straight away when the lock or the session is lost
+func (l *Locker) WithLockCtxOnLost(ctx context.Context, lockName string, timeout int, fn func(context.Context) error, onLost LostHandler) error {
+	return withLockCtxOnLost(ctx, l, lockName, timeout, fn, l.watchLock, onLost)
+}
+
+// Reacquire replaces a lost session with a new one, set up as NewLocker
+// and EnsureSessionTimeout did the old one, and takes lockName and every
+// other lock the old session held on it again, waiting up to timeout
+// seconds in all. ConnectionID reports the new session afterwards. If a
+// lock cannot be taken again, those already taken are released and it
+// reports false.
+func (l *Locker) Reacquire(ctx context.Context, lockName string, timeout int) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+
+	// Every lock went with the old session
+	l.mu.Lock()
+	held := make(map[string]int, len(l.held)+1)
+	for name, count := range l.held {
+		held[name] = count
+	}
+	clear(l.held)
+	l.mu.Unlock()
+	if held[lockName] == 0 {
+		held[lockName] = 1
+	}
+
+	if old, _ := l.session(); old != nil {
+		// Discard the old session instead of returning it to the pool
+		_ = old.Raw(func(any) error { return driver.ErrBadConn })
+		old.Close()
+
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			return false, kindError{ErrConnect, fmt.Errorf("failed to open session: %w", err)}
+		}
+		// The endpoint may still lead to the old, now read-only writer
+		if err := l.startSession(ctx, conn); err != nil {
+			return false, err
+		}
+	}
+
+	// lockName first, then the others in a fixed order
+	names := make([]string, 0, len(held))
+	for name := range held {
+		if name != lockName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{lockName}, names...)
+
+	clk := clock.OrReal(l.clock)
+	deadline := clk.Now().Add(time.Duration(timeout) * time.Second)
+	for i, name := range names {
+		var acquired bool
+		var err error
+		if wait := int(deadline.Sub(clk.Now()) / time.Second); wait > 0 {
+			acquired, err = l.AcquireLock(ctx, name, wait)
+		} else {
+			acquired, err = l.TryLock(ctx, name)
+		}
+		if err != nil || !acquired {
+			for _, taken := range names[:i] {
+				if _, releaseErr := l.ReleaseLock(ctx, taken); releaseErr != nil {
+					logging.Printc(logging.Yellow, "Warning: failed to release lock: %v\n", releaseErr)
+				}
+			}
+			if err != nil {
+				return false, fmt.Errorf("failed to reacquire lock '%s': %w", name, err)
+			}
+			return false, nil
+		}
+	}
+
+	// Nested holders keep their references
+	l.mu.Lock()
+	if l.held == nil {
+		l.held = make(map[string]int)
+	}
+	for name, count := range held {
+		l.held[name] = count
+	}
+	l.mu.Unlock()
+	return true, nil
+}
+
+// watchLock polls the server until stop is closed and returns an error as
+// soon as the session no longer holds the lock
+func (l *Locker) watchLock(stop <-chan struct{}, lockName string) error {
+	interval := l.checkInterval
+	if interval <= 0 {
+		interval = DefaultLockCheckInterval
+	}
+	ticker := clock.OrReal(l.clock).NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C():
+		}
+
+		// Each check has its own context, since the driver closes a
+		// connection whose query is cancelled and this one holds the lock
+		ctx, cancel := context.WithTimeout(context.Background(), lockCheckTimeout)
+		err := l.Extend(ctx, lockName)
+		if err == nil {
+			if err = l.checkFailover(ctx); err != nil {
+				err = fmt.Errorf("%w: %v", ErrLockLost, err)
+			}
+		}
+		cancel()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			if l.preempting() {
+				ctx, cancel := context.WithTimeout(context.Background(), lockCheckTimeout)
+				if superseded := l.supersededBy(ctx, lockName); superseded != nil {
+					err = fmt.Errorf("%w: %w", ErrLockLost, superseded)
+				}
+				cancel()
+			}
+			return err
+		}
+	}
+}
+
+// Extend checks that this session still holds the lock. Advisory locks have
+// no expiry, so the round trip only keeps the session from going idle; call
+// it periodically to detect a lost lock or a dropped connection.
+func (l *Locker) Extend(ctx context.Context, lockName string) error {
+	if err := l.checkName(lockName); err != nil {
+		return err
+	}
+
+	holder, err := l.queryInt(ctx, "SELECT IS_USED_LOCK(?)", lockName)
+	if err != nil {
+		return fmt.Errorf("lock check failed: %w", err)
+	}
+	if connID := l.ConnectionID(); !holder.Valid || (connID != 0 && holder.Int64 != connID) {
+		l.mu.Lock()
+		delete(l.held, lockName)
+		l.mu.Unlock()
+		return fmt.Errorf("%w: lock is no longer held by this session", ErrLockLost)
+	}
+	return nil
+}
+
+// withLock acquires the lock on b, runs fn and releases the lock afterwards
+func withLock(ctx context.Context, b Backend, lockName string, timeout int, fn func() error) error {
+	return withLockCtx(ctx, b, lockName, timeout, func(context.Context) error { return fn() }, nil)
+}
+
+// lockWatcher checks that lockName stays held until stop is closed, and
+// returns an error once it is lost
+type lockWatcher func(stop <-chan struct{}, lockName string) error
+
+// withLockCtx acquires the lock on b and runs fn with a context that watch
+// cancels if the lock is lost. A nil watch means the lock cannot be lost.
+func withLockCtx(ctx context.Context, b Backend, lockName string, timeout int, fn func(context.Context) error, watch lockWatcher) error {
+	return withLockCtxOnLost(ctx, b, lockName, timeout, fn, watch, nil)
+}
+
+// withLockCtxOnLost is withLockCtx with a handler that may recover a lost
+// lock before the context is cancelled
+func withLockCtxOnLost(ctx context.Context, b Backend, lockName string, timeout int, fn func(context.Context) error, watch lockWatcher, onLost LostHandler) (err error) {
+	// A timeout of 0 tries the lock once without waiting
+	var acquired bool
+	if timeout == 0 {
+		acquired, err = b.TryLock(ctx, lockName)
+	} else {
+		acquired, err = b.AcquireLock(ctx, lockName, timeout)
+	}
 	if err != nil {
 		return err
 	}
@@ -139,22 +958,103 @@ func (l *Locker) WithLock(ctx context.Context, lockName string, timeout int, fn
 
 	defer func() {
 		releaseCtx := context.Background()
-		_, releaseErr := l.ReleaseLock(releaseCtx, lockName)
+		released, releaseErr := b.ReleaseLock(releaseCtx, lockName)
+		strict, ok := b.(strictReleaser)
+		if !ok || !strict.isStrictRelease() {
+			if releaseErr != nil {
+				// Log error but don't override the function error
+				logging.Printc(logging.Yellow, "Warning: failed to release lock: %v\n", releaseErr)
+			}
+			return
+		}
+		// A lost lock is already reported as such
+		if releaseErr == nil && !released && !errors.Is(err, ErrLockLost) {
+			releaseErr = kindError{ErrReleaseFailed, fmt.Errorf("RELEASE_LOCK('%s') found the lock no longer held by this session", lockName)}
+		}
 		if releaseErr != nil {
-			// Log error but don't override the function error
-			fmt.Fprintf(os.Stderr, "Warning: failed to release lock: %v\n", releaseErr)
+			err = errors.Join(releaseErr, err)
 		}
 	}()
 
-	return fn()
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if watch != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := watch(stop, lockName)
+				if err == nil {
+					return
+				}
+				if onLost != nil {
+					if err = onLost(lockCtx, err); err == nil {
+						continue
+					}
+				}
+				if !errors.Is(err, ErrLockLost) {
+					err = fmt.Errorf("%w: %w", ErrLockLost, err)
+				}
+				cancel(err)
+				return
+			}
+		}()
+	}
+
+	err = fn(lockCtx)
+
+	// Stop the watcher before releasing, so it does not see the release as a
+	// loss. A check in flight runs to its end, as cancelling it would close
+	// the session that holds the lock.
+	close(stop)
+	cancel(nil)
+	wg.Wait()
+
+	if cause := context.Cause(lockCtx); errors.Is(cause, ErrLockLost) {
+		return cause
+	}
+	return err
+}
+
+// strictReleaser is a Backend that can be told to return a failed release
+// from WithLockCtx instead of logging it
+type strictReleaser interface {
+	isStrictRelease() bool
+}
+
+// IsReservedExitCode reports whether a command exit code collides with
+// the range mylock uses for its own results
+func IsReservedExitCode(code int) bool {
+	return code >= ReservedExitCodeMin && code <= ReservedExitCodeMax
 }
 
 func ExitCode(err error) int {
 	if err == nil {
 		return 0
 	}
-	if errors.Is(err, ErrLockTimeout) {
+	if errors.Is(err, ErrSuperseded) {
+		return Preempted
+	}
+	if errors.Is(err, ErrLockTimeout) || errors.Is(err, ErrLockDeadlock) {
 		return LockTimeout
 	}
+	if errors.Is(err, ErrLockUnsupported) {
+		return LockUnsupported
+	}
+	if errors.Is(err, ErrLockLost) {
+		return LockLost
+	}
+	if errors.Is(err, ErrReleaseFailed) {
+		return ReleaseFailed
+	}
+	if errors.Is(err, ErrGetLockNull) {
+		return GetLockNull
+	}
+	if errors.Is(err, ErrBlocked) {
+		return Blocked
+	}
 	return InternalError
 }
@@ -1,11 +1,21 @@
 package locker
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/logging"
 )
 
 // mockDriver implements the database/sql/driver interfaces for testing
@@ -13,6 +23,42 @@ type mockDriver struct {
 	connectError error
 	queryError   error
 	queryResult  int64
+	// queryResults overrides queryResult for specific queries
+	queryResults map[string]int64
+	// nullResults lists queries answered with NULL
+	nullResults map[string]bool
+	execError   error
+	execQueries []string
+	// queryFailures, when positive, limits queryError to that many more queries
+	queryFailures int
+	// queries records every query run, without the leading SQL comment that
+	// lock queries carry, which rawQueries keeps; both guarded by mu
+	queries    []string
+	rawQueries []string
+
+	// mu guards queryError for tests that change it while a lock is watched
+	mu sync.Mutex
+
+	// block, when set, holds each query until it is closed; blocked is sent
+	// to as a query starts waiting, and cancelled counts queries whose
+	// context ended first, which the real driver answers by closing the
+	// connection. All three guarded by mu.
+	block     chan struct{}
+	blocked   chan struct{}
+	cancelled int
+}
+
+func (d *mockDriver) setBlock(block, blocked chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.block = block
+	d.blocked = blocked
+}
+
+func (d *mockDriver) setQueryError(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queryError = err
 }
 
 func (d *mockDriver) Open(name string) (driver.Conn, error) {
@@ -27,7 +73,13 @@ type mockConn struct {
 }
 
 func (c *mockConn) Prepare(query string) (driver.Stmt, error) {
-	return &mockStmt{conn: c, query: query}, nil
+	stmt := &mockStmt{conn: c, query: query, raw: query}
+	if strings.HasPrefix(query, "/*") {
+		if end := strings.Index(query, "*/ "); end >= 0 {
+			stmt.query = query[end+len("*/ "):]
+		}
+	}
+	return stmt, nil
 }
 
 func (c *mockConn) Close() error {
@@ -41,6 +93,7 @@ func (c *mockConn) Begin() (driver.Tx, error) {
 type mockStmt struct {
 	conn  *mockConn
 	query string
+	raw   string
 }
 
 func (s *mockStmt) Close() error {
@@ -52,16 +105,64 @@ func (s *mockStmt) NumInput() int {
 }
 
 func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
-	return nil, errors.New("not implemented")
+	if s.conn.driver.execError != nil {
+		return nil, s.conn.driver.execError
+	}
+	s.conn.driver.execQueries = append(s.conn.driver.execQueries, s.query)
+	return driver.ResultNoRows, nil
 }
 
 func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
-	if s.conn.driver.queryError != nil {
-		return nil, s.conn.driver.queryError
+	d := s.conn.driver
+	d.mu.Lock()
+	d.queries = append(d.queries, s.query)
+	d.rawQueries = append(d.rawQueries, s.raw)
+	queryError := d.queryError
+	if queryError != nil && d.queryFailures > 0 {
+		d.queryFailures--
+		if d.queryFailures == 0 {
+			d.queryError = nil
+		}
+	}
+	d.mu.Unlock()
+	if queryError != nil {
+		return nil, queryError
+	}
+	if s.conn.driver.nullResults[s.query] {
+		return &mockRows{valid: false}, nil
+	}
+	if result, ok := s.conn.driver.queryResults[s.query]; ok {
+		return &mockRows{result: result, valid: true}, nil
 	}
 	return &mockRows{result: s.conn.driver.queryResult, valid: true}, nil
 }
 
+func (s *mockStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	d := s.conn.driver
+	d.mu.Lock()
+	block, blocked := d.block, d.blocked
+	d.mu.Unlock()
+	if block != nil {
+		select {
+		case blocked <- struct{}{}:
+		default:
+		}
+		select {
+		case <-block:
+		case <-ctx.Done():
+			d.mu.Lock()
+			d.cancelled++
+			d.mu.Unlock()
+			return nil, driver.ErrBadConn
+		}
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return s.Query(values)
+}
+
 type mockRows struct {
 	result int64
 	valid  bool
@@ -176,6 +277,17 @@ func TestNewLocker_Coverage(t *testing.T) {
 	}
 }
 
+func TestNewLocker_ErrConnect(t *testing.T) {
+	// Nothing listens on port 1, so the ping is refused
+	_, err := NewLocker("user:pass@tcp(127.0.0.1:1)/test?timeout=1s")
+	if !errors.Is(err, ErrConnect) {
+		t.Fatalf("NewLocker() error = %v, want it to match ErrConnect", err)
+	}
+	if !contains(err.Error(), "failed to ping database") {
+		t.Errorf("NewLocker() error = %v, want the ping failure in the message", err)
+	}
+}
+
 func TestLocker_Close_Coverage(t *testing.T) {
 	t.Run("close with nil db", func(t *testing.T) {
 		l := &Locker{db: nil}
@@ -200,8 +312,7 @@ func TestLocker_AcquireLock_Coverage(t *testing.T) {
 	sql.Register("mock-query", md)
 
 	db, _ := sql.Open("mock-query", "test")
-	l := &Locker{db: db}
-	defer l.Close()
+	defer db.Close()
 
 	ctx := context.Background()
 
@@ -263,6 +374,8 @@ func TestLocker_AcquireLock_Coverage(t *testing.T) {
 			md.queryResult = tt.queryResult
 			md.queryError = tt.queryError
 
+			// A fresh session per case, since locks already held are reentrant
+			l := &Locker{db: db}
 			got, err := l.AcquireLock(ctx, tt.lockName, tt.timeout)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AcquireLock() error = %v, wantErr %v", err, tt.wantErr)
@@ -345,6 +458,9 @@ func TestLocker_ReleaseLock_Coverage(t *testing.T) {
 					t.Errorf("ReleaseLock() error = %v, want to contain %v", err, tt.errMsg)
 				}
 			}
+			if tt.queryError != nil && !errors.Is(err, ErrReleaseFailed) {
+				t.Errorf("ReleaseLock() error = %v, want it to match ErrReleaseFailed", err)
+			}
 			if got != tt.want {
 				t.Errorf("ReleaseLock() = %v, want %v", got, tt.want)
 			}
@@ -448,6 +564,715 @@ func TestLocker_WithLock_Coverage(t *testing.T) {
 	}
 }
 
+func TestLocker_GetLockNull(t *testing.T) {
+	md := &mockDriver{nullResults: map[string]bool{"SELECT GET_LOCK(?, ?)": true}}
+	sql.Register("mock-getlock-null", md)
+
+	db, _ := sql.Open("mock-getlock-null", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	acquired, err := l.AcquireLock(context.Background(), "null-lock", 5)
+	if !errors.Is(err, ErrGetLockNull) {
+		t.Fatalf("AcquireLock() error = %v, want it to match ErrGetLockNull", err)
+	}
+	if acquired {
+		t.Error("AcquireLock() = true for a NULL result")
+	}
+	if errors.Is(err, ErrLockTimeout) {
+		t.Error("a NULL result is reported as a timeout")
+	}
+	if got := ExitCode(err); got != GetLockNull {
+		t.Errorf("ExitCode() = %d, want %d", got, GetLockNull)
+	}
+}
+
+func TestLocker_AcquireVerifiesOwnership(t *testing.T) {
+	md := &mockDriver{queryResults: map[string]int64{
+		"SELECT GET_LOCK(?, ?)":                      1,
+		"SELECT IS_USED_LOCK(?) <=> CONNECTION_ID()": 0,
+	}}
+	sql.Register("mock-ownership", md)
+
+	db, _ := sql.Open("mock-ownership", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	acquired, err := l.AcquireLock(context.Background(), "owned-lock", 5)
+	if !errors.Is(err, ErrLockUnsupported) {
+		t.Fatalf("AcquireLock() error = %v, want it to match ErrLockUnsupported", err)
+	}
+	if acquired {
+		t.Error("AcquireLock() = true for a lock another session holds")
+	}
+	if l.held["owned-lock"] != 0 {
+		t.Error("the lock is counted as held")
+	}
+}
+
+func TestLocker_ReleaseRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     bool
+		wantErr  bool
+	}{
+		{name: "succeeds after transient failures", failures: 2, want: true},
+		{name: "gives up after every attempt fails", failures: 0, wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResult: 1, queryError: errors.New("connection reset"), queryFailures: tt.failures}
+			driverName := fmt.Sprintf("mock-release-retry-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			conn, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := &Locker{db: db, conn: conn, connID: 7, held: map[string]int{"retry-lock": 1, "other-lock": 1}}
+			defer l.Close()
+			fake := clock.NewFake(time.Now())
+			l.SetClock(fake)
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			defer logging.SetOutput(nil)
+
+			type result struct {
+				released bool
+				err      error
+			}
+			done := make(chan result, 1)
+			go func() {
+				released, err := l.ReleaseLock(context.Background(), "retry-lock")
+				done <- result{released, err}
+			}()
+
+			// Waits of 200ms and then 400ms between the three attempts
+			for _, backoff := range []time.Duration{200 * time.Millisecond, 400 * time.Millisecond} {
+				fake.BlockUntil(1)
+				fake.Advance(backoff)
+			}
+
+			var got result
+			select {
+			case got = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("ReleaseLock() did not return after the retries")
+			}
+			if (got.err != nil) != tt.wantErr {
+				t.Fatalf("ReleaseLock() error = %v, wantErr %v", got.err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(got.err, ErrReleaseFailed) {
+				t.Errorf("ReleaseLock() error = %v, want it to match ErrReleaseFailed", got.err)
+			}
+			if got.released != tt.want {
+				t.Errorf("ReleaseLock() = %v, want %v", got.released, tt.want)
+			}
+
+			md.mu.Lock()
+			attempts := len(md.queries)
+			md.mu.Unlock()
+			if attempts != releaseAttempts {
+				t.Errorf("RELEASE_LOCK ran %d times, want %d", attempts, releaseAttempts)
+			}
+
+			// Giving up closes the session, which frees all of its locks
+			closed := strings.Contains(logs.String(), "closed connection id 7")
+			if closed != tt.wantErr {
+				t.Errorf("log = %q, want a closed session only when giving up", logs.String())
+			}
+			if tt.wantErr && len(l.held) != 0 {
+				t.Errorf("held = %v after the session was closed, want none", l.held)
+			}
+		})
+	}
+}
+
+func TestLocker_StrictRelease(t *testing.T) {
+	tests := []struct {
+		name          string
+		releaseResult int64
+		releaseErr    error
+		fnErr         error
+		wantErr       error
+	}{
+		{name: "released", releaseResult: 1},
+		{name: "release query fails", releaseErr: errors.New("connection reset"), wantErr: ErrReleaseFailed},
+		{name: "lock no longer held", releaseResult: 0, wantErr: ErrReleaseFailed},
+		{name: "command error is kept", releaseErr: errors.New("connection reset"), fnErr: ErrLockUnsupported, wantErr: ErrReleaseFailed},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResult: 1}
+			driverName := fmt.Sprintf("mock-strict-release-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db}
+			defer l.Close()
+			l.SetStrictRelease(true)
+
+			err := l.WithLock(context.Background(), "strict-lock", 5, func() error {
+				md.queryResult = tt.releaseResult
+				md.queryError = tt.releaseErr
+				return tt.fnErr
+			})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("WithLock() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("WithLock() error = %v, want it to match %v", err, tt.wantErr)
+			}
+			if tt.fnErr != nil && !errors.Is(err, tt.fnErr) {
+				t.Errorf("WithLock() error = %v, want it to keep %v", err, tt.fnErr)
+			}
+			if got := ExitCode(err); got != ReleaseFailed && tt.fnErr == nil {
+				t.Errorf("ExitCode() = %d, want %d", got, ReleaseFailed)
+			}
+		})
+	}
+}
+
+func TestLocker_DebugLogging(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-debug", md)
+
+	db, _ := sql.Open("mock-debug", "test")
+	l := &Locker{db: db, connID: 42}
+	defer l.Close()
+
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	logging.SetDebug(true)
+	defer logging.SetOutput(nil)
+	defer logging.SetDebug(false)
+
+	if _, err := l.AcquireLock(context.Background(), "debug-lock", 5); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{"[debug]", "conn=42", "GET_LOCK", "debug-lock", "result=1", "took="} {
+		if !strings.Contains(got, want) {
+			t.Errorf("debug output %q does not contain %q", got, want)
+		}
+	}
+}
+
+func TestLocker_SingleLockSemantics(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-single-lock", md)
+
+	db, _ := sql.Open("mock-single-lock", "test")
+	old, _ := ParseServerVersion("5.6.51")
+	l := &Locker{db: db, version: &old}
+	defer l.Close()
+
+	ctx := context.Background()
+	if _, err := l.AcquireLock(ctx, "first-lock", 5); err != nil {
+		t.Fatalf("AcquireLock(first-lock) error = %v", err)
+	}
+	if _, err := l.AcquireLock(ctx, "second-lock", 5); err == nil || !strings.Contains(err.Error(), "only one advisory lock") {
+		t.Errorf("AcquireLock(second-lock) error = %v, want single lock error", err)
+	}
+
+	if _, err := l.ReleaseLock(ctx, "first-lock"); err != nil {
+		t.Fatalf("ReleaseLock(first-lock) error = %v", err)
+	}
+	if _, err := l.AcquireLock(ctx, "second-lock", 5); err != nil {
+		t.Errorf("AcquireLock(second-lock) after release error = %v", err)
+	}
+}
+
+func TestLocker_ProbeLockSupport(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-probe", md)
+
+	db, _ := sql.Open("mock-probe", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	ctx := context.Background()
+	if err := l.probeLockSupport(ctx); err != nil {
+		t.Errorf("probeLockSupport() error = %v, want nil", err)
+	}
+
+	md.queryError = errors.New("unsupported function: is_free_lock")
+	err := l.probeLockSupport(ctx)
+	if !errors.Is(err, ErrLockUnsupported) {
+		t.Errorf("probeLockSupport() error = %v, want ErrLockUnsupported", err)
+	}
+}
+
+func TestLocker_DetectMultiplexing(t *testing.T) {
+	tests := []struct {
+		name        string
+		connID      int64
+		queryResult int64
+		wantErr     bool
+	}{
+		{
+			name:        "same session throughout",
+			connID:      7,
+			queryResult: 7,
+		},
+		{
+			name:        "queries answered by another session",
+			connID:      8,
+			queryResult: 7,
+			wantErr:     true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driverName := fmt.Sprintf("mock-multiplex-%d", i)
+			sql.Register(driverName, &mockDriver{
+				queryResult: tt.queryResult,
+				queryResults: map[string]int64{
+					"SELECT GET_LOCK(?, 0)":  1,
+					"SELECT RELEASE_LOCK(?)": 1,
+				},
+			})
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db, connID: tt.connID}
+			defer l.Close()
+
+			err := l.detectMultiplexing(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectMultiplexing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrLockUnsupported) {
+				t.Errorf("detectMultiplexing() error = %v, want ErrLockUnsupported", err)
+			}
+		})
+	}
+}
+
+func TestLocker_EnsureSessionTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		current         int64
+		expectedRuntime time.Duration
+		execError       error
+		wantExec        string
+		wantErr         bool
+	}{
+		{
+			name:            "raises short timeout",
+			current:         600,
+			expectedRuntime: 2 * time.Hour,
+			wantExec:        "SET SESSION wait_timeout = 7260, SESSION interactive_timeout = 7260",
+		},
+		{
+			name:            "keeps long enough timeout",
+			current:         28800,
+			expectedRuntime: time.Hour,
+		},
+		{
+			name:            "rounds partial seconds up",
+			current:         10,
+			expectedRuntime: 1500 * time.Millisecond,
+			wantExec:        "SET SESSION wait_timeout = 62, SESSION interactive_timeout = 62",
+		},
+		{
+			name:            "set fails",
+			current:         10,
+			expectedRuntime: time.Hour,
+			execError:       errors.New("access denied"),
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResult: tt.current, execError: tt.execError}
+			driverName := "mock-session-timeout-" + tt.name
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db}
+			defer l.Close()
+
+			err := l.EnsureSessionTimeout(context.Background(), tt.expectedRuntime)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EnsureSessionTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotExec string
+			if len(md.execQueries) > 0 {
+				gotExec = md.execQueries[0]
+			}
+			if gotExec != tt.wantExec {
+				t.Errorf("EnsureSessionTimeout() executed %q, want %q", gotExec, tt.wantExec)
+			}
+		})
+	}
+}
+
+func TestLocker_WithLockCtx(t *testing.T) {
+	t.Run("lock kept", func(t *testing.T) {
+		md := &mockDriver{queryResult: 1}
+		sql.Register("mock-withlockctx-kept", md)
+
+		db, _ := sql.Open("mock-withlockctx-kept", "test")
+		l := &Locker{db: db, checkInterval: time.Millisecond}
+		defer l.Close()
+
+		err := l.WithLockCtx(context.Background(), "test-lock", 5, func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			return ctx.Err()
+		})
+		if err != nil {
+			t.Errorf("WithLockCtx() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("lock lost", func(t *testing.T) {
+		md := &mockDriver{queryResult: 1}
+		sql.Register("mock-withlockctx-lost", md)
+
+		db, _ := sql.Open("mock-withlockctx-lost", "test")
+		l := &Locker{db: db, checkInterval: time.Millisecond}
+		defer l.Close()
+
+		err := l.WithLockCtx(context.Background(), "test-lock", 5, func(ctx context.Context) error {
+			// The session goes away while the work is running
+			md.setQueryError(errors.New("invalid connection"))
+			select {
+			case <-ctx.Done():
+				if !errors.Is(context.Cause(ctx), ErrLockLost) {
+					t.Errorf("context cause = %v, want ErrLockLost", context.Cause(ctx))
+				}
+				return ctx.Err()
+			case <-time.After(time.Second):
+				t.Error("context was not cancelled after the lock was lost")
+				return nil
+			}
+		})
+		if !errors.Is(err, ErrLockLost) {
+			t.Errorf("WithLockCtx() error = %v, want ErrLockLost", err)
+		}
+		if got := ExitCode(err); got != LockLost {
+			t.Errorf("ExitCode() = %v, want %v", got, LockLost)
+		}
+	})
+}
+
+func TestLocker_WithLockCtx_CheckInFlight(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-withlockctx-inflight", md)
+
+	db, _ := sql.Open("mock-withlockctx-inflight", "test")
+	l := &Locker{db: db, checkInterval: time.Millisecond}
+	defer l.Close()
+
+	// The work ends while a lock check waits on the server
+	block, blocked := make(chan struct{}), make(chan struct{}, 1)
+	err := l.WithLockCtx(context.Background(), "test-lock", 5, func(ctx context.Context) error {
+		md.setBlock(block, blocked)
+		<-blocked
+		time.AfterFunc(20*time.Millisecond, func() { close(block) })
+		return nil
+	})
+	if err != nil {
+		t.Errorf("WithLockCtx() error = %v, want nil", err)
+	}
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	if md.cancelled != 0 {
+		t.Errorf("%d lock checks were cancelled when the work ended, closing the lock session", md.cancelled)
+	}
+	if last := md.queries[len(md.queries)-1]; !strings.Contains(last, "RELEASE_LOCK") {
+		t.Errorf("last query = %q, want RELEASE_LOCK", last)
+	}
+}
+
+func TestLocker_Reacquire(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-reacquire", md)
+
+	db, _ := sql.Open("mock-reacquire", "test")
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Locker{db: db, conn: conn, connID: 1, sessionRuntime: time.Hour}
+	defer l.Close()
+	// A --claim slot is held twice, another lock once
+	l.held = map[string]int{"slot-1": 2, "other": 1}
+
+	acquired, err := l.Reacquire(context.Background(), "slot-1", 5)
+	if err != nil || !acquired {
+		t.Fatalf("Reacquire() = (%v, %v), want (true, nil)", acquired, err)
+	}
+	if want := map[string]int{"slot-1": 2, "other": 1}; !reflect.DeepEqual(l.held, want) {
+		t.Errorf("held = %v, want %v", l.held, want)
+	}
+
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	var getLocks int
+	for _, query := range md.queries {
+		if strings.Contains(query, "GET_LOCK(?, ?)") {
+			getLocks++
+		}
+	}
+	if getLocks != 2 {
+		t.Errorf("%d GET_LOCK queries, want one per held lock in %q", getLocks, md.queries)
+	}
+	if !strings.Contains(strings.Join(md.execQueries, "\n"), "wait_timeout") {
+		t.Errorf("new session did not get the session timeouts, exec %q", md.execQueries)
+	}
+}
+
+func TestLocker_FirstBlock_NoAccess(t *testing.T) {
+	// An account with only the rights to take locks may not read the table
+	for i, number := range []uint16{errNoSuchTable, errTableAccessDenied, errDBAccessDenied} {
+		md := &mockDriver{queryError: &mysql.MySQLError{Number: number, Message: "denied"}}
+		driverName := fmt.Sprintf("mock-firstblock-%d", i)
+		sql.Register(driverName, md)
+
+		db, _ := sql.Open(driverName, "test")
+		l := &Locker{db: db}
+		if block, err := l.FirstBlock(context.Background(), "shard.3", "shard"); block != nil || err != nil {
+			t.Errorf("FirstBlock() with MySQL error %d = %+v, %v, want nil, nil", number, block, err)
+		}
+		l.Close()
+	}
+}
+
+func TestLocker_TryLock(t *testing.T) {
+	tests := []struct {
+		name         string
+		lockName     string
+		queryResult  int64
+		queryError   error
+		wantAcquired bool
+		wantErr      bool
+	}{
+		{
+			name:         "lock is free",
+			lockName:     "test-lock",
+			queryResult:  1,
+			wantAcquired: true,
+		},
+		{
+			name:         "lock is held elsewhere",
+			lockName:     "test-lock",
+			queryResult:  0,
+			wantAcquired: false,
+		},
+		{
+			name:     "invalid lock name",
+			lockName: "invalid lock",
+			wantErr:  true,
+		},
+		{
+			name:       "query error",
+			lockName:   "test-lock",
+			queryError: errors.New("query failed"),
+			wantErr:    true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driverName := fmt.Sprintf("mock-trylock-%d", i)
+			sql.Register(driverName, &mockDriver{queryResult: tt.queryResult, queryError: tt.queryError})
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db}
+			defer l.Close()
+
+			acquired, err := l.TryLock(context.Background(), tt.lockName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TryLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if acquired != tt.wantAcquired {
+				t.Errorf("TryLock() = %v, want %v", acquired, tt.wantAcquired)
+			}
+		})
+	}
+}
+
+func TestLocker_Reentrant(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-reentrant", md)
+
+	db, _ := sql.Open("mock-reentrant", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+	logging.SetDebug(true)
+	defer logging.SetDebug(false)
+
+	err := l.WithLock(context.Background(), "test-lock", 5, func() error {
+		return l.WithLock(context.Background(), "test-lock", 5, func() error { return nil })
+	})
+	if err != nil {
+		t.Fatalf("nested WithLock() error = %v, want nil", err)
+	}
+
+	// Only the outer acquisition and release reach the server
+	out := buf.String()
+	if got := strings.Count(out, "GET_LOCK"); got != 1 {
+		t.Errorf("GET_LOCK ran %d times, want 1", got)
+	}
+	if got := strings.Count(out, "RELEASE_LOCK"); got != 1 {
+		t.Errorf("RELEASE_LOCK ran %d times, want 1", got)
+	}
+	if len(l.held) != 0 {
+		t.Errorf("held = %v after release, want empty", l.held)
+	}
+}
+
+func TestLocker_NoRelease(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-norelease", md)
+
+	db, _ := sql.Open("mock-norelease", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+	l.SetNoRelease(true)
+
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+	logging.SetDebug(true)
+	defer logging.SetDebug(false)
+
+	if err := l.WithLock(context.Background(), "test-lock", 5, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock() error = %v, want nil", err)
+	}
+	if strings.Contains(buf.String(), "SELECT RELEASE_LOCK") {
+		t.Errorf("RELEASE_LOCK ran with no-release set:\n%s", buf.String())
+	}
+	if released, _ := l.ReleaseLock(context.Background(), "test-lock"); released {
+		t.Error("ReleaseLock() of a forgotten lock = true, want false")
+	}
+}
+
+func TestLocker_Extend(t *testing.T) {
+	tests := []struct {
+		name         string
+		queryResult  int64
+		queryError   error
+		wantErr      bool
+		wantLockLost bool
+	}{
+		{
+			name:        "held by this session",
+			queryResult: 42,
+		},
+		{
+			name:         "held by another session",
+			queryResult:  43,
+			wantErr:      true,
+			wantLockLost: true,
+		},
+		{
+			name:       "connection error",
+			queryError: errors.New("invalid connection"),
+			wantErr:    true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driverName := fmt.Sprintf("mock-extend-%d", i)
+			sql.Register(driverName, &mockDriver{queryResult: tt.queryResult, queryError: tt.queryError})
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db, connID: 42}
+			defer l.Close()
+
+			err := l.Extend(context.Background(), "test-lock")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Extend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrLockLost) != tt.wantLockLost {
+				t.Errorf("Extend() error = %v, want ErrLockLost %v", err, tt.wantLockLost)
+			}
+		})
+	}
+}
+
+func TestLocker_WithLockCtxOnLost(t *testing.T) {
+	t.Run("handler recovers the lock", func(t *testing.T) {
+		md := &mockDriver{queryResult: 1}
+		sql.Register("mock-onlost-recover", md)
+
+		db, _ := sql.Open("mock-onlost-recover", "test")
+		l := &Locker{db: db, checkInterval: time.Millisecond}
+		defer l.Close()
+
+		handled := make(chan struct{}, 1)
+		onLost := func(ctx context.Context, lost error) error {
+			md.setQueryError(nil)
+			select {
+			case handled <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+
+		err := l.WithLockCtxOnLost(context.Background(), "test-lock", 5, func(ctx context.Context) error {
+			md.setQueryError(errors.New("invalid connection"))
+			select {
+			case <-handled:
+			case <-time.After(time.Second):
+				t.Error("handler was not called after the lock was lost")
+			}
+			time.Sleep(10 * time.Millisecond)
+			return ctx.Err()
+		}, onLost)
+		if err != nil {
+			t.Errorf("WithLockCtxOnLost() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("handler gives up", func(t *testing.T) {
+		md := &mockDriver{queryResult: 1}
+		sql.Register("mock-onlost-giveup", md)
+
+		db, _ := sql.Open("mock-onlost-giveup", "test")
+		l := &Locker{db: db, checkInterval: time.Millisecond}
+		defer l.Close()
+
+		onLost := func(ctx context.Context, lost error) error {
+			return errors.New("reacquire failed")
+		}
+
+		err := l.WithLockCtxOnLost(context.Background(), "test-lock", 5, func(ctx context.Context) error {
+			md.setQueryError(errors.New("invalid connection"))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+				t.Error("context was not cancelled after the handler gave up")
+			}
+			return ctx.Err()
+		}, onLost)
+		if !errors.Is(err, ErrLockLost) || !strings.Contains(err.Error(), "reacquire failed") {
+			t.Errorf("WithLockCtxOnLost() error = %v, want ErrLockLost with the handler error", err)
+		}
+	})
+}
+
 func TestExitCode_Coverage(t *testing.T) {
 	if got := ExitCode(nil); got != 0 {
 		t.Errorf("ExitCode(nil) = %v, want 0", got)
@@ -455,6 +1280,12 @@ func TestExitCode_Coverage(t *testing.T) {
 	if got := ExitCode(ErrLockTimeout); got != LockTimeout {
 		t.Errorf("ExitCode(ErrLockTimeout) = %v, want %v", got, LockTimeout)
 	}
+	if got := ExitCode(fmt.Errorf("%w: probe failed", ErrLockUnsupported)); got != LockUnsupported {
+		t.Errorf("ExitCode(ErrLockUnsupported) = %v, want %v", got, LockUnsupported)
+	}
+	if got := ExitCode(fmt.Errorf("lock 'x' is %w", ErrBlocked)); got != Blocked {
+		t.Errorf("ExitCode(ErrBlocked) = %v, want %v", got, Blocked)
+	}
 	if got := ExitCode(errors.New("other")); got != InternalError {
 		t.Errorf("ExitCode(other error) = %v, want %v", got, InternalError)
 	}
@@ -463,3 +1294,399 @@ func TestExitCode_Coverage(t *testing.T) {
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || contains(s[1:], substr)))
 }
+
+func TestLocker_Preempt(t *testing.T) {
+	// The holder's connection id is higher than this session's in every
+	// case, so only the start times order the runs
+	tests := []struct {
+		name           string
+		started        int64
+		noStart        bool
+		wantAcquired   bool
+		wantSuperseded bool
+		wantKill       string
+	}{
+		{
+			name:         "older holder is killed",
+			started:      5,
+			wantAcquired: true,
+			wantKill:     "KILL 12",
+		},
+		{
+			name:           "newer holder supersedes",
+			started:        11,
+			wantSuperseded: true,
+		},
+		{
+			name:           "holder started at the same time supersedes",
+			started:        10,
+			wantSuperseded: true,
+		},
+		{
+			name:         "holder that is not a preempting run is killed",
+			noStart:      true,
+			wantAcquired: true,
+			wantKill:     "KILL 12",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResults: map[string]int64{
+				"SELECT IS_USED_LOCK(?)":                     12,
+				holderStartQuery:                             tt.started,
+				"SELECT GET_LOCK(?, ?)":                      1,
+				"SELECT IS_USED_LOCK(?) <=> CONNECTION_ID()": 1,
+			}, nullResults: map[string]bool{holderStartQuery: tt.noStart}}
+			driverName := fmt.Sprintf("mock-preempt-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db, connID: 10}
+			defer l.Close()
+			l.SetPreempt(time.Unix(0, 10))
+
+			acquired, err := l.AcquireLock(context.Background(), "deploy", 5)
+			if acquired != tt.wantAcquired {
+				t.Errorf("AcquireLock() = %v, want %v", acquired, tt.wantAcquired)
+			}
+			if errors.Is(err, ErrSuperseded) != tt.wantSuperseded {
+				t.Errorf("AcquireLock() error = %v, want superseded %v", err, tt.wantSuperseded)
+			}
+			if !tt.wantSuperseded && err != nil {
+				t.Errorf("AcquireLock() error = %v", err)
+			}
+			killed := strings.Join(md.execQueries, ";")
+			if killed != tt.wantKill {
+				t.Errorf("exec queries = %q, want %q", killed, tt.wantKill)
+			}
+		})
+	}
+}
+
+func TestLocker_SupersededBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		started int64
+		want    bool
+	}{
+		{name: "taken over by a newer run", started: 11, want: true},
+		{name: "taken by an older run", started: 5},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResults: map[string]int64{
+				"SELECT IS_USED_LOCK(?)": 12,
+				holderStartQuery:         tt.started,
+			}}
+			driverName := fmt.Sprintf("mock-superseded-by-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db, connID: 10}
+			defer l.Close()
+			l.SetPreempt(time.Unix(0, 10))
+
+			err := l.supersededBy(context.Background(), "deploy")
+			if errors.Is(err, ErrSuperseded) != tt.want {
+				t.Errorf("supersededBy() = %v, want superseded %v", err, tt.want)
+			}
+			if err != nil && ExitCode(fmt.Errorf("%w: %w", ErrLockLost, err)) != Preempted {
+				t.Errorf("ExitCode(%v) = %d, want %d", err, ExitCode(err), Preempted)
+			}
+		})
+	}
+}
+
+func TestLocker_Dedupe(t *testing.T) {
+	lastSuccess := "SELECT COALESCE(MAX(TIMESTAMPDIFF(MICROSECOND, succeeded_at, UTC_TIMESTAMP(6))), -1) FROM mylock_dedupe WHERE command_hash = ?"
+	tests := []struct {
+		name      string
+		micros    int64
+		wantAge   time.Duration
+		wantFound bool
+	}{
+		{name: "never succeeded", micros: -1},
+		{name: "succeeded a minute ago", micros: 60_000_000, wantAge: time.Minute, wantFound: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResults: map[string]int64{lastSuccess: tt.micros}}
+			driverName := fmt.Sprintf("mock-dedupe-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db}
+			defer l.Close()
+
+			age, found, err := l.LastSuccess(context.Background(), "mylock-abc")
+			if err != nil {
+				t.Fatalf("LastSuccess() error = %v", err)
+			}
+			if age != tt.wantAge || found != tt.wantFound {
+				t.Errorf("LastSuccess() = %v, %v, want %v, %v", age, found, tt.wantAge, tt.wantFound)
+			}
+
+			if err := l.RecordSuccess(context.Background(), "mylock-abc"); err != nil {
+				t.Fatalf("RecordSuccess() error = %v", err)
+			}
+			if len(md.execQueries) != 3 || !strings.HasPrefix(md.execQueries[2], "INSERT INTO mylock_dedupe") {
+				t.Errorf("exec queries = %q, want table creation and an insert", md.execQueries)
+			}
+		})
+	}
+}
+
+func TestLocker_WaitFree(t *testing.T) {
+	tests := []struct {
+		name     string
+		isFree   int64
+		wantFree bool
+	}{
+		{name: "free lock", isFree: 1, wantFree: true},
+		{name: "held lock times out", isFree: 0, wantFree: false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryResult: tt.isFree}
+			driverName := fmt.Sprintf("mock-waitfree-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db}
+			defer l.Close()
+
+			free, err := l.WaitFree(context.Background(), "nightly", 1)
+			if err != nil {
+				t.Fatalf("WaitFree() error = %v", err)
+			}
+			if free != tt.wantFree {
+				t.Errorf("WaitFree() = %v, want %v", free, tt.wantFree)
+			}
+		})
+	}
+
+	if _, err := (&Locker{}).WaitFree(context.Background(), "bad name", 1); err == nil {
+		t.Error("WaitFree() with an invalid lock name should fail")
+	}
+}
+
+func TestLocker_WaitFreeWithFakeClock(t *testing.T) {
+	md := &mockDriver{queryResult: 0}
+	sql.Register("mock-waitfree-fakeclock", md)
+
+	db, _ := sql.Open("mock-waitfree-fakeclock", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+	fake := clock.NewFake(time.Now())
+	l.SetClock(fake)
+
+	done := make(chan bool, 1)
+	go func() {
+		free, _ := l.WaitFree(context.Background(), "nightly", 3600)
+		done <- free
+	}()
+
+	// The timeout timer and the poll ticker
+	fake.BlockUntil(2)
+	fake.Advance(time.Hour)
+	select {
+	case free := <-done:
+		if free {
+			t.Error("WaitFree() = true for a held lock, want false")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitFree() did not time out when the fake clock passed the timeout")
+	}
+}
+
+func TestLocker_LockHolder(t *testing.T) {
+	md := &mockDriver{queryResult: 42}
+	sql.Register("mock-lockholder", md)
+
+	db, _ := sql.Open("mock-lockholder", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	holder, err := l.LockHolder(context.Background(), "nightly")
+	if err != nil {
+		t.Fatalf("LockHolder() error = %v", err)
+	}
+	if holder != 42 {
+		t.Errorf("LockHolder() = %d, want 42", holder)
+	}
+
+	if _, err := l.LockHolder(context.Background(), "bad name"); err == nil {
+		t.Error("LockHolder() with an invalid lock name should fail")
+	}
+}
+
+func TestLocker_DeadlockByDialect(t *testing.T) {
+	mysql8 := ServerVersion{Raw: "8.0.36", Major: 8, Patch: 36}
+	mariadb := ServerVersion{Raw: "10.11.6-MariaDB", Major: 10, Minor: 11, Patch: 6, MariaDB: true}
+	tests := []struct {
+		name     string
+		version  *ServerVersion
+		number   uint16
+		deadlock bool
+	}{
+		{name: "MySQL user lock deadlock", version: &mysql8, number: errUserLockDeadlock, deadlock: true},
+		{name: "MariaDB deadlock", version: &mariadb, number: errLockDeadlock, deadlock: true},
+		{name: "unknown server deadlock", number: errLockDeadlock, deadlock: true},
+		{name: "MySQL row lock deadlock", version: &mysql8, number: errLockDeadlock},
+		{name: "other error", version: &mariadb, number: 1045},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := &mockDriver{queryError: &mysql.MySQLError{Number: tt.number, Message: "Deadlock found"}}
+			driverName := fmt.Sprintf("mock-deadlock-%d", i)
+			sql.Register(driverName, md)
+
+			db, _ := sql.Open(driverName, "test")
+			l := &Locker{db: db, version: tt.version}
+			defer l.Close()
+
+			acquired, err := l.AcquireLock(context.Background(), "deadlock-lock", 5)
+			if err == nil || acquired {
+				t.Fatalf("AcquireLock() = %v, %v, want an error", acquired, err)
+			}
+			if got := errors.Is(err, ErrLockDeadlock); got != tt.deadlock {
+				t.Errorf("errors.Is(err, ErrLockDeadlock) = %v, want %v (err = %v)", got, tt.deadlock, err)
+			}
+			wantCode := InternalError
+			if tt.deadlock {
+				wantCode = LockTimeout
+			}
+			if got := ExitCode(err); got != wantCode {
+				t.Errorf("ExitCode() = %d, want %d", got, wantCode)
+			}
+		})
+	}
+}
+
+func TestLocker_QueryComment(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-query-comment", md)
+
+	db, _ := sql.Open("mock-query-comment", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+	l.SetQueryComment("web1.example.com", "3f2a")
+
+	ctx := context.Background()
+	if _, err := l.AcquireLock(ctx, "nightly", 5); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if _, err := l.ReleaseLock(ctx, "nightly"); err != nil {
+		t.Fatalf("ReleaseLock() error = %v", err)
+	}
+
+	want := []string{
+		"/* mylock name=nightly host=web1.example.com run=3f2a */ SELECT GET_LOCK(?, ?)",
+		"/* mylock name=nightly host=web1.example.com run=3f2a */ SELECT RELEASE_LOCK(?)",
+	}
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	for _, query := range want {
+		found := false
+		for _, raw := range md.rawQueries {
+			found = found || raw == query
+		}
+		if !found {
+			t.Errorf("query %q not run; ran %q", query, md.rawQueries)
+		}
+	}
+}
+
+func TestCommentValue(t *testing.T) {
+	tests := map[string]string{
+		"nightly-backup.v2": "nightly-backup.v2",
+		"a*/ DROP":          "a___DROP",
+		"what?":             "what_",
+		"ホスト":               "___",
+	}
+	for in, want := range tests {
+		if got := commentValue(in); got != want {
+			t.Errorf("commentValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseQueryComment(t *testing.T) {
+	l := &Locker{}
+	l.SetQueryComment("web1", "3f2a")
+	name, host, run, ok := parseQueryComment(l.lockQuery("nightly", "SELECT GET_LOCK(?, ?)"))
+	if !ok || name != "nightly" || host != "web1" || run != "3f2a" {
+		t.Errorf("parseQueryComment() = %q, %q, %q, %v, want nightly, web1, 3f2a, true", name, host, run, ok)
+	}
+
+	if _, _, _, ok := parseQueryComment("SELECT GET_LOCK('other', 10)"); ok {
+		t.Error("parseQueryComment() found a comment in a query without one")
+	}
+}
+
+func TestLocker_AcquireManyOrder(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-acquire-many", md)
+
+	db, _ := sql.Open("mock-acquire-many", "test")
+	l := &Locker{db: db}
+	defer l.Close()
+
+	ctx := context.Background()
+	if ok, err := l.AcquireMany(ctx, []string{"zeta", "alpha", "mid"}, 5); !ok || err != nil {
+		t.Fatalf("AcquireMany() = %v, %v, want true", ok, err)
+	}
+	if err := l.ReleaseMany(ctx, []string{"zeta", "alpha", "mid"}); err != nil {
+		t.Fatalf("ReleaseMany() error = %v", err)
+	}
+
+	var got []string
+	md.mu.Lock()
+	for _, raw := range md.rawQueries {
+		if name, _, _, ok := parseQueryComment(raw); ok {
+			got = append(got, name+" "+raw[strings.Index(raw, "*/ ")+3:])
+		}
+	}
+	md.mu.Unlock()
+	want := []string{
+		"alpha SELECT GET_LOCK(?, ?)",
+		"mid SELECT GET_LOCK(?, ?)",
+		"zeta SELECT GET_LOCK(?, ?)",
+		"zeta SELECT RELEASE_LOCK(?)",
+		"mid SELECT RELEASE_LOCK(?)",
+		"alpha SELECT RELEASE_LOCK(?)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lock queries = %q, want %q", got, want)
+	}
+}
+
+func TestLocker_CloseLogsPoolStats(t *testing.T) {
+	md := &mockDriver{queryResult: 1}
+	sql.Register("mock-pool-stats", md)
+
+	db, _ := sql.Open("mock-pool-stats", "test")
+	l := &Locker{db: db}
+	if _, err := l.AcquireLock(context.Background(), "pool-lock", 5); err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if stats := l.DBStats(); stats.OpenConnections != 1 {
+		t.Errorf("DBStats().OpenConnections = %d, want 1", stats.OpenConnections)
+	}
+
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+	logging.SetDebug(true)
+	defer logging.SetDebug(false)
+	l.Close()
+
+	if got := buf.String(); !strings.Contains(got, "pool open=1 in_use=0 idle=1 wait_count=0") {
+		t.Errorf("debug output %q does not report the pool statistics", got)
+	}
+}
@@ -205,6 +205,11 @@ func TestExitCode(t *testing.T) {
 			err:  ErrLockTimeout,
 			want: LockTimeout,
 		},
+		{
+			name: "superseded by a newer run",
+			err:  ErrSuperseded,
+			want: Preempted,
+		},
 		{
 			name: "internal error",
 			err:  errors.New("some error"),
@@ -220,3 +225,25 @@ func TestExitCode(t *testing.T) {
 		})
 	}
 }
+
+func TestIsReservedExitCode(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{code: 0, want: false},
+		{code: 1, want: false},
+		{code: 199, want: false},
+		{code: LockTimeout, want: true},
+		{code: InternalError, want: true},
+		{code: 209, want: true},
+		{code: 210, want: false},
+		{code: 255, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsReservedExitCode(tt.code); got != tt.want {
+			t.Errorf("IsReservedExitCode(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+// AcquireMany takes every lock in names, or none of them: on a timeout or
+// an error the locks already taken are released again. Locks are taken in
+// sorted order, so callers asking for overlapping sets cannot deadlock each
+// other. timeout bounds the whole acquisition, not each lock.
+func (l *Locker) AcquireMany(ctx context.Context, names []string, timeout int) (bool, error) {
+	return acquireMany(ctx, l, l.clock, names, timeout)
+}
+
+// ReleaseMany releases locks taken with AcquireMany
+func (l *Locker) ReleaseMany(ctx context.Context, names []string) error {
+	return releaseMany(ctx, l, names)
+}
+
+// AcquireMany takes every lock in names, or none of them; see
+// Locker.AcquireMany
+func (l *MemoryLocker) AcquireMany(ctx context.Context, names []string, timeout int) (bool, error) {
+	return acquireMany(ctx, l, l.clock, names, timeout)
+}
+
+// ReleaseMany releases locks taken with AcquireMany
+func (l *MemoryLocker) ReleaseMany(ctx context.Context, names []string) error {
+	return releaseMany(ctx, l, names)
+}
+
+// lockOrder returns names sorted and without duplicates, after checking
+// that b accepts every name
+func lockOrder(b Backend, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no lock names given")
+	}
+	check := ValidateLockName
+	if c, ok := b.(nameChecker); ok {
+		check = c.checkName
+	}
+	sorted := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if err := check(name); err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+func acquireMany(ctx context.Context, b Backend, c clock.Clock, names []string, timeout int) (bool, error) {
+	order, err := lockOrder(b, names)
+	if err != nil {
+		return false, err
+	}
+	if timeout <= 0 {
+		return false, errors.New("timeout must be positive")
+	}
+	c = clock.OrReal(c)
+	deadline := c.Now().Add(time.Duration(timeout) * time.Second)
+
+	for i, name := range order {
+		// Each lock waits for what is left of the timeout, rounded up; once
+		// it is used up, only locks that are free right now are taken
+		var acquired bool
+		if wait := int((deadline.Sub(c.Now()) + time.Second - 1) / time.Second); wait > 0 {
+			acquired, err = b.AcquireLock(ctx, name, wait)
+		} else {
+			acquired, err = b.TryLock(ctx, name)
+		}
+		if err == nil && acquired {
+			continue
+		}
+		if rollbackErr := rollbackLocks(b, order[:i]); rollbackErr != nil {
+			err = errors.Join(err, rollbackErr)
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to acquire lock '%s': %w", name, err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// rollbackLocks releases held in reverse order, even if ctx is done, so a
+// cancelled acquisition does not leave locks behind
+func rollbackLocks(b Backend, held []string) error {
+	var errs []error
+	for i := len(held) - 1; i >= 0; i-- {
+		if _, err := b.ReleaseLock(context.Background(), held[i]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release lock '%s': %w", held[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func releaseMany(ctx context.Context, b Backend, names []string) error {
+	order, err := lockOrder(b, names)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		released, err := b.ReleaseLock(ctx, order[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to release lock '%s': %w", order[i], err))
+		} else if !released {
+			errs = append(errs, fmt.Errorf("lock '%s' was not held", order[i]))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,227 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+// memoryLock is one named lock shared by every MemoryLocker in the process
+type memoryLock struct {
+	// token holds a value while the lock is held
+	token chan struct{}
+	owner *MemoryLocker
+}
+
+var memoryLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}{locks: make(map[string]*memoryLock)}
+
+func getMemoryLock(lockName string) *memoryLock {
+	memoryLocks.mu.Lock()
+	defer memoryLocks.mu.Unlock()
+
+	m, ok := memoryLocks.locks[lockName]
+	if !ok {
+		m = &memoryLock{token: make(chan struct{}, 1)}
+		memoryLocks.locks[lockName] = m
+	}
+	return m
+}
+
+// MemoryLocker implements the locking API inside a single process without
+// any database, for CI and local development. Locks are shared by all
+// MemoryLockers in the process, but not across processes.
+type MemoryLocker struct {
+	// held counts nested acquisitions of each lock; guarded by memoryLocks.mu
+	held map[string]int
+	// clock times the wait for a lock; nil uses the system clock
+	clock clock.Clock
+	// names is the policy for accepted lock names
+	names LockNamePolicy
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{held: make(map[string]int)}
+}
+
+// SetClock replaces the clock that times the wait for a lock, for tests
+func (l *MemoryLocker) SetClock(c clock.Clock) {
+	l.clock = c
+}
+
+// SetLockNamePolicy changes the lock names accepted; call it before taking
+// any lock
+func (l *MemoryLocker) SetLockNamePolicy(p LockNamePolicy) {
+	l.names = p
+}
+
+func (l *MemoryLocker) checkName(lockName string) error {
+	return l.names.Validate(lockName)
+}
+
+func (l *MemoryLocker) AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+	if timeout <= 0 {
+		return false, errors.New("timeout must be positive")
+	}
+
+	m := getMemoryLock(lockName)
+	if l.reenter(m, lockName) {
+		return true, nil
+	}
+	timer := clock.OrReal(l.clock).NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case m.token <- struct{}{}:
+		memoryLocks.mu.Lock()
+		m.owner = l
+		l.held[lockName] = 1
+		memoryLocks.mu.Unlock()
+		return true, nil
+	case <-timer.C():
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// TryLock acquires the lock only if no other MemoryLocker holds it
+func (l *MemoryLocker) TryLock(ctx context.Context, lockName string) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+
+	m := getMemoryLock(lockName)
+	if l.reenter(m, lockName) {
+		return true, nil
+	}
+	select {
+	case m.token <- struct{}{}:
+		memoryLocks.mu.Lock()
+		m.owner = l
+		l.held[lockName] = 1
+		memoryLocks.mu.Unlock()
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// WaitFree blocks until no MemoryLocker holds the lock, without acquiring
+// it. It reports false if the lock is still held after timeout seconds; with
+// a timeout of 0 it checks only once.
+func (l *MemoryLocker) WaitFree(ctx context.Context, lockName string, timeout int) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+
+	m := getMemoryLock(lockName)
+	clk := clock.OrReal(l.clock)
+	timer := clk.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+	ticker := clk.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		memoryLocks.mu.Lock()
+		free := m.owner == nil
+		memoryLocks.mu.Unlock()
+		if free {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-timer.C():
+			return false, nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// Extend reports ErrLockLost if l does not hold the lock
+func (l *MemoryLocker) Extend(ctx context.Context, lockName string) error {
+	if err := l.checkName(lockName); err != nil {
+		return err
+	}
+
+	m := getMemoryLock(lockName)
+	memoryLocks.mu.Lock()
+	defer memoryLocks.mu.Unlock()
+	if m.owner != l {
+		return fmt.Errorf("%w: lock is not held", ErrLockLost)
+	}
+	return nil
+}
+
+func (l *MemoryLocker) ReleaseLock(ctx context.Context, lockName string) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+
+	m := getMemoryLock(lockName)
+	memoryLocks.mu.Lock()
+	defer memoryLocks.mu.Unlock()
+	return l.release(m, lockName), nil
+}
+
+// reenter counts another acquisition if l already holds m
+func (l *MemoryLocker) reenter(m *memoryLock, lockName string) bool {
+	memoryLocks.mu.Lock()
+	defer memoryLocks.mu.Unlock()
+	if m.owner != l {
+		return false
+	}
+	l.held[lockName]++
+	return true
+}
+
+// release drops one reference to m if l holds it, and frees m once the last
+// one is gone; memoryLocks.mu must be held
+func (l *MemoryLocker) release(m *memoryLock, lockName string) bool {
+	if m.owner != l {
+		return false
+	}
+	if l.held[lockName] > 1 {
+		l.held[lockName]--
+		return true
+	}
+	m.owner = nil
+	delete(l.held, lockName)
+	<-m.token
+	return true
+}
+
+func (l *MemoryLocker) WithLock(ctx context.Context, lockName string, timeout int, fn func() error) error {
+	return withLock(ctx, l, lockName, timeout, fn)
+}
+
+// WithLockCtx is like WithLock; process-local locks cannot be lost, so the
+// context is only cancelled when ctx is
+func (l *MemoryLocker) WithLockCtx(ctx context.Context, lockName string, timeout int, fn func(context.Context) error) error {
+	return withLockCtx(ctx, l, lockName, timeout, fn, nil)
+}
+
+// ConnectionID is always 0, as there is no server session
+func (l *MemoryLocker) ConnectionID() int64 {
+	return 0
+}
+
+// Close releases every lock still held, like closing a MySQL session would
+func (l *MemoryLocker) Close() error {
+	memoryLocks.mu.Lock()
+	defer memoryLocks.mu.Unlock()
+	for lockName := range l.held {
+		l.held[lockName] = 1
+		l.release(memoryLocks.locks[lockName], lockName)
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+	first := NewMemoryLocker()
+	second := NewMemoryLocker()
+
+	acquired, err := first.AcquireLock(ctx, "memory-lock", 1)
+	if err != nil || !acquired {
+		t.Fatalf("first.AcquireLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+
+	// Another locker in the same process must wait and time out
+	start := time.Now()
+	acquired, err = second.AcquireLock(ctx, "memory-lock", 1)
+	if err != nil || acquired {
+		t.Fatalf("second.AcquireLock() = (%v, %v), want (false, nil)", acquired, err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("second.AcquireLock() returned after %v, want about 1s", elapsed)
+	}
+
+	// Only the owner can release
+	if released, _ := second.ReleaseLock(ctx, "memory-lock"); released {
+		t.Error("second.ReleaseLock() = true, want false for a lock it does not hold")
+	}
+	if released, _ := first.ReleaseLock(ctx, "memory-lock"); !released {
+		t.Error("first.ReleaseLock() = false, want true")
+	}
+
+	acquired, err = second.AcquireLock(ctx, "memory-lock", 1)
+	if err != nil || !acquired {
+		t.Fatalf("second.AcquireLock() after release = (%v, %v), want (true, nil)", acquired, err)
+	}
+	second.ReleaseLock(ctx, "memory-lock")
+}
+
+func TestMemoryLocker_WithLock(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+
+	executed := false
+	err := l.WithLock(ctx, "memory-withlock", 1, func() error {
+		executed = true
+		// Nested acquisition by another locker must time out
+		return NewMemoryLocker().WithLock(ctx, "memory-withlock", 1, func() error {
+			t.Error("inner function should not run while the lock is held")
+			return nil
+		})
+	})
+	if !executed {
+		t.Error("WithLock() did not run the function")
+	}
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("WithLock() error = %v, want ErrLockTimeout from inner call", err)
+	}
+
+	// The lock is released afterwards
+	if acquired, _ := l.AcquireLock(ctx, "memory-withlock", 1); !acquired {
+		t.Error("lock was not released by WithLock()")
+	}
+	l.ReleaseLock(ctx, "memory-withlock")
+}
+
+func TestMemoryLocker_Validation(t *testing.T) {
+	l := NewMemoryLocker()
+	if _, err := l.AcquireLock(context.Background(), "", 1); err == nil {
+		t.Error("AcquireLock() with empty name should fail")
+	}
+	if _, err := l.AcquireLock(context.Background(), "memory-lock", 0); err == nil {
+		t.Error("AcquireLock() with zero timeout should fail")
+	}
+}
+
+func TestMemoryLocker_CloseReleasesLocks(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	if acquired, _ := l.AcquireLock(ctx, "memory-close", 1); !acquired {
+		t.Fatal("AcquireLock() = false, want true")
+	}
+	l.Close()
+
+	other := NewMemoryLocker()
+	defer other.Close()
+	if acquired, _ := other.AcquireLock(ctx, "memory-close", 1); !acquired {
+		t.Error("lock was not released by Close()")
+	}
+}
+
+func TestMemoryLocker_WaitFree(t *testing.T) {
+	ctx := context.Background()
+	holder := NewMemoryLocker()
+	waiter := NewMemoryLocker()
+	defer holder.Close()
+	defer waiter.Close()
+
+	if free, err := waiter.WaitFree(ctx, "memory-waitfree", 1); err != nil || !free {
+		t.Fatalf("WaitFree() of a free lock = (%v, %v), want (true, nil)", free, err)
+	}
+
+	if acquired, err := holder.TryLock(ctx, "memory-waitfree"); err != nil || !acquired {
+		t.Fatalf("TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+	fake := clock.NewFake(time.Now())
+	waiter.SetClock(fake)
+	done := make(chan bool)
+	go func() {
+		free, _ := waiter.WaitFree(ctx, "memory-waitfree", 60)
+		done <- free
+	}()
+	fake.BlockUntil(2)
+	holder.ReleaseLock(ctx, "memory-waitfree")
+	fake.Advance(waitPollInterval)
+	if free := <-done; !free {
+		t.Errorf("WaitFree() = false after the lock was released, want true")
+	}
+
+	// WaitFree never takes the lock itself
+	if acquired, err := holder.TryLock(ctx, "memory-waitfree"); err != nil || !acquired {
+		t.Fatalf("TryLock() after WaitFree() = (%v, %v), want (true, nil)", acquired, err)
+	}
+	go func() {
+		free, _ := waiter.WaitFree(ctx, "memory-waitfree", 60)
+		done <- free
+	}()
+	fake.BlockUntil(2)
+	fake.Advance(time.Minute)
+	if free := <-done; free {
+		t.Errorf("WaitFree() = true while the lock is held, want false after the timeout")
+	}
+}
+
+func TestMemoryLocker_TryLockAndExtend(t *testing.T) {
+	ctx := context.Background()
+	first := NewMemoryLocker()
+	second := NewMemoryLocker()
+	defer first.Close()
+	defer second.Close()
+
+	if acquired, err := first.TryLock(ctx, "memory-trylock"); err != nil || !acquired {
+		t.Fatalf("first.TryLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+
+	// A held lock is reported immediately instead of waiting
+	start := time.Now()
+	if acquired, err := second.TryLock(ctx, "memory-trylock"); err != nil || acquired {
+		t.Errorf("second.TryLock() = (%v, %v), want (false, nil)", acquired, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("second.TryLock() took %v, want no wait", elapsed)
+	}
+
+	if err := first.Extend(ctx, "memory-trylock"); err != nil {
+		t.Errorf("first.Extend() error = %v, want nil", err)
+	}
+	if err := second.Extend(ctx, "memory-trylock"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("second.Extend() error = %v, want ErrLockLost", err)
+	}
+
+	first.ReleaseLock(ctx, "memory-trylock")
+	if err := first.Extend(ctx, "memory-trylock"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Extend() after release error = %v, want ErrLockLost", err)
+	}
+}
+
+func TestMemoryLocker_Reentrant(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	defer l.Close()
+	other := NewMemoryLocker()
+	defer other.Close()
+
+	err := l.WithLock(ctx, "memory-reentrant", 1, func() error {
+		// Nested use of the same name on the same locker must not deadlock
+		return l.WithLock(ctx, "memory-reentrant", 1, func() error {
+			if acquired, _ := other.TryLock(ctx, "memory-reentrant"); acquired {
+				t.Error("other.TryLock() = true inside nested WithLock(), want false")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("nested WithLock() error = %v, want nil", err)
+	}
+
+	// Both references are gone, so another locker can take the lock
+	if acquired, _ := other.TryLock(ctx, "memory-reentrant"); !acquired {
+		t.Error("lock was not freed after the outer WithLock() returned")
+	}
+}
+
+func TestMemoryLocker_ReentrantReleaseCount(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	defer l.Close()
+	other := NewMemoryLocker()
+	defer other.Close()
+
+	l.TryLock(ctx, "memory-refcount")
+	l.TryLock(ctx, "memory-refcount")
+
+	l.ReleaseLock(ctx, "memory-refcount")
+	if acquired, _ := other.TryLock(ctx, "memory-refcount"); acquired {
+		t.Fatal("lock was freed while a reference was still held")
+	}
+
+	l.ReleaseLock(ctx, "memory-refcount")
+	if acquired, _ := other.TryLock(ctx, "memory-refcount"); !acquired {
+		t.Error("lock was not freed after the last release")
+	}
+}
+
+func TestMemoryLocker_TimeoutWithFakeClock(t *testing.T) {
+	ctx := context.Background()
+	holder := NewMemoryLocker()
+	if ok, err := holder.AcquireLock(ctx, "fake-clock-lock", 1); !ok || err != nil {
+		t.Fatalf("AcquireLock() = %v, %v", ok, err)
+	}
+	defer holder.ReleaseLock(ctx, "fake-clock-lock")
+
+	fake := clock.NewFake(time.Now())
+	waiter := NewMemoryLocker()
+	waiter.SetClock(fake)
+
+	done := make(chan bool, 1)
+	go func() {
+		ok, _ := waiter.AcquireLock(ctx, "fake-clock-lock", 3600)
+		done <- ok
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Hour)
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("AcquireLock() = true while the lock is held, want false")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcquireLock() did not time out when the fake clock passed the timeout")
+	}
+}
+
+func TestMemoryLocker_AcquireMany(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	other := NewMemoryLocker()
+	names := []string{"many-c", "many-a", "many-b", "many-a"}
+
+	if ok, err := l.AcquireMany(ctx, names, 1); !ok || err != nil {
+		t.Fatalf("AcquireMany() = %v, %v, want true", ok, err)
+	}
+	for _, name := range []string{"many-a", "many-b", "many-c"} {
+		if ok, _ := other.TryLock(ctx, name); ok {
+			t.Errorf("TryLock(%q) = true after AcquireMany", name)
+		}
+	}
+
+	if err := l.ReleaseMany(ctx, names); err != nil {
+		t.Fatalf("ReleaseMany() error = %v", err)
+	}
+	for _, name := range []string{"many-a", "many-b", "many-c"} {
+		if ok, _ := other.TryLock(ctx, name); !ok {
+			t.Errorf("TryLock(%q) = false after ReleaseMany", name)
+		}
+	}
+	if err := other.ReleaseMany(ctx, names); err != nil {
+		t.Fatalf("ReleaseMany() error = %v", err)
+	}
+	if err := other.ReleaseMany(ctx, names); err == nil {
+		t.Error("ReleaseMany() of locks not held succeeded")
+	}
+}
+
+func TestMemoryLocker_AcquireManyRollsBack(t *testing.T) {
+	ctx := context.Background()
+	holder := NewMemoryLocker()
+	if ok, err := holder.AcquireLock(ctx, "rollback-b", 1); !ok || err != nil {
+		t.Fatalf("AcquireLock() = %v, %v", ok, err)
+	}
+	defer holder.ReleaseLock(ctx, "rollback-b")
+
+	fake := clock.NewFake(time.Now())
+	waiter := NewMemoryLocker()
+	waiter.SetClock(fake)
+
+	done := make(chan bool, 1)
+	go func() {
+		ok, _ := waiter.AcquireMany(ctx, []string{"rollback-c", "rollback-a", "rollback-b"}, 60)
+		done <- ok
+	}()
+
+	// rollback-a is taken first, then the wait for rollback-b times out
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("AcquireMany() = true while one lock is held elsewhere")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcquireMany() did not time out")
+	}
+
+	other := NewMemoryLocker()
+	defer other.Close()
+	for _, name := range []string{"rollback-a", "rollback-c"} {
+		if ok, _ := other.TryLock(ctx, name); !ok {
+			t.Errorf("TryLock(%q) = false, want the failed AcquireMany to have released it", name)
+		}
+	}
+}
+
+func TestWithLockRenew(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	renewFailure := errors.New("renewal failed")
+	var renewals int
+	var lost []error
+	opts := RenewOptions{
+		Interval: time.Minute,
+		Renew: func(ctx context.Context, lockName string) error {
+			renewals++
+			if renewals == 2 {
+				return renewFailure
+			}
+			return nil
+		},
+		OnLost: func(err error) { lost = append(lost, err) },
+		Clock:  fake,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WithLockRenew(context.Background(), NewMemoryLocker(), "renew-lock", 1, opts, func(ctx context.Context) error {
+			<-ctx.Done()
+			if !errors.Is(context.Cause(ctx), ErrLockLost) {
+				t.Errorf("work context cause = %v, want ErrLockLost", context.Cause(ctx))
+			}
+			return ctx.Err()
+		})
+	}()
+
+	for i := 0; i < 2; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(time.Minute)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrLockLost) || !errors.Is(err, renewFailure) {
+			t.Errorf("WithLockRenew() error = %v, want ErrLockLost wrapping the renewal error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WithLockRenew() did not stop after a failed renewal")
+	}
+	if renewals != 2 || len(lost) != 1 || !errors.Is(lost[0], renewFailure) {
+		t.Errorf("renewals = %d, OnLost calls = %v, want 2 renewals and one call with the failure", renewals, lost)
+	}
+
+	// The lock is released afterwards
+	other := NewMemoryLocker()
+	defer other.Close()
+	if ok, _ := other.TryLock(context.Background(), "renew-lock"); !ok {
+		t.Error("TryLock() = false after WithLockRenew returned")
+	}
+}
+
+func TestMemoryLocker_LockNamePolicy(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	defer l.Close()
+
+	if _, err := l.AcquireLock(ctx, "job: nightly backup", 1); err == nil {
+		t.Fatal("AcquireLock() accepted a name with spaces by default")
+	}
+
+	l.SetLockNamePolicy(LockNamesAny)
+	if ok, err := l.AcquireLock(ctx, "job: nightly backup", 1); !ok || err != nil {
+		t.Fatalf("AcquireLock() = %v, %v with LockNamesAny", ok, err)
+	}
+	if ok, err := l.AcquireMany(ctx, []string{"a b", "c:d"}, 1); !ok || err != nil {
+		t.Fatalf("AcquireMany() = %v, %v with LockNamesAny", ok, err)
+	}
+	if err := l.ReleaseMany(ctx, []string{"a b", "c:d"}); err != nil {
+		t.Fatalf("ReleaseMany() error = %v", err)
+	}
+
+	l.SetLockNamePolicy(LockNamesUnicode)
+	if _, err := l.AcquireLock(ctx, "job: nightly backup", 1); err == nil {
+		t.Error("AcquireLock() accepted a name with spaces with LockNamesUnicode")
+	}
+	if ok, err := l.AcquireLock(ctx, "日次バッチ", 1); !ok || err != nil {
+		t.Errorf("AcquireLock() = %v, %v with LockNamesUnicode", ok, err)
+	}
+}
+
+func TestMemoryLocker_AcquireAny(t *testing.T) {
+	ctx := context.Background()
+	holder := NewMemoryLocker()
+	defer holder.Close()
+	if ok, err := holder.TryLock(ctx, "slot-0"); !ok || err != nil {
+		t.Fatalf("TryLock() = %v, %v", ok, err)
+	}
+
+	worker := NewMemoryLocker()
+	defer worker.Close()
+	names := []string{"slot-0", "slot-1", "slot-2"}
+	if got, err := worker.AcquireAny(ctx, names, 1); got != "slot-1" || err != nil {
+		t.Fatalf("AcquireAny() = %q, %v, want slot-1", got, err)
+	}
+	if ok, err := holder.TryLock(ctx, "slot-2"); !ok || err != nil {
+		t.Fatalf("TryLock(slot-2) = %v, %v, want the other slots left free", ok, err)
+	}
+
+	// With every slot held, the next worker waits for one to be released
+	fake := clock.NewFake(time.Now())
+	waiter := NewMemoryLocker()
+	defer waiter.Close()
+	waiter.SetClock(fake)
+	done := make(chan string, 1)
+	go func() {
+		got, _ := waiter.AcquireAny(ctx, names, 60)
+		done <- got
+	}()
+	fake.BlockUntil(2)
+	worker.ReleaseLock(ctx, "slot-1")
+	fake.Advance(claimPollInterval)
+	if got := <-done; got != "slot-1" {
+		t.Errorf("AcquireAny() = %q after slot-1 was released, want slot-1", got)
+	}
+
+	go func() {
+		got, _ := NewMemoryLocker().AcquireAny(ctx, names, 1)
+		done <- got
+	}()
+	if got := <-done; got != "" {
+		t.Errorf("AcquireAny() = %q with every slot held, want none", got)
+	}
+}
@@ -0,0 +1,51 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// LockHolder returns the connection id of the session holding the lock, or
+// 0 if it is free
+func (l *Locker) LockHolder(ctx context.Context, lockName string) (int64, error) {
+	if err := l.checkName(lockName); err != nil {
+		return 0, err
+	}
+	holder, err := l.queryInt(ctx, "SELECT IS_USED_LOCK(?)", lockName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check lock holder: %w", err)
+	}
+	return holder.Int64, nil
+}
+
+// SessionRunID returns the mylock_run_id connection attribute of a server
+// session, or an empty string if the session is gone or was not opened by a
+// mylock run. It needs performance_schema.
+func (l *Locker) SessionRunID(ctx context.Context, connID int64) (string, error) {
+	var runID string
+	err := l.queryRow(ctx, "SELECT ATTR_VALUE FROM performance_schema.session_connect_attrs WHERE PROCESSLIST_ID = ? AND ATTR_NAME = 'mylock_run_id'", connID).Scan(&runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the run of session %d: %w", connID, err)
+	}
+	return runID, nil
+}
+
+// SessionOwner describes a server session as user@host from the
+// processlist. It returns an empty string if the session is gone, or is
+// not visible without the PROCESS privilege.
+func (l *Locker) SessionOwner(ctx context.Context, connID int64) (string, error) {
+	var user, host sql.NullString
+	err := l.queryRow(ctx, "SELECT USER, HOST FROM information_schema.PROCESSLIST WHERE ID = ?", connID).Scan(&user, &host)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up session %d: %w", connID, err)
+	}
+	return user.String + "@" + host.String, nil
+}
@@ -0,0 +1,117 @@
+package locker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+// preemptWait is how long each GET_LOCK waits before the holder of a
+// preempted lock is looked at again
+const preemptWait = 1
+
+// StartedAtAttribute is the connection attribute a preempting run records
+// its start in, as Unix nanoseconds. It goes with every session the run
+// opens, so the order of runs survives reconnects and failovers.
+const StartedAtAttribute = "mylock_started_at"
+
+// holderStartQuery reads the StartedAtAttribute of a session, or NULL if it
+// has none
+const holderStartQuery = "SELECT (SELECT CAST(ATTR_VALUE AS SIGNED) FROM performance_schema.session_connect_attrs WHERE PROCESSLIST_ID = ? AND ATTR_NAME = '" + StartedAtAttribute + "')"
+
+// ErrSuperseded means a newer run holds the lock, so this one gave up
+// instead of preempting it, or took the lock over from this one
+var ErrSuperseded = errors.New("superseded by a newer run")
+
+// SetPreempt makes AcquireLock take over locks held by runs that started
+// before startedAt, which must also be the StartedAtAttribute of the
+// session: their session is killed, which frees the lock and makes them see
+// it as lost. A lock held by a run that started later fails with
+// ErrSuperseded, as does losing the lock to one. A holder without the
+// attribute is not a preempting run and is taken over. Reading the
+// attribute needs performance_schema; killing another session needs the
+// same MySQL user, or the CONNECTION_ADMIN privilege. A zero startedAt
+// turns preemption off.
+func (l *Locker) SetPreempt(startedAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.preemptStart = startedAt
+}
+
+// preemptLock acquires the lock within timeout seconds, killing the session
+// of any older holder on the way
+func (l *Locker) preemptLock(ctx context.Context, lockName string, timeout int) (bool, error) {
+	clk := clock.OrReal(l.clock)
+	deadline := clk.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		holder, err := l.queryInt(ctx, "SELECT IS_USED_LOCK(?)", lockName)
+		if err != nil {
+			return false, fmt.Errorf("failed to check lock holder: %w", err)
+		}
+		if holder.Valid && holder.Int64 != l.ConnectionID() {
+			started, err := l.queryInt(ctx, holderStartQuery, holder.Int64)
+			if err != nil {
+				return false, fmt.Errorf("failed to look up when the run holding the lock started: %w", err)
+			}
+			if l.isNewer(started) {
+				return false, fmt.Errorf("%w (connection id %d holds '%s')", ErrSuperseded, holder.Int64, lockName)
+			}
+			logging.Printf("Cancelling the run holding lock '%s' (connection id %d)\n", lockName, holder.Int64)
+			// holder is an integer read from the server, so formatting it into the statement is safe
+			if err := l.exec(ctx, fmt.Sprintf("KILL %d", holder.Int64)); err != nil {
+				return false, fmt.Errorf("failed to cancel the run holding the lock: %w", err)
+			}
+		}
+
+		acquired, err := l.getLock(ctx, lockName, preemptWait)
+		if err != nil || acquired {
+			return acquired, err
+		}
+		if !clk.Now().Before(deadline) {
+			return false, nil
+		}
+	}
+}
+
+// isNewer reports whether a run that started at started, in Unix
+// nanoseconds, started after this one; a tie counts as newer, so only one
+// of the two preempts
+func (l *Locker) isNewer(started sql.NullInt64) bool {
+	l.mu.Lock()
+	own := l.preemptStart
+	l.mu.Unlock()
+	return started.Valid && started.Int64 >= own.UnixNano()
+}
+
+// preempting reports whether SetPreempt turned preemption on
+func (l *Locker) preempting() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.preemptStart.IsZero()
+}
+
+// supersededBy returns an error wrapping ErrSuperseded if a newer run holds
+// lockName, after this session lost it. It asks on a new session, since the
+// lock session was most likely killed, and returns nil when it cannot tell.
+func (l *Locker) supersededBy(ctx context.Context, lockName string) error {
+	db := l.db
+	if l.connector != nil {
+		// The pool's only connection is the lost session
+		db = sql.OpenDB(l.connector)
+		defer db.Close()
+	}
+	var holder sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?)", lockName).Scan(&holder); err != nil || !holder.Valid || holder.Int64 == l.ConnectionID() {
+		return nil
+	}
+	var started sql.NullInt64
+	if err := db.QueryRowContext(ctx, holderStartQuery, holder.Int64).Scan(&started); err != nil || !l.isNewer(started) {
+		return nil
+	}
+	return fmt.Errorf("%w (connection id %d took '%s' over)", ErrSuperseded, holder.Int64, lockName)
+}
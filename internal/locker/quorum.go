@@ -0,0 +1,272 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// QuorumLocker holds a lock only while a majority (or another quorum) of
+// its backends hold it, so no single server is the source of truth.
+//
+// Backends are always tried in the order given. Every QuorumLocker sharing
+// the same servers must list them in the same order, so that two of them
+// never wait on each other's partial majorities.
+type QuorumLocker struct {
+	backends []Backend
+	quorum   int
+	// names is the policy for accepted lock names
+	names LockNamePolicy
+
+	mu sync.Mutex
+	// held records which backends hold each lock, and how many times the
+	// lock has been taken through this QuorumLocker
+	held map[string]*quorumHold
+}
+
+type quorumHold struct {
+	backends []Backend
+	count    int
+}
+
+// Majority is the quorum for n backends
+func Majority(n int) int {
+	return n/2 + 1
+}
+
+// NewQuorumLocker returns a Backend that needs quorum of backends to hold
+// a lock. backends may omit servers that could not be reached, as long as
+// enough remain to reach the quorum.
+func NewQuorumLocker(backends []Backend, quorum int) (*QuorumLocker, error) {
+	if quorum <= 0 {
+		return nil, errors.New("quorum must be positive")
+	}
+	if len(backends) < quorum {
+		return nil, fmt.Errorf("only %d backends available, %d needed for a quorum", len(backends), quorum)
+	}
+	return &QuorumLocker{
+		backends: backends,
+		quorum:   quorum,
+		held:     make(map[string]*quorumHold),
+	}, nil
+}
+
+// SetLockNamePolicy changes the lock names accepted, here and on every
+// backend; call it before taking any lock
+func (q *QuorumLocker) SetLockNamePolicy(p LockNamePolicy) {
+	q.names = p
+	for _, b := range q.backends {
+		if s, ok := b.(interface{ SetLockNamePolicy(LockNamePolicy) }); ok {
+			s.SetLockNamePolicy(p)
+		}
+	}
+}
+
+func (q *QuorumLocker) checkName(lockName string) error {
+	return q.names.Validate(lockName)
+}
+
+// AcquireLock takes the lock on backends in order until the quorum holds
+// it, sharing timeout between them. If the quorum cannot be reached, the
+// partial locks are released again.
+func (q *QuorumLocker) AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error) {
+	if err := q.checkName(lockName); err != nil {
+		return false, err
+	}
+	if timeout <= 0 {
+		return false, errors.New("timeout must be positive")
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	return q.acquire(ctx, lockName, func(b Backend) (bool, error) {
+		remaining := int(time.Until(deadline).Round(time.Second) / time.Second)
+		if remaining <= 0 {
+			return b.TryLock(ctx, lockName)
+		}
+		return b.AcquireLock(ctx, lockName, remaining)
+	})
+}
+
+// TryLock takes the lock only if the quorum can be reached without waiting
+func (q *QuorumLocker) TryLock(ctx context.Context, lockName string) (bool, error) {
+	if err := q.checkName(lockName); err != nil {
+		return false, err
+	}
+	return q.acquire(ctx, lockName, func(b Backend) (bool, error) {
+		return b.TryLock(ctx, lockName)
+	})
+}
+
+func (q *QuorumLocker) acquire(ctx context.Context, lockName string, lock func(Backend) (bool, error)) (bool, error) {
+	q.mu.Lock()
+	if h, ok := q.held[lockName]; ok {
+		h.count++
+		q.mu.Unlock()
+		return true, nil
+	}
+	q.mu.Unlock()
+
+	var holders []Backend
+	var errs []error
+	for i, b := range q.backends {
+		// Stop once the remaining backends can no longer make a quorum
+		if len(holders)+len(q.backends)-i < q.quorum {
+			break
+		}
+		acquired, err := lock(b)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if acquired {
+			holders = append(holders, b)
+			if len(holders) == q.quorum {
+				break
+			}
+		}
+	}
+
+	if len(holders) < q.quorum {
+		q.releaseAll(holders, lockName)
+		// Failing backends rather than contention kept the quorum out of reach
+		if len(errs) > len(q.backends)-q.quorum {
+			return false, fmt.Errorf("failed to reach a quorum of %d: %w", q.quorum, errors.Join(errs...))
+		}
+		return false, nil
+	}
+
+	q.mu.Lock()
+	q.held[lockName] = &quorumHold{backends: holders, count: 1}
+	q.mu.Unlock()
+	return true, nil
+}
+
+// Extend checks every backend holding the lock and reports ErrLockLost once
+// fewer than the quorum still hold it
+func (q *QuorumLocker) Extend(ctx context.Context, lockName string) error {
+	if err := q.checkName(lockName); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	h, ok := q.held[lockName]
+	var holders []Backend
+	if ok {
+		holders = append(holders, h.backends...)
+	}
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: lock is not held", ErrLockLost)
+	}
+
+	var alive []Backend
+	var errs []error
+	for _, b := range holders {
+		if err := b.Extend(ctx, lockName); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		alive = append(alive, b)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(alive) < q.quorum {
+		return fmt.Errorf("%w: only %d of %d needed backends still hold the lock: %v", ErrLockLost, len(alive), q.quorum, errors.Join(errs...))
+	}
+	if h, ok := q.held[lockName]; ok {
+		h.backends = alive
+	}
+	return nil
+}
+
+// ReleaseLock releases the lock on every backend holding it once the last
+// nested acquisition is released
+func (q *QuorumLocker) ReleaseLock(ctx context.Context, lockName string) (bool, error) {
+	if err := q.checkName(lockName); err != nil {
+		return false, err
+	}
+
+	q.mu.Lock()
+	h, ok := q.held[lockName]
+	if !ok {
+		q.mu.Unlock()
+		return false, nil
+	}
+	if h.count > 1 {
+		h.count--
+		q.mu.Unlock()
+		return true, nil
+	}
+	delete(q.held, lockName)
+	q.mu.Unlock()
+
+	return q.releaseAll(h.backends, lockName)
+}
+
+// releaseAll releases lockName on backends, reporting whether any of them
+// held it
+func (q *QuorumLocker) releaseAll(backends []Backend, lockName string) (bool, error) {
+	released := false
+	var errs []error
+	for _, b := range backends {
+		ok, err := b.ReleaseLock(context.Background(), lockName)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		released = released || ok
+	}
+	return released, errors.Join(errs...)
+}
+
+func (q *QuorumLocker) WithLock(ctx context.Context, lockName string, timeout int, fn func() error) error {
+	return withLock(ctx, q, lockName, timeout, fn)
+}
+
+// WithLockCtx is like WithLock, but fn receives a context that is cancelled
+// with ErrLockLost as its cause once fewer than the quorum hold the lock
+func (q *QuorumLocker) WithLockCtx(ctx context.Context, lockName string, timeout int, fn func(context.Context) error) error {
+	return withLockCtx(ctx, q, lockName, timeout, fn, q.watchLock)
+}
+
+func (q *QuorumLocker) watchLock(stop <-chan struct{}, lockName string) error {
+	ticker := time.NewTicker(DefaultLockCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), lockCheckTimeout)
+		err := q.Extend(ctx, lockName)
+		cancel()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+	}
+}
+
+// ConnectionID is the session id on the first backend
+func (q *QuorumLocker) ConnectionID() int64 {
+	return q.backends[0].ConnectionID()
+}
+
+// Close closes every backend, which also frees any lock still held
+func (q *QuorumLocker) Close() error {
+	var errs []error
+	for _, b := range q.backends {
+		if err := b.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
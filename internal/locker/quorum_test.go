@@ -0,0 +1,183 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeServer is a lock server shared by the fakeSessions connected to it
+type fakeServer struct {
+	mu     sync.Mutex
+	owners map[string]*fakeSession
+	down   bool
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{owners: make(map[string]*fakeSession)}
+}
+
+// fakeSession is a Backend that never waits: a lock held elsewhere is
+// reported as not acquired straight away
+type fakeSession struct {
+	server *fakeServer
+}
+
+func (s *fakeSession) AcquireLock(ctx context.Context, lockName string, timeout int) (bool, error) {
+	return s.TryLock(ctx, lockName)
+}
+
+func (s *fakeSession) TryLock(ctx context.Context, lockName string) (bool, error) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	if s.server.down {
+		return false, errors.New("server is down")
+	}
+	if owner, ok := s.server.owners[lockName]; ok && owner != s {
+		return false, nil
+	}
+	s.server.owners[lockName] = s
+	return true, nil
+}
+
+func (s *fakeSession) Extend(ctx context.Context, lockName string) error {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	if s.server.down || s.server.owners[lockName] != s {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (s *fakeSession) ReleaseLock(ctx context.Context, lockName string) (bool, error) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	if s.server.owners[lockName] != s {
+		return false, nil
+	}
+	delete(s.server.owners, lockName)
+	return true, nil
+}
+
+func (s *fakeSession) WithLock(ctx context.Context, lockName string, timeout int, fn func() error) error {
+	return withLock(ctx, s, lockName, timeout, fn)
+}
+
+func (s *fakeSession) WithLockCtx(ctx context.Context, lockName string, timeout int, fn func(context.Context) error) error {
+	return withLockCtx(ctx, s, lockName, timeout, fn, nil)
+}
+
+func (s *fakeSession) ConnectionID() int64 { return 1 }
+func (s *fakeSession) Close() error        { return nil }
+
+func newQuorum(t *testing.T, servers []*fakeServer) *QuorumLocker {
+	t.Helper()
+	var backends []Backend
+	for _, server := range servers {
+		backends = append(backends, &fakeSession{server: server})
+	}
+	q, err := NewQuorumLocker(backends, Majority(len(servers)))
+	if err != nil {
+		t.Fatalf("NewQuorumLocker() error = %v", err)
+	}
+	return q
+}
+
+func TestMajority(t *testing.T) {
+	for n, want := range map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 3} {
+		if got := Majority(n); got != want {
+			t.Errorf("Majority(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestNewQuorumLocker(t *testing.T) {
+	if _, err := NewQuorumLocker([]Backend{&fakeSession{server: newFakeServer()}}, 2); err == nil {
+		t.Error("NewQuorumLocker() with fewer backends than the quorum should fail")
+	}
+	if _, err := NewQuorumLocker(nil, 0); err == nil {
+		t.Error("NewQuorumLocker() with zero quorum should fail")
+	}
+}
+
+func TestQuorumLocker_MutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	servers := []*fakeServer{newFakeServer(), newFakeServer(), newFakeServer()}
+	first := newQuorum(t, servers)
+	second := newQuorum(t, servers)
+
+	if acquired, err := first.AcquireLock(ctx, "quorum-lock", 1); err != nil || !acquired {
+		t.Fatalf("first.AcquireLock() = (%v, %v), want (true, nil)", acquired, err)
+	}
+	if acquired, err := second.AcquireLock(ctx, "quorum-lock", 1); err != nil || acquired {
+		t.Fatalf("second.AcquireLock() = (%v, %v), want (false, nil)", acquired, err)
+	}
+
+	// The failed attempt must not leave partial locks behind
+	for i, server := range servers {
+		if owner := server.owners["quorum-lock"]; owner == second.backends[i] {
+			t.Errorf("server %d is still locked by the losing locker", i)
+		}
+	}
+
+	if released, err := first.ReleaseLock(ctx, "quorum-lock"); err != nil || !released {
+		t.Fatalf("first.ReleaseLock() = (%v, %v), want (true, nil)", released, err)
+	}
+	if acquired, _ := second.TryLock(ctx, "quorum-lock"); !acquired {
+		t.Error("second.TryLock() after release = false, want true")
+	}
+}
+
+func TestQuorumLocker_ToleratesMinorityFailure(t *testing.T) {
+	ctx := context.Background()
+	servers := []*fakeServer{newFakeServer(), newFakeServer(), newFakeServer()}
+	servers[0].down = true
+	q := newQuorum(t, servers)
+
+	if acquired, err := q.AcquireLock(ctx, "quorum-lock", 1); err != nil || !acquired {
+		t.Fatalf("AcquireLock() with one server down = (%v, %v), want (true, nil)", acquired, err)
+	}
+	if err := q.Extend(ctx, "quorum-lock"); err != nil {
+		t.Errorf("Extend() error = %v, want nil", err)
+	}
+
+	// Losing a second server drops below the quorum
+	servers[1].down = true
+	if err := q.Extend(ctx, "quorum-lock"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Extend() with two servers down error = %v, want ErrLockLost", err)
+	}
+	q.ReleaseLock(ctx, "quorum-lock")
+}
+
+func TestQuorumLocker_MajorityDown(t *testing.T) {
+	servers := []*fakeServer{newFakeServer(), newFakeServer(), newFakeServer()}
+	servers[0].down = true
+	servers[2].down = true
+	q := newQuorum(t, servers)
+
+	acquired, err := q.AcquireLock(context.Background(), "quorum-lock", 1)
+	if err == nil || acquired {
+		t.Errorf("AcquireLock() with two servers down = (%v, %v), want (false, error)", acquired, err)
+	}
+	if len(servers[1].owners) != 0 {
+		t.Error("partial lock on the healthy server was not released")
+	}
+}
+
+func TestQuorumLocker_Reentrant(t *testing.T) {
+	ctx := context.Background()
+	servers := []*fakeServer{newFakeServer(), newFakeServer(), newFakeServer()}
+	q := newQuorum(t, servers)
+	other := newQuorum(t, servers)
+
+	err := q.WithLock(ctx, "quorum-lock", 1, func() error {
+		return q.WithLock(ctx, "quorum-lock", 1, func() error { return nil })
+	})
+	if err != nil {
+		t.Fatalf("nested WithLock() error = %v, want nil", err)
+	}
+	if acquired, _ := other.TryLock(ctx, "quorum-lock"); !acquired {
+		t.Error("lock was not freed after the outer WithLock() returned")
+	}
+}
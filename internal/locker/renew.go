@@ -0,0 +1,68 @@
+package locker
+
+import (
+	"context"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+// RenewOptions configures WithLockRenew
+type RenewOptions struct {
+	// Interval is the time between renewals; DefaultLockCheckInterval when
+	// zero
+	Interval time.Duration
+	// Renew keeps the lock alive and returns an error if it is no longer
+	// held. nil uses the backend's Extend.
+	Renew func(ctx context.Context, lockName string) error
+	// OnLost is called with the renewal error, before the work context is
+	// cancelled
+	OnLost func(lost error)
+	// Clock times the renewals; nil uses the system clock
+	Clock clock.Clock
+}
+
+// WithLockRenew acquires the lock on b and runs fn while renewing the lock
+// every opts.Interval. When a renewal fails, opts.OnLost is called and fn's
+// context is cancelled with a cause matching ErrLockLost, which is also
+// returned.
+func WithLockRenew(ctx context.Context, b Backend, lockName string, timeout int, opts RenewOptions, fn func(context.Context) error) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultLockCheckInterval
+	}
+	renew := opts.Renew
+	if renew == nil {
+		renew = b.Extend
+	}
+
+	watch := func(stop <-chan struct{}, lockName string) error {
+		ticker := clock.OrReal(opts.Clock).NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-ticker.C():
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), lockCheckTimeout)
+			err := renew(ctx, lockName)
+			cancel()
+			if err != nil {
+				select {
+				case <-stop:
+					return nil
+				default:
+					return err
+				}
+			}
+		}
+	}
+	onLost := func(ctx context.Context, lost error) error {
+		if opts.OnLost != nil {
+			opts.OnLost(lost)
+		}
+		return lost
+	}
+	return withLockCtxOnLost(ctx, b, lockName, timeout, fn, watch, onLost)
+}
@@ -0,0 +1,198 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+// errNoSuchTable is ER_NO_SUCH_TABLE
+const errNoSuchTable = 1146
+
+// Snapshot is the mylock-relevant state of a server at one moment
+type Snapshot struct {
+	Time    time.Time
+	Version string
+	// Held lists the user locks currently granted, by any client
+	Held []HeldLock
+	// Waiting lists the sessions blocked in GET_LOCK
+	Waiting []LockWaiter
+	// Dedupe lists the mylock_dedupe rows, empty if the table does not exist
+	Dedupe []DedupeRecord
+	// Errors lists the parts that could not be read, e.g. for lack of a
+	// privilege; the rest of the snapshot is still filled in
+	Errors []string
+}
+
+// HeldLock is a granted user lock
+type HeldLock struct {
+	Name         string
+	ConnectionID int64
+	// Owner is user@host of the holding session, or empty if not visible
+	Owner string
+}
+
+// LockWaiter is a session waiting in GET_LOCK. LockName, Host and Run come
+// from the SQL comment mylock puts on its lock queries, and are empty for
+// other clients.
+type LockWaiter struct {
+	ConnectionID int64
+	Owner        string
+	Waited       time.Duration
+	LockName     string
+	Host         string
+	Run          string
+}
+
+// DedupeRecord is a command's last success recorded by --dedupe-window
+type DedupeRecord struct {
+	CommandHash string
+	Age         time.Duration
+}
+
+// Snapshot reads the held user locks, the GET_LOCK waiters and the dedupe
+// records. Seeing other sessions needs the PROCESS privilege; held locks
+// come from performance_schema on MySQL and from the METADATA_LOCK_INFO
+// plugin on MariaDB.
+func (l *Locker) Snapshot(ctx context.Context) Snapshot {
+	s := Snapshot{Time: clock.OrReal(l.clock).Now().UTC()}
+	if l.version != nil {
+		s.Version = l.version.Raw
+	}
+
+	var err error
+	if s.Held, err = l.heldLocks(ctx); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Waiting, err = l.lockWaiters(ctx); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	if s.Dedupe, err = l.dedupeRecords(ctx); err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+	return s
+}
+
+func (l *Locker) heldLocks(ctx context.Context) ([]HeldLock, error) {
+	query := "SELECT m.OBJECT_NAME, t.PROCESSLIST_ID, COALESCE(t.PROCESSLIST_USER, ''), COALESCE(t.PROCESSLIST_HOST, '') " +
+		"FROM performance_schema.metadata_locks m JOIN performance_schema.threads t ON t.THREAD_ID = m.OWNER_THREAD_ID " +
+		"WHERE m.OBJECT_TYPE = 'USER LEVEL LOCK' AND m.LOCK_STATUS = 'GRANTED' ORDER BY m.OBJECT_NAME"
+	source := "performance_schema.metadata_locks"
+	if l.version != nil && l.version.MariaDB {
+		// MariaDB keeps a user lock's name in TABLE_SCHEMA
+		query = "SELECT m.TABLE_SCHEMA, m.THREAD_ID, COALESCE(p.USER, ''), COALESCE(p.HOST, '') " +
+			"FROM information_schema.METADATA_LOCK_INFO m LEFT JOIN information_schema.PROCESSLIST p ON p.ID = m.THREAD_ID " +
+			"WHERE m.LOCK_TYPE = 'User lock' ORDER BY m.TABLE_SCHEMA"
+		source = "information_schema.METADATA_LOCK_INFO (INSTALL SONAME 'metadata_lock_info')"
+	}
+
+	rows, err := l.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read held locks from %s: %w", source, err)
+	}
+	defer rows.Close()
+	var held []HeldLock
+	for rows.Next() {
+		var lock HeldLock
+		var user, host string
+		if err := rows.Scan(&lock.Name, &lock.ConnectionID, &user, &host); err != nil {
+			return held, fmt.Errorf("failed to read held locks: %w", err)
+		}
+		lock.Owner = owner(user, host)
+		held = append(held, lock)
+	}
+	if err := rows.Err(); err != nil {
+		return held, fmt.Errorf("failed to read held locks: %w", err)
+	}
+	return held, nil
+}
+
+func (l *Locker) lockWaiters(ctx context.Context) ([]LockWaiter, error) {
+	rows, err := l.query(ctx, "SELECT ID, COALESCE(USER, ''), COALESCE(HOST, ''), TIME, INFO FROM information_schema.PROCESSLIST "+
+		"WHERE INFO LIKE '%GET\\_LOCK(%' AND ID <> CONNECTION_ID() ORDER BY TIME DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock waiters: %w", err)
+	}
+	defer rows.Close()
+	var waiting []LockWaiter
+	for rows.Next() {
+		var w LockWaiter
+		var user, host, info string
+		var seconds int64
+		if err := rows.Scan(&w.ConnectionID, &user, &host, &seconds, &info); err != nil {
+			return waiting, fmt.Errorf("failed to read lock waiters: %w", err)
+		}
+		w.Owner = owner(user, host)
+		w.Waited = time.Duration(seconds) * time.Second
+		w.LockName, w.Host, w.Run, _ = parseQueryComment(info)
+		waiting = append(waiting, w)
+	}
+	if err := rows.Err(); err != nil {
+		return waiting, fmt.Errorf("failed to read lock waiters: %w", err)
+	}
+	return waiting, nil
+}
+
+func (l *Locker) dedupeRecords(ctx context.Context) ([]DedupeRecord, error) {
+	rows, err := l.query(ctx, "SELECT command_hash, TIMESTAMPDIFF(MICROSECOND, succeeded_at, UTC_TIMESTAMP(6)) FROM "+dedupeTable+
+		" ORDER BY succeeded_at DESC")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoSuchTable {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dedupeTable, err)
+	}
+	defer rows.Close()
+	var records []DedupeRecord
+	for rows.Next() {
+		var r DedupeRecord
+		var micros int64
+		if err := rows.Scan(&r.CommandHash, &micros); err != nil {
+			return records, fmt.Errorf("failed to read %s: %w", dedupeTable, err)
+		}
+		r.Age = time.Duration(micros) * time.Microsecond
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return records, fmt.Errorf("failed to read %s: %w", dedupeTable, err)
+	}
+	return records, nil
+}
+
+func owner(user, host string) string {
+	if user == "" {
+		return ""
+	}
+	return user + "@" + host
+}
+
+// parseQueryComment reads back the comment lockQuery puts on a query. ok is
+// false if the query has none.
+func parseQueryComment(query string) (name, host, run string, ok bool) {
+	rest, found := strings.CutPrefix(query, "/* mylock ")
+	if !found {
+		return "", "", "", false
+	}
+	end := strings.Index(rest, " */")
+	if end < 0 {
+		return "", "", "", false
+	}
+	for _, field := range strings.Fields(rest[:end]) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "name":
+			name = value
+		case "host":
+			host = value
+		case "run":
+			run = value
+		}
+	}
+	return name, host, run, true
+}
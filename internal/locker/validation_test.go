@@ -105,13 +105,13 @@ func TestValidateLockName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateLockName(tt.lockName)
+			err := ValidateLockName(tt.lockName)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("validateLockName() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ValidateLockName() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if err != nil && tt.errMsg != "" && !strings.Contains(err.Error(), tt.errMsg) {
-				t.Errorf("validateLockName() error message = %v, want to contain %v", err.Error(), tt.errMsg)
+				t.Errorf("ValidateLockName() error message = %v, want to contain %v", err.Error(), tt.errMsg)
 			}
 		})
 	}
@@ -136,10 +136,101 @@ func TestLockNamePatternSecurity(t *testing.T) {
 
 	for _, name := range dangerousNames {
 		t.Run("dangerous: "+name, func(t *testing.T) {
-			err := validateLockName(name)
+			err := ValidateLockName(name)
 			if err == nil {
-				t.Errorf("validateLockName() should reject dangerous name: %q", name)
+				t.Errorf("ValidateLockName() should reject dangerous name: %q", name)
 			}
 		})
 	}
 }
+
+func FuzzValidateLockName(f *testing.F) {
+	seeds := []string{
+		"my-lock",
+		"app.module.lock",
+		"",
+		strings.Repeat("a", 64),
+		strings.Repeat("a", 65),
+		"'; DROP TABLE locks; --",
+		"lock\x00null",
+		"ロック",
+		"lock​name",
+		"app..lock",
+		"lock--name",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, lockName string) {
+		if err := ValidateLockName(lockName); err != nil {
+			return
+		}
+
+		// Anything accepted must be safe to hand to GET_LOCK
+		if lockName == "" || len(lockName) > 64 {
+			t.Fatalf("accepted lock name with invalid length %d: %q", len(lockName), lockName)
+		}
+		for _, r := range lockName {
+			isAllowed := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+				r == '_' || r == '-' || r == '.'
+			if !isAllowed {
+				t.Fatalf("accepted lock name with character %q: %q", r, lockName)
+			}
+		}
+		if strings.Contains(lockName, "..") || strings.Contains(lockName, "--") {
+			t.Fatalf("accepted lock name with consecutive separators: %q", lockName)
+		}
+	})
+}
+
+func TestValidateAnyLockName(t *testing.T) {
+	tests := []struct {
+		lockName string
+		wantErr  bool
+	}{
+		{lockName: "job: nightly backup"},
+		{lockName: "urn:app/tenant 42"},
+		{lockName: "ロック"},
+		{lockName: strings.Repeat("ロ", 64)},
+		{lockName: "", wantErr: true},
+		{lockName: strings.Repeat("a", 65), wantErr: true},
+		{lockName: "bad\xffutf8", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateAnyLockName(tt.lockName); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateAnyLockName(%q) error = %v, wantErr %v", tt.lockName, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateUnicodeLockName(t *testing.T) {
+	composed := "caf\u00e9.nightly"
+	decomposed := "cafe\u0301.nightly"
+	tests := []struct {
+		lockName string
+		wantErr  bool
+	}{
+		{lockName: "nightly-backup"},
+		{lockName: "日次バッチ.集計"},
+		{lockName: composed},
+		{lockName: decomposed, wantErr: true},
+		{lockName: strings.Repeat("ロ", 21)},
+		{lockName: strings.Repeat("ロ", 22), wantErr: true},
+		{lockName: "日次 バッチ", wantErr: true},
+		{lockName: "日次..バッチ", wantErr: true},
+		{lockName: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateUnicodeLockName(tt.lockName); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateUnicodeLockName(%q) error = %v, wantErr %v", tt.lockName, err, tt.wantErr)
+		}
+	}
+
+	if got := NormalizeLockName(decomposed); got != composed {
+		t.Errorf("NormalizeLockName(%q) = %q, want %q", decomposed, got, composed)
+	}
+	if err := ValidateUnicodeLockName(NormalizeLockName(decomposed)); err != nil {
+		t.Errorf("normalized name rejected: %v", err)
+	}
+}
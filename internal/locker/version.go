@@ -0,0 +1,71 @@
+package locker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ServerVersion is a parsed MySQL/MariaDB VERSION() string
+type ServerVersion struct {
+	Raw     string
+	Major   int
+	Minor   int
+	Patch   int
+	MariaDB bool
+}
+
+// ParseServerVersion parses strings such as "8.0.36", "5.7.44-log" or
+// "10.6.12-MariaDB-1:10.6.12+maria~ubu2004"
+func ParseServerVersion(raw string) (ServerVersion, error) {
+	v := ServerVersion{
+		Raw:     raw,
+		MariaDB: strings.Contains(strings.ToLower(raw), "mariadb"),
+	}
+
+	numbers := raw
+	if i := strings.IndexAny(numbers, "-+~ "); i >= 0 {
+		numbers = numbers[:i]
+	}
+	parts := strings.Split(numbers, ".")
+	if len(parts) < 2 {
+		return v, fmt.Errorf("unrecognized server version %q", raw)
+	}
+
+	fields := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		if i >= len(fields) {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, fmt.Errorf("unrecognized server version %q", raw)
+		}
+		*fields[i] = n
+	}
+	return v, nil
+}
+
+func (v ServerVersion) atLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// SupportsMultipleLocks reports whether one session can hold several
+// GET_LOCK locks at once. Before MySQL 5.7.5 (and MariaDB 10.0.2), calling
+// GET_LOCK silently released any lock the session already held.
+func (v ServerVersion) SupportsMultipleLocks() bool {
+	if v.MariaDB {
+		return v.atLeast(10, 0, 2)
+	}
+	return v.atLeast(5, 7, 5)
+}
+
+func (v ServerVersion) String() string {
+	return v.Raw
+}
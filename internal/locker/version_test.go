@@ -0,0 +1,81 @@
+package locker
+
+import "testing"
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           string
+		want          ServerVersion
+		wantErr       bool
+		wantMultiLock bool
+	}{
+		{
+			name:          "MySQL 8.0",
+			raw:           "8.0.36",
+			want:          ServerVersion{Raw: "8.0.36", Major: 8, Minor: 0, Patch: 36},
+			wantMultiLock: true,
+		},
+		{
+			name:          "MySQL 5.7 with suffix",
+			raw:           "5.7.44-log",
+			want:          ServerVersion{Raw: "5.7.44-log", Major: 5, Minor: 7, Patch: 44},
+			wantMultiLock: true,
+		},
+		{
+			name:          "MySQL 5.7.4 single lock semantics",
+			raw:           "5.7.4-m14",
+			want:          ServerVersion{Raw: "5.7.4-m14", Major: 5, Minor: 7, Patch: 4},
+			wantMultiLock: false,
+		},
+		{
+			name:          "MySQL 5.6",
+			raw:           "5.6.51",
+			want:          ServerVersion{Raw: "5.6.51", Major: 5, Minor: 6, Patch: 51},
+			wantMultiLock: false,
+		},
+		{
+			name:          "MariaDB 10.6",
+			raw:           "10.6.12-MariaDB-1:10.6.12+maria~ubu2004",
+			want:          ServerVersion{Raw: "10.6.12-MariaDB-1:10.6.12+maria~ubu2004", Major: 10, Minor: 6, Patch: 12, MariaDB: true},
+			wantMultiLock: true,
+		},
+		{
+			name:          "MariaDB 5.5",
+			raw:           "5.5.68-MariaDB",
+			want:          ServerVersion{Raw: "5.5.68-MariaDB", Major: 5, Minor: 5, Patch: 68, MariaDB: true},
+			wantMultiLock: false,
+		},
+		{
+			name:    "garbage",
+			raw:     "unknown",
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric component",
+			raw:     "8.x.1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServerVersion(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseServerVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseServerVersion() = %+v, want %+v", got, tt.want)
+			}
+			if got.SupportsMultipleLocks() != tt.wantMultiLock {
+				t.Errorf("SupportsMultipleLocks() = %v, want %v", got.SupportsMultipleLocks(), tt.wantMultiLock)
+			}
+			if wantFlavor := map[bool]string{true: "MariaDB", false: "MySQL"}[tt.want.MariaDB]; got.Flavor() != wantFlavor {
+				t.Errorf("Flavor() = %q, want %q", got.Flavor(), wantFlavor)
+			}
+		})
+	}
+}
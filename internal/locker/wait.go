@@ -0,0 +1,43 @@
+package locker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+)
+
+// waitPollInterval is how often WaitFree checks whether the lock is free
+const waitPollInterval = 500 * time.Millisecond
+
+// WaitFree blocks until no session holds the lock, without acquiring it.
+// It reports false if the lock is still held after timeout seconds; with a
+// timeout of 0 it checks only once.
+func (l *Locker) WaitFree(ctx context.Context, lockName string, timeout int) (bool, error) {
+	if err := l.checkName(lockName); err != nil {
+		return false, err
+	}
+
+	clk := clock.OrReal(l.clock)
+	timer := clk.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+	ticker := clk.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		free, err := l.queryInt(ctx, "SELECT IS_FREE_LOCK(?)", lockName)
+		if err != nil {
+			return false, fmt.Errorf("failed to check lock: %w", err)
+		}
+		if free.Valid && free.Int64 == 1 {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-timer.C():
+			return false, nil
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// minSecretLength keeps very short secrets from redacting unrelated text
+const minSecretLength = 4
+
+var (
+	mu      sync.Mutex
+	output  io.Writer
+	secrets []string
+	debug   bool
+	color   bool
+
+	// Matches the credentials part of a go-sql-driver DSN: user:password@tcp(...)
+	dsnPattern = regexp.MustCompile(`([^\s:/@]+):\S*@(tcp|unix)\(`)
+)
+
+// SetOutput changes where messages are written. A nil writer means os.Stderr.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+// SetDebug turns debug messages on or off
+func SetDebug(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	debug = enabled
+}
+
+// DebugEnabled reports whether debug messages are written
+func DebugEnabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return debug
+}
+
+// Color is an ANSI color for diagnostics on a terminal
+type Color string
+
+const (
+	Green  Color = "32"
+	Yellow Color = "33"
+	Red    Color = "31"
+)
+
+// SetColor turns colored output on or off
+func SetColor(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	color = enabled
+}
+
+// ColorEnabled reports whether colored output is on
+func ColorEnabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return color
+}
+
+// ColorAllowed applies the NO_COLOR convention (https://no-color.org): any
+// non-empty NO_COLOR disables color, as does an output that is not a terminal
+func ColorAllowed(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Colorize wraps s in c when color is on, keeping a trailing newline outside
+// the escape sequence
+func Colorize(c Color, s string) string {
+	if !ColorEnabled() {
+		return s
+	}
+	return colorize(c, s)
+}
+
+func colorize(c Color, s string) string {
+	body := strings.TrimSuffix(s, "\n")
+	return "\033[" + string(c) + "m" + body + "\033[0m" + s[len(body):]
+}
+
+// AddSecret registers a value that must never appear in mylock's output
+func AddSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = append(secrets, secret)
+}
+
+// Redact scrubs registered secrets and DSN passwords from s
+func Redact(s string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	return redact(s)
+}
+
+func redact(s string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return dsnPattern.ReplaceAllString(s, "$1:***@$2(")
+}
+
+// Printf writes a redacted diagnostic message.
+// The command's own output never goes through here.
+func Printf(format string, args ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	w := output
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprint(w, redact(fmt.Sprintf(format, args...)))
+}
+
+// Printc is like Printf, but colors the message with c when color is on
+func Printc(c Color, format string, args ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	w := output
+	if w == nil {
+		w = os.Stderr
+	}
+	msg := redact(fmt.Sprintf(format, args...))
+	if color {
+		msg = colorize(c, msg)
+	}
+	fmt.Fprint(w, msg)
+}
+
+// Debugf writes a redacted "[debug]" line when debug mode is on
+func Debugf(format string, args ...any) {
+	if !DebugEnabled() {
+		return
+	}
+	Printf("[debug] "+format+"\n", args...)
+}
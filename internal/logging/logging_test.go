@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	secrets = nil
+	defer func() { secrets = nil }()
+	AddSecret("s3cr3t-pass")
+	AddSecret("abc") // too short to be redacted
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "registered secret",
+			input: "access denied with password s3cr3t-pass",
+			want:  "access denied with password ***",
+		},
+		{
+			name:  "DSN with password",
+			input: "invalid DSN: user:p@ss:word@tcp(localhost:3306)/db",
+			want:  "invalid DSN: user:***@tcp(localhost:3306)/db",
+		},
+		{
+			name:  "unix socket DSN",
+			input: "root:hunter2@unix(/var/run/mysqld.sock)/db",
+			want:  "root:***@unix(/var/run/mysqld.sock)/db",
+		},
+		{
+			name:  "DSN without password",
+			input: "user@tcp(localhost:3306)/db",
+			want:  "user@tcp(localhost:3306)/db",
+		},
+		{
+			name:  "short secret is not redacted",
+			input: "abcdef",
+			want:  "abcdef",
+		},
+		{
+			name:  "nothing to redact",
+			input: "Failed to acquire lock 'test' within 5 seconds",
+			want:  "Failed to acquire lock 'test' within 5 seconds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.input); got != tt.want {
+				t.Errorf("Redact() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	secrets = nil
+	defer func() { secrets = nil }()
+	AddSecret("topsecret")
+
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(nil)
+
+	Printf("Error: %v\n", "connect as user:topsecret@tcp(db:3306)/jobs failed")
+
+	want := "Error: connect as user:***@tcp(db:3306)/jobs failed\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Printf() wrote %q, want %q", got, want)
+	}
+}
+
+func TestDebugf(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(nil)
+	defer SetDebug(false)
+
+	SetDebug(false)
+	Debugf("hidden %d", 1)
+	if buf.Len() != 0 {
+		t.Errorf("Debugf() wrote %q with debug disabled", buf.String())
+	}
+
+	SetDebug(true)
+	Debugf("shown %d", 2)
+	if got, want := buf.String(), "[debug] shown 2\n"; got != want {
+		t.Errorf("Debugf() wrote %q, want %q", got, want)
+	}
+}
+
+func TestPrintc(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(nil)
+	defer SetColor(false)
+
+	SetColor(false)
+	Printc(Red, "Error: %s\n", "plain")
+	if got, want := buf.String(), "Error: plain\n"; got != want {
+		t.Errorf("Printc() without color = %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	SetColor(true)
+	Printc(Red, "Error: %s\n", "colored")
+	if got, want := buf.String(), "\033[31mError: colored\033[0m\n"; got != want {
+		t.Errorf("Printc() with color = %q, want %q", got, want)
+	}
+
+	if got, want := Colorize(Green, "done"), "\033[32mdone\033[0m"; got != want {
+		t.Errorf("Colorize() = %q, want %q", got, want)
+	}
+}
+
+func TestColorAllowed_NoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	if ColorAllowed(os.Stderr) {
+		t.Error("ColorAllowed() = true with NO_COLOR set, want false")
+	}
+}
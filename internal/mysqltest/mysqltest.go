@@ -0,0 +1,132 @@
+// Package mysqltest starts a throwaway MySQL or MariaDB server in Docker, so
+// the integration tests can run without a server set up by hand
+package mysqltest
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// User, Password and Database are the account and schema the server is
+	// created with
+	User     = "testuser"
+	Password = "testpass"
+	Database = "testdb"
+
+	rootPassword = "rootpass"
+	// readyTimeout bounds the server's first start, which initializes its data
+	readyTimeout = 3 * time.Minute
+)
+
+// Image is the -mysql-image test flag. When it is empty the tests use the
+// server their environment variables point at, as before.
+var Image = flag.String("mysql-image", "", "Docker image to start for the integration tests, e.g. mysql:8.4 or mariadb:11.4")
+
+// Server is a running server container
+type Server struct {
+	ID   string
+	Host string
+	Port int
+}
+
+// Start runs image with a published port and waits until it accepts
+// connections as User
+func Start(image string) (*Server, error) {
+	out, err := exec.Command("docker", "run", "--detach", "--rm",
+		"--env", "MYSQL_ROOT_PASSWORD="+rootPassword,
+		"--env", "MYSQL_DATABASE="+Database,
+		"--env", "MYSQL_USER="+User,
+		"--env", "MYSQL_PASSWORD="+Password,
+		"--publish", "127.0.0.1::3306",
+		image).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", image, commandError(err))
+	}
+	s := &Server{ID: strings.TrimSpace(string(out))}
+
+	out, err = exec.Command("docker", "port", s.ID, "3306/tcp").Output()
+	if err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("failed to find the port of %s: %w", image, commandError(err))
+	}
+	// Only the first line; Docker may list an IPv6 binding as well
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("unexpected port mapping %q: %w", addr, err)
+	}
+	s.Host = host
+	if s.Port, err = strconv.Atoi(portStr); err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("unexpected port mapping %q: %w", addr, err)
+	}
+
+	if err := s.waitReady(); err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("%s did not become ready: %w", image, err)
+	}
+	return s, nil
+}
+
+// DSN connects to the server as User
+func (s *Server) DSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = User
+	cfg.Passwd = Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	cfg.DBName = Database
+	return cfg.FormatDSN()
+}
+
+// Stop removes the container
+func (s *Server) Stop() error {
+	if err := exec.Command("docker", "rm", "--force", s.ID).Run(); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", s.ID, commandError(err))
+	}
+	return nil
+}
+
+// waitReady pings the server until it answers. The images start a
+// temporary server without networking while they initialize, so a
+// successful TCP ping means the real server is up.
+func (s *Server) waitReady() error {
+	db, err := sql.Open("mysql", s.DSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// commandError adds the stderr of a failed docker command to err
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+// mailTimeout bounds sending one mail, from dialing to QUIT, so an SMTP
+// server that stops answering cannot hold up the run
+var mailTimeout = 30 * time.Second
+
+// sendMail is replaced in tests
+var sendMail = sendMailTimeout
+
+// Mailer sends failure notifications through an SMTP server
+type Mailer struct {
+	Server config.SMTP
+	From   string
+	To     []string
+}
+
+// SendFailure mails a short report of f. The server's STARTTLS is used when
+// it offers it; logging in is only attempted over TLS or to localhost.
+func (m Mailer) SendFailure(f Failure) error {
+	var auth smtp.Auth
+	if m.Server.User != "" {
+		auth = smtp.PlainAuth("", m.Server.User, m.Server.Password, m.Server.Host)
+	}
+	addr := net.JoinHostPort(m.Server.Host, strconv.Itoa(m.Server.Port))
+	if err := sendMail(addr, auth, m.From, m.To, m.failureMessage(f, time.Now())); err != nil {
+		return fmt.Errorf("failed to send failure mail: %w", err)
+	}
+	return nil
+}
+
+// failureMessage builds the RFC 5322 message for f
+func (m Mailer) failureMessage(f Failure, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(f.Summary()))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+
+	fmt.Fprintf(&b, "Lock:      %s\r\n", f.LockName)
+	fmt.Fprintf(&b, "Host:      %s\r\n", f.Host)
+	fmt.Fprintf(&b, "Command:   %s\r\n", f.commandLine())
+	fmt.Fprintf(&b, "Exit code: %d\r\n", f.ExitCode)
+	if f.OutputTail != "" {
+		b.WriteString("\r\nLast output:\r\n\r\n")
+		tail := strings.ReplaceAll(f.OutputTail, "\r\n", "\n")
+		b.WriteString(strings.ReplaceAll(strings.TrimRight(tail, "\n"), "\n", "\r\n"))
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
+
+// headerValue keeps a header on one line
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// sendMailTimeout is smtp.SendMail with the whole exchange bounded by
+// mailTimeout
+func sendMailTimeout(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	for _, line := range append([]string{from}, to...) {
+		if strings.ContainsAny(line, "\r\n") {
+			return errors.New("smtp: a line must not contain CR or LF")
+		}
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, mailTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(mailTimeout)); err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
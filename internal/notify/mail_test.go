@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/config"
+)
+
+func TestMailer_SendFailure(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotAuth smtp.Auth
+	var gotMsg []byte
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotAuth, gotFrom, gotTo, gotMsg = addr, a, from, to, msg
+		return nil
+	}
+	defer func() { sendMail = sendMailTimeout }()
+
+	m := Mailer{
+		Server: config.SMTP{Host: "mail.example.com", Port: 587, User: "cron", Password: "secret"},
+		From:   "mylock@web1",
+		To:     []string{"ops@example.com", "dev@example.com"},
+	}
+	err := m.SendFailure(Failure{
+		LockName:   "nightly",
+		Command:    []string{"backup.sh", "--full"},
+		ExitCode:   3,
+		Host:       "web1",
+		OutputTail: "copying\ndisk full\n",
+	})
+	if err != nil {
+		t.Fatalf("SendFailure() error = %v", err)
+	}
+
+	if gotAddr != "mail.example.com:587" || gotFrom != "mylock@web1" || gotAuth == nil {
+		t.Errorf("SendMail(%q, %v, %q, ...), want mail.example.com:587 with auth from mylock@web1", gotAddr, gotAuth, gotFrom)
+	}
+	if !reflect.DeepEqual(gotTo, m.To) {
+		t.Errorf("recipients = %v, want %v", gotTo, m.To)
+	}
+	msg := string(gotMsg)
+	for _, want := range []string{
+		"To: ops@example.com, dev@example.com\r\n",
+		"Subject: mylock: nightly failed with exit code 3 on web1\r\n",
+		"Command:   backup.sh --full\r\n",
+		"Exit code: 3\r\n",
+		"copying\r\ndisk full\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestMailer_SendFailureError(t *testing.T) {
+	sendMail = func(string, smtp.Auth, string, []string, []byte) error {
+		return errors.New("connection refused")
+	}
+	defer func() { sendMail = sendMailTimeout }()
+
+	m := Mailer{Server: config.SMTP{Host: "mail.example.com", Port: 25}, From: "a@b", To: []string{"c@d"}}
+	if err := m.SendFailure(Failure{LockName: "nightly"}); err == nil {
+		t.Error("SendFailure() should return the SMTP error")
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	msg := Mailer{From: "a@b", To: []string{"c@d"}}.failureMessage(Failure{LockName: "x\r\nBcc: evil@example.com"}, time.Unix(0, 0))
+	headers, _, _ := strings.Cut(string(msg), "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") {
+		t.Errorf("a newline in the subject started a new header:\n%s", msg)
+	}
+}
+
+func TestSendMailTimeout(t *testing.T) {
+	// A server that accepts the connection but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	defer func(orig time.Duration) { mailTimeout = orig }(mailTimeout)
+	mailTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = sendMailTimeout(ln.Addr().String(), nil, "mylock@web1", []string{"ops@example.com"}, []byte("Subject: x\r\n\r\n"))
+	if err == nil {
+		t.Fatal("sendMailTimeout() to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sendMailTimeout() gave up after %s, want about %s", elapsed, mailTimeout)
+	}
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Lock lifecycle events
+const (
+	EventAcquired = "acquired"
+	EventReleased = "released"
+	EventFailed   = "failed"
+)
+
+// natsDefaultPort is the NATS client port used when the URL has none
+const natsDefaultPort = "4222"
+
+// natsTimeout bounds publishing one event, from dialing to the server's PONG
+const natsTimeout = 5 * time.Second
+
+// Event is one step in the life of a locked run
+type Event struct {
+	Event    string    `json:"event"`
+	LockName string    `json:"lock_name"`
+	Host     string    `json:"host"`
+	Time     time.Time `json:"time"`
+	// ExitCode is mylock's exit code, set on released and failed events
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Reason says why a run failed, e.g. "timeout", "command" or "lock lost"
+	Reason      string  `json:"reason,omitempty"`
+	WaitSeconds float64 `json:"wait_seconds"`
+	RunSeconds  float64 `json:"run_seconds,omitempty"`
+}
+
+// NATS publishes events to a NATS server over its text protocol, on the
+// subject "<subject>.<event>". Each event uses its own short connection,
+// so a long job never keeps an idle one open.
+type NATS struct {
+	URL     *url.URL
+	Subject string
+}
+
+// Publish sends the event and waits for the server to have processed it
+func (n NATS) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := n.publish(ctx, n.Subject+"."+e.Event, payload); err != nil {
+		return fmt.Errorf("failed to publish %s event to NATS: %w", e.Event, err)
+	}
+	return nil
+}
+
+func (n NATS) publish(ctx context.Context, subject string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+
+	port := n.URL.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(n.URL.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	r := bufio.NewReader(conn)
+
+	info, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(info, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(info))
+	}
+	var serverInfo struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(info), "INFO ")), &serverInfo); err == nil && serverInfo.TLSRequired {
+		return fmt.Errorf("the server requires TLS, which is not supported")
+	}
+
+	connect, err := json.Marshal(n.connectOptions())
+	if err != nil {
+		return err
+	}
+	// PING makes the server answer with PONG once everything before it is
+	// processed, or with -ERR if the connection or the publish was refused
+	msg := fmt.Sprintf("CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", connect, subject, len(payload), payload)
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK, PING and INFO updates need no answer before our PONG
+	}
+}
+
+// connectOptions are the CONNECT fields, with the credentials from the URL
+func (n NATS) connectOptions() map[string]any {
+	opts := map[string]any{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "mylock",
+		"lang":     "go",
+		"protocol": 0,
+	}
+	if user := n.URL.User; user != nil {
+		if password, ok := user.Password(); ok {
+			opts["user"] = user.Username()
+			opts["pass"] = password
+		} else {
+			opts["auth_token"] = user.Username()
+		}
+	}
+	return opts
+}
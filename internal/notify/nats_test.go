@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNATS accepts one connection, records what the client sends and
+// answers PING with reply
+func fakeNATS(t *testing.T, info, reply string) (addr string, received chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received = make(chan []string, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO " + info + "\r\n"))
+		r := bufio.NewReader(conn)
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			if strings.HasPrefix(line, "PUB ") {
+				fields := strings.Fields(line)
+				size, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, size+2)
+				if _, err := r.Read(payload); err != nil {
+					break
+				}
+				lines = append(lines, string(payload[:size]))
+			}
+			if line == "PING" {
+				conn.Write([]byte(reply + "\r\n"))
+				break
+			}
+		}
+		received <- lines
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestNATS_Publish(t *testing.T) {
+	addr, received := fakeNATS(t, `{"server_id":"test"}`, "PONG")
+	u, _ := url.Parse("nats://user:secret@" + addr)
+	n := NATS{URL: u, Subject: "mylock.events"}
+
+	code := 0
+	event := Event{Event: EventReleased, LockName: "nightly", Host: "web1", Time: time.Unix(0, 0).UTC(), ExitCode: &code, WaitSeconds: 1.5}
+	if err := n.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	lines := <-received
+	if len(lines) != 4 {
+		t.Fatalf("client sent %q, want CONNECT, PUB, payload and PING", lines)
+	}
+	var connect map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[0], "CONNECT ")), &connect); err != nil {
+		t.Fatalf("CONNECT is not JSON: %q", lines[0])
+	}
+	if connect["user"] != "user" || connect["pass"] != "secret" || connect["verbose"] != false {
+		t.Errorf("CONNECT options = %v", connect)
+	}
+	if !strings.HasPrefix(lines[1], "PUB mylock.events.released ") {
+		t.Errorf("PUB line = %q, want subject mylock.events.released", lines[1])
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(lines[2]), &got); err != nil {
+		t.Fatalf("payload is not JSON: %q", lines[2])
+	}
+	if got.Event != EventReleased || got.LockName != "nightly" || got.ExitCode == nil || *got.ExitCode != 0 {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestNATS_PublishErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		info  string
+		reply string
+	}{
+		{name: "authorization violation", info: `{}`, reply: "-ERR 'Authorization Violation'"},
+		{name: "TLS required", info: `{"tls_required":true}`, reply: "PONG"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := fakeNATS(t, tt.info, tt.reply)
+			u, _ := url.Parse("nats://token@" + addr)
+			n := NATS{URL: u, Subject: "mylock.events"}
+			if err := n.Publish(context.Background(), Event{Event: EventAcquired}); err == nil {
+				t.Error("Publish() should fail")
+			}
+		})
+	}
+}
+
+func TestNATS_ConnectOptionsToken(t *testing.T) {
+	u, _ := url.Parse("nats://s3cr3t@nats.example.com")
+	opts := NATS{URL: u}.connectOptions()
+	if opts["auth_token"] != "s3cr3t" || opts["user"] != nil {
+		t.Errorf("connectOptions() = %v, want a token", opts)
+	}
+}
@@ -0,0 +1,29 @@
+// Package notify tells people and services outside the host that a locked
+// run failed
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Failure describes a locked run whose command exited non-zero
+type Failure struct {
+	LockName string
+	Command  []string
+	ExitCode int
+	// Host is the machine mylock ran on
+	Host string
+	// OutputTail is the end of the command's combined output
+	OutputTail string
+}
+
+// commandLine joins the command for display; it is not meant to be re-run
+func (f Failure) commandLine() string {
+	return strings.Join(f.Command, " ")
+}
+
+// Summary is a one-line description of the failure
+func (f Failure) Summary() string {
+	return fmt.Sprintf("mylock: %s failed with exit code %d on %s", f.LockName, f.ExitCode, f.Host)
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyTimeout bounds each call, so an unreachable API cannot hold up
+// mylock's exit
+const pagerDutyTimeout = 10 * time.Second
+
+// PagerDuty triggers and resolves incidents through the Events API v2. All
+// events for a lock share one dedup key, so repeated failures update a
+// single incident and the next success can resolve it.
+type PagerDuty struct {
+	RoutingKey string
+	// URL overrides the Events API endpoint, for tests
+	URL string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Component     string         `json:"component"`
+	CustomDetails map[string]any `json:"custom_details,omitempty"`
+}
+
+// DedupKey is the PagerDuty dedup key of a lock
+func DedupKey(lockName string) string {
+	return "mylock:" + lockName
+}
+
+// TriggerFailure opens or updates the lock's incident for a failed command
+func (p PagerDuty) TriggerFailure(ctx context.Context, f Failure) error {
+	return p.trigger(ctx, f.LockName, f.Host, f.Summary(), map[string]any{
+		"command":     f.commandLine(),
+		"exit_code":   f.ExitCode,
+		"output_tail": f.OutputTail,
+	})
+}
+
+// TriggerTimeout opens or updates the lock's incident for a lock that was
+// not acquired within timeout seconds
+func (p PagerDuty) TriggerTimeout(ctx context.Context, lockName, host string, timeout int) error {
+	summary := fmt.Sprintf("mylock: lock %s not acquired within %d seconds on %s", lockName, timeout, host)
+	return p.trigger(ctx, lockName, host, summary, map[string]any{"timeout_seconds": timeout})
+}
+
+func (p PagerDuty) trigger(ctx context.Context, lockName, host, summary string, details map[string]any) error {
+	return p.send(ctx, pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    DedupKey(lockName),
+		Payload: &pagerDutyPayload{
+			Summary:       summary,
+			Source:        host,
+			Severity:      "error",
+			Component:     lockName,
+			CustomDetails: details,
+		},
+	})
+}
+
+// Resolve closes the lock's incident, if there is one
+func (p PagerDuty) Resolve(ctx context.Context, lockName string) error {
+	return p.send(ctx, pagerDutyEvent{
+		RoutingKey:  p.RoutingKey,
+		EventAction: "resolve",
+		DedupKey:    DedupKey(lockName),
+	})
+}
+
+func (p PagerDuty) send(ctx context.Context, event pagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	url := p.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pagerDutyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send PagerDuty %s event: %w", event.EventAction, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PagerDuty %s event rejected: %s: %s", event.EventAction, resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
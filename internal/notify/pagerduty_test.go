@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPagerDuty(t *testing.T) {
+	var events []pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("request body is not an event: %v", err)
+		}
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	pd := PagerDuty{RoutingKey: "R0UT1NG", URL: server.URL}
+	ctx := context.Background()
+	if err := pd.TriggerFailure(ctx, Failure{LockName: "nightly", Command: []string{"backup.sh"}, ExitCode: 2, Host: "web1"}); err != nil {
+		t.Fatalf("TriggerFailure() error = %v", err)
+	}
+	if err := pd.TriggerTimeout(ctx, "nightly", "web1", 60); err != nil {
+		t.Fatalf("TriggerTimeout() error = %v", err)
+	}
+	if err := pd.Resolve(ctx, "nightly"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	for i, want := range []string{"trigger", "trigger", "resolve"} {
+		if events[i].EventAction != want || events[i].DedupKey != "mylock:nightly" || events[i].RoutingKey != "R0UT1NG" {
+			t.Errorf("event %d = %+v, want %s for mylock:nightly", i, events[i], want)
+		}
+	}
+	failure := events[0].Payload
+	if failure == nil || failure.Summary != "mylock: nightly failed with exit code 2 on web1" || failure.Source != "web1" {
+		t.Errorf("failure payload = %+v", failure)
+	}
+	if events[2].Payload != nil {
+		t.Errorf("resolve payload = %+v, want none", events[2].Payload)
+	}
+}
+
+func TestPagerDuty_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status":"invalid event"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pd := PagerDuty{RoutingKey: "bad", URL: server.URL}
+	if err := pd.Resolve(context.Background(), "nightly"); err == nil {
+		t.Error("Resolve() should fail when PagerDuty rejects the event")
+	}
+}
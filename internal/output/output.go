@@ -0,0 +1,141 @@
+// Package output re-frames the command's output streams line by line, so
+// mylock can label or merge them without splitting lines
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ansiPattern matches terminal escape sequences: CSI sequences such as
+// colors and cursor movement, OSC sequences such as titles and hyperlinks,
+// and the other escapes, such as saving the cursor or selecting a charset
+var ansiPattern = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[ -/]*[0-~])`)
+
+// maxLine is the longest partial line kept before it is written out anyway
+const maxLine = 64 * 1024
+
+// FormatFunc renders one line of a stream, without its newline, as the bytes
+// to write
+type FormatFunc func(stream string, line []byte) []byte
+
+// Sink writes whole lines from one or more streams to a single writer.
+// Lines are written under a lock, so lines of different streams never
+// interleave mid-line.
+type Sink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format FormatFunc
+}
+
+func NewSink(w io.Writer, format FormatFunc) *Sink {
+	return &Sink{w: w, format: format}
+}
+
+// Stream returns a writer for one named stream of the sink. Its last line
+// is only written once it ends or on Flush.
+func (s *Sink) Stream(name string) *LineWriter {
+	return &LineWriter{sink: s, name: name}
+}
+
+func (s *Sink) emit(stream string, line []byte) error {
+	out := s.format(stream, line)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(out)
+	return err
+}
+
+// LineWriter splits what is written to it into lines for its Sink
+type LineWriter struct {
+	sink *Sink
+	name string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (l *LineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := l.buf[:i]
+		l.buf = l.buf[i+1:]
+		if err := l.sink.emit(l.name, bytes.TrimSuffix(line, []byte("\r"))); err != nil {
+			return len(p), err
+		}
+	}
+	if len(l.buf) >= maxLine {
+		line := l.buf
+		l.buf = nil
+		if err := l.sink.emit(l.name, line); err != nil {
+			return len(p), err
+		}
+	}
+	// Keep the partial line in a buffer of its own
+	l.buf = append([]byte(nil), l.buf...)
+	return len(p), nil
+}
+
+// Flush writes out a last line that did not end with a newline
+func (l *LineWriter) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) == 0 {
+		return nil
+	}
+	line := l.buf
+	l.buf = nil
+	return l.sink.emit(l.name, line)
+}
+
+// Plain writes each line as is, ended with a newline
+func Plain(stream string, line []byte) []byte {
+	return append(append(make([]byte, 0, len(line)+1), line...), '\n')
+}
+
+// StripANSI wraps format so that terminal escape sequences are removed from
+// each line before it is formatted
+func StripANSI(format FormatFunc) FormatFunc {
+	return func(stream string, line []byte) []byte {
+		return format(stream, ansiPattern.ReplaceAll(line, nil))
+	}
+}
+
+// jsonLine is one line of --output-format json
+type jsonLine struct {
+	Time     string `json:"time"`
+	Stream   string `json:"stream"`
+	LockName string `json:"lock_name"`
+	RunID    string `json:"run_id"`
+	Line     string `json:"line"`
+}
+
+// JSON formats each line as a JSON object with its stream, an RFC 3339
+// timestamp, the lock name and the run id, for log shippers to ingest
+func JSON(lockName, runID string) FormatFunc {
+	return func(stream string, line []byte) []byte {
+		data, err := json.Marshal(jsonLine{
+			Time:     time.Now().UTC().Format(time.RFC3339Nano),
+			Stream:   stream,
+			LockName: lockName,
+			RunID:    runID,
+			Line:     string(line),
+		})
+		if err != nil {
+			// A string always marshals; keep the line rather than drop it
+			return append(append([]byte(nil), line...), '\n')
+		}
+		return append(data, '\n')
+	}
+}
@@ -0,0 +1,99 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewSink(&out, func(stream string, line []byte) []byte {
+		return []byte(stream + ": " + string(line) + "\n")
+	})
+	stdout := sink.Stream("out")
+	stderr := sink.Stream("err")
+
+	stdout.Write([]byte("hel"))
+	stderr.Write([]byte("warn\r\n"))
+	stdout.Write([]byte("lo\nwor"))
+	stdout.Write([]byte("ld\nlast"))
+	if err := stdout.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if err := stderr.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	want := "err: warn\nout: hello\nout: world\nout: last\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestLineWriter_LongLine(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewSink(&out, func(stream string, line []byte) []byte {
+		return append(append([]byte(nil), line...), '\n')
+	})
+	w := sink.Stream("out")
+	w.Write(bytes.Repeat([]byte("x"), maxLine+10))
+
+	if got := strings.Count(out.String(), "\n"); got != 1 {
+		t.Errorf("a line over %d bytes should be written out without waiting for its end, got %d lines", maxLine, got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewSink(&out, JSON("nightly", "abc123"))
+	w := sink.Stream("stderr")
+	w.Write([]byte("disk \"full\"\n"))
+
+	var got jsonLine
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v: %q", err, out.String())
+	}
+	if got.Stream != "stderr" || got.LockName != "nightly" || got.RunID != "abc123" || got.Line != `disk "full"` {
+		t.Errorf("JSON line = %+v", got)
+	}
+	if got.Time == "" {
+		t.Error("JSON line has no time")
+	}
+}
+
+func TestPlain(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewSink(&out, Plain)
+	stdout, stderr := sink.Stream("stdout"), sink.Stream("stderr")
+	stdout.Write([]byte("progress 1"))
+	stderr.Write([]byte("warning\n"))
+	stdout.Write([]byte("0%\n"))
+
+	if got, want := out.String(), "warning\nprogress 10%\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"plain", "plain"},
+		{"\x1b[1;31merror\x1b[0m: failed", "error: failed"},
+		{"\x1b[2K\x1b[1Gdone", "done"},
+		{"\x1b]0;title\x07text", "text"},
+		{"\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"\x1b7saved\x1b8", "saved"},
+		{"\x1b(Bcharset", "charset"},
+	}
+
+	format := StripANSI(Plain)
+	for _, tt := range tests {
+		if got := string(format("stdout", []byte(tt.line))); got != tt.want+"\n" {
+			t.Errorf("StripANSI(%q) = %q, want %q", tt.line, got, tt.want+"\n")
+		}
+	}
+}
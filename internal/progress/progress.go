@@ -0,0 +1,133 @@
+// Package progress reports on a lock acquisition that is still waiting, and
+// on a command that is still running under the lock
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+const (
+	// DefaultInterval is how often a waiting acquisition is reported
+	DefaultInterval = 15 * time.Second
+	// spinnerInterval is how often the spinner is redrawn on a terminal
+	spinnerInterval = 100 * time.Millisecond
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// clk times the reports; it is replaced in tests
+var clk clock.Clock = clock.Real
+
+// Reporter shows how long mylock has been waiting for a lock, either as a
+// periodic log line or as a spinner on a terminal
+type Reporter struct {
+	lockName string
+	timeout  int
+	interval time.Duration
+	// spinner is the terminal the spinner is drawn on, or nil for log lines
+	spinner io.Writer
+	// heartbeat reports a running command instead of a wait
+	heartbeat bool
+	start     time.Time
+	waited    time.Duration
+	done      chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// Start begins reporting the wait for lockName every interval until Stop is
+// called. Nothing is printed if the lock is acquired within the first interval.
+func Start(lockName string, timeout int, interval time.Duration) *Reporter {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return start(&Reporter{lockName: lockName, timeout: timeout, interval: interval})
+}
+
+// StartSpinner draws a spinner with the elapsed wait on w, which should be
+// a terminal, until Stop or Acquired is called
+func StartSpinner(w io.Writer, lockName string, timeout int) *Reporter {
+	return start(&Reporter{lockName: lockName, timeout: timeout, interval: spinnerInterval, spinner: w})
+}
+
+// StartHeartbeat logs that the command is still running under lockName
+// every interval until Stop is called, so log-based monitoring can tell a
+// long job from a dead one
+func StartHeartbeat(lockName string, interval time.Duration) *Reporter {
+	return start(&Reporter{lockName: lockName, interval: interval, heartbeat: true})
+}
+
+func start(r *Reporter) *Reporter {
+	r.start = clk.Now()
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+func (r *Reporter) run() {
+	defer r.wg.Done()
+	ticker := clk.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C():
+		}
+
+		elapsed := clk.Now().Sub(r.start)
+		if r.heartbeat {
+			logging.Printf("Still running under lock '%s' (%s elapsed)\n", r.lockName, elapsed.Round(time.Second))
+			continue
+		}
+		if r.spinner != nil {
+			fmt.Fprintf(r.spinner, "\r%s Waiting for lock '%s' (%.1fs elapsed, timeout %ds)", spinnerFrames[frame%len(spinnerFrames)], r.lockName, elapsed.Seconds(), r.timeout)
+			continue
+		}
+		logging.Printf("Waiting for lock '%s' (%s elapsed, timeout %ds)\n", r.lockName, elapsed.Round(time.Second), r.timeout)
+	}
+}
+
+// Stop ends reporting, clears the spinner line and returns how long the
+// wait took. It is safe to call more than once; later calls return the
+// same duration.
+func (r *Reporter) Stop() time.Duration {
+	r.stopOnce.Do(func() {
+		r.waited = clk.Now().Sub(r.start)
+		close(r.done)
+		r.wg.Wait()
+		if r.spinner != nil {
+			fmt.Fprint(r.spinner, "\r\033[K")
+		}
+	})
+	return r.waited
+}
+
+// Acquired stops reporting and, for a spinner, replaces it with a final
+// line saying how long the wait took. Log lines stay quiet, so cron output
+// only changes when the wait was long.
+func (r *Reporter) Acquired() time.Duration {
+	waited := r.Stop()
+	if r.spinner != nil {
+		fmt.Fprint(r.spinner, logging.Colorize(logging.Green, fmt.Sprintf("Acquired lock '%s' after %.1fs\n", r.lockName, waited.Seconds())))
+	}
+	return waited
+}
+
+// IsTerminal reports whether f is a character device such as a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,141 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yammerjp/mylock/internal/clock"
+	"github.com/yammerjp/mylock/internal/logging"
+)
+
+func TestReporter(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+
+	r := Start("report-lock", 60, 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	waited := r.Stop()
+
+	if waited < 35*time.Millisecond {
+		t.Errorf("Stop() = %v, want at least 35ms", waited)
+	}
+	if again := r.Stop(); again != waited {
+		t.Errorf("second Stop() = %v, want %v", again, waited)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "Waiting for lock 'report-lock' (") || !strings.Contains(out, "timeout 60s)") {
+		t.Errorf("output = %q, want a waiting message", out)
+	}
+
+	// Nothing more is printed once stopped
+	before := buf.Len()
+	time.Sleep(30 * time.Millisecond)
+	if buf.Len() != before {
+		t.Errorf("output after Stop() = %q, want nothing", buf.String()[before:])
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+
+	r := StartHeartbeat("beat-lock", 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	r.Stop()
+
+	out := buf.String()
+	if !strings.Contains(out, "Still running under lock 'beat-lock' (") || strings.Contains(out, "Waiting") {
+		t.Errorf("output = %q, want a still running message", out)
+	}
+}
+
+// lockedBuffer lets a test read log output while a reporter writes it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHeartbeat_FakeClock(t *testing.T) {
+	var buf lockedBuffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+	fake := clock.NewFake(time.Now())
+	clk = fake
+	defer func() { clk = clock.Real }()
+
+	r := StartHeartbeat("beat-lock", time.Minute)
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Minute)
+
+	// However many of the two ticks are received, each report reads the advanced clock
+	want := "Still running under lock 'beat-lock' (2m0s elapsed)"
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q, want %q", buf.String(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := r.Stop(); elapsed != 2*time.Minute {
+		t.Errorf("Stop() = %v, want 2m0s", elapsed)
+	}
+}
+
+func TestReporter_QuickAcquisitionIsSilent(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(nil)
+
+	r := Start("quick-lock", 60, time.Hour)
+	r.Stop()
+
+	if buf.Len() != 0 {
+		t.Errorf("output = %q, want nothing", buf.String())
+	}
+}
+
+func TestReporter_Spinner(t *testing.T) {
+	var buf bytes.Buffer
+	r := StartSpinner(&buf, "spin-lock", 60)
+	time.Sleep(250 * time.Millisecond)
+	r.Acquired()
+
+	out := buf.String()
+	if !strings.Contains(out, "\r| Waiting for lock 'spin-lock' (") {
+		t.Errorf("output = %q, want a spinner frame", out)
+	}
+	if !strings.Contains(out, "\r\033[K") {
+		t.Errorf("output = %q, want the spinner line cleared", out)
+	}
+	if !strings.HasSuffix(out, "\n") || !strings.Contains(out, "Acquired lock 'spin-lock' after ") {
+		t.Errorf("output = %q, want a final acquired line", out)
+	}
+}
+
+func TestReporter_SpinnerStopWithoutAcquiring(t *testing.T) {
+	var buf bytes.Buffer
+	r := StartSpinner(&buf, "spin-lock", 1)
+	r.Stop()
+
+	if strings.Contains(buf.String(), "Acquired") {
+		t.Errorf("output = %q, want no acquired line after Stop()", buf.String())
+	}
+}
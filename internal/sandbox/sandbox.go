@@ -0,0 +1,22 @@
+// Package sandbox confines the current process before it executes a
+// command, with no-new-privs and Landlock filesystem rules on Linux
+package sandbox
+
+import "errors"
+
+// ErrUnsupported means the platform or kernel cannot apply the sandbox
+var ErrUnsupported = errors.New("sandboxing is not supported on this system")
+
+// Check reports whether Restrict can apply rules for allowPaths here, so
+// callers can fail before starting any work. Paths must exist.
+func Check(allowPaths []string) error {
+	return check(allowPaths)
+}
+
+// Restrict sets no-new-privs on the calling thread and, when allowPaths is
+// not empty, a Landlock ruleset that denies filesystem access outside those
+// paths. The restrictions are inherited across execve and cannot be undone,
+// so callers lock the OS thread and execute the command right after.
+func Restrict(allowPaths []string) error {
+	return restrict(allowPaths)
+}
@@ -0,0 +1,150 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const prSetNoNewPrivs = 38
+
+const (
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+	oPath                        = 0x200000
+)
+
+// Filesystem access rights, by the Landlock ABI version that added them
+const (
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	// ABI 2
+	accessRefer = 1 << 13
+	// ABI 3
+	accessTruncate = 1 << 14
+	// ABI 5
+	accessIoctlDev = 1 << 15
+)
+
+// fileAccess are the rights that apply to a file rather than a directory
+const fileAccess = accessExecute | accessWriteFile | accessReadFile | accessTruncate | accessIoctlDev
+
+// handledAccess returns every filesystem right the kernel's Landlock ABI
+// knows about, all of which are denied outside the allowed paths
+func handledAccess(abi int) uint64 {
+	access := uint64(accessExecute | accessWriteFile | accessReadFile | accessReadDir |
+		accessRemoveDir | accessRemoveFile | accessMakeChar | accessMakeDir | accessMakeReg |
+		accessMakeSock | accessMakeFifo | accessMakeBlock | accessMakeSym)
+	if abi >= 2 {
+		access |= accessRefer
+	}
+	if abi >= 3 {
+		access |= accessTruncate
+	}
+	if abi >= 5 {
+		access |= accessIoctlDev
+	}
+	return access
+}
+
+// allowedAccess narrows handled to what a rule on a file or directory may grant
+func allowedAccess(handled uint64, dir bool) uint64 {
+	if dir {
+		return handled
+	}
+	return handled & fileAccess
+}
+
+// landlockABI returns the Landlock ABI version of the running kernel, or 0
+// when Landlock is missing or disabled
+func landlockABI() int {
+	v, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0
+	}
+	return int(v)
+}
+
+func check(allowPaths []string) error {
+	if len(allowPaths) == 0 {
+		return nil
+	}
+	if landlockABI() == 0 {
+		return fmt.Errorf("%w: Landlock is not available in this kernel", ErrUnsupported)
+	}
+	for _, path := range allowPaths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cannot allow %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func restrict(allowPaths []string) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("failed to set no-new-privs: %w", errno)
+	}
+	if len(allowPaths) == 0 {
+		return nil
+	}
+
+	abi := landlockABI()
+	if abi == 0 {
+		return fmt.Errorf("%w: Landlock is not available in this kernel", ErrUnsupported)
+	}
+	handled := handledAccess(abi)
+	attr := handled
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create Landlock ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer syscall.Close(ruleset)
+
+	for _, path := range allowPaths {
+		if err := addPathRule(ruleset, path, handled); err != nil {
+			return err
+		}
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("failed to enforce Landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+// addPathRule allows every handled right beneath path
+func addPathRule(ruleset int, path string, handled uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("cannot allow %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("cannot allow %s: %w", path, err)
+	}
+
+	// struct landlock_path_beneath_attr is packed: a u64 followed by an s32
+	var rule [12]byte
+	binary.NativeEndian.PutUint64(rule[:8], allowedAccess(handled, st.Mode&syscall.S_IFMT == syscall.S_IFDIR))
+	binary.NativeEndian.PutUint32(rule[8:], uint32(int32(fd)))
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule[0])), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("cannot allow %s: %w", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestHandledAccess(t *testing.T) {
+	if got := handledAccess(1); got&(accessRefer|accessTruncate|accessIoctlDev) != 0 {
+		t.Errorf("handledAccess(1) = %#x, want no rights added after ABI 1", got)
+	}
+	if got := handledAccess(3); got&accessTruncate == 0 || got&accessIoctlDev != 0 {
+		t.Errorf("handledAccess(3) = %#x, want truncate but not ioctl", got)
+	}
+
+	handled := handledAccess(5)
+	if got := allowedAccess(handled, true); got != handled {
+		t.Errorf("allowedAccess(dir) = %#x, want %#x", got, handled)
+	}
+	if got := allowedAccess(handled, false); got&^uint64(fileAccess) != 0 || got&accessReadFile == 0 {
+		t.Errorf("allowedAccess(file) = %#x, want only file rights", got)
+	}
+}
+
+// TestRestrict runs in a child process, since the rules cannot be lifted
+func TestRestrict(t *testing.T) {
+	if allowed := os.Getenv("SANDBOX_TEST_ALLOWED"); allowed != "" {
+		runtime.LockOSThread()
+		if err := Restrict([]string{allowed}); err != nil {
+			t.Fatalf("Restrict() error = %v", err)
+		}
+		if _, err := os.ReadFile(filepath.Join(allowed, "ok")); err != nil {
+			t.Errorf("reading an allowed file: %v", err)
+		}
+		if _, err := os.ReadFile(os.Getenv("SANDBOX_TEST_DENIED")); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("reading a denied file error = %v, want permission denied", err)
+		}
+		return
+	}
+	if landlockABI() == 0 {
+		t.Skip("Landlock is not available")
+	}
+
+	allowed, denied := t.TempDir(), filepath.Join(t.TempDir(), "secret")
+	for _, path := range []string{filepath.Join(allowed, "ok"), denied} {
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Check([]string{allowed}); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestrict$")
+	cmd.Env = append(os.Environ(), "SANDBOX_TEST_ALLOWED="+allowed, "SANDBOX_TEST_DENIED="+denied)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("sandboxed test process failed: %v\n%s", err, out)
+	}
+}
+
+func TestCheck_MissingPath(t *testing.T) {
+	if landlockABI() == 0 {
+		t.Skip("Landlock is not available")
+	}
+	if err := Check([]string{filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("Check() of a missing path succeeded, want an error")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package sandbox
+
+func check(allowPaths []string) error {
+	return ErrUnsupported
+}
+
+func restrict(allowPaths []string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,10 @@
+//go:build linux && (mips64 || mips64le)
+
+package sandbox
+
+// Landlock system call numbers for the mips n64 ABI, offset by 5000
+const (
+	sysLandlockCreateRuleset = 5444
+	sysLandlockAddRule       = 5445
+	sysLandlockRestrictSelf  = 5446
+)
@@ -0,0 +1,10 @@
+//go:build linux && (mips || mipsle)
+
+package sandbox
+
+// Landlock system call numbers for the mips o32 ABI, offset by 4000
+const (
+	sysLandlockCreateRuleset = 4444
+	sysLandlockAddRule       = 4445
+	sysLandlockRestrictSelf  = 4446
+)
@@ -0,0 +1,82 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 3, 13, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 13, 10, 8, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2024, 3, 13, 10, 10, 0, 0, time.UTC)},
+		{"7 * * * *", time.Date(2024, 3, 13, 11, 7, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 3, 14, 2, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 3, 13, 13, 0, 0, 0, time.UTC)},
+		{"15,45 10 * * *", time.Date(2024, 3, 13, 10, 15, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches
+		{"0 0 20 * mon", time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 13, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next() = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestNext_Location(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	s, _ := Parse("0 * * * *")
+	from := time.Date(2024, 3, 13, 10, 7, 0, 0, loc)
+	if got, want := s.Next(from), time.Date(2024, 3, 13, 11, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v on the hour in +05:30", got, want)
+	}
+}
+
+func TestNext_Never(t *testing.T) {
+	s, err := Parse("0 0 30 feb *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next() = %v, want the zero time for February 30th", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@sometimes",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
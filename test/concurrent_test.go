@@ -2,15 +2,45 @@ package test
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/yammerjp/mylock/internal/mysqltest"
 )
 
+// TestMain starts a server for the tests when -mysql-image is given;
+// otherwise they run against MYLOCK_HOST, or are skipped without it
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if *mysqltest.Image == "" || testing.Short() {
+		os.Exit(m.Run())
+	}
+
+	server, err := mysqltest.Start(*mysqltest.Image)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("MYLOCK_HOST", server.Host)
+	os.Setenv("MYLOCK_PORT", strconv.Itoa(server.Port))
+	os.Setenv("MYLOCK_USER", mysqltest.User)
+	os.Setenv("MYLOCK_PASSWORD", mysqltest.Password)
+	os.Setenv("MYLOCK_DATABASE", mysqltest.Database)
+
+	code := m.Run()
+	if err := server.Stop(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
+
 func TestConcurrentExecution(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping concurrent test in short mode")
@@ -19,7 +49,7 @@ func TestConcurrentExecution(t *testing.T) {
 	// Check if MySQL is available
 	host := os.Getenv("MYLOCK_HOST")
 	if host == "" {
-		t.Skip("Skipping test: MYLOCK_HOST not set")
+		t.Skip("Skipping test: MYLOCK_HOST not set and no -mysql-image given")
 	}
 
 	// Build the binary
@@ -148,7 +178,7 @@ func TestConcurrentRelease(t *testing.T) {
 	// Check if MySQL is available
 	host := os.Getenv("MYLOCK_HOST")
 	if host == "" {
-		t.Skip("Skipping test: MYLOCK_HOST not set")
+		t.Skip("Skipping test: MYLOCK_HOST not set and no -mysql-image given")
 	}
 
 	// Build the binary
@@ -204,7 +234,7 @@ func TestConcurrentSignalHandling(t *testing.T) {
 	// Check if MySQL is available
 	host := os.Getenv("MYLOCK_HOST")
 	if host == "" {
-		t.Skip("Skipping test: MYLOCK_HOST not set")
+		t.Skip("Skipping test: MYLOCK_HOST not set and no -mysql-image given")
 	}
 
 	// Build the binary
@@ -278,7 +308,7 @@ func TestRaceCondition(t *testing.T) {
 	// Check if MySQL is available
 	host := os.Getenv("MYLOCK_HOST")
 	if host == "" {
-		t.Skip("Skipping test: MYLOCK_HOST not set")
+		t.Skip("Skipping test: MYLOCK_HOST not set and no -mysql-image given")
 	}
 
 	// Build the binary